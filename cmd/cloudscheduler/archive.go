@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+// runExport exports the job database to a JSON archive.
+// The cloud scheduler using the database must be stopped.
+func runExport(args []string) error {
+	var dataDir, outPath string
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&dataDir, "data-dir", "data", "Path to meta directory")
+	flags.StringVar(&outPath, "o", "-", "Path to the archive to write. - writes to stdout")
+	flags.Parse(args)
+	archive, err := cloudscheduler.ExportJobDB(dataDir)
+	if err != nil {
+		return err
+	}
+	blob, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	if outPath == "-" {
+		_, err = fmt.Fprintln(os.Stdout, string(blob))
+		return err
+	}
+	if err := ioutil.WriteFile(outPath, blob, 0600); err != nil {
+		return err
+	}
+	logger.Info.Printf("Exported %d jobs of schema version %d to %s", len(archive.Jobs), archive.SchemaVersion, outPath)
+	return nil
+}
+
+// runImport imports a JSON archive to the job database.
+// The cloud scheduler using the database must be stopped.
+func runImport(args []string) error {
+	var dataDir, inPath string
+	var overwrite bool
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.StringVar(&dataDir, "data-dir", "data", "Path to meta directory")
+	flags.StringVar(&inPath, "i", "-", "Path to the archive to read. - reads from stdin")
+	flags.BoolVar(&overwrite, "overwrite", false, "Replace jobs of the same ID already in the job database. Other jobs are kept")
+	flags.Parse(args)
+	var (
+		blob []byte
+		err  error
+	)
+	if inPath == "-" {
+		blob, err = io.ReadAll(os.Stdin)
+	} else {
+		blob, err = ioutil.ReadFile(inPath)
+	}
+	if err != nil {
+		return err
+	}
+	var archive cloudscheduler.JobArchive
+	if err := json.Unmarshal(blob, &archive); err != nil {
+		return fmt.Errorf("Failed to parse archive: %s", err.Error())
+	}
+	if err := cloudscheduler.ImportJobDB(dataDir, &archive, overwrite); err != nil {
+		return err
+	}
+	logger.Info.Printf("Imported %d jobs of schema version %d to %s", len(archive.Jobs), archive.SchemaVersion, dataDir)
+	return nil
+}
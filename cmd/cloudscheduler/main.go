@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/cloudscheduler"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
@@ -20,8 +24,29 @@ func getenv(key string, def string) string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "export":
+			err = runExport(os.Args[2:])
+		case "import":
+			err = runImport(os.Args[2:])
+		default:
+			runScheduler()
+			return
+		}
+		if err != nil {
+			logger.Error.Fatalln(err.Error())
+		}
+		return
+	}
+	runScheduler()
+}
+
+func runScheduler() {
 	var config cloudscheduler.CloudSchedulerConfig
 	var configPath string
+	var exclusiveHardware string
 	config.Version = Version
 	flag.StringVar(&configPath, "config", "", "Path to config file")
 	flag.StringVar(&config.Name, "name", "cloudscheduler-sage", "Name of cloud scheduler")
@@ -34,8 +59,36 @@ func main() {
 	flag.StringVar(&config.RabbitmqURI, "rabbitmq-uri", getenv("RABBITMQ_URI", "rabbitmq:5672"), "RabbitMQ management uri")
 	flag.StringVar(&config.RabbitmqUsername, "rabbitmq-username", getenv("RABBITMQ_USERNAME", "guest"), "RabbitMQ management username")
 	flag.StringVar(&config.RabbitmqPassword, "rabbitmq-password", getenv("RABBITMQ_PASSWORD", "guest"), "RabbitMQ management password")
+	flag.StringVar(&config.RabbitmqCaCertPath, "rabbitmq-cacert", getenv("RABBITMQ_CACERT", ""), "Path to the CA certificate verifying RabbitMQ. TLS is used if given")
+	flag.StringVar(&config.RabbitmqCertPath, "rabbitmq-cert", getenv("RABBITMQ_CERT", ""), "Path to the client certificate for RabbitMQ")
+	flag.StringVar(&config.RabbitmqKeyPath, "rabbitmq-key", getenv("RABBITMQ_KEY", ""), "Path to the client key for RabbitMQ")
+	flag.BoolVar(&config.RabbitmqAuthExternal, "rabbitmq-auth-external", getenv("RABBITMQ_AUTH_EXTERNAL", "") == "true", "Authenticate to RabbitMQ with the client certificate using EXTERNAL instead of the username and password")
+	flag.StringVar(&config.RabbitmqServerName, "rabbitmq-server-name", "", "Server name to verify in the RabbitMQ certificate. The host of the RabbitMQ URI is verified if not given")
+	flag.StringVar(&config.EventBus, "event-bus", "rabbitmq", "Event bus to receive events from nodes: rabbitmq or mqtt")
+	flag.StringVar(&config.MQTTBrokerURI, "mqtt-broker-uri", getenv("MQTT_BROKER_URI", "tcp://localhost:1883"), "MQTT broker uri, for example, tcp://host:1883 or ssl://host:8883")
+	flag.StringVar(&config.MQTTUsername, "mqtt-username", getenv("MQTT_USERNAME", ""), "MQTT username")
+	flag.StringVar(&config.MQTTPassword, "mqtt-password", getenv("MQTT_PASSWORD", ""), "MQTT password")
+	flag.StringVar(&config.MQTTCaCertPath, "mqtt-cacert", getenv("MQTT_CACERT", ""), "Path to the CA certificate verifying the MQTT broker. TLS is used if given")
+	flag.StringVar(&config.MQTTCertPath, "mqtt-cert", getenv("MQTT_CERT", ""), "Path to the client certificate for the MQTT broker")
+	flag.StringVar(&config.MQTTKeyPath, "mqtt-key", getenv("MQTT_KEY", ""), "Path to the client key for the MQTT broker")
+	flag.StringVar(&config.MQTTTopicPrefix, "mqtt-topic-prefix", "waggle", "Prefix of MQTT topics")
+	flag.StringVar(&config.QuotaFilePath, "quota-file", "", "Path to the quota file. No quota is applied if not given")
+	flag.StringVar(&exclusiveHardware, "exclusive-hardware", "", "Comma-separated list of hardware that plugins of different jobs cannot share on a node")
+	flag.IntVar(&config.ExpectedPluginRuntime, "expected-plugin-runtime", 60, "Expected runtime of a plugin in seconds when estimating its duty cycle")
+	flag.BoolVar(&config.RejectOversubscription, "reject-oversubscription", false, "Reject jobs that oversubscribe node devices instead of warning")
 	flag.BoolVar(&config.PushNotification, "push-notification", true, "Enable HTTP push notification for science goals")
+	flag.IntVar(&config.TLSPort, "tls-port", 0, "Port to listen over TLS. TLS is disabled if 0")
+	flag.StringVar(&config.TLSCertPath, "tls-cert", "", "Path to the server certificate for TLS")
+	flag.StringVar(&config.TLSKeyPath, "tls-key", "", "Path to the server key for TLS")
+	flag.StringVar(&config.TLSClientCACertPath, "tls-client-cacert", "", "Path to the CA certificate verifying node certificates")
+	flag.StringVar(&config.NodeIdentityFilePath, "node-identity-file", "", "Path to the file mapping node certificate names to VSNs. Certificate names are VSNs if not given")
+	flag.BoolVar(&config.GoalsOverTLSOnly, "goals-over-tls-only", false, "Serve goals only over TLS to nodes with a certificate. Requires -tls-port")
+	flag.StringVar(&config.GoalSigningKeyPath, "goal-signing-key", "", "Path to the ed25519 private key signing goals for nodes. Goals are not signed if not given")
+	flag.StringVar(&config.AdminToken, "admin-token", getenv("ADMIN_TOKEN", ""), "Token authorizing admin APIs such as the job database snapshot. Admin APIs are disabled if not given")
 	flag.Parse()
+	if exclusiveHardware != "" {
+		config.ExclusiveHardware = strings.Split(exclusiveHardware, ",")
+	}
 	logger.Info.Printf("Cloud scheduler (%s) starts...", config.Name)
 	if configPath != "" {
 		logger.Info.Printf("Config file (%s) provided. Loading configs...", configPath)
@@ -57,5 +110,9 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	cs.Run()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := cs.Run(ctx); err != nil {
+		logger.Error.Fatalln(err.Error())
+	}
 }
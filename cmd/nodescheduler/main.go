@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler"
@@ -24,6 +28,7 @@ var Version = "0.0.0"
 func main() {
 	var config nodescheduler.NodeSchedulerConfig
 	var configPath string
+	var profilePreference string
 	config.Version = Version
 	flag.StringVar(&configPath, "config", "", "Path to config file")
 	flag.BoolVar(&config.Simulate, "simulate", false, "Simulate the scheduler")
@@ -38,10 +43,40 @@ func main() {
 	flag.StringVar(&config.RabbitmqURI, "rabbitmq-uri", getenv("RABBITMQ_URI", "wes-rabbitmq:5672"), "RabbitMQ management uri")
 	flag.StringVar(&config.RabbitmqUsername, "rabbitmq-username", getenv("RABBITMQ_USERNAME", "service"), "RabbitMQ management username")
 	flag.StringVar(&config.RabbitmqPassword, "rabbitmq-password", getenv("RABBITMQ_PASSWORD", "service"), "RabbitMQ management password")
+	flag.StringVar(&config.RabbitmqCaCertPath, "rabbitmq-cacert", getenv("RABBITMQ_CACERT", ""), "Path to the CA certificate verifying RabbitMQ. TLS is used if given")
+	flag.StringVar(&config.RabbitmqCertPath, "rabbitmq-cert", getenv("RABBITMQ_CERT", ""), "Path to the client certificate for RabbitMQ")
+	flag.StringVar(&config.RabbitmqKeyPath, "rabbitmq-key", getenv("RABBITMQ_KEY", ""), "Path to the client key for RabbitMQ")
+	flag.BoolVar(&config.RabbitmqAuthExternal, "rabbitmq-auth-external", getenv("RABBITMQ_AUTH_EXTERNAL", "") == "true", "Authenticate to RabbitMQ with the client certificate using EXTERNAL instead of the username and password")
+	flag.StringVar(&config.RabbitmqServerName, "rabbitmq-server-name", "", "Server name to verify in the RabbitMQ certificate. The host of the RabbitMQ URI is verified if not given")
+	flag.StringVar(&config.EventBus, "event-bus", "rabbitmq", "Event bus to send events to the cloud scheduler: rabbitmq or mqtt")
+	flag.StringVar(&config.MQTTBrokerURI, "mqtt-broker-uri", getenv("MQTT_BROKER_URI", "tcp://localhost:1883"), "MQTT broker uri, for example, tcp://host:1883 or ssl://host:8883")
+	flag.StringVar(&config.MQTTUsername, "mqtt-username", getenv("MQTT_USERNAME", ""), "MQTT username")
+	flag.StringVar(&config.MQTTPassword, "mqtt-password", getenv("MQTT_PASSWORD", ""), "MQTT password")
+	flag.StringVar(&config.MQTTCaCertPath, "mqtt-cacert", getenv("MQTT_CACERT", ""), "Path to the CA certificate verifying the MQTT broker. TLS is used if given")
+	flag.StringVar(&config.MQTTCertPath, "mqtt-cert", getenv("MQTT_CERT", ""), "Path to the client certificate for the MQTT broker")
+	flag.StringVar(&config.MQTTKeyPath, "mqtt-key", getenv("MQTT_KEY", ""), "Path to the client key for the MQTT broker")
+	flag.StringVar(&config.MQTTTopicPrefix, "mqtt-topic-prefix", "waggle", "Prefix of MQTT topics")
+	flag.StringVar(&config.OutboxPath, "outbox", getenv("OUTBOX_PATH", "/var/lib/nodescheduler/outbox.db"), "Path to the outbox file keeping events until the event bus accepts them. Events are not kept on disk if empty")
+	flag.IntVar(&config.OutboxMaxEvents, "outbox-max-events", 10000, "Maximum number of events in the outbox. The oldest events are dropped beyond it")
+	flag.IntVar(&config.OutboxMaxAge, "outbox-max-age", 7*24*3600, "Maximum age of events in the outbox in seconds. Older events are dropped")
 	flag.StringVar(&config.GoalStreamURL, "goalstream-url", "", "URL to receive goal stream")
-	flag.StringVar(&config.RuleCheckerURI, "rulechecker-uri", "http://wes-sciencerule-checker:5000", "rulechecker URI")
-	flag.StringVar(&config.SchedulingPolicy, "policy", "default", "Name of the scheduling policy")
+	flag.StringVar(&config.GoalStreamCACertPath, "goalstream-cacert", "", "Path to the CA certificate verifying the cloud scheduler over HTTPS")
+	flag.StringVar(&config.GoalStreamCertPath, "goalstream-cert", "", "Path to the node certificate presented to the cloud scheduler")
+	flag.StringVar(&config.GoalStreamKeyPath, "goalstream-key", "", "Path to the node key presented to the cloud scheduler")
+	flag.StringVar(&config.GoalVerificationKeyPath, "goal-verification-key", "", "Path to the ed25519 public key of the cloud scheduler. Goals not signed with the key are rejected if given")
+	flag.StringVar(&config.RuleCheckerURI, "rulechecker-uri", "", "URI of the science rule checker evaluating science rules, for example, http://wes-sciencerule-checker:5000. Rules are evaluated in the scheduler against the node data stream if empty")
+	flag.StringVar(&config.SchedulingPolicy, "policy", "default", "Name of the scheduling policy: default, roundrobin, priority, fairshare or pipeline. The pipeline is composed in the config file")
+	flag.IntVar(&config.ConcurrencyLimits.Global, "max-plugins", 0, "Maximum number of plugins running at the same time. No limit if 0")
+	flag.IntVar(&config.ConcurrencyLimits.Goal, "max-plugins-per-goal", 0, "Maximum number of plugins of a science goal running at the same time. No limit if 0")
+	flag.IntVar(&config.FairShareHalfLife, "fair-share-half-life", 3600, "Time in seconds it takes for runtime consumed by plugins to count half in the fairshare policy")
+	flag.Float64Var(&config.ResourceLimitRatio, "resource-limit-ratio", 0, "Ratio of resource limits to resource requests of plugins, for example, 2 limits plugins to twice their requests. Plugins have no limit if 0")
+	flag.StringVar(&profilePreference, "profile-preference", "", "Comma-separated names of plugin profiles in the order of preference. Names may have wildcards, for example, \"*_cuda\"")
+	flag.StringVar(&config.KnobInjection, "knob-injection", "env", "How knobs of the chosen profile are passed to plugins: env or args")
+	flag.BoolVar(&config.TerminatePluginsOnShutdown, "terminate-plugins-on-shutdown", false, "Terminate running plugins when the scheduler shuts down")
 	flag.Parse()
+	if profilePreference != "" {
+		config.ProfilePreference = strings.Split(profilePreference, ",")
+	}
 	if configPath != "" {
 		logger.Info.Printf("Config file (%s) provided. Loading configs...", configPath)
 		blob, err := ioutil.ReadFile(configPath)
@@ -67,5 +102,9 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	ns.Run()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := ns.Run(ctx); err != nil {
+		logger.Error.Fatalln(err.Error())
+	}
 }
@@ -162,7 +162,7 @@ func runPlugin(resourceManager *nodescheduler.ResourceManager, plugin *datatype.
 	return nil
 }
 
-func updateDeployment(clientset *kubernetes.Clientset, deployment *v1.Deployment) error {
+func updateDeployment(clientset kubernetes.Interface, deployment *v1.Deployment) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
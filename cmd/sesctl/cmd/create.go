@@ -1,11 +1,10 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/url"
 
 	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 )
 
 func init() {
@@ -15,36 +14,28 @@ func init() {
 		TraverseChildren: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			createFunc := func(r *JobRequest) error {
+				var job *datatype.Job
 				if r.FilePath != "" {
-					resp, err := r.handler.RequestPostFromFile("api/v1/create", r.FilePath)
+					j, err := readJobFile(r.FilePath)
 					if err != nil {
 						return err
 					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
-					if err != nil {
-						return err
-					}
-					blob, _ := json.MarshalIndent(body, "", " ")
-					fmt.Printf("%s\n", string(blob))
+					job = j
 				} else {
 					if len(args) < 1 {
 						return fmt.Errorf("Please specify job name")
 					}
-					name := args[0]
-					q, err := url.ParseQuery("name=" + name)
-					if err != nil {
-						return err
-					}
-					resp, err := r.handler.RequestGet("api/v1/create", q, r.Headers)
-					if err != nil {
-						return err
-					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
-					if err != nil {
-						return err
-					}
-					fmt.Printf("%v", body)
+					job = datatype.NewJob(args[0], "", "")
+				}
+				created, err := r.client.CreateJob(job)
+				if err != nil {
+					return err
 				}
+				printJSON(map[string]interface{}{
+					"job_id":   created.JobID,
+					"job_name": created.Name,
+					"status":   created.Status,
+				})
 				return nil
 			}
 			return jobRequest.Run(createFunc)
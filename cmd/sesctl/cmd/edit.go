@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/url"
 
 	"github.com/spf13/cobra"
 )
@@ -18,24 +16,31 @@ func init() {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			jobRequest.JobID = args[0]
 			editFunc := func(r *JobRequest) error {
-				if r.FilePath != "" {
-					q, err := url.ParseQuery("&id=" + fmt.Sprint(args[0]))
-					if err != nil {
-						return err
-					}
-					resp, err := r.handler.RequestPostFromFileWithQueries("api/v1/edit", r.FilePath, q)
-					if err != nil {
-						return err
-					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
-					if err != nil {
-						return err
-					}
-					blob, _ := json.MarshalIndent(body, "", " ")
-					fmt.Printf("%s\n", string(blob))
-				} else {
+				if r.FilePath == "" {
 					return fmt.Errorf("Interactive job editing is not supported. Please use -f to change job.")
 				}
+				job, err := readJobFile(r.FilePath)
+				if err != nil {
+					return err
+				}
+				result, err := r.client.ReplaceJob(r.JobID, job, r.DryRun)
+				if err != nil {
+					return err
+				}
+				response := map[string]interface{}{
+					"job_id": r.JobID,
+				}
+				if result.Report != nil {
+					response["nodes_updated"] = result.NodesUpdated
+					response["nodes_removed"] = result.NodesRemoved
+					response["report"] = result.Report
+				}
+				if result.DryRun {
+					response["dryrun"] = true
+				} else {
+					response["status"] = result.Job.Status
+				}
+				printJSON(response)
 				return nil
 			}
 			return jobRequest.Run(editFunc)
@@ -43,5 +48,6 @@ func init() {
 	}
 	flags := cmdEdit.Flags()
 	flags.StringVarP(&jobRequest.FilePath, "file-path", "f", "", "Path to the job file")
+	flags.BoolVarP(&jobRequest.DryRun, "dry-run", "", false, "Validate the change without applying it")
 	rootCmd.AddCommand(cmdEdit)
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func init() {
+	var (
+		nodeNames []string
+		nodeTags  []string
+	)
+	selection := func() (*datatype.NodeSelection, error) {
+		if len(nodeNames) < 1 && len(nodeTags) < 1 {
+			return nil, fmt.Errorf("Either --node or --tag should be provided.")
+		}
+		return &datatype.NodeSelection{
+			Nodes:    nodeNames,
+			NodeTags: nodeTags,
+		}, nil
+	}
+	cmdNodes := &cobra.Command{
+		Use:   "nodes [COMMANDS]",
+		Short: "Add or remove nodes of a job",
+	}
+	cmdNodesAdd := &cobra.Command{
+		Use:              "add [FLAGS] JOB_ID",
+		Short:            "Add nodes to a job",
+		TraverseChildren: true,
+		Args:             cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			addFunc := func(r *JobRequest) error {
+				s, err := selection()
+				if err != nil {
+					return err
+				}
+				result, err := r.client.AddJobNodes(r.JobID, s)
+				if err != nil {
+					return err
+				}
+				printJSON(result)
+				return nil
+			}
+			return jobRequest.Run(addFunc)
+		},
+	}
+	cmdNodesRm := &cobra.Command{
+		Use:              "rm [FLAGS] JOB_ID",
+		Short:            "Remove nodes from a job",
+		TraverseChildren: true,
+		Args:             cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jobRequest.JobID = args[0]
+			rmFunc := func(r *JobRequest) error {
+				s, err := selection()
+				if err != nil {
+					return err
+				}
+				result, err := r.client.RemoveJobNodes(r.JobID, s)
+				if err != nil {
+					return err
+				}
+				printJSON(result)
+				return nil
+			}
+			return jobRequest.Run(rmFunc)
+		},
+	}
+	for _, c := range []*cobra.Command{cmdNodesAdd, cmdNodesRm} {
+		flags := c.Flags()
+		flags.StringSliceVarP(&nodeNames, "node", "n", []string{}, "Node names (VSN), comma-separated")
+		flags.StringSliceVarP(&nodeTags, "tag", "t", []string{}, "Node tags to select nodes, comma-separated")
+		cmdNodes.AddCommand(c)
+	}
+	rootCmd.AddCommand(cmdNodes)
+}
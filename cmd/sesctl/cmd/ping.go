@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"encoding/json"
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
@@ -14,16 +11,11 @@ func init() {
 		TraverseChildren: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			pingFunc := func(r *JobRequest) error {
-				resp, err := r.handler.RequestGet("", nil, r.Headers)
-				if err != nil {
-					return err
-				}
-				body, err := r.handler.ParseJSONHTTPResponse(resp)
+				info, err := r.client.Info()
 				if err != nil {
 					return err
 				}
-				blob, _ := json.MarshalIndent(body, "", " ")
-				fmt.Printf("%s\n", string(blob))
+				printJSON(info)
 				return nil
 			}
 			return jobRequest.Run(pingFunc)
@@ -1,12 +1,8 @@
 package cmd
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
-	"strconv"
-
 	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 )
 
 func init() {
@@ -18,20 +14,22 @@ func init() {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			jobRequest.JobID = args[0]
 			rmFunc := func(r *JobRequest) error {
-				q, err := url.ParseQuery("id=" + r.JobID + "&suspend=" + strconv.FormatBool(r.Suspend) + "&force=" + strconv.FormatBool(r.Force))
-				if err != nil {
-					return err
-				}
-				resp, err := r.handler.RequestGet(fmt.Sprintf("api/v1/jobs/%s/rm", r.JobID), q, r.Headers)
-				if err != nil {
-					return err
+				var (
+					job *datatype.Job
+					err error
+				)
+				if r.Suspend {
+					job, err = r.client.SuspendJob(r.JobID)
+				} else {
+					job, err = r.client.RemoveJob(r.JobID, r.Force)
 				}
-				body, err := r.handler.ParseJSONHTTPResponse(resp)
 				if err != nil {
 					return err
 				}
-				blob, _ := json.MarshalIndent(body, "", " ")
-				fmt.Printf("%s\n", string(blob))
+				printJSON(map[string]interface{}{
+					"job_id": job.JobID,
+					"status": job.Status,
+				})
 				return nil
 			}
 			return jobRequest.Run(rmFunc)
@@ -8,11 +8,23 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/waggle-sensor/edge-scheduler/pkg/client"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 )
 
 func init() {
-	var showAll bool
+	var (
+		showAll bool
+		query   struct {
+			statuses []string
+			user     string
+			node     string
+			name     string
+			sort     string
+			limit    int
+			cursor   string
+		}
+	)
 	cmdStat := &cobra.Command{
 		Use:              "stat [FLAGS]",
 		Short:            "List jobs",
@@ -20,45 +32,46 @@ func init() {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			statFunc := func(r *JobRequest) error {
 				if r.JobID != "" {
-					resp, err := r.handler.RequestGet(fmt.Sprintf("api/v1/jobs/%s/status", r.JobID), nil, r.Headers)
+					job, err := r.client.GetJob(r.JobID)
 					if err != nil {
-						return err
+						return fmt.Errorf("Failed to get the job %q: %s", r.JobID, err.Error())
 					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
-					if err != nil {
-						return err
-					}
-					if blob, exist := body[r.JobID]; exist {
-						jobBlob, err := json.MarshalIndent(blob, "", "  ")
+					if r.OutPath != "" {
+						jobBlob, err := json.MarshalIndent(job, "", "  ")
 						if err != nil {
 							return err
 						}
-						if r.OutPath != "" {
-							err := ioutil.WriteFile(r.OutPath, jobBlob, 0644)
-							if err != nil {
-								return err
-							}
-						} else {
-							var job datatype.Job
-							err := json.Unmarshal(jobBlob, &job)
-							if err != nil {
-								return err
-							}
-							fmt.Print(printJob(&job))
-						}
-						return nil
-					} else {
-						return fmt.Errorf("Failed to get the job %q: Job does not exist", r.JobID)
+						return ioutil.WriteFile(r.OutPath, jobBlob, 0644)
 					}
+					fmt.Print(printJob(job))
+					return nil
 				} else {
-					resp, err := r.handler.RequestGet("api/v1/jobs", nil, r.Headers)
-					if err != nil {
-						return err
+					options := &client.ListJobsOptions{
+						User:         query.user,
+						Node:         query.node,
+						NameContains: query.name,
+						Sort:         query.sort,
+						Limit:        query.limit,
+						Cursor:       query.cursor,
 					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
+					if len(query.statuses) > 0 {
+						for _, status := range query.statuses {
+							options.Statuses = append(options.Statuses, datatype.JobStatus(status))
+						}
+					} else if !showAll {
+						options.Statuses = []datatype.JobStatus{
+							datatype.JobCreated,
+							datatype.JobDrafted,
+							datatype.JobSubmitted,
+							datatype.JobRunning,
+							datatype.JobSuspended,
+						}
+					}
+					list, err := r.client.ListJobs(options)
 					if err != nil {
 						return err
 					}
+					jobs := list.Jobs
 					var (
 						maxLengthID     int = 5
 						maxLengthName   int = 26
@@ -70,21 +83,7 @@ func init() {
 					)
 					formattedList := fmt.Sprintf("%-*s%-*s%-*s%-*s%-*s\n", maxLengthID+3, "JOB_ID", maxLengthName+3, "NAME", maxLengthUser+3, "USER", maxLengthStatus+3, "STATUS", maxAge+3, "AGE")
 					formattedList += strings.Repeat("=", len(formattedList)) + "\n"
-					for _, blob := range body {
-						jobBlob, err := json.Marshal(blob)
-						if err != nil {
-							return err
-						}
-						var job *datatype.Job
-						err = json.Unmarshal(jobBlob, &job)
-						if err != nil {
-							return err
-						}
-						if !showAll {
-							if job.Status == datatype.JobRemoved || job.Status == datatype.JobComplete {
-								continue
-							}
-						}
+					for _, job := range jobs {
 						var name string
 						if len(job.Name) > maxLengthName {
 							name = job.Name[:maxLengthName-1] + "..."
@@ -102,6 +101,9 @@ func init() {
 						}
 					}
 					fmt.Printf("%s", formattedList)
+					if list.NextCursor != "" {
+						fmt.Printf("\nMore jobs available. Use --cursor %s to see the next page\n", list.NextCursor)
+					}
 				}
 				return nil
 			}
@@ -112,5 +114,12 @@ func init() {
 	flags.StringVarP(&jobRequest.JobID, "job-id", "j", "", "Job ID")
 	flags.StringVarP(&jobRequest.OutPath, "out", "o", "", "Path to save output")
 	flags.BoolVarP(&showAll, "show-all", "A", false, "Show all jobs including removed and completed jobs")
+	flags.StringSliceVar(&query.statuses, "status", []string{}, "Show jobs in the statuses")
+	flags.StringVarP(&query.user, "user", "u", "", "Show jobs of the user")
+	flags.StringVar(&query.node, "node", "", "Show jobs that select the node")
+	flags.StringVar(&query.name, "name", "", "Show jobs whose name contains the text")
+	flags.StringVar(&query.sort, "sort", "id", "Sort jobs by id, name, created, or updated. Prefix with - for descending order")
+	flags.IntVar(&query.limit, "limit", 0, "Maximum number of jobs to show. 0 shows all")
+	flags.StringVar(&query.cursor, "cursor", "", "Cursor to show the next page of jobs")
 	rootCmd.AddCommand(cmdStat)
 }
@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/url"
 
 	"github.com/spf13/cobra"
 )
@@ -15,39 +13,37 @@ func init() {
 		TraverseChildren: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			submitFunc := func(r *JobRequest) error {
-				if r.JobID != "" {
-					q, err := url.ParseQuery("id=" + r.JobID + "&dryrun=" + fmt.Sprint(r.DryRun))
-					if err != nil {
-						return err
-					}
-					resp, err := r.handler.RequestGet("api/v1/submit", q, r.Headers)
-					if err != nil {
-						return err
-					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
-					if err != nil {
-						return err
+				jobID := r.JobID
+				if jobID == "" {
+					if r.FilePath == "" {
+						return fmt.Errorf("Either --job-id or --file-path should be provided.")
 					}
-					blob, _ := json.MarshalIndent(body, "", " ")
-					fmt.Printf("%s\n", string(blob))
-				} else if r.FilePath != "" {
-					q, err := url.ParseQuery("&dryrun=" + fmt.Sprint(r.DryRun))
+					job, err := readJobFile(r.FilePath)
 					if err != nil {
 						return err
 					}
-					resp, err := r.handler.RequestPostFromFileWithQueries("api/v1/submit", r.FilePath, q)
+					created, err := r.client.CreateJob(job)
 					if err != nil {
 						return err
 					}
-					body, err := r.handler.ParseJSONHTTPResponse(resp)
-					if err != nil {
-						return err
-					}
-					blob, _ := json.MarshalIndent(body, "", " ")
-					fmt.Printf("%s\n", string(blob))
+					jobID = created.JobID
+				}
+				result, err := r.client.SubmitJob(jobID, r.DryRun)
+				if err != nil {
+					return fmt.Errorf("Failed to submit job %q: %s", jobID, err.Error())
+				}
+				response := map[string]interface{}{
+					"job_id": jobID,
+				}
+				if result.Report != nil {
+					response["report"] = result.Report
+				}
+				if result.DryRun {
+					response["dryrun"] = true
 				} else {
-					return fmt.Errorf("Either --job-id or --file-path should be provided.")
+					response["status"] = result.Job.Status
 				}
+				printJSON(response)
 				return nil
 			}
 			return jobRequest.Run(submitFunc)
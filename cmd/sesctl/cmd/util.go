@@ -1,10 +1,13 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
+	"github.com/waggle-sensor/edge-scheduler/pkg/client"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
-	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"gopkg.in/yaml.v2"
 )
 
 func printJob(j *datatype.Job) (ret string) {
@@ -62,29 +65,44 @@ Total number of nodes %d
 
 type JobRequest struct {
 	ServerHostString string
-	handler          *interfacing.HTTPRequest
+	client           *client.Client
 	UserToken        string
 	JobID            string
-	OutPath          string            // for saving response into a file
-	DryRun           bool              // dry-run of job submission
-	FilePath         string            // for loading job description from a file
-	Suspend          bool              // for suspending a job
-	Force            bool              // for making the request forceful
-	Headers          map[string]string // additional headers for request
+	OutPath          string // for saving response into a file
+	DryRun           bool   // dry-run of job submission
+	FilePath         string // for loading job description from a file
+	Suspend          bool   // for suspending a job
+	Force            bool   // for making the request forceful
 }
 
-func (r *JobRequest) open() {
-	r.handler = interfacing.NewHTTPRequest(r.ServerHostString)
+func (r *JobRequest) open() (err error) {
+	r.client, err = client.NewClient(r.ServerHostString, r.UserToken)
+	return
 }
 
 func (r *JobRequest) Run(f func(*JobRequest) error) error {
-	if r.handler == nil {
-		r.open()
-	}
-	// TODO: The token may use different name other than Sage
-	r.Headers = map[string]string{
-		"Accept":        "applications/json",
-		"Authorization": fmt.Sprintf("Sage %s", r.UserToken),
+	if r.client == nil {
+		if err := r.open(); err != nil {
+			return err
+		}
 	}
 	return f(r)
 }
+
+// readJobFile reads a job description in YAML (or JSON) from the file
+func readJobFile(filePath string) (*datatype.Job, error) {
+	blob, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	job := datatype.NewJob("", "", "")
+	if err := yaml.Unmarshal(blob, job); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", filePath, err.Error())
+	}
+	return job, nil
+}
+
+func printJSON(v interface{}) {
+	blob, _ := json.MarshalIndent(v, "", " ")
+	fmt.Printf("%s\n", string(blob))
+}
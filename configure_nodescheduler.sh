@@ -47,6 +47,15 @@ spec:
           requests:
             cpu: 100m
             memory: 100Mi
+        # The outbox keeps events on the host until RabbitMQ accepts them
+        volumeMounts:
+        - name: scheduler-data
+          mountPath: /var/lib/nodescheduler
+      volumes:
+      - name: scheduler-data
+        hostPath:
+          path: /var/lib/nodescheduler
+          type: DirectoryOrCreate
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
@@ -64,6 +73,30 @@ subjects:
   name: wes-plugin-scheduler
   namespace: default
 ---
+# Plugins of a priority above the default run under priority classes the scheduler creates.
+# The built-in edit role does not cover priority classes as they are cluster-scoped
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: wes-plugin-scheduler-priorityclasses
+rules:
+- apiGroups: ["scheduling.k8s.io"]
+  resources: ["priorityclasses"]
+  verbs: ["get", "create"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: wes-plugin-scheduler-priorityclasses
+roleRef:
+  kind: ClusterRole
+  name: wes-plugin-scheduler-priorityclasses
+  apiGroup: rbac.authorization.k8s.io
+subjects:
+- kind: ServiceAccount
+  name: wes-plugin-scheduler
+  namespace: default
+---
 apiVersion: v1
 kind: ServiceAccount
 metadata:
@@ -0,0 +1,227 @@
+// Package client is a Go client of the /api/v2 API of the cloud scheduler
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const apiPrefix = "api/v2"
+
+// APIError is returned when the cloud scheduler responds with an error
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+// Client talks to the cloud scheduler
+type Client struct {
+	baseURL    *url.URL
+	token      string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client of the cloud scheduler at serverURL.
+// The token is sent as a Sage token in every request.
+func NewClient(serverURL string, token string) (*Client, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return &Client{
+		baseURL:    u,
+		token:      token,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// ListJobsOptions structs filters, sort order, and page of a job listing.
+// Zero values are not sent.
+type ListJobsOptions struct {
+	Statuses      []datatype.JobStatus
+	User          string
+	Node          string
+	NameContains  string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// Sort is one of id, name, created, and updated. Prefix with - for descending order
+	Sort   string
+	Limit  int
+	Cursor string
+}
+
+func (o *ListJobsOptions) values() url.Values {
+	values := url.Values{}
+	if o == nil {
+		return values
+	}
+	if len(o.Statuses) > 0 {
+		statuses := make([]string, 0, len(o.Statuses))
+		for _, status := range o.Statuses {
+			statuses = append(statuses, string(status))
+		}
+		values.Set("status", strings.Join(statuses, ","))
+	}
+	for key, value := range map[string]string{
+		"user":   o.User,
+		"node":   o.Node,
+		"name":   o.NameContains,
+		"sort":   o.Sort,
+		"cursor": o.Cursor,
+	} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	for key, t := range map[string]time.Time{
+		"created_after":  o.CreatedAfter,
+		"created_before": o.CreatedBefore,
+		"updated_after":  o.UpdatedAfter,
+		"updated_before": o.UpdatedBefore,
+	} {
+		if !t.IsZero() {
+			values.Set(key, t.Format(time.RFC3339))
+		}
+	}
+	if o.Limit > 0 {
+		values.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return values
+}
+
+// Info returns identity of the cloud scheduler
+func (c *Client) Info() (info *datatype.ServerInfo, err error) {
+	err = c.do(http.MethodGet, apiPrefix, nil, nil, &info)
+	return
+}
+
+// ListJobs returns a page of jobs matched with the options
+func (c *Client) ListJobs(options *ListJobsOptions) (list *datatype.JobList, err error) {
+	err = c.do(http.MethodGet, apiPrefix+"/jobs", options.values(), nil, &list)
+	return
+}
+
+// GetJob returns the job
+func (c *Client) GetJob(jobID string) (job *datatype.Job, err error) {
+	err = c.do(http.MethodGet, jobPath(jobID, ""), nil, nil, &job)
+	return
+}
+
+// CreateJob creates a job and returns it with its job ID
+func (c *Client) CreateJob(job *datatype.Job) (created *datatype.Job, err error) {
+	err = c.do(http.MethodPost, apiPrefix+"/jobs", nil, job, &created)
+	return
+}
+
+// ReplaceJob replaces the job. If dryrun is set, the change is validated but not applied.
+func (c *Client) ReplaceJob(jobID string, job *datatype.Job, dryrun bool) (result *datatype.JobUpdateResult, err error) {
+	err = c.do(http.MethodPut, jobPath(jobID, ""), boolQuery("dryrun", dryrun), job, &result)
+	return
+}
+
+// SubmitJob validates and submits the job. If dryrun is set, the job is validated but not submitted.
+func (c *Client) SubmitJob(jobID string, dryrun bool) (result *datatype.JobSubmitResult, err error) {
+	err = c.do(http.MethodPost, jobPath(jobID, ":submit"), boolQuery("dryrun", dryrun), nil, &result)
+	return
+}
+
+// SuspendJob suspends the job
+func (c *Client) SuspendJob(jobID string) (job *datatype.Job, err error) {
+	err = c.do(http.MethodPost, jobPath(jobID, ":suspend"), nil, nil, &job)
+	return
+}
+
+// RemoveJob removes the job. A running job is removed only if force is set.
+func (c *Client) RemoveJob(jobID string, force bool) (job *datatype.Job, err error) {
+	err = c.do(http.MethodDelete, jobPath(jobID, ""), boolQuery("force", force), nil, &job)
+	return
+}
+
+// AddJobNodes adds the selected nodes to the job
+func (c *Client) AddJobNodes(jobID string, selection *datatype.NodeSelection) (result *datatype.JobNodesResult, err error) {
+	err = c.do(http.MethodPost, jobPath(jobID, "/nodes"), nil, selection, &result)
+	return
+}
+
+// RemoveJobNodes removes the selected nodes from the job
+func (c *Client) RemoveJobNodes(jobID string, selection *datatype.NodeSelection) (result *datatype.JobNodesResult, err error) {
+	err = c.do(http.MethodDelete, jobPath(jobID, "/nodes"), nil, selection, &result)
+	return
+}
+
+func jobPath(jobID string, suffix string) string {
+	return fmt.Sprintf("%s/jobs/%s%s", apiPrefix, url.PathEscape(jobID), suffix)
+}
+
+func boolQuery(key string, value bool) url.Values {
+	if !value {
+		return nil
+	}
+	return url.Values{key: []string{"true"}}
+}
+
+// do sends the request with body encoded in JSON and decodes the response into out
+func (c *Client) do(method string, path string, queries url.Values, body interface{}, out interface{}) error {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	u := c.baseURL.ResolveReference(ref)
+	u.RawQuery = queries.Encode()
+	var reader io.Reader
+	if body != nil {
+		blob, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(blob)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	// TODO: The token may use different name other than Sage
+	req.Header.Set("Authorization", fmt.Sprintf("Sage %s", c.token))
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	blob, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var errorResponse datatype.ErrorResponse
+		if err := json.Unmarshal(blob, &errorResponse); err != nil || errorResponse.Error == "" {
+			errorResponse.Error = strings.TrimSpace(string(blob))
+		}
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    errorResponse.Error,
+		}
+	}
+	return json.Unmarshal(blob, out)
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestClientRequests(t *testing.T) {
+	tests := map[string]struct {
+		Call      func(c *Client) error
+		Method    string
+		Path      string
+		Query     string
+		HasBody   bool
+		Status    int
+		Response  interface{}
+		WantError int
+	}{
+		"info": {
+			Call:     func(c *Client) error { _, err := c.Info(); return err },
+			Method:   http.MethodGet,
+			Path:     "/api/v2",
+			Response: &datatype.ServerInfo{ID: "test"},
+		},
+		"listjobs": {
+			Call: func(c *Client) error {
+				_, err := c.ListJobs(&ListJobsOptions{
+					Statuses: []datatype.JobStatus{datatype.JobSubmitted, datatype.JobRunning},
+					User:     "alice",
+					Limit:    10,
+				})
+				return err
+			},
+			Method:   http.MethodGet,
+			Path:     "/api/v2/jobs",
+			Query:    "limit=10&status=Submitted%2CRunning&user=alice",
+			Response: &datatype.JobList{},
+		},
+		"createjob": {
+			Call:     func(c *Client) error { _, err := c.CreateJob(datatype.NewJob("test", "", "")); return err },
+			Method:   http.MethodPost,
+			Path:     "/api/v2/jobs",
+			HasBody:  true,
+			Status:   http.StatusCreated,
+			Response: datatype.NewJob("test", "", ""),
+		},
+		"replacejob": {
+			Call:     func(c *Client) error { _, err := c.ReplaceJob("1", datatype.NewJob("test", "", ""), true); return err },
+			Method:   http.MethodPut,
+			Path:     "/api/v2/jobs/1",
+			Query:    "dryrun=true",
+			HasBody:  true,
+			Response: &datatype.JobUpdateResult{},
+		},
+		"submitjob": {
+			Call:     func(c *Client) error { _, err := c.SubmitJob("1", false); return err },
+			Method:   http.MethodPost,
+			Path:     "/api/v2/jobs/1:submit",
+			Response: &datatype.JobSubmitResult{},
+		},
+		"suspendjob": {
+			Call:     func(c *Client) error { _, err := c.SuspendJob("1"); return err },
+			Method:   http.MethodPost,
+			Path:     "/api/v2/jobs/1:suspend",
+			Response: datatype.NewJob("test", "", ""),
+		},
+		"removejob": {
+			Call:     func(c *Client) error { _, err := c.RemoveJob("1", true); return err },
+			Method:   http.MethodDelete,
+			Path:     "/api/v2/jobs/1",
+			Query:    "force=true",
+			Response: datatype.NewJob("test", "", ""),
+		},
+		"addnodes": {
+			Call: func(c *Client) error {
+				_, err := c.AddJobNodes("1", &datatype.NodeSelection{Nodes: []string{"W001"}})
+				return err
+			},
+			Method:   http.MethodPost,
+			Path:     "/api/v2/jobs/1/nodes",
+			HasBody:  true,
+			Response: &datatype.JobNodesResult{},
+		},
+		"notfound": {
+			Call:      func(c *Client) error { _, err := c.GetJob("2"); return err },
+			Method:    http.MethodGet,
+			Path:      "/api/v2/jobs/2",
+			Status:    http.StatusNotFound,
+			Response:  &datatype.ErrorResponse{Error: "Job 2 does not exist"},
+			WantError: http.StatusNotFound,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != tc.Method {
+					t.Errorf("Method mismatch: wanted %s, got %s", tc.Method, r.Method)
+				}
+				if r.URL.Path != tc.Path {
+					t.Errorf("Path mismatch: wanted %s, got %s", tc.Path, r.URL.Path)
+				}
+				if r.URL.RawQuery != tc.Query {
+					t.Errorf("Query mismatch: wanted %s, got %s", tc.Query, r.URL.RawQuery)
+				}
+				if got := r.Header.Get("Authorization"); got != "Sage token" {
+					t.Errorf("Authorization mismatch: got %q", got)
+				}
+				if hasBody := r.ContentLength > 0; hasBody != tc.HasBody {
+					t.Errorf("Body mismatch: wanted %t, got %t", tc.HasBody, hasBody)
+				}
+				status := tc.Status
+				if status == 0 {
+					status = http.StatusOK
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				json.NewEncoder(w).Encode(tc.Response)
+			}))
+			defer server.Close()
+			c, err := NewClient(server.URL, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tc.Call(c)
+			if tc.WantError == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err.Error())
+				}
+				return
+			}
+			var apiError *APIError
+			if !errors.As(err, &apiError) {
+				t.Fatalf("Wanted APIError, got %v", err)
+			}
+			if apiError.StatusCode != tc.WantError {
+				t.Errorf("Status code mismatch: wanted %d, got %d", tc.WantError, apiError.StatusCode)
+			}
+		})
+	}
+}
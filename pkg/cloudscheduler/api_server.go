@@ -1,6 +1,10 @@
 package cloudscheduler
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,11 +13,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 	yaml "gopkg.in/yaml.v2"
 	// "github.com/urfave/negroni"
@@ -28,6 +34,17 @@ type APIServer struct {
 	subscribers            map[string]map[chan *datatype.Event]bool
 	subscriberMutex        sync.Mutex
 	authenticator          Authenticator
+	server                 *http.Server
+	tlsServer              *http.Server
+	nodeIdentities         *NodeIdentityMapper
+	goalsOverTLSOnly       bool
+	// adminToken authorizes admin APIs. They are disabled if empty
+	adminToken string
+	// goalSigningKey signs goals sent to nodes if set
+	goalSigningKey ed25519.PrivateKey
+	// closing is closed when the server shuts down to end goal streams
+	closing     chan struct{}
+	closingOnce sync.Once
 }
 
 func (api *APIServer) subscribe(nodeName string, c chan *datatype.Event) {
@@ -38,6 +55,7 @@ func (api *APIServer) subscribe(nodeName string, c chan *datatype.Event) {
 	}
 	api.subscribers[nodeName][c] = true
 	api.subscriberMutex.Unlock()
+	api.cloudScheduler.Metrics.SubscriberAdded(nodeName)
 }
 
 func (api *APIServer) unsubscribe(nodeName string, c chan *datatype.Event) {
@@ -47,6 +65,7 @@ func (api *APIServer) unsubscribe(nodeName string, c chan *datatype.Event) {
 		delete(api.subscribers[nodeName], c)
 	}
 	api.subscriberMutex.Unlock()
+	api.cloudScheduler.Metrics.SubscriberRemoved(nodeName)
 }
 
 func (api *APIServer) Push(nodeName string, event *datatype.Event) {
@@ -56,8 +75,10 @@ func (api *APIServer) Push(nodeName string, event *datatype.Event) {
 		for ch := range api.subscribers[nodeName] {
 			select {
 			case ch <- event:
+				api.cloudScheduler.Metrics.Pushed(nodeName, false)
 			default:
 				// (Sean) don't block on slow channels. assume they will drop and reconnect to fetch goal.
+				api.cloudScheduler.Metrics.Pushed(nodeName, true)
 			}
 		}
 	}
@@ -67,6 +88,7 @@ func (api *APIServer) Push(nodeName string, event *datatype.Event) {
 func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 	api.mainRouter = mux.NewRouter()
 	r := api.mainRouter
+	r.Use(api.instrument)
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		response := datatype.NewAPIMessageBuilder().
 			AddEntity("id", fmt.Sprintf("Cloud Scheduler (%s)", api.cloudScheduler.Name)).
@@ -74,28 +96,190 @@ func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 		respondJSON(w, http.StatusOK, response.ToJson())
 		fmt.Fprintln(w)
 	})
+	api.configureAPIv2(r)
 	api_route := r.PathPrefix("/api/v1").Subrouter()
 	if prometheusGatherer != nil {
 		api_route.Handle("/system/metrics", promhttp.HandlerFor(prometheusGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})).Methods(http.MethodGet)
 	}
+	api_route.Handle("/system/snapshot", api.authorizeAdmin(api.handlerSnapshot)).Methods(http.MethodGet)
 	api_route.Handle("/create", http.HandlerFunc(api.handlerCreateJob)).Methods(http.MethodGet, http.MethodPost)
 	api_route.Handle("/edit", http.HandlerFunc(api.handlerEditJob)).Methods(http.MethodPost)
 	api_route.Handle("/submit", http.HandlerFunc(api.handlerSubmitJobs)).Methods(http.MethodGet, http.MethodPost)
 	api_route.Handle("/jobs", http.HandlerFunc(api.handlerJobs)).Methods(http.MethodGet)
 	api_route.Handle("/jobs/{id}/status", http.HandlerFunc(api.handlerJobStatus)).Methods(http.MethodGet)
 	api_route.Handle("/jobs/{id}/rm", http.HandlerFunc(api.handlerJobRemove)).Methods(http.MethodGet)
+	api_route.Handle("/jobs/{id}/nodes", http.HandlerFunc(api.handlerJobNodes)).Methods(http.MethodPost, http.MethodDelete)
+	api_route.Handle("/users/{user}/quota", http.HandlerFunc(api.handlerUserQuota)).Methods(http.MethodGet)
 	// api.Handle("/goals", http.HandlerFunc(cs.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
-	api_route.Handle("/goals/{nodeName}", http.HandlerFunc(api.handlerGoalForNode)).Methods(http.MethodGet)
+	api_route.Handle("/goals/{nodeName}", api.authorizeNode(api.handlerGoalForNode)).Methods(http.MethodGet)
 	if api.enablePushNotification {
 		logger.Info.Printf("Enabling push notification. Nodes can connect to /goals/{nodeName}/stream to get notification from the cloud scheduler.")
-		api_route.Handle("/goals/{nodeName}/stream", http.HandlerFunc(api.handlerGoalStreamForNode)).Methods(http.MethodGet)
+		api_route.Handle("/goals/{nodeName}/stream", api.authorizeNode(api.handlerGoalStreamForNode)).Methods(http.MethodGet)
 	}
+	api.server = &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", api.port),
+		Handler: api.mainRouter,
+	}
+	// Goal streams never end by themselves. They need to return for the shutdown to finish
+	api.server.RegisterOnShutdown(api.closeGoalStreams)
+}
+
+// ConfigureTLS adds a TLS listener serving the same APIs. Client certificates
+// signed by the client CA are verified if presented and are required to access goals
+func (api *APIServer) ConfigureTLS(port int, certPath string, keyPath string, clientCACertPath string) error {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("Failed to load server certificate: %s", err.Error())
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if clientCACertPath != "" {
+		tlsConfig.ClientCAs, err = interfacing.LoadCertPool(clientCACertPath)
+		if err != nil {
+			return fmt.Errorf("Failed to load client CA certificate: %s", err.Error())
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	} else {
+		logger.Info.Println("No client CA certificate is given. Nodes cannot access goals over TLS")
+	}
+	api.tlsServer = &http.Server{
+		Addr:      fmt.Sprintf("0.0.0.0:%d", port),
+		Handler:   api.mainRouter,
+		TLSConfig: tlsConfig,
+	}
+	api.tlsServer.RegisterOnShutdown(api.closeGoalStreams)
+	return nil
+}
+
+func (api *APIServer) closeGoalStreams() {
+	api.closingOnce.Do(func() {
+		close(api.closing)
+	})
+}
+
+// Run serves the API until Shutdown is called
+func (api *APIServer) Run() error {
+	chanServerError := make(chan error, 2)
+	servers := 1
+	go func() {
+		logger.Info.Printf("API server starts at %q...", api.server.Addr)
+		chanServerError <- api.server.ListenAndServe()
+	}()
+	if api.tlsServer != nil {
+		servers += 1
+		go func() {
+			logger.Info.Printf("API server starts TLS at %q...", api.tlsServer.Addr)
+			// Certificates are loaded in the TLS configuration
+			chanServerError <- api.tlsServer.ListenAndServeTLS("", "")
+		}()
+	}
+	for i := 0; i < servers; i++ {
+		if err := <-chanServerError; err != http.ErrServerClosed {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests, closes goal streams, and waits for
+// in-flight requests to finish until ctx is done
+func (api *APIServer) Shutdown(ctx context.Context) error {
+	logger.Info.Println("API server is shutting down...")
+	err := api.server.Shutdown(ctx)
+	if api.tlsServer != nil {
+		if tlsErr := api.tlsServer.Shutdown(ctx); err == nil {
+			err = tlsErr
+		}
+	}
+	return err
+}
+
+// authorizeNode allows only the node to access its goals over TLS. The node is
+// identified by its client certificate. Requests not over TLS are allowed
+// unless goals are served only over TLS
+func (api *APIServer) authorizeNode(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nodeName := mux.Vars(r)["nodeName"]
+		if r.TLS == nil {
+			if api.goalsOverTLSOnly {
+				response := datatype.NewAPIMessageBuilder().AddError("Goals are served only over TLS with a node certificate").Build()
+				respondJSON(w, http.StatusForbidden, response.ToJson())
+				return
+			}
+			next(w, r)
+			return
+		}
+		if len(r.TLS.PeerCertificates) < 1 {
+			response := datatype.NewAPIMessageBuilder().AddError("Node certificate is required to access goals").Build()
+			respondJSON(w, http.StatusUnauthorized, response.ToJson())
+			return
+		}
+		cert := r.TLS.PeerCertificates[0]
+		if !api.nodeIdentities.Authorize(cert, nodeName) {
+			logger.Info.Printf("Certificate %q requested goals of %s but identifies %v", cert.Subject.CommonName, nodeName, api.nodeIdentities.VSNs(cert))
+			response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("Certificate does not identify node %s", nodeName)).Build()
+			respondJSON(w, http.StatusForbidden, response.ToJson())
+			return
+		}
+		next(w, r)
+	})
+}
+
+// authorizeAdmin allows only requests carrying the admin token as a bearer token.
+// Admin APIs are refused if no admin token is set
+func (api *APIServer) authorizeAdmin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api.adminToken == "" {
+			response := datatype.NewAPIMessageBuilder().AddError("Admin APIs are disabled. Set the admin token of the scheduler to use them").Build()
+			respondJSON(w, http.StatusForbidden, response.ToJson())
+			return
+		}
+		const prefix = "Bearer "
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, prefix) || subtle.ConstantTimeCompare([]byte(auth[len(prefix):]), []byte(api.adminToken)) != 1 {
+			response := datatype.NewAPIMessageBuilder().AddError("Admin token is required").Build()
+			respondJSON(w, http.StatusUnauthorized, response.ToJson())
+			return
+		}
+		next(w, r)
+	})
+}
+
+// statusRecorder records the status code of a response. It keeps the response
+// flushable for the goal stream
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
 }
 
-func (api *APIServer) Run() {
-	api_address_port := fmt.Sprintf("0.0.0.0:%d", api.port)
-	logger.Info.Printf("API server starts at %q...", api_address_port)
-	logger.Info.Fatalln(http.ListenAndServe(api_address_port, api.mainRouter))
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrument observes latency of requests labeled by the route template
+// so that requests of different jobs and nodes fall into the same route
+func (api *APIServer) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		api.cloudScheduler.Metrics.ObserveAPIRequest(route, r.Method, rec.status, time.Since(start))
+	})
 }
 
 func (api *APIServer) handlerCreateJob(w http.ResponseWriter, r *http.Request) {
@@ -141,6 +325,16 @@ func (api *APIServer) handlerEditJob(w http.ResponseWriter, r *http.Request) {
 	queries := r.URL.Query()
 	if _, exist := queries["id"]; exist {
 		jobID := queries.Get("id")
+		flagDryRun := false
+		if _, exist := queries["dryrun"]; exist {
+			f, err := strconv.ParseBool(queries.Get("dryrun"))
+			if err != nil {
+				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+				respondJSON(w, http.StatusBadRequest, response.ToJson())
+				return
+			}
+			flagDryRun = f
+		}
 		oldJob, err := api.cloudScheduler.GoalManager.GetJob(jobID)
 		if err != nil {
 			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
@@ -163,12 +357,24 @@ func (api *APIServer) handlerEditJob(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			updatedJob.JobID = jobID
-			// Remove science goal of old Job if exists
-			if oldJob.ScienceGoal != nil {
-				api.cloudScheduler.GoalManager.RemoveScienceGoal(oldJob.ScienceGoal.ID)
+			result, errorList := api.cloudScheduler.EditJob(oldJob, updatedJob, flagDryRun)
+			if len(errorList) > 0 {
+				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("%v", errorList)).Build()
+				respondJSON(w, http.StatusBadRequest, response.ToJson())
+				return
+			}
+			response := datatype.NewAPIMessageBuilder().AddEntity("job_id", jobID)
+			if result.Report != nil {
+				response = response.
+					AddEntity("nodes_updated", result.NodesUpdated).
+					AddEntity("nodes_removed", result.NodesRemoved).
+					AddEntity("report", result.Report)
+			}
+			if flagDryRun {
+				response = response.AddEntity("dryrun", true)
+			} else {
+				response = response.AddEntity("status", result.Job.Status)
 			}
-			api.cloudScheduler.GoalManager.UpdateJob(updatedJob, false)
-			response := datatype.NewAPIMessageBuilder().AddEntity("job_id", jobID).AddEntity("status", datatype.JobDrafted)
 			respondJSON(w, http.StatusOK, response.Build().ToJson())
 			return
 		}
@@ -195,13 +401,15 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 	case http.MethodGet:
 		queries := r.URL.Query()
 		if _, exist := queries["id"]; exist {
-			errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(queries.Get("id"), flagDryRun)
+			report, errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(queries.Get("id"), flagDryRun)
 			if len(errorList) > 0 {
 				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("%v", errorList)).Build()
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
 				return
 			} else {
-				response := datatype.NewAPIMessageBuilder().AddEntity("job_id", queries.Get("id"))
+				response := datatype.NewAPIMessageBuilder().
+					AddEntity("job_id", queries.Get("id")).
+					AddEntity("report", report)
 				if flagDryRun {
 					response = response.AddEntity("dryrun", true)
 				} else {
@@ -231,13 +439,15 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 				return
 			}
 			jobID := api.cloudScheduler.GoalManager.AddJob(newJob)
-			errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(jobID, flagDryRun)
+			report, errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(jobID, flagDryRun)
 			if len(errorList) > 0 {
 				response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("%v", errorList)).Build()
 				respondJSON(w, http.StatusBadRequest, response.ToJson())
 				return
 			} else {
-				response := datatype.NewAPIMessageBuilder().AddEntity("job_id", jobID)
+				response := datatype.NewAPIMessageBuilder().
+					AddEntity("job_id", jobID).
+					AddEntity("report", report)
 				if flagDryRun {
 					response = response.AddEntity("dryrun", true)
 				} else {
@@ -250,15 +460,39 @@ func (api *APIServer) handlerSubmitJobs(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// handlerJobs lists jobs. Without query parameters of ParseJobQuery all jobs are returned
+// keyed by job ID as v1 clients expect. With the parameters matched jobs are returned
+// as a list in the requested order along with next_cursor to get the next page.
 func (api *APIServer) handlerJobs(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		response := datatype.NewAPIMessageBuilder()
-
-		jobs := api.cloudScheduler.GoalManager.GetJobs()
-		for _, job := range jobs {
-			response.AddEntity(job.JobID, job)
+		queries := r.URL.Query()
+		if !hasJobQuery(queries) {
+			response := datatype.NewAPIMessageBuilder()
+			for _, job := range api.cloudScheduler.GoalManager.GetJobs() {
+				response.AddEntity(job.JobID, job)
+			}
+			respondJSON(w, http.StatusOK, response.Build().ToJson())
+			return
 		}
-		respondJSON(w, http.StatusOK, response.Build().ToJson())
+		q, err := ParseJobQuery(queries)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		jobs, nextCursor, err := api.cloudScheduler.GoalManager.QueryJobs(q)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusBadRequest, response.ToJson())
+			return
+		}
+		if jobs == nil {
+			jobs = []*datatype.Job{}
+		}
+		response := datatype.NewAPIMessageBuilder().
+			AddEntity("jobs", jobs).
+			AddEntity("next_cursor", nextCursor).Build()
+		respondJSON(w, http.StatusOK, response.ToJson())
 	}
 }
 
@@ -321,6 +555,105 @@ func (api *APIServer) handlerJobRemove(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlerJobNodes adds (POST) or drops (DELETE) nodes of a job.
+// The body selects nodes by name and/or by tags, for example
+// {"nodes": ["W023"], "nodeTags": ["WSN"]}
+func (api *APIServer) handlerJobNodes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+	var selection struct {
+		Nodes    []string `yaml:"nodes"`
+		NodeTags []string `yaml:"nodeTags"`
+	}
+	blob, err := io.ReadAll(r.Body)
+	if err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	if err = yaml.Unmarshal(blob, &selection); err != nil {
+		response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	if len(selection.Nodes) < 1 && len(selection.NodeTags) < 1 {
+		response := datatype.NewAPIMessageBuilder().AddError("nodes or nodeTags is required").Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	var (
+		nodes     []string
+		report    *datatype.ValidationReport
+		errorList []error
+		key       string
+	)
+	switch r.Method {
+	case http.MethodPost:
+		nodes, report, errorList = api.cloudScheduler.AddNodesToJob(jobID, selection.Nodes, selection.NodeTags)
+		key = "nodes_added"
+	case http.MethodDelete:
+		nodes, errorList = api.cloudScheduler.DropNodesFromJob(jobID, selection.Nodes, selection.NodeTags)
+		key = "nodes_removed"
+	}
+	if len(errorList) > 0 {
+		response := datatype.NewAPIMessageBuilder().AddEntity("job_id", jobID).
+			AddError(fmt.Sprintf("%v", errorList)).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+		return
+	}
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("job_id", jobID).
+		AddEntity(key, nodes)
+	if report != nil {
+		response = response.AddEntity("report", report)
+	}
+	respondJSON(w, http.StatusOK, response.Build().ToJson())
+}
+
+func (api *APIServer) handlerUserQuota(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	user := vars["user"]
+	response := datatype.NewAPIMessageBuilder().
+		AddEntity("user", user).
+		AddEntity("quota", api.cloudScheduler.QuotaManager.GetQuota(user)).
+		AddEntity("usage", api.cloudScheduler.getQuotaUsage(user)).
+		Build()
+	respondJSON(w, http.StatusOK, response.ToJson())
+}
+
+// handlerSnapshot returns a copy of the job database for backups. The copy is
+// the database file by default and a portable JSON archive if format=json
+func (api *APIServer) handlerSnapshot(w http.ResponseWriter, r *http.Request) {
+	timestamp := time.Now().UTC().Format("20060102T150405Z")
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "db":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"job-%s.db\"", timestamp))
+		if err := api.cloudScheduler.GoalManager.SnapshotJobDB(w); err != nil {
+			// Headers may have been sent already
+			logger.Error.Printf("Failed to write snapshot of job database: %s", err.Error())
+		}
+	case "json":
+		archive, err := api.cloudScheduler.GoalManager.ExportJobs()
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusInternalServerError, response.ToJson())
+			return
+		}
+		blob, err := json.Marshal(archive)
+		if err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusInternalServerError, response.ToJson())
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"jobs-%s.json\"", timestamp))
+		respondJSON(w, http.StatusOK, blob)
+	default:
+		response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("Unsupported format %q. Use db or json", format)).Build()
+		respondJSON(w, http.StatusBadRequest, response.ToJson())
+	}
+}
+
 func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 
@@ -360,6 +693,9 @@ func (api *APIServer) handlerGoalForNode(w http.ResponseWriter, r *http.Request)
 		respondJSON(w, http.StatusOK, response.ToJson())
 		return
 	}
+	if api.goalSigningKey != nil {
+		w.Header().Set(datatype.GoalSignatureHeader, datatype.SignGoals(api.goalSigningKey, nodeName, blob))
+	}
 	respondJSON(w, http.StatusOK, blob)
 }
 
@@ -389,7 +725,7 @@ func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Re
 	// returning null may raise an exception in edge scheduler
 	if len(goals) < 1 {
 		event := datatype.NewEventBuilder(datatype.EventGoalStatusUpdated).AddEntry("goals", "[]").Build()
-		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
+		if err := api.writeGoalEvent(w, nodeName, &event); err != nil {
 			return
 		}
 		flusher.Flush()
@@ -399,7 +735,7 @@ func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Re
 			logger.Error.Printf("Failed to compress goals for node %q before pushing", nodeName)
 		} else {
 			event := datatype.NewEventBuilder(datatype.EventGoalStatusUpdated).AddEntry("goals", string(blob)).Build()
-			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
+			if err := api.writeGoalEvent(w, nodeName, &event); err != nil {
 				return
 			}
 			flusher.Flush()
@@ -408,7 +744,7 @@ func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Re
 	for {
 		select {
 		case event := <-c:
-			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), event.GetEntry("goals")); err != nil {
+			if err := api.writeGoalEvent(w, nodeName, event); err != nil {
 				return
 			}
 			// option 1. send a small heartbeat to the client to keep the connection and notify if it fails
@@ -417,8 +753,26 @@ func (api *APIServer) handlerGoalStreamForNode(w http.ResponseWriter, r *http.Re
 		case <-r.Context().Done():
 			flusher.Flush()
 			return
+		case <-api.closing:
+			// The node will reconnect to the next instance and get its goals
+			flusher.Flush()
+			return
+		}
+	}
+}
+
+// writeGoalEvent writes the goal event in the server-sent event format. The signature
+// of goals comes before the event so that nodes not verifying goals can ignore it
+func (api *APIServer) writeGoalEvent(w io.Writer, nodeName string, event *datatype.Event) error {
+	goals := event.GetEntry("goals")
+	if api.goalSigningKey != nil {
+		signature := datatype.SignGoals(api.goalSigningKey, nodeName, []byte(goals))
+		if _, err := fmt.Fprintf(w, "signature: %s\n", signature); err != nil {
+			return err
 		}
 	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.ToString(), goals)
+	return err
 }
 
 func (api *APIServer) authenticate(r *http.Request) error {
@@ -0,0 +1,302 @@
+package cloudscheduler
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
+
+func TestAPIServerShutdownClosesGoalStreams(t *testing.T) {
+	cs := NewCloudSchedulerBuilder(&CloudSchedulerConfig{
+		Name:             "test",
+		PushNotification: true,
+	}).
+		AddGoalManager().
+		AddAPIServer().
+		Build()
+	cs.APIServer.ConfigureAPIs(nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- cs.APIServer.server.Serve(listener)
+	}()
+	resp, err := http.Get(fmt.Sprintf("http://%s/api/v1/goals/W001/stream", listener.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "event:") {
+		t.Fatalf("Wanted the first event, got %q (%v)", line, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := cs.APIServer.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown did not finish: %s", err.Error())
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Stream did not end cleanly: %s", err.Error())
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Wanted %v, got %v", http.ErrServerClosed, err)
+	}
+}
+
+func TestAPIServerSignsGoals(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	cs := NewCloudSchedulerBuilder(&CloudSchedulerConfig{
+		Name:             "test",
+		PushNotification: true,
+	}).
+		AddGoalManager().
+		AddAPIServer().
+		Build()
+	cs.APIServer.goalSigningKey = key
+	cs.APIServer.ConfigureAPIs(nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cs.APIServer.server.Serve(listener)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		cs.APIServer.Shutdown(ctx)
+	}()
+	r := interfacing.NewHTTPRequest(fmt.Sprintf("http://%s", listener.Addr().String()))
+
+	resp, err := r.RequestGet("/api/v1/goals/W001", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err := datatype.VerifyGoals(pub, "W001", blob, resp.Header.Get(datatype.GoalSignatureHeader)); err != nil {
+		t.Errorf("Goals in the response are not signed: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan *datatype.Event, 1)
+	r.Subscribe(ctx, "/api/v1/goals/W001/stream", ch, false)
+	select {
+	case event := <-ch:
+		if event.Type != datatype.EventGoalStatusUpdated {
+			t.Errorf("Event type mismatch: wanted %s, got %s", datatype.EventGoalStatusUpdated, event.Type)
+		}
+		if err := datatype.VerifyGoals(pub, "W001", []byte(event.GetEntry("goals")), event.GetEntry("signature")); err != nil {
+			t.Errorf("Goals in the stream are not signed: %s", err.Error())
+		}
+		if err := datatype.VerifyGoals(pub, "W002", []byte(event.GetEntry("goals")), event.GetEntry("signature")); err == nil {
+			t.Errorf("Goals signed for W001 are valid for W002")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No event received from the stream")
+	}
+}
+
+func TestAPIServerJobNodes(t *testing.T) {
+	tests := map[string]struct {
+		Method     string
+		Body       string
+		WantStatus int
+		WantKey    string
+		WantNodes  []string
+	}{
+		"add": {
+			Method:     http.MethodPost,
+			Body:       `{"nodes": ["W003"]}`,
+			WantStatus: http.StatusOK,
+			WantKey:    "nodes_added",
+			WantNodes:  []string{"W003"},
+		},
+		"addbytag": {
+			Method:     http.MethodPost,
+			Body:       `{"nodeTags": ["test"]}`,
+			WantStatus: http.StatusOK,
+			WantKey:    "nodes_added",
+			WantNodes:  []string{"W003"},
+		},
+		"drop": {
+			Method:     http.MethodDelete,
+			Body:       `{"nodes": ["W001"]}`,
+			WantStatus: http.StatusOK,
+			WantKey:    "nodes_removed",
+			WantNodes:  []string{"W001"},
+		},
+		"dropbytag": {
+			Method:     http.MethodDelete,
+			Body:       `{"nodeTags": ["WSN"]}`,
+			WantStatus: http.StatusOK,
+			WantKey:    "nodes_removed",
+			WantNodes:  []string{"W001", "W002"},
+		},
+		"empty": {
+			Method:     http.MethodPost,
+			Body:       `{}`,
+			WantStatus: http.StatusBadRequest,
+		},
+		"unknown": {
+			Method:     http.MethodPost,
+			Body:       `{"nodes": ["W999"]}`,
+			WantStatus: http.StatusBadRequest,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cs := newTestCloudScheduler(t)
+			cs.APIServer.ConfigureAPIs(nil)
+			jobID := submitTestJob(t, cs, []string{"W001", "W002"}, nil)
+			req := httptest.NewRequest(test.Method, fmt.Sprintf("/api/v1/jobs/%s/nodes", jobID), strings.NewReader(test.Body))
+			rec := httptest.NewRecorder()
+			cs.APIServer.server.Handler.ServeHTTP(rec, req)
+			if rec.Code != test.WantStatus {
+				t.Fatalf("Wanted status %d, got %d: %s", test.WantStatus, rec.Code, rec.Body.String())
+			}
+			if test.WantKey == "" {
+				return
+			}
+			var response map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			var nodes []string
+			if list, ok := response[test.WantKey].([]interface{}); ok {
+				for _, n := range list {
+					nodes = append(nodes, fmt.Sprint(n))
+				}
+			}
+			if !equalStrings(nodes, test.WantNodes) {
+				t.Errorf("Wanted %s %v, got %v", test.WantKey, test.WantNodes, response[test.WantKey])
+			}
+		})
+	}
+}
+
+func TestAPIServerJobs(t *testing.T) {
+	tests := map[string]struct {
+		Query          string
+		WantByID       bool
+		WantJobIDs     []string
+		WantNextCursor bool
+	}{
+		"noquery":          {WantByID: true, WantJobIDs: []string{"1", "2", "3"}},
+		"unknownparameter": {Query: "?verbose=true", WantByID: true, WantJobIDs: []string{"1", "2", "3"}},
+		"sort":             {Query: "?sort=-id", WantJobIDs: []string{"3", "2", "1"}},
+		"page":             {Query: "?limit=2", WantJobIDs: []string{"1", "2"}, WantNextCursor: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cs := newTestCloudScheduler(t)
+			cs.APIServer.ConfigureAPIs(nil)
+			for i := 0; i < 3; i++ {
+				cs.GoalManager.AddJob(datatype.NewJob("test", "user", ""))
+			}
+			rec := httptest.NewRecorder()
+			cs.APIServer.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/jobs"+test.Query, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Wanted status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+			}
+			var jobIDs []string
+			if test.WantByID {
+				// v1 clients get jobs keyed by job ID
+				var jobs map[string]*datatype.Job
+				if err := json.Unmarshal(rec.Body.Bytes(), &jobs); err != nil {
+					t.Fatal(err)
+				}
+				for jobID, job := range jobs {
+					if job == nil || job.JobID != jobID {
+						t.Fatalf("Wanted job %q keyed by its ID, got %v", jobID, job)
+					}
+					jobIDs = append(jobIDs, jobID)
+				}
+				sort.Strings(jobIDs)
+			} else {
+				var list datatype.JobList
+				if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+					t.Fatal(err)
+				}
+				for _, job := range list.Jobs {
+					jobIDs = append(jobIDs, job.JobID)
+				}
+				if (list.NextCursor != "") != test.WantNextCursor {
+					t.Errorf("Wanted next cursor %t, got %q", test.WantNextCursor, list.NextCursor)
+				}
+			}
+			if !equalStrings(jobIDs, test.WantJobIDs) {
+				t.Errorf("Wanted jobs %v, got %v", test.WantJobIDs, jobIDs)
+			}
+		})
+	}
+}
+
+func TestAPIServerSnapshotRequiresAdminToken(t *testing.T) {
+	tests := map[string]struct {
+		AdminToken    string
+		Authorization string
+		WantStatus    int
+	}{
+		"disabled": {
+			Authorization: "Bearer secret",
+			WantStatus:    http.StatusForbidden,
+		},
+		"notoken": {
+			AdminToken: "secret",
+			WantStatus: http.StatusUnauthorized,
+		},
+		"wrongtoken": {
+			AdminToken:    "secret",
+			Authorization: "Bearer wrong",
+			WantStatus:    http.StatusUnauthorized,
+		},
+		"usertoken": {
+			AdminToken:    "secret",
+			Authorization: "Sage secret",
+			WantStatus:    http.StatusUnauthorized,
+		},
+		"admintoken": {
+			AdminToken:    "secret",
+			Authorization: "Bearer secret",
+			WantStatus:    http.StatusOK,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cs := newTestCloudScheduler(t)
+			cs.APIServer.adminToken = test.AdminToken
+			cs.APIServer.ConfigureAPIs(nil)
+			cs.GoalManager.AddJob(datatype.NewJob("test", "user", ""))
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/system/snapshot?format=json", nil)
+			if test.Authorization != "" {
+				req.Header.Set("Authorization", test.Authorization)
+			}
+			rec := httptest.NewRecorder()
+			cs.APIServer.server.Handler.ServeHTTP(rec, req)
+			if rec.Code != test.WantStatus {
+				t.Fatalf("Wanted status %d, got %d: %s", test.WantStatus, rec.Code, rec.Body.String())
+			}
+			// Jobs are never sent without the admin token
+			if test.WantStatus != http.StatusOK && strings.Contains(rec.Body.String(), `"user"`) {
+				t.Errorf("Snapshot must not include jobs: %s", rec.Body.String())
+			}
+		})
+	}
+}
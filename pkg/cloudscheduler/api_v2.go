@@ -0,0 +1,241 @@
+package cloudscheduler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// openAPIDocument describes the /api/v2 API
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// jobIDPattern excludes ":" so that actions like /jobs/{id}:submit are routed
+const jobIDPattern = "{id:[^/:]+}"
+
+// configureAPIv2 adds routes of the /api/v2 API. Requests and responses
+// are typed with structs in the datatype package and errors are returned
+// as datatype.ErrorResponse with a proper HTTP status code.
+func (api *APIServer) configureAPIv2(r *mux.Router) {
+	r.Handle("/api/v2", http.HandlerFunc(api.handlerV2ServerInfo)).Methods(http.MethodGet)
+	v2 := r.PathPrefix("/api/v2").Subrouter()
+	v2.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(openAPIDocument)
+	}).Methods(http.MethodGet)
+	v2.Handle("/jobs", http.HandlerFunc(api.handlerV2ListJobs)).Methods(http.MethodGet)
+	v2.Handle("/jobs", http.HandlerFunc(api.handlerV2CreateJob)).Methods(http.MethodPost)
+	v2.Handle("/jobs/"+jobIDPattern+":submit", http.HandlerFunc(api.handlerV2SubmitJob)).Methods(http.MethodPost)
+	v2.Handle("/jobs/"+jobIDPattern+":suspend", http.HandlerFunc(api.handlerV2SuspendJob)).Methods(http.MethodPost)
+	v2.Handle("/jobs/"+jobIDPattern, http.HandlerFunc(api.handlerV2GetJob)).Methods(http.MethodGet)
+	v2.Handle("/jobs/"+jobIDPattern, http.HandlerFunc(api.handlerV2ReplaceJob)).Methods(http.MethodPut)
+	v2.Handle("/jobs/"+jobIDPattern, http.HandlerFunc(api.handlerV2RemoveJob)).Methods(http.MethodDelete)
+	v2.Handle("/jobs/"+jobIDPattern+"/nodes", http.HandlerFunc(api.handlerV2JobNodes)).Methods(http.MethodPost, http.MethodDelete)
+}
+
+func (api *APIServer) handlerV2ServerInfo(w http.ResponseWriter, r *http.Request) {
+	respondTyped(w, http.StatusOK, &datatype.ServerInfo{
+		ID:      fmt.Sprintf("Cloud Scheduler (%s)", api.cloudScheduler.Name),
+		Version: api.version,
+	})
+}
+
+func (api *APIServer) handlerV2ListJobs(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseJobQuery(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobs, nextCursor, err := api.cloudScheduler.GoalManager.QueryJobs(q)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []*datatype.Job{}
+	}
+	respondTyped(w, http.StatusOK, &datatype.JobList{
+		Jobs:       jobs,
+		NextCursor: nextCursor,
+	})
+}
+
+func (api *APIServer) handlerV2CreateJob(w http.ResponseWriter, r *http.Request) {
+	job, err := decodeJob(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	api.cloudScheduler.GoalManager.AddJob(job)
+	respondTyped(w, http.StatusCreated, job)
+}
+
+func (api *APIServer) handlerV2GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := api.cloudScheduler.GoalManager.GetJob(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	respondTyped(w, http.StatusOK, job)
+}
+
+func (api *APIServer) handlerV2ReplaceJob(w http.ResponseWriter, r *http.Request) {
+	dryrun, err := parseBoolQuery(r, "dryrun")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	oldJob, err := api.cloudScheduler.GoalManager.GetJob(mux.Vars(r)["id"])
+	if err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	updatedJob, err := decodeJob(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	result, errorList := api.cloudScheduler.EditJob(oldJob, updatedJob, dryrun)
+	if len(errorList) > 0 {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("%v", errorList))
+		return
+	}
+	respondTyped(w, http.StatusOK, result)
+}
+
+func (api *APIServer) handlerV2RemoveJob(w http.ResponseWriter, r *http.Request) {
+	force, err := parseBoolQuery(r, "force")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobID := mux.Vars(r)["id"]
+	if _, err := api.cloudScheduler.GoalManager.GetJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.RemoveJob(jobID, force); err != nil {
+		respondError(w, http.StatusConflict, err)
+		return
+	}
+	api.handlerV2GetJob(w, r)
+}
+
+func (api *APIServer) handlerV2SubmitJob(w http.ResponseWriter, r *http.Request) {
+	dryrun, err := parseBoolQuery(r, "dryrun")
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	jobID := mux.Vars(r)["id"]
+	if _, err := api.cloudScheduler.GoalManager.GetJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	report, errorList := api.cloudScheduler.ValidateJobAndCreateScienceGoal(jobID, dryrun)
+	if len(errorList) > 0 {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("%v", errorList))
+		return
+	}
+	job, err := api.cloudScheduler.GoalManager.GetJob(jobID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondTyped(w, http.StatusOK, &datatype.JobSubmitResult{
+		Job:    job,
+		DryRun: dryrun,
+		Report: report,
+	})
+}
+
+func (api *APIServer) handlerV2SuspendJob(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	if _, err := api.cloudScheduler.GoalManager.GetJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	if err := api.cloudScheduler.GoalManager.SuspendJob(jobID); err != nil {
+		respondError(w, http.StatusConflict, err)
+		return
+	}
+	api.handlerV2GetJob(w, r)
+}
+
+func (api *APIServer) handlerV2JobNodes(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	var selection datatype.NodeSelection
+	if err := json.NewDecoder(r.Body).Decode(&selection); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(selection.Nodes) < 1 && len(selection.NodeTags) < 1 {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("nodes or node_tags is required"))
+		return
+	}
+	if _, err := api.cloudScheduler.GoalManager.GetJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, err)
+		return
+	}
+	result := &datatype.JobNodesResult{
+		JobID: jobID,
+	}
+	var errorList []error
+	switch r.Method {
+	case http.MethodPost:
+		result.Nodes, result.Report, errorList = api.cloudScheduler.AddNodesToJob(jobID, selection.Nodes, selection.NodeTags)
+	case http.MethodDelete:
+		result.Nodes, errorList = api.cloudScheduler.DropNodesFromJob(jobID, selection.Nodes, selection.NodeTags)
+	}
+	if len(errorList) > 0 {
+		respondError(w, http.StatusBadRequest, fmt.Errorf("%v", errorList))
+		return
+	}
+	respondTyped(w, http.StatusOK, result)
+}
+
+// decodeJob decodes a job from the JSON body of the request.
+// Fields managed by the scheduler are cleared.
+func decodeJob(r *http.Request) (*datatype.Job, error) {
+	job := datatype.NewJob("", "", "")
+	if err := json.NewDecoder(r.Body).Decode(job); err != nil {
+		return nil, fmt.Errorf("Failed to parse job: %s", err.Error())
+	}
+	job.JobID = ""
+	job.ScienceGoal = nil
+	job.Status = ""
+	return job, nil
+}
+
+func parseBoolQuery(r *http.Request, key string) (bool, error) {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s %q", key, v)
+	}
+	return b, nil
+}
+
+func respondTyped(w http.ResponseWriter, status int, v interface{}) {
+	blob, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondJSON(w, status, blob)
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	blob, _ := json.Marshal(&datatype.ErrorResponse{Error: err.Error()})
+	respondJSON(w, status, blob)
+}
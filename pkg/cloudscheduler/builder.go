@@ -1,6 +1,8 @@
 package cloudscheduler
 
 import (
+	"time"
+
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
 )
@@ -13,11 +15,45 @@ type CloudSchedulerConfig struct {
 	RabbitmqUsername   string `json:"rabbitmq_username" yaml:"rabbitMQUsername"`
 	RabbitmqPassword   string `json:"rabbitmq_password" yaml:"rabbitMQPassword"`
 	RabbitmqCaCertPath string `json:"rabbitmq_cacert_path" yaml:"rabbitMQCacertPath"`
-	ECRURI             string `json:"ecr_uri" yaml:"ecrURI"`
-	Port               int    `json:"port" yaml:"port"`
-	DataDir            string `json:"data_dir,omitempty" yaml:"dataDir,omitempty"`
-	PushNotification   bool   `json:"push_notification" yaml:"PushNotification"`
-	AuthServerURL      string `json:"auth_server_url" yaml:"authServerURL"`
+	RabbitmqCertPath   string `json:"rabbitmq_cert_path" yaml:"rabbitMQCertPath"`
+	RabbitmqKeyPath    string `json:"rabbitmq_key_path" yaml:"rabbitMQKeyPath"`
+	RabbitmqServerName string `json:"rabbitmq_server_name" yaml:"rabbitMQServerName"`
+	// RabbitmqAuthExternal authenticates with the client certificate instead of the username
+	RabbitmqAuthExternal bool `json:"rabbitmq_auth_external" yaml:"rabbitMQAuthExternal"`
+	// EventBus is either "rabbitmq" or "mqtt". Events are not received from nodes if NoRabbitMQ is set
+	EventBus          string   `json:"event_bus" yaml:"eventBus"`
+	MQTTBrokerURI     string   `json:"mqtt_broker_uri" yaml:"mqttBrokerURI"`
+	MQTTUsername      string   `json:"mqtt_username" yaml:"mqttUsername"`
+	MQTTPassword      string   `json:"mqtt_password" yaml:"mqttPassword"`
+	MQTTCaCertPath    string   `json:"mqtt_cacert_path" yaml:"mqttCacertPath"`
+	MQTTCertPath      string   `json:"mqtt_cert_path" yaml:"mqttCertPath"`
+	MQTTKeyPath       string   `json:"mqtt_key_path" yaml:"mqttKeyPath"`
+	MQTTTopicPrefix   string   `json:"mqtt_topic_prefix" yaml:"mqttTopicPrefix"`
+	ECRURI            string   `json:"ecr_uri" yaml:"ecrURI"`
+	Port              int      `json:"port" yaml:"port"`
+	DataDir           string   `json:"data_dir,omitempty" yaml:"dataDir,omitempty"`
+	PushNotification  bool     `json:"push_notification" yaml:"PushNotification"`
+	AuthServerURL     string   `json:"auth_server_url" yaml:"authServerURL"`
+	QuotaFilePath     string   `json:"quota_file_path" yaml:"quotaFilePath"`
+	ExclusiveHardware []string `json:"exclusive_hardware" yaml:"exclusiveHardware"`
+	// ExpectedPluginRuntime is in seconds
+	ExpectedPluginRuntime  int  `json:"expected_plugin_runtime" yaml:"expectedPluginRuntime"`
+	RejectOversubscription bool `json:"reject_oversubscription" yaml:"rejectOversubscription"`
+	// TLSPort enables the TLS listener if not zero. Nodes presenting a client certificate
+	// signed by the client CA can only access their own goals over the listener
+	TLSPort              int    `json:"tls_port" yaml:"tlsPort"`
+	TLSCertPath          string `json:"tls_cert_path" yaml:"tlsCertPath"`
+	TLSKeyPath           string `json:"tls_key_path" yaml:"tlsKeyPath"`
+	TLSClientCACertPath  string `json:"tls_client_cacert_path" yaml:"tlsClientCacertPath"`
+	NodeIdentityFilePath string `json:"node_identity_file_path" yaml:"nodeIdentityFilePath"`
+	// GoalsOverTLSOnly refuses goal requests that do not come over the TLS listener.
+	// Configure fails if it is set without TLSPort
+	GoalsOverTLSOnly bool `json:"goals_over_tls_only" yaml:"goalsOverTLSOnly"`
+	// GoalSigningKeyPath is the ed25519 private key signing goals of each node
+	GoalSigningKeyPath string `json:"goal_signing_key_path" yaml:"goalSigningKeyPath"`
+	// AdminToken authorizes admin APIs such as the job database snapshot.
+	// The admin APIs are disabled if not set
+	AdminToken string `json:"admin_token" yaml:"adminToken"`
 }
 
 type CloudSchedulerBuilder struct {
@@ -31,6 +67,10 @@ func NewCloudSchedulerBuilder(config *CloudSchedulerConfig) *CloudSchedulerBuild
 			Version:             config.Version,
 			Config:              config,
 			Validator:           NewJobValidator(config.DataDir),
+			QuotaManager:        NewQuotaManager(config.QuotaFilePath),
+			ConflictChecker:     NewConflictChecker(config.ExclusiveHardware),
+			CapacityPlanner:     NewCapacityPlanner(time.Duration(config.ExpectedPluginRuntime) * time.Second),
+			Metrics:             NewMetrics(),
 			chanFromGoalManager: make(chan datatype.Event, maxChannelBuffer),
 		},
 	}
@@ -41,8 +81,12 @@ func (csb *CloudSchedulerBuilder) AddGoalManager() *CloudSchedulerBuilder {
 		scienceGoals: make(map[string]*datatype.ScienceGoal),
 		Notifier:     interfacing.NewNotifier(),
 		dataPath:     csb.cloudScheduler.Config.DataDir,
+		jobIndex:     NewJobIndex(),
+		metrics:      csb.cloudScheduler.Metrics,
 	}
-	csb.cloudScheduler.GoalManager.Notifier.Subscribe(csb.cloudScheduler.chanFromGoalManager)
+	csb.cloudScheduler.GoalManager.Notifier.SubscribeWithOptions(csb.cloudScheduler.chanFromGoalManager, interfacing.SubscriptionOptions{
+		Name: "scheduler",
+	})
 	return csb
 }
 
@@ -54,6 +98,10 @@ func (csb *CloudSchedulerBuilder) AddAPIServer() *CloudSchedulerBuilder {
 		enablePushNotification: csb.cloudScheduler.Config.PushNotification,
 		subscribers:            make(map[string]map[chan *datatype.Event]bool),
 		authenticator:          NewAuthenticator(csb.cloudScheduler.Config.AuthServerURL),
+		nodeIdentities:         NewNodeIdentityMapper(),
+		goalsOverTLSOnly:       csb.cloudScheduler.Config.GoalsOverTLSOnly,
+		adminToken:             csb.cloudScheduler.Config.AdminToken,
+		closing:                make(chan struct{}),
 	}
 	return csb
 }
@@ -0,0 +1,218 @@
+package cloudscheduler
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+const defaultPluginRuntime = 60 * time.Second
+
+// dutyCycleYear is the year duty cycles of cronjobs are counted over
+const dutyCycleYear = 2023
+
+var cronjobPattern = regexp.MustCompile(`cronjob\(\s*["'][^"']*["']\s*,\s*["']([^"']*)["']\s*\)`)
+
+// CapacityPlanner projects load on node devices from plugins of active science goals
+type CapacityPlanner struct {
+	pluginRuntime time.Duration
+}
+
+// NewCapacityPlanner returns a capacity planner. pluginRuntime is the expected time
+// a plugin runs each time it is scheduled by a cronjob. The default is used if not positive.
+func NewCapacityPlanner(pluginRuntime time.Duration) *CapacityPlanner {
+	if pluginRuntime <= 0 {
+		pluginRuntime = defaultPluginRuntime
+	}
+	return &CapacityPlanner{
+		pluginRuntime: pluginRuntime,
+	}
+}
+
+// Project places plugins of the sub goal and of other active science goals on the node
+// onto devices of the node and returns the projected load of each device.
+// Goals of the job itself in activeGoals are ignored as the sub goal replaces them.
+//
+// A plugin is placed on the device of the supported architecture that is least utilized
+// after placing the plugin. The first profile of the plugin that fits the device is used.
+// Plugins without a manifest or without a device to fit are listed as unplaced.
+func (cp *CapacityPlanner) Project(nodeManifest *datatype.NodeManifest, jobID string, subGoal *datatype.SubGoal, activeGoals []*datatype.ScienceGoal, getManifest func(*datatype.Plugin) *datatype.PluginManifest) *datatype.NodeCapacityProjection {
+	projection := &datatype.NodeCapacityProjection{
+		Node: nodeManifest.Name,
+	}
+	for _, device := range nodeManifest.Devices {
+		projection.Devices = append(projection.Devices, &datatype.DeviceLoad{
+			Device:   device.Name,
+			Capacity: device.Resource,
+		})
+	}
+	// Goals are placed in the order of their job IDs to get the same projection every time.
+	// The goals are sorted in a copy as the caller owns activeGoals
+	goals := append([]*datatype.ScienceGoal{}, activeGoals...)
+	sort.Slice(goals, func(i, j int) bool {
+		return goals[i].JobID < goals[j].JobID
+	})
+	seen := make(map[string]bool)
+	for _, goal := range goals {
+		if goal.JobID == jobID || seen[goal.ID] {
+			continue
+		}
+		seen[goal.ID] = true
+		if otherSubGoal := goal.GetMySubGoal(nodeManifest.Name); otherSubGoal != nil {
+			cp.place(projection, nodeManifest, goal.JobID, otherSubGoal, getManifest)
+		}
+	}
+	cp.place(projection, nodeManifest, jobID, subGoal, getManifest)
+	return projection
+}
+
+func (cp *CapacityPlanner) place(projection *datatype.NodeCapacityProjection, nodeManifest *datatype.NodeManifest, jobID string, subGoal *datatype.SubGoal, getManifest func(*datatype.Plugin) *datatype.PluginManifest) {
+	for _, plugin := range subGoal.Plugins {
+		label := fmt.Sprintf("%s/%s", jobID, plugin.Name)
+		dutyCycle := cp.EstimateDutyCycle(plugin.Name, subGoal.ScienceRules)
+		if dutyCycle <= 0 {
+			continue
+		}
+		pluginManifest := getManifest(plugin)
+		if pluginManifest == nil {
+			projection.Unplaced = append(projection.Unplaced, label)
+			continue
+		}
+		var (
+			target  *datatype.DeviceLoad
+			require datatype.Resource
+			lowest  = math.Inf(1)
+		)
+		for i, device := range nodeManifest.Devices {
+			if !supportsArchitecture(device, pluginManifest) {
+				continue
+			}
+			profileRequire, fits := firstFittingProfile(device, pluginManifest)
+			if !fits {
+				continue
+			}
+			load := projection.Devices[i]
+			cpu, memory, gpuMemory := requirement(&profileRequire)
+			if u := load.Utilization(
+				load.ExpectedCPU+cpu*dutyCycle,
+				load.ExpectedMemory+memory*dutyCycle,
+				load.ExpectedGPUMemory+gpuMemory*dutyCycle); u < lowest {
+				lowest = u
+				target = load
+				require = profileRequire
+			}
+		}
+		if target == nil {
+			projection.Unplaced = append(projection.Unplaced, label)
+			continue
+		}
+		cpu, memory, gpuMemory := requirement(&require)
+		target.ExpectedCPU += cpu * dutyCycle
+		target.ExpectedMemory += memory * dutyCycle
+		target.ExpectedGPUMemory += gpuMemory * dutyCycle
+		target.PeakCPU += int(cpu)
+		target.PeakMemory += int(memory)
+		target.PeakGPUMemory += int(gpuMemory)
+		target.Plugins = append(target.Plugins, label)
+	}
+}
+
+// EstimateDutyCycle returns the expected fraction of time the plugin runs
+// according to the science rules. A plugin without a rule never runs.
+// A rule that has a cronjob runs the plugin at most as often as the cronjob
+// on average over a year, so that a cronjob running only on some days, weekdays
+// or months counts less. Any other rule is assumed to keep the plugin running.
+func (cp *CapacityPlanner) EstimateDutyCycle(pluginName string, scienceRules []string) (dutyCycle float64) {
+	for _, rule := range scienceRules {
+		sp := strings.SplitN(rule, ":", 2)
+		if len(sp) != 2 || strings.TrimSpace(sp[0]) != pluginName {
+			continue
+		}
+		dutyCycle = math.Max(dutyCycle, cp.estimateRuleDutyCycle(sp[1]))
+	}
+	return
+}
+
+func (cp *CapacityPlanner) estimateRuleDutyCycle(condition string) float64 {
+	matches := cronjobPattern.FindAllStringSubmatch(condition, -1)
+	if len(matches) < 1 {
+		return 1.
+	}
+	dutyCycle := 0.
+	for _, match := range matches {
+		d, err := cp.cronjobDutyCycle(match[1])
+		if err != nil {
+			return 1.
+		}
+		dutyCycle = math.Max(dutyCycle, d)
+	}
+	return dutyCycle
+}
+
+// cronjobDutyCycle returns the fraction of time the cron schedule keeps a plugin running
+// over a year. Schedules running on some days of month, months or days of week count less
+func (cp *CapacityPlanner) cronjobDutyCycle(expression string) (float64, error) {
+	schedule, err := sciencerule.ParseCronSchedule(expression)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Date(dutyCycleYear, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(1, 0, 0)
+	period := end.Sub(start)
+	var running time.Duration
+	for t := schedule.Next(start.Add(-time.Minute)); !t.IsZero() && t.Before(end); t = schedule.Next(t) {
+		running += cp.pluginRuntime
+		if running >= period {
+			return 1., nil
+		}
+	}
+	return running.Seconds() / period.Seconds(), nil
+}
+
+func supportsArchitecture(device datatype.Device, pluginManifest *datatype.PluginManifest) bool {
+	for _, arch := range pluginManifest.Architecture {
+		if arch == device.Architecture {
+			return true
+		}
+	}
+	return false
+}
+
+// firstFittingProfile returns the resource required by the first profile of the plugin
+// that fits the device. A plugin without profiles requires nothing.
+func firstFittingProfile(device datatype.Device, pluginManifest *datatype.PluginManifest) (datatype.Resource, bool) {
+	if len(pluginManifest.Profile) < 1 {
+		return datatype.Resource{}, true
+	}
+	for _, profile := range pluginManifest.Profile {
+		if device.Resource.CanAccommodate(&profile.Require) {
+			return profile.Require, true
+		}
+	}
+	return datatype.Resource{}, false
+}
+
+// fittingProfiles returns profiles of the plugin that fit any of the devices in order
+func fittingProfiles(devices []datatype.Device, pluginManifest *datatype.PluginManifest) (profiles []datatype.Profile) {
+	for _, profile := range pluginManifest.Profile {
+		for _, device := range devices {
+			if device.Resource.CanAccommodate(&profile.Require) {
+				profiles = append(profiles, profile)
+				break
+			}
+		}
+	}
+	return
+}
+
+// requirement returns CPU, memory, and GPU memory of the resource.
+// Resources that are not given count as zero.
+func requirement(r *datatype.Resource) (cpu float64, memory float64, gpuMemory float64) {
+	return math.Max(float64(r.CPUInMilli()), 0), math.Max(float64(r.MemoryInMega()), 0), math.Max(float64(r.GPUMemoryInMega()), 0)
+}
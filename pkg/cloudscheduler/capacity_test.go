@@ -0,0 +1,142 @@
+package cloudscheduler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestCapacityPlannerEstimateDutyCycle(t *testing.T) {
+	cp := NewCapacityPlanner(60 * time.Second)
+	tests := map[string]struct {
+		Rules []string
+		Want  float64
+	}{
+		"norule": {
+			Rules: []string{"other-app: True"},
+			Want:  0.,
+		},
+		"always": {
+			Rules: []string{"myapp: True"},
+			Want:  1.,
+		},
+		"every10minutes": {
+			Rules: []string{"myapp: cronjob('myapp', '*/10 * * * *')"},
+			Want:  144. * 60. / 86400.,
+		},
+		"everyminute": {
+			Rules: []string{"myapp: cronjob('myapp', '* * * * *')"},
+			Want:  1.,
+		},
+		"conditionalcronjob": {
+			Rules: []string{"myapp: v('env.raingauge.uint') > 3 and cronjob('myapp', '0 0-11 * * *')"},
+			Want:  12. * 60. / 86400.,
+		},
+		"daysofmonth": {
+			// 7 months have the 31st
+			Rules: []string{"myapp: cronjob('myapp', '0 0 31 * *')"},
+			Want:  7. * 60. / (365. * 86400.),
+		},
+		"month": {
+			Rules: []string{"myapp: cronjob('myapp', '0 0 * jan *')"},
+			Want:  31. * 60. / (365. * 86400.),
+		},
+		"weekday": {
+			// 2023 has 53 Sundays
+			Rules: []string{"myapp: cronjob('myapp', '0 12 * * sun')"},
+			Want:  53. * 60. / (365. * 86400.),
+		},
+		"never": {
+			Rules: []string{"myapp: cronjob('myapp', '0 0 30 feb *')"},
+			Want:  0.,
+		},
+		"invalidcronjob": {
+			Rules: []string{"myapp: cronjob('myapp', '@hourly')"},
+			Want:  1.,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := cp.EstimateDutyCycle("myapp", tc.Rules); got != tc.Want {
+				t.Errorf("Duty cycle mismatch: wanted %f, got %f", tc.Want, got)
+			}
+		})
+	}
+}
+
+func TestCapacityPlannerProject(t *testing.T) {
+	node := &datatype.NodeManifest{
+		Name: "W001",
+		Devices: []datatype.Device{
+			{Name: "nxcore", Architecture: "arm64", Resource: datatype.Resource{CPU: "4", Memory: "8Gi"}},
+		},
+	}
+	manifests := map[string]*datatype.PluginManifest{
+		"small:0.1.0": {Architecture: []string{"arm64"}, Profile: []datatype.Profile{
+			{Name: "default", Require: datatype.Resource{CPU: "1", Memory: "1Gi"}},
+		}},
+		"large:0.1.0": {Architecture: []string{"arm64"}, Profile: []datatype.Profile{
+			{Name: "default", Require: datatype.Resource{CPU: "3", Memory: "6Gi"}},
+		}},
+	}
+	getManifest := func(plugin *datatype.Plugin) *datatype.PluginManifest {
+		return manifests[plugin.PluginSpec.Image]
+	}
+	newGoal := func(jobID string, image string, rule string) *datatype.ScienceGoal {
+		plugin := &datatype.Plugin{Name: "app-" + jobID, PluginSpec: &datatype.PluginSpec{Image: image}}
+		return datatype.NewScienceGoalBuilder("test", jobID).
+			AddSubGoal("W001", []*datatype.Plugin{plugin}, []string{"app-" + jobID + ": " + rule}).Build()
+	}
+	tests := map[string]struct {
+		New                *datatype.ScienceGoal
+		Active             []*datatype.ScienceGoal
+		WantOversubscribed bool
+		WantOvercommitted  bool
+		WantUnplaced       []string
+	}{
+		"fits": {
+			New:    newGoal("1", "small:0.1.0", "True"),
+			Active: []*datatype.ScienceGoal{newGoal("2", "large:0.1.0", "True")},
+		},
+		"oversubscribed": {
+			New:                newGoal("1", "large:0.1.0", "True"),
+			Active:             []*datatype.ScienceGoal{newGoal("2", "large:0.1.0", "True")},
+			WantOversubscribed: true,
+		},
+		"overcommitted": {
+			New:               newGoal("1", "large:0.1.0", "cronjob('app-1', '0 * * * *')"),
+			Active:            []*datatype.ScienceGoal{newGoal("2", "large:0.1.0", "cronjob('app-2', '30 * * * *')")},
+			WantOvercommitted: true,
+		},
+		"unordered": {
+			New:    newGoal("1", "small:0.1.0", "True"),
+			Active: []*datatype.ScienceGoal{newGoal("3", "small:0.1.0", "True"), newGoal("2", "small:0.1.0", "True")},
+		},
+		"unknownplugin": {
+			New:          newGoal("1", "unknown:0.1.0", "True"),
+			WantUnplaced: []string{"1/app-1"},
+		},
+	}
+	cp := NewCapacityPlanner(60 * time.Second)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var active []*datatype.ScienceGoal
+			active = append(active, tc.Active...)
+			projection := cp.Project(node, "1", tc.New.GetMySubGoal("W001"), tc.Active, getManifest)
+			if !reflect.DeepEqual(tc.Active, active) {
+				t.Errorf("Active goals of the caller must not be reordered")
+			}
+			if got := len(projection.Oversubscribed()) > 0; got != tc.WantOversubscribed {
+				t.Errorf("Oversubscription mismatch: wanted %t, got %t", tc.WantOversubscribed, got)
+			}
+			if got := len(projection.Overcommitted()) > 0; got != tc.WantOvercommitted {
+				t.Errorf("Overcommitment mismatch: wanted %t, got %t", tc.WantOvercommitted, got)
+			}
+			if !reflect.DeepEqual(projection.Unplaced, tc.WantUnplaced) {
+				t.Errorf("Unplaced mismatch: wanted %v, got %v", tc.WantUnplaced, projection.Unplaced)
+			}
+		})
+	}
+}
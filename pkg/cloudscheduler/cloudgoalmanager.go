@@ -3,10 +3,8 @@ package cloudscheduler
 import (
 	"encoding/json"
 	"fmt"
-	"path"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/boltdb/bolt"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
@@ -22,11 +20,14 @@ type CloudGoalManager struct {
 	mu           sync.Mutex
 	dataPath     string
 	jobDB        *bolt.DB
+	jobIndex     *JobIndex
+	metrics      *Metrics
 }
 
 func (cgm *CloudGoalManager) AddJob(job *datatype.Job) string {
 	job.UpdateStatus(datatype.JobCreated)
-	cgm.jobDB.Update(func(tx *bolt.Tx) error {
+	job.CreatedAt = job.LastUpdated
+	err := cgm.jobDB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(jobBucketName))
 		if b == nil {
 			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
@@ -40,6 +41,9 @@ func (cgm *CloudGoalManager) AddJob(job *datatype.Job) string {
 		b.Put([]byte(job.JobID), []byte(buf))
 		return nil
 	})
+	if err == nil {
+		cgm.indexJob(job)
+	}
 	return job.JobID
 }
 
@@ -81,6 +85,34 @@ func (cgm *CloudGoalManager) GetJob(jobID string) (job *datatype.Job, err error)
 	return
 }
 
+// QueryJobs returns jobs matched with the query using the job index.
+// nextCursor is set if there are more jobs to query.
+func (cgm *CloudGoalManager) QueryJobs(q *JobQuery) (jobs []*datatype.Job, nextCursor string, err error) {
+	jobIDs, nextCursor, err := cgm.jobIndex.Query(q)
+	if err != nil {
+		return nil, "", err
+	}
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		for _, jobID := range jobIDs {
+			v := b.Get([]byte(jobID))
+			if v == nil {
+				continue
+			}
+			var j datatype.Job
+			if err := json.Unmarshal(v, &j); err != nil {
+				return err
+			}
+			jobs = append(jobs, &j)
+		}
+		return nil
+	})
+	return
+}
+
 func (cgm *CloudGoalManager) UpdateJob(job *datatype.Job, submit bool) (err error) {
 	// update the status before puting the job to the database
 	if submit {
@@ -101,6 +133,7 @@ func (cgm *CloudGoalManager) UpdateJob(job *datatype.Job, submit bool) (err erro
 	if err != nil {
 		return
 	}
+	cgm.indexJob(job)
 	// send an event for scheduling the science goal
 	if submit {
 		newScienceGoal := job.ScienceGoal
@@ -111,8 +144,56 @@ func (cgm *CloudGoalManager) UpdateJob(job *datatype.Job, submit bool) (err erro
 	return
 }
 
+// ReplaceScienceGoal stores the job and replaces its running science goal with job.ScienceGoal.
+// It returns nodes whose sub goal changed and nodes that no longer have a sub goal.
+// The nodes are notified via EventGoalStatusUpdated so that only those nodes get the new goal.
+// The goal manager is locked from reading the running goal to storing the new one
+// so that the returned nodes are computed against the goal being replaced.
+func (cgm *CloudGoalManager) ReplaceScienceGoal(job *datatype.Job) (changed []string, removed []string, err error) {
+	newScienceGoal := job.ScienceGoal
+	if newScienceGoal == nil {
+		return nil, nil, fmt.Errorf("Job %q does not have a science goal", job.JobID)
+	}
+	cgm.mu.Lock()
+	oldScienceGoal, exist := cgm.scienceGoals[newScienceGoal.ID]
+	if !exist {
+		cgm.mu.Unlock()
+		return nil, nil, fmt.Errorf("Failed to find goal %q", newScienceGoal.ID)
+	}
+	changed, removed = oldScienceGoal.DiffSubGoals(newScienceGoal)
+	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobBucketName))
+		if b == nil {
+			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
+		}
+		buf, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(job.JobID), []byte(buf))
+	})
+	if err != nil {
+		cgm.mu.Unlock()
+		return nil, nil, err
+	}
+	cgm.indexJob(job)
+	cgm.scienceGoals[newScienceGoal.ID] = newScienceGoal
+	cgm.mu.Unlock()
+	nodesToUpdate := append(append([]string{}, changed...), removed...)
+	if len(nodesToUpdate) > 0 {
+		event := datatype.NewEventBuilder(datatype.EventGoalStatusUpdated).
+			AddJob(job).
+			AddGoal(newScienceGoal).
+			AddEntry("nodes", strings.Join(nodesToUpdate, ",")).
+			Build()
+		cgm.Notifier.Notify(event)
+	}
+	return
+}
+
 func (cgm *CloudGoalManager) UpdateJobStatus(jobID string, status datatype.JobStatus) (err error) {
-	return cgm.jobDB.Update(func(tx *bolt.Tx) error {
+	var j datatype.Job
+	err = cgm.jobDB.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(jobBucketName))
 		if b == nil {
 			return fmt.Errorf("Bucket %s does not exist", jobBucketName)
@@ -121,7 +202,6 @@ func (cgm *CloudGoalManager) UpdateJobStatus(jobID string, status datatype.JobSt
 		if v == nil {
 			return fmt.Errorf("Job ID %q does not exist", jobID)
 		}
-		var j datatype.Job
 		if err := json.Unmarshal(v, &j); err != nil {
 			return err
 		}
@@ -133,6 +213,10 @@ func (cgm *CloudGoalManager) UpdateJobStatus(jobID string, status datatype.JobSt
 		b.Put([]byte(jobID), []byte(buf))
 		return nil
 	})
+	if err == nil {
+		cgm.indexJob(&j)
+	}
+	return
 }
 
 func (cgm *CloudGoalManager) SuspendJob(jobID string) (err error) {
@@ -159,6 +243,7 @@ func (cgm *CloudGoalManager) SuspendJob(jobID string) (err error) {
 	if err != nil {
 		return
 	}
+	cgm.indexJob(&job)
 	event := datatype.NewEventBuilder(datatype.EventJobStatusSuspended).
 		AddJob(&job).
 		AddReason("Suspended by user").Build()
@@ -193,6 +278,7 @@ func (cgm *CloudGoalManager) RemoveJob(jobID string, force bool) (err error) {
 	if err != nil {
 		return
 	}
+	cgm.indexJob(&job)
 	event := datatype.NewEventBuilder(datatype.EventJobStatusRemoved).
 		AddJob(&job).
 		Build()
@@ -247,6 +333,8 @@ func (cgm *CloudGoalManager) GetScienceGoal(goalID string) (*datatype.ScienceGoa
 
 // GetScienceGoalsForNode returns a list of goals associated to given node.
 func (cgm *CloudGoalManager) GetScienceGoalsForNode(nodeName string) (goals []*datatype.ScienceGoal) {
+	cgm.mu.Lock()
+	defer cgm.mu.Unlock()
 	for _, scienceGoal := range cgm.scienceGoals {
 		for _, subGoal := range scienceGoal.SubGoals {
 			if strings.ToLower(subGoal.Name) == strings.ToLower(nodeName) {
@@ -257,19 +345,32 @@ func (cgm *CloudGoalManager) GetScienceGoalsForNode(nodeName string) (goals []*d
 	return
 }
 
+// OpenJobDB opens the job database and migrates it to the latest schema version
 func (cgm *CloudGoalManager) OpenJobDB() error {
-	db, err := bolt.Open(path.Join(cgm.dataPath, "job.db"), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	db, err := openJobDBFile(cgm.dataPath, false)
 	if err != nil {
 		return err
 	}
-	cgm.jobDB = db
-	cgm.jobDB.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(jobBucketName))
+	if err := migrateJobDB(db); err != nil {
+		db.Close()
 		return err
-	})
+	}
+	cgm.jobDB = db
+	// Building the job index is the only full scan of jobs; queries use the index afterwards
+	for _, job := range cgm.GetJobs() {
+		cgm.indexJob(job)
+	}
 	return nil
 }
 
+// CloseJobDB closes the job database. Jobs cannot be read or written afterwards
+func (cgm *CloudGoalManager) CloseJobDB() error {
+	if cgm.jobDB == nil {
+		return nil
+	}
+	return cgm.jobDB.Close()
+}
+
 func (cgm *CloudGoalManager) LoadScienceGoalsFromJobDB() error {
 	cgm.jobDB.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(jobBucketName))
@@ -290,3 +391,11 @@ func (cgm *CloudGoalManager) LoadScienceGoalsFromJobDB() error {
 	})
 	return nil
 }
+
+// indexJob puts the job in the job index and updates job counts in metrics
+func (cgm *CloudGoalManager) indexJob(job *datatype.Job) {
+	previous, existed := cgm.jobIndex.Put(job)
+	if cgm.metrics != nil {
+		cgm.metrics.JobStatusChanged(previous, existed, job.Status)
+	}
+}
@@ -1,8 +1,12 @@
 package cloudscheduler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -11,7 +15,11 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
-const maxChannelBuffer = 100
+const (
+	maxChannelBuffer = 100
+	// gracefulShutdownTimeout is shorter than the default grace period of Kubernetes pods
+	gracefulShutdownTimeout = 20 * time.Second
+)
 
 // CloudScheduler structs the cloud scheduler
 type CloudScheduler struct {
@@ -20,13 +28,21 @@ type CloudScheduler struct {
 	Config              *CloudSchedulerConfig
 	GoalManager         *CloudGoalManager
 	Validator           *JobValidator
+	QuotaManager        *QuotaManager
+	ConflictChecker     *ConflictChecker
+	CapacityPlanner     *CapacityPlanner
 	APIServer           *APIServer
 	chanFromGoalManager chan datatype.Event
-	MetricsCollector    *prometheus.Collector
-	eventListener       *interfacing.RabbitMQHandler
+	Metrics             *Metrics
+	eventListener       interfacing.EventBus
+	// editMu serializes edits of jobs so that each edit builds on the latest science goal
+	editMu sync.Mutex
 }
 
 func (cs *CloudScheduler) Configure() error {
+	if cs.Config.GoalsOverTLSOnly && cs.Config.TLSPort <= 0 {
+		return fmt.Errorf("Goals over TLS only requires the TLS port")
+	}
 	// Loading job database
 	if err := cs.GoalManager.OpenJobDB(); err != nil {
 		return err
@@ -40,46 +56,425 @@ func (cs *CloudScheduler) Configure() error {
 	if err := cs.Validator.LoadDatabase(); err != nil {
 		return err
 	}
+	// Loading user quotas
+	if err := cs.QuotaManager.Load(); err != nil {
+		return err
+	}
 	// Setting up Prometheus metrics
 	reg := prometheus.NewRegistry()
 	reg.MustRegister(collectors.NewGoCollector())
-	reg.MustRegister(NewMetricsCollector(cs))
+	cs.Metrics.Register(reg)
+	reg.MustRegister(interfacing.NewNotifierCollector(map[string]*interfacing.Notifier{
+		"goalmanager": cs.GoalManager.Notifier,
+	}))
+	if cs.Config.GoalSigningKeyPath != "" {
+		key, err := datatype.LoadGoalSigningKey(cs.Config.GoalSigningKeyPath)
+		if err != nil {
+			return err
+		}
+		cs.APIServer.goalSigningKey = key
+		logger.Info.Printf("Goals are signed with the key %s", cs.Config.GoalSigningKeyPath)
+	}
 	cs.APIServer.ConfigureAPIs(reg)
+	if cs.Config.TLSPort > 0 {
+		if err := cs.APIServer.nodeIdentities.Load(cs.Config.NodeIdentityFilePath); err != nil {
+			return err
+		}
+		if err := cs.APIServer.ConfigureTLS(cs.Config.TLSPort, cs.Config.TLSCertPath, cs.Config.TLSKeyPath, cs.Config.TLSClientCACertPath); err != nil {
+			return err
+		}
+	}
 
-	// Setting up RabbitMQ connection to receive scheduling events from nodes
+	// Setting up the event bus to receive scheduling events from nodes
 	if !cs.Config.NoRabbitMQ {
+		eventListener, err := cs.newEventBus()
+		if err != nil {
+			return err
+		}
+		cs.eventListener = eventListener
+	}
+	return nil
+}
+
+// newEventBus returns the event bus of the configured type
+func (cs *CloudScheduler) newEventBus() (interfacing.EventBus, error) {
+	switch cs.Config.EventBus {
+	case "", "rabbitmq":
 		logger.Info.Printf(
 			"Using RabbitMQ at %s with user %s",
 			cs.Config.RabbitmqURI,
 			cs.Config.RabbitmqUsername,
 		)
-		cs.eventListener = interfacing.NewRabbitMQHandler(
+		rh := interfacing.NewRabbitMQHandler(
 			cs.Config.RabbitmqURI,
 			cs.Config.RabbitmqUsername,
 			cs.Config.RabbitmqPassword,
 			cs.Config.RabbitmqCaCertPath,
 			"",
 		)
+		rh.SetClientCertificate(cs.Config.RabbitmqCertPath, cs.Config.RabbitmqKeyPath)
+		rh.SetExternalAuth(cs.Config.RabbitmqAuthExternal)
+		rh.SetServerName(cs.Config.RabbitmqServerName)
+		return rh, nil
+	case "mqtt":
+		logger.Info.Printf("Using MQTT broker at %s with user %s", cs.Config.MQTTBrokerURI, cs.Config.MQTTUsername)
+		tlsConfig, err := interfacing.NewMQTTTLSConfig(cs.Config.MQTTBrokerURI, cs.Config.MQTTCaCertPath, cs.Config.MQTTCertPath, cs.Config.MQTTKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return interfacing.NewMQTTEventBus(
+			cs.Config.MQTTBrokerURI,
+			cs.Config.MQTTUsername,
+			cs.Config.MQTTPassword,
+			cs.Name,
+			cs.Config.MQTTTopicPrefix,
+			tlsConfig,
+		), nil
+	default:
+		return nil, fmt.Errorf("Unknown event bus %q", cs.Config.EventBus)
 	}
-	return nil
 }
 
-func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(jobID string, dryrun bool) (errorList []error) {
+func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(jobID string, dryrun bool) (report *datatype.ValidationReport, errorList []error) {
 	job, err := cs.GoalManager.GetJob(jobID)
 	if err != nil {
-		return []error{err}
+		return nil, []error{err}
+	}
+	scienceGoal, errorList := cs.validateJob(job, datatype.NewScienceGoalBuilder(job.Name, job.JobID))
+	if len(errorList) > 0 {
+		logger.Info.Printf("Validation failed for Job ID %q: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckManifest)
+		return nil, errorList
+	}
+	job.ScienceGoal = scienceGoal
+	if errorList := cs.checkQuota(job); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q exceeds quota: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckQuota)
+		return nil, errorList
+	}
+	report = &datatype.ValidationReport{}
+	if errorList := cs.checkConflicts(job, report); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q conflicts with other jobs: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckConflict)
+		return nil, errorList
+	}
+	if errorList := cs.checkCapacity(job, report, dryrun); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q oversubscribes nodes: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckCapacity)
+		return nil, errorList
+	}
+	logger.Info.Printf("Updating science goal for JOB ID %q", jobID)
+	if dryrun {
+		cs.GoalManager.UpdateJob(job, false)
+	} else {
+		cs.GoalManager.UpdateJob(job, true)
+	}
+	return report, nil
+}
+
+// ValidateJobAndUpdateScienceGoal validates an edited job whose science goal is
+// already running on nodes. The new science goal keeps the ID of the running goal
+// so that nodes whose sub goal did not change are left untouched.
+// Nothing is changed if the validation fails.
+func (cs *CloudScheduler) ValidateJobAndUpdateScienceGoal(job *datatype.Job, runningGoal *datatype.ScienceGoal, dryrun bool) (changed []string, removed []string, report *datatype.ValidationReport, errorList []error) {
+	scienceGoal, errorList := cs.validateJob(job, datatype.NewScienceGoalBuilderWithID(job.Name, job.JobID, runningGoal.ID))
+	if len(errorList) > 0 {
+		logger.Info.Printf("Validation failed for Job ID %q: %v", job.JobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckManifest)
+		return
+	}
+	job.ScienceGoal = scienceGoal
+	if errorList = cs.checkQuota(job); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q exceeds quota: %v", job.JobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckQuota)
+		return
+	}
+	report = &datatype.ValidationReport{}
+	if errorList = cs.checkConflicts(job, report); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q conflicts with other jobs: %v", job.JobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckConflict)
+		return
+	}
+	if errorList = cs.checkCapacity(job, report, dryrun); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q oversubscribes nodes: %v", job.JobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckCapacity)
+		return
+	}
+	if dryrun {
+		changed, removed = runningGoal.DiffSubGoals(scienceGoal)
+		return
+	}
+	changed, removed, err := cs.GoalManager.ReplaceScienceGoal(job)
+	if err != nil {
+		errorList = append(errorList, err)
+	}
+	return
+}
+
+// EditJob replaces the old job with the updated job.
+// A job that is running on nodes gets its science goal updated in place so that
+// only nodes whose sub goal changes receive the new goal. Any other job becomes
+// a draft and needs to be submitted again. Dry run is supported only for running jobs.
+func (cs *CloudScheduler) EditJob(oldJob *datatype.Job, updatedJob *datatype.Job, dryrun bool) (result *datatype.JobUpdateResult, errorList []error) {
+	cs.editMu.Lock()
+	defer cs.editMu.Unlock()
+	updatedJob.JobID = oldJob.JobID
+	updatedJob.CreatedAt = oldJob.CreatedAt
+	result = &datatype.JobUpdateResult{
+		Job:    updatedJob,
+		DryRun: dryrun,
+	}
+	if runningGoal := cs.getRunningScienceGoal(oldJob); runningGoal != nil {
+		updatedJob.Status = oldJob.Status
+		updatedJob.LastUpdated = oldJob.LastUpdated
+		result.NodesUpdated, result.NodesRemoved, result.Report, errorList = cs.ValidateJobAndUpdateScienceGoal(updatedJob, runningGoal, dryrun)
+		if len(errorList) > 0 {
+			return nil, errorList
+		}
+		return
+	}
+	if dryrun {
+		return nil, []error{fmt.Errorf("dryrun is supported only for submitted or running jobs")}
+	}
+	// Remove science goal of old Job if exists
+	if oldJob.ScienceGoal != nil {
+		cs.GoalManager.RemoveScienceGoal(oldJob.ScienceGoal.ID)
+	}
+	updatedJob.UpdateStatus(datatype.JobDrafted)
+	if err := cs.GoalManager.UpdateJob(updatedJob, false); err != nil {
+		return nil, []error{err}
+	}
+	return
+}
+
+// AddNodesToJob adds nodes selected by names and tags to the job.
+// Each new node is validated on its own. If the job is running, sub goals for
+// the new nodes are added to its science goal and only the new nodes get the goal.
+// Nothing is changed if any of the new nodes fails the validation.
+func (cs *CloudScheduler) AddNodesToJob(jobID string, nodeNames []string, nodeTags []string) (added []string, report *datatype.ValidationReport, errorList []error) {
+	cs.editMu.Lock()
+	defer cs.editMu.Unlock()
+	job, err := cs.GoalManager.GetJob(jobID)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	for _, nodeName := range append(append([]string{}, nodeNames...), cs.Validator.GetNodeNamesByTags(nodeTags)...) {
+		if _, exist := job.Nodes[nodeName]; exist {
+			continue
+		}
+		job.AddNodes([]string{nodeName})
+		added = append(added, nodeName)
+	}
+	if len(added) < 1 {
+		return nil, nil, []error{fmt.Errorf("No new node is selected for job %q", jobID)}
+	}
+	runningGoal := cs.getRunningScienceGoal(job)
+	if runningGoal == nil {
+		// The job is not running. The new nodes will be validated when it is submitted
+		if err := cs.GoalManager.UpdateJob(job, false); err != nil {
+			return nil, nil, []error{err}
+		}
+		return
+	}
+	newGoal := *runningGoal
+	newGoal.SubGoals = append([]*datatype.SubGoal{}, runningGoal.SubGoals...)
+	for _, nodeName := range added {
+		approvedPlugins, nodeErrorList := cs.validateNode(job, nodeName)
+		if len(nodeErrorList) > 0 {
+			errorList = append(errorList, nodeErrorList...)
+			continue
+		}
+		if len(approvedPlugins) > 0 {
+			if err := newGoal.AddSubGoal(nodeName, approvedPlugins, job.ScienceRules); err != nil {
+				errorList = append(errorList, err)
+			}
+		}
+	}
+	if len(errorList) > 0 {
+		logger.Info.Printf("Validation failed for adding nodes %v to Job ID %q: %v", added, jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckManifest)
+		return nil, nil, errorList
+	}
+	job.ScienceGoal = &newGoal
+	if errorList = cs.checkQuota(job); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q exceeds quota: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckQuota)
+		return nil, nil, errorList
+	}
+	report = &datatype.ValidationReport{}
+	if errorList = cs.checkConflicts(job, report); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q conflicts with other jobs: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckConflict)
+		return nil, nil, errorList
+	}
+	if errorList = cs.checkCapacity(job, report, false); len(errorList) > 0 {
+		logger.Info.Printf("Job ID %q oversubscribes nodes: %v", jobID, errorList)
+		cs.Metrics.ValidationFailed(validationCheckCapacity)
+		return nil, nil, errorList
+	}
+	if _, _, err := cs.GoalManager.ReplaceScienceGoal(job); err != nil {
+		return nil, nil, []error{err}
+	}
+	return
+}
+
+// DropNodesFromJob drops nodes selected by names and tags from the job.
+// If node tags of the job select any of the dropped nodes, the tags are replaced by the other
+// nodes they select so that the dropped nodes do not come back when the job is validated again.
+// If the job is running, sub goals of the nodes are removed from its science goal
+// and only the dropped nodes get notified.
+func (cs *CloudScheduler) DropNodesFromJob(jobID string, nodeNames []string, nodeTags []string) (dropped []string, errorList []error) {
+	cs.editMu.Lock()
+	defer cs.editMu.Unlock()
+	job, err := cs.GoalManager.GetJob(jobID)
+	if err != nil {
+		return nil, []error{err}
+	}
+	// Nodes selected by tags of the job are listed to be dropped or to replace the tags
+	job.AddNodes(cs.Validator.GetNodeNamesByTags(job.NodeTags))
+	for _, nodeName := range append(append([]string{}, nodeNames...), cs.Validator.GetNodeNamesByTags(nodeTags)...) {
+		if _, exist := job.Nodes[nodeName]; !exist {
+			continue
+		}
+		job.DropNode(nodeName)
+		dropped = append(dropped, nodeName)
+	}
+	if len(dropped) < 1 {
+		return nil, []error{fmt.Errorf("No node of job %q is selected", jobID)}
+	}
+	// Nodes the tags select are already in the job
+	if selectsAnyOf(cs.Validator.GetNodeNamesByTags(job.NodeTags), dropped) {
+		job.NodeTags = nil
+	}
+	runningGoal := cs.getRunningScienceGoal(job)
+	if runningGoal == nil {
+		if err := cs.GoalManager.UpdateJob(job, false); err != nil {
+			return nil, []error{err}
+		}
+		return
+	}
+	newGoal := *runningGoal
+	newGoal.SubGoals = append([]*datatype.SubGoal{}, runningGoal.SubGoals...)
+	for _, nodeName := range dropped {
+		newGoal.DropSubGoal(nodeName)
+	}
+	job.ScienceGoal = &newGoal
+	if _, _, err := cs.GoalManager.ReplaceScienceGoal(job); err != nil {
+		return nil, []error{err}
+	}
+	return
+}
+
+// selectsAnyOf returns true if any of the nodes is in the node names
+func selectsAnyOf(nodes []string, nodeNames []string) bool {
+	for _, node := range nodes {
+		for _, nodeName := range nodeNames {
+			if node == nodeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkQuota returns errors if the job exceeds the quota of its user
+// when the job becomes active with its science goal
+func (cs *CloudScheduler) checkQuota(job *datatype.Job) []error {
+	usage := cs.getQuotaUsage(job.User, job.JobID)
+	return cs.QuotaManager.GetQuota(job.User).Check(usage, job)
+}
+
+// getQuotaUsage counts use of resources by active jobs of the user found in the job index
+func (cs *CloudScheduler) getQuotaUsage(user string, excludeJobIDs ...string) *QuotaUsage {
+	activeJobs, _, err := cs.GoalManager.QueryJobs(&JobQuery{
+		User:     user,
+		Statuses: []datatype.JobStatus{datatype.JobSubmitted, datatype.JobRunning},
+	})
+	if err != nil {
+		logger.Error.Printf("Failed to query active jobs of user %q: %s", user, err.Error())
+	}
+	return NewQuotaUsage(user, activeJobs, excludeJobIDs...)
+}
+
+// checkConflicts compares the science goal of the job with science goals of
+// other active jobs on each node. Conflicts that prevent plugins from running
+// are returned as errors and the others are added to the report.
+func (cs *CloudScheduler) checkConflicts(job *datatype.Job, report *datatype.ValidationReport) (errorList []error) {
+	if job.ScienceGoal == nil {
+		return
+	}
+	for _, subGoal := range job.ScienceGoal.SubGoals {
+		activeGoals := cs.GoalManager.GetScienceGoalsForNode(subGoal.Name)
+		for _, conflict := range cs.ConflictChecker.FindConflicts(job.JobID, subGoal, activeGoals, cs.Validator.GetPluginManifest) {
+			if conflict.IsFatal() {
+				errorList = append(errorList, fmt.Errorf("%s", conflict.String()))
+			} else {
+				report.Conflicts = append(report.Conflicts, conflict)
+			}
+		}
+	}
+	return
+}
+
+// checkCapacity projects load on devices of each node of the job together with
+// active goals of other jobs. Oversubscribed nodes are rejected if configured so,
+// and are reported as warnings otherwise. Projections are added to the report if requested.
+func (cs *CloudScheduler) checkCapacity(job *datatype.Job, report *datatype.ValidationReport, includeProjection bool) (errorList []error) {
+	if job.ScienceGoal == nil {
+		return
+	}
+	for _, subGoal := range job.ScienceGoal.SubGoals {
+		nodeManifest := cs.Validator.GetNodeManifest(subGoal.Name)
+		if nodeManifest == nil {
+			continue
+		}
+		activeGoals := cs.GoalManager.GetScienceGoalsForNode(subGoal.Name)
+		projection := cs.CapacityPlanner.Project(nodeManifest, job.JobID, subGoal, activeGoals, cs.Validator.GetPluginManifest)
+		if includeProjection {
+			report.Capacity = append(report.Capacity, projection)
+		}
+		for _, message := range projection.Oversubscribed() {
+			if cs.Config.RejectOversubscription {
+				errorList = append(errorList, fmt.Errorf("%s", message))
+			} else {
+				report.Warnings = append(report.Warnings, message)
+			}
+		}
+		report.Warnings = append(report.Warnings, projection.Overcommitted()...)
+	}
+	return
+}
+
+// getRunningScienceGoal returns the science goal of the job if the goal is
+// currently served to nodes. It returns nil otherwise.
+func (cs *CloudScheduler) getRunningScienceGoal(job *datatype.Job) *datatype.ScienceGoal {
+	if job.ScienceGoal == nil {
+		return nil
 	}
-	scienceGoalBuilder := datatype.NewScienceGoalBuilder(job.Name, job.JobID)
+	switch job.Status {
+	case datatype.JobSubmitted, datatype.JobRunning:
+		scienceGoal, err := cs.GoalManager.GetScienceGoal(job.ScienceGoal.ID)
+		if err != nil {
+			return nil
+		}
+		return scienceGoal
+	}
+	return nil
+}
+
+// validateJob checks the job against node and plugin manifests and builds
+// a science goal using given builder. The job is not changed in the database.
+func (cs *CloudScheduler) validateJob(job *datatype.Job, scienceGoalBuilder *datatype.ScienceGoalBuilder) (scienceGoal *datatype.ScienceGoal, errorList []error) {
 	logger.Info.Printf("Validating %s...", job.Name)
 	// Step 1: Resolve node tags
 	job.AddNodes(cs.Validator.GetNodeNamesByTags(job.NodeTags))
 	if len(job.Nodes) < 1 {
-		return []error{fmt.Errorf("Node is not selected")}
+		return nil, []error{fmt.Errorf("Node is not selected")}
 	}
 	// Check if email is set for notification
 	if len(job.NotificationOn) > 0 {
 		if job.Email == "" {
-			return []error{fmt.Errorf("No email is set for notification")}
+			return nil, []error{fmt.Errorf("No email is set for notification")}
 		}
 		// Check if given notification types are valid
 		for _, s := range job.NotificationOn {
@@ -100,87 +495,112 @@ func (cs *CloudScheduler) ValidateJobAndCreateScienceGoal(jobID string, dryrun b
 			return
 		}
 	}
+	// Check if priorities are in range
+	if job.Priority < 0 || job.Priority > datatype.MaxPluginPriority {
+		errorList = append(errorList, fmt.Errorf("Priority %d of Job must be between 0 and %d", job.Priority, datatype.MaxPluginPriority))
+	}
+	for _, plugin := range job.Plugins {
+		if p := plugin.GetPriority(); p < 0 || p > datatype.MaxPluginPriority {
+			errorList = append(errorList, fmt.Errorf("Priority %d of %s must be between 0 and %d", p, plugin.Name, datatype.MaxPluginPriority))
+		}
+	}
+	if job.Weight < 0 {
+		errorList = append(errorList, fmt.Errorf("Weight %g of Job must not be negative", job.Weight))
+	}
+	if len(errorList) > 0 {
+		return
+	}
+	scienceGoalBuilder = scienceGoalBuilder.SetUser(job.User).SetWeight(job.Weight)
 	for nodeName := range job.Nodes {
-		approvedPlugins := []*datatype.Plugin{}
-		nodeManifest := cs.Validator.GetNodeManifest(nodeName)
-		if nodeManifest == nil {
-			errorList = append(errorList, fmt.Errorf("%s does not exist", nodeName))
+		approvedPlugins, nodeErrorList := cs.validateNode(job, nodeName)
+		errorList = append(errorList, nodeErrorList...)
+		// Check 5: valiables are valid
+		if len(approvedPlugins) > 0 {
+			scienceGoalBuilder = scienceGoalBuilder.AddSubGoal(nodeName, approvedPlugins, job.ScienceRules)
+		}
+	}
+	if len(errorList) > 0 {
+		return nil, errorList
+	}
+	return scienceGoalBuilder.Build(), nil
+}
+
+// validateNode checks if plugins of the job can run on the node.
+// It returns the plugins approved to run on the node.
+func (cs *CloudScheduler) validateNode(job *datatype.Job, nodeName string) (approvedPlugins []*datatype.Plugin, errorList []error) {
+	nodeManifest := cs.Validator.GetNodeManifest(nodeName)
+	if nodeManifest == nil {
+		errorList = append(errorList, fmt.Errorf("%s does not exist", nodeName))
+		return
+	}
+	for _, plugin := range job.Plugins {
+		pluginManifest := cs.Validator.GetPluginManifest(plugin)
+		if pluginManifest == nil {
+			errorList = append(errorList, fmt.Errorf("%s does not exist in ECR", plugin.PluginSpec.Image))
 			continue
 		}
-		for _, plugin := range job.Plugins {
-			pluginManifest := cs.Validator.GetPluginManifest(plugin)
-			if pluginManifest == nil {
-				errorList = append(errorList, fmt.Errorf("%s does not exist in ECR", plugin.PluginSpec.Image))
-				continue
-			}
-			// Check 1: plugin exists in ECR
-			// exists := pluginExists(plugin)
-			// if !exists {
-			// 	errorList = append(errorList, fmt.Errorf("%s:%s not exist in ECR", plugin.Name, plugin.Version))
-			// 	continue
-			// }
-			// logger.Info.Printf("%s:%s exists in ECR", plugin.Name, plugin.Version)
+		// Check 1: plugin exists in ECR
+		// exists := pluginExists(plugin)
+		// if !exists {
+		// 	errorList = append(errorList, fmt.Errorf("%s:%s not exist in ECR", plugin.Name, plugin.Version))
+		// 	continue
+		// }
+		// logger.Info.Printf("%s:%s exists in ECR", plugin.Name, plugin.Version)
 
-			// Check 2: node supports hardware requirements of the plugin
-			supported, unsupportedHardwareList := nodeManifest.GetPluginHardwareUnsupportedList(pluginManifest)
-			if !supported {
-				errorList = append(errorList, fmt.Errorf("%s does not support hardware %v required by %s (%s)", nodeName, unsupportedHardwareList, plugin.Name, plugin.PluginSpec.Image))
-				continue
-			}
-			logger.Info.Printf("%s passed Check 2", plugin.Name)
+		// Check 2: node supports hardware requirements of the plugin
+		supported, unsupportedHardwareList := nodeManifest.GetPluginHardwareUnsupportedList(pluginManifest)
+		if !supported {
+			errorList = append(errorList, fmt.Errorf("%s does not support hardware %v required by %s (%s)", nodeName, unsupportedHardwareList, plugin.Name, plugin.PluginSpec.Image))
+			continue
+		}
+		logger.Info.Printf("%s passed Check 2", plugin.Name)
 
-			// Check 3: architecture of the plugin is supported by node
-			supported, supportedDevices := nodeManifest.GetPluginArchitectureSupportedDevices(pluginManifest)
+		// Check 3: architecture of the plugin is supported by node
+		supported, supportedDevices := nodeManifest.GetPluginArchitectureSupportedDevices(pluginManifest)
+		if !supported {
+			errorList = append(errorList, fmt.Errorf("%s does not support architecture %v required by %s (%s)", nodeName, pluginManifest.Architecture, plugin.Name, plugin.PluginSpec.Image))
+			continue
+		}
+		logger.Info.Printf("%s passed Check 3", plugin.Name)
+
+		// Check 4: the required resource is available in node devices
+		for _, device := range supportedDevices {
+			supported, _ := device.GetUnsupportedPluginProfiles(pluginManifest)
 			if !supported {
-				errorList = append(errorList, fmt.Errorf("%s does not support architecture %v required by %s (%s)", nodeName, pluginManifest.Architecture, plugin.Name, plugin.PluginSpec.Image))
+				errorList = append(errorList, fmt.Errorf("%s (%s) does not support resource required by %s (%s)", nodeName, device.Name, plugin.Name, plugin.PluginSpec.Image))
 				continue
 			}
-			logger.Info.Printf("%s passed Check 3", plugin.Name)
-
-			// Check 4: the required resource is available in node devices
-			for _, device := range supportedDevices {
-				supported, _ := device.GetUnsupportedPluginProfiles(pluginManifest)
-				if !supported {
-					errorList = append(errorList, fmt.Errorf("%s (%s) does not support resource required by %s (%s)", nodeName, device.Name, plugin.Name, plugin.PluginSpec.Image))
-					continue
-				}
-				// // Filter out unsupported knob settings
-				// for _, profile := range profiles {
-				// 	err := plugin.RemoveProfile(profile)
-				// 	if err != nil {
-				// 		logger.Error.Printf("%s", err)
-				// 	}
-				// }
-			}
-			plugin.UpdatePluginSchedulingStatus(datatype.Waiting)
-			approvedPlugins = append(approvedPlugins, plugin)
 		}
-		// Check 4: conditions of job are valid
-
-		// Check 5: valiables are valid
-		if len(approvedPlugins) > 0 {
-			scienceGoalBuilder = scienceGoalBuilder.AddSubGoal(nodeName, approvedPlugins, job.ScienceRules)
+		plugin.UpdatePluginSchedulingStatus(datatype.Waiting)
+		// The node scheduler chooses one of the profiles that fit the node when it runs the plugin.
+		// Plugins are shared by nodes of the job and so each node gets its own copy
+		approvedPlugin := *plugin
+		approvedPlugin.Profiles = fittingProfiles(supportedDevices, pluginManifest)
+		approvedPlugin.Status.KnobStatus = nil
+		if len(approvedPlugin.Profiles) > 0 {
+			approvedPlugin.Status.KnobStatus = &approvedPlugin.Profiles[0]
 		}
+		// Plugins take the priority of the job unless given their own
+		if plugin.GetPriority() == 0 && job.Priority > 0 {
+			pluginSpec := *plugin.PluginSpec
+			pluginSpec.Priority = job.Priority
+			approvedPlugin.PluginSpec = &pluginSpec
+		}
+		approvedPlugins = append(approvedPlugins, &approvedPlugin)
 	}
-	if len(errorList) > 0 {
-		logger.Info.Printf("Validation failed for Job ID %q: %v", jobID, errorList)
-		return errorList
-	}
-	logger.Info.Printf("Updating science goal for JOB ID %q", jobID)
-	job.ScienceGoal = scienceGoalBuilder.Build()
-	if dryrun {
-		cs.GoalManager.UpdateJob(job, false)
-	} else {
-		cs.GoalManager.UpdateJob(job, true)
-	}
-	return nil
+	// Check 4: conditions of job are valid
+	return
 }
 
 func (cs *CloudScheduler) updateNodes(nodes []string) {
 	for _, nodeName := range nodes {
-		var goals []*datatype.ScienceGoal
+		var (
+			goals   []*datatype.ScienceGoal
+			goalIDs []string
+		)
 		for _, g := range cs.GoalManager.GetScienceGoalsForNode(nodeName) {
 			goals = append(goals, g.ShowMyScienceGoal(nodeName))
+			goalIDs = append(goalIDs, g.ID)
 		}
 		// if no science goal is assigned to the node return an empty list []
 		// returning null may raise an exception in edge scheduler
@@ -193,31 +613,57 @@ func (cs *CloudScheduler) updateNodes(nodes []string) {
 		} else {
 			event := datatype.NewEventBuilder(datatype.EventGoalStatusUpdated).AddEntry("goals", string(blob)).Build()
 			cs.APIServer.Push(nodeName, &event)
+			cs.Metrics.GoalsPushed(nodeName, goalIDs, time.Now())
 		}
 	}
 }
 
-func (cs *CloudScheduler) Run() {
+// Run runs the cloud scheduler until ctx is done and then shuts it down.
+// It returns an error if the API server fails or the shutdown does not go cleanly.
+func (cs *CloudScheduler) Run(ctx context.Context) error {
 	logger.Info.Printf("Cloud Scheduler %s starts...", cs.Name)
-	go cs.APIServer.Run()
+	chanAPIServerError := make(chan error, 1)
+	go func() {
+		chanAPIServerError <- cs.APIServer.Run()
+	}()
+	go cs.QuotaManager.Run(ctx)
 	chanEventFromNode := make(chan *datatype.Event)
 	if cs.eventListener != nil {
-		cs.eventListener.SubscribeEvents("waggle.msg", "to-scheduler", chanEventFromNode)
+		if err := interfacing.SubscribeEvents(ctx, cs.eventListener, "sys.scheduler.#", chanEventFromNode); err != nil {
+			logger.Error.Printf("Failed to subscribe events from nodes: %s", err.Error())
+		}
 	}
 	for {
 		select {
+		case <-ctx.Done():
+			logger.Info.Printf("Cloud Scheduler %s is shutting down...", cs.Name)
+			return cs.shutdown()
+		case err := <-chanAPIServerError:
+			logger.Error.Printf("API server stopped unexpectedly: %v", err)
+			if shutdownErr := cs.shutdown(); shutdownErr != nil {
+				logger.Error.Printf("%s", shutdownErr.Error())
+			}
+			return fmt.Errorf("API server stopped: %v", err)
 		case event := <-chanEventFromNode:
 			logger.Debug.Printf("%s:%v", event.ToString(), event)
+			cs.Metrics.EventReceived(event)
 			// TODO: stat aggregator for jobs may use this event
 			sender := event.GetEntry("vsn")
 			// sender must be identified
 			switch event.Type {
 			case datatype.EventGoalStatusReceived, datatype.EventGoalStatusUpdated:
-				goalID := event.GetGoalID()
+				payload, err := event.Payload()
+				if err != nil {
+					logger.Error.Printf("Failed to decode %q from %s: %s", event.Type, sender, err.Error())
+					break
+				}
+				goalID := payload.(*datatype.GoalEventPayload).GoalID
 				logger.Debug.Printf("%s received science goal %s", sender, goalID)
+				cs.Metrics.GoalReceived(sender, goalID, time.Now())
 				scienceGoal, err := cs.GoalManager.GetScienceGoal(goalID)
 				if err != nil {
 					logger.Error.Printf("Failed to find science goal %s", goalID)
+					break
 				}
 				err = cs.GoalManager.UpdateJobStatus(scienceGoal.JobID, datatype.JobRunning)
 				if err != nil {
@@ -280,7 +726,52 @@ func (cs *CloudScheduler) Run() {
 				logger.Info.Printf("Goal %q is submitted for job id %q.", scienceGoal.Name, scienceGoal.JobID)
 				NodesToUpdate := scienceGoal.GetSubjectNodes()
 				cs.updateNodes(NodesToUpdate)
+			case datatype.EventGoalStatusUpdated:
+				// Only nodes whose sub goal is changed or removed need the update
+				NodesToUpdate := strings.Split(event.GetEntry("nodes"), ",")
+				logger.Info.Printf("Goal %q is updated for job id %q. Updating nodes %v", event.GetGoalName(), event.GetJobID(), NodesToUpdate)
+				cs.updateNodes(NodesToUpdate)
 			}
 		}
 	}
 }
+
+// shutdown stops the cloud scheduler within gracefulShutdownTimeout.
+// In-flight API requests are drained and goal streams are closed before
+// pending publishes to RabbitMQ are flushed. The job database is closed last
+// as in-flight requests may still write to it.
+func (cs *CloudScheduler) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), gracefulShutdownTimeout)
+	defer cancel()
+	// Events from the goal manager are not handled anymore. Draining them keeps
+	// in-flight requests from blocking. Nodes get their latest goals when they
+	// reconnect to the next instance
+	stopDraining := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-cs.chanFromGoalManager:
+			case <-stopDraining:
+				return
+			}
+		}
+	}()
+	defer close(stopDraining)
+	var errorList []error
+	if err := cs.APIServer.Shutdown(ctx); err != nil {
+		errorList = append(errorList, fmt.Errorf("Failed to shut down API server: %s", err.Error()))
+	}
+	if cs.eventListener != nil {
+		if err := cs.eventListener.Close(ctx); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	if err := cs.GoalManager.CloseJobDB(); err != nil {
+		errorList = append(errorList, fmt.Errorf("Failed to close job database: %s", err.Error()))
+	}
+	if len(errorList) > 0 {
+		return fmt.Errorf("Cloud Scheduler %s did not shut down cleanly: %v", cs.Name, errorList)
+	}
+	logger.Info.Printf("Cloud Scheduler %s stopped", cs.Name)
+	return nil
+}
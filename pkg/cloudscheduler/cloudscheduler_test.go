@@ -0,0 +1,512 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
+
+func TestValidateNodeProfiles(t *testing.T) {
+	validator := NewJobValidator("")
+	validator.Nodes["W001"] = &datatype.NodeManifest{
+		Name: "W001",
+		Devices: []datatype.Device{
+			{Name: "nxcore", Architecture: "arm64", Resource: datatype.Resource{CPU: "4", Memory: "8Gi", GPUMemory: "8Gi"}},
+		},
+	}
+	validator.Nodes["W002"] = &datatype.NodeManifest{
+		Name: "W002",
+		Devices: []datatype.Device{
+			{Name: "rpi", Architecture: "arm64", Resource: datatype.Resource{CPU: "4", Memory: "4Gi"}},
+		},
+	}
+	validator.Plugins["cloudcover:0.1.0"] = &datatype.PluginManifest{
+		Architecture: []string{"arm64"},
+		Profile: []datatype.Profile{
+			{Name: "unet_cuda", Require: datatype.Resource{CPU: "2", GPUMemory: "2Gi"}},
+			{Name: "unet", Require: datatype.Resource{CPU: "2", Memory: "2Gi"}},
+		},
+	}
+	validator.Plugins["sampler:0.1.0"] = &datatype.PluginManifest{Architecture: []string{"arm64"}}
+	cs := &CloudScheduler{Validator: validator}
+	job := datatype.NewJob("test", "user", "1")
+	job.Plugins = []*datatype.Plugin{
+		{Name: "cloudcover", PluginSpec: &datatype.PluginSpec{Image: "cloudcover:0.1.0"}},
+		{Name: "sampler", PluginSpec: &datatype.PluginSpec{Image: "sampler:0.1.0"}},
+	}
+	tests := map[string]struct {
+		Node         string
+		WantProfile  map[string]string
+		WantProfiles map[string]int
+	}{
+		"gpu": {
+			Node:         "W001",
+			WantProfile:  map[string]string{"cloudcover": "unet_cuda", "sampler": ""},
+			WantProfiles: map[string]int{"cloudcover": 2, "sampler": 0},
+		},
+		"nogpu": {
+			Node:         "W002",
+			WantProfile:  map[string]string{"cloudcover": "unet", "sampler": ""},
+			WantProfiles: map[string]int{"cloudcover": 1, "sampler": 0},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plugins, errorList := cs.validateNode(job, test.Node)
+			if len(errorList) > 0 {
+				t.Fatalf("Unexpected errors: %v", errorList)
+			}
+			if len(plugins) != len(job.Plugins) {
+				t.Fatalf("Expected %d plugins approved, but %d", len(job.Plugins), len(plugins))
+			}
+			for _, plugin := range plugins {
+				got := ""
+				if plugin.Status.KnobStatus != nil {
+					got = plugin.Status.KnobStatus.Name
+				}
+				if got != test.WantProfile[plugin.Name] {
+					t.Errorf("Wrong profile of %q: expected %q, but %q", plugin.Name, test.WantProfile[plugin.Name], got)
+				}
+				if len(plugin.Profiles) != test.WantProfiles[plugin.Name] {
+					t.Errorf("Expected %d profiles of %q to fit, but %d", test.WantProfiles[plugin.Name], plugin.Name, len(plugin.Profiles))
+				}
+			}
+		})
+	}
+	// Plugins of the job are not changed by nodes
+	for _, plugin := range job.Plugins {
+		if plugin.Status.KnobStatus != nil || len(plugin.Profiles) > 0 {
+			t.Errorf("Plugin %q of the job has profiles", plugin.Name)
+		}
+	}
+}
+
+func TestValidateNodePriority(t *testing.T) {
+	validator := NewJobValidator("")
+	validator.Nodes["W001"] = &datatype.NodeManifest{
+		Name:    "W001",
+		Devices: []datatype.Device{{Name: "rpi", Architecture: "arm64"}},
+	}
+	validator.Plugins["sampler:0.1.0"] = &datatype.PluginManifest{Architecture: []string{"arm64"}}
+	cs := &CloudScheduler{Validator: validator}
+	job := datatype.NewJob("test", "user", "1")
+	job.Priority = 10
+	job.Plugins = []*datatype.Plugin{
+		{Name: "inherit", PluginSpec: &datatype.PluginSpec{Image: "sampler:0.1.0"}},
+		{Name: "own", PluginSpec: &datatype.PluginSpec{Image: "sampler:0.1.0", Priority: 50}},
+	}
+	want := map[string]int{"inherit": 10, "own": 50}
+	plugins, errorList := cs.validateNode(job, "W001")
+	if len(errorList) > 0 {
+		t.Fatalf("Unexpected errors: %v", errorList)
+	}
+	for _, plugin := range plugins {
+		if plugin.GetPriority() != want[plugin.Name] {
+			t.Errorf("Wrong priority of %q: expected %d, but %d", plugin.Name, want[plugin.Name], plugin.GetPriority())
+		}
+	}
+	// The plugin spec of the job is not changed
+	if job.Plugins[0].GetPriority() != 0 {
+		t.Errorf("Priority of the job plugin changed to %d", job.Plugins[0].GetPriority())
+	}
+}
+
+// newTestCloudScheduler returns a cloud scheduler keeping jobs in a temporary directory.
+// Nodes W001 and W002 have the tag "WSN" and W003 has the tag "test"
+func newTestCloudScheduler(t *testing.T) *CloudScheduler {
+	cs := NewCloudSchedulerBuilder(&CloudSchedulerConfig{
+		Name:    "test",
+		DataDir: t.TempDir(),
+	}).
+		AddGoalManager().
+		AddAPIServer().
+		Build()
+	if err := cs.GoalManager.OpenJobDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.GoalManager.CloseJobDB() })
+	for name, tag := range map[string]string{"W001": "WSN", "W002": "WSN", "W003": "test"} {
+		cs.Validator.Nodes[name] = &datatype.NodeManifest{
+			Name:    name,
+			Tags:    []string{tag},
+			Devices: []datatype.Device{{Name: "rpi", Architecture: "arm64", Resource: datatype.Resource{CPU: "4", Memory: "4Gi"}}},
+		}
+	}
+	cs.Validator.Plugins["sampler:0.1.0"] = &datatype.PluginManifest{Architecture: []string{"arm64"}}
+	cs.Validator.Plugins["cloudcover:0.1.0"] = &datatype.PluginManifest{Architecture: []string{"arm64"}}
+	return cs
+}
+
+// submitTestJob submits a job running the sampler on the nodes and the nodes of the tags
+func submitTestJob(t *testing.T, cs *CloudScheduler, nodes []string, nodeTags []string) string {
+	job := datatype.NewJob("test", "user", "")
+	job.Plugins = []*datatype.Plugin{{Name: "sampler", PluginSpec: &datatype.PluginSpec{Image: "sampler:0.1.0"}}}
+	job.ScienceRules = []string{"sampler: True"}
+	job.AddNodes(nodes)
+	job.NodeTags = nodeTags
+	jobID := cs.GoalManager.AddJob(job)
+	if _, errorList := cs.ValidateJobAndCreateScienceGoal(jobID, false); len(errorList) > 0 {
+		t.Fatalf("Failed to submit job: %v", errorList)
+	}
+	return jobID
+}
+
+// nodesOfJob returns nodes of the job and nodes of the sub goals of its running science goal
+func nodesOfJob(t *testing.T, cs *CloudScheduler, jobID string) (jobNodes []string, goalNodes []string) {
+	job, err := cs.GoalManager.GetJob(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for nodeName := range job.Nodes {
+		jobNodes = append(jobNodes, nodeName)
+	}
+	sort.Strings(jobNodes)
+	if goal := cs.getRunningScienceGoal(job); goal != nil {
+		goalNodes = goal.GetSubjectNodes()
+		sort.Strings(goalNodes)
+	}
+	return
+}
+
+func TestAddAndDropNodesOfJob(t *testing.T) {
+	type change struct {
+		Add      bool
+		Nodes    []string
+		NodeTags []string
+		WantErr  bool
+	}
+	tests := map[string]struct {
+		Nodes     []string
+		NodeTags  []string
+		Changes   []change
+		WantNodes []string
+	}{
+		"addByName": {
+			Nodes:     []string{"W001"},
+			Changes:   []change{{Add: true, Nodes: []string{"W003"}}},
+			WantNodes: []string{"W001", "W003"},
+		},
+		"addByTag": {
+			Nodes:     []string{"W003"},
+			Changes:   []change{{Add: true, NodeTags: []string{"WSN"}}},
+			WantNodes: []string{"W001", "W002", "W003"},
+		},
+		"addExisting": {
+			Nodes:     []string{"W001"},
+			Changes:   []change{{Add: true, Nodes: []string{"W001"}, WantErr: true}},
+			WantNodes: []string{"W001"},
+		},
+		"addUnknown": {
+			Nodes:     []string{"W001"},
+			Changes:   []change{{Add: true, Nodes: []string{"W999"}, WantErr: true}},
+			WantNodes: []string{"W001"},
+		},
+		"dropByName": {
+			Nodes:     []string{"W001", "W003"},
+			Changes:   []change{{Nodes: []string{"W001"}}},
+			WantNodes: []string{"W003"},
+		},
+		"dropNotInJob": {
+			Nodes:     []string{"W001"},
+			Changes:   []change{{Nodes: []string{"W003"}, WantErr: true}},
+			WantNodes: []string{"W001"},
+		},
+		"dropByTagRoundTrip": {
+			Nodes: []string{"W003"},
+			Changes: []change{
+				{Add: true, NodeTags: []string{"WSN"}},
+				{NodeTags: []string{"WSN"}},
+			},
+			WantNodes: []string{"W003"},
+		},
+		"dropNodeOfJobTag": {
+			NodeTags:  []string{"WSN"},
+			Changes:   []change{{Nodes: []string{"W001"}}},
+			WantNodes: []string{"W002"},
+		},
+		"dropJobTag": {
+			Nodes:     []string{"W003"},
+			NodeTags:  []string{"WSN"},
+			Changes:   []change{{NodeTags: []string{"WSN"}}},
+			WantNodes: []string{"W003"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cs := newTestCloudScheduler(t)
+			jobID := submitTestJob(t, cs, test.Nodes, test.NodeTags)
+			for i, c := range test.Changes {
+				var errorList []error
+				if c.Add {
+					_, _, errorList = cs.AddNodesToJob(jobID, c.Nodes, c.NodeTags)
+				} else {
+					_, errorList = cs.DropNodesFromJob(jobID, c.Nodes, c.NodeTags)
+				}
+				if (len(errorList) > 0) != c.WantErr {
+					t.Fatalf("Wrong result of change %d: expected error %t, but %v", i, c.WantErr, errorList)
+				}
+			}
+			jobNodes, goalNodes := nodesOfJob(t, cs, jobID)
+			if !equalStrings(jobNodes, test.WantNodes) || !equalStrings(goalNodes, test.WantNodes) {
+				t.Errorf("Wrong nodes: expected %v, but job has %v and its goal has %v", test.WantNodes, jobNodes, goalNodes)
+			}
+			// Dropped nodes do not come back when the job is validated again
+			job, err := cs.GoalManager.GetJob(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goal, errorList := cs.validateJob(job, datatype.NewScienceGoalBuilder(job.Name, job.JobID))
+			if len(errorList) > 0 {
+				t.Fatalf("Failed to validate job again: %v", errorList)
+			}
+			validatedNodes := goal.GetSubjectNodes()
+			sort.Strings(validatedNodes)
+			if !equalStrings(validatedNodes, test.WantNodes) {
+				t.Errorf("Wrong nodes after validation: expected %v, but %v", test.WantNodes, validatedNodes)
+			}
+		})
+	}
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// subGoalSpec returns plugin specs and science rules of the sub goal. Scheduling status is left out
+func subGoalSpec(subGoal *datatype.SubGoal) string {
+	var specs []*datatype.PluginSpec
+	for _, plugin := range subGoal.Plugins {
+		specs = append(specs, plugin.PluginSpec)
+	}
+	blob, _ := json.Marshal(map[string]interface{}{"plugins": specs, "rules": subGoal.ScienceRules})
+	return string(blob)
+}
+
+func TestEditRunningJob(t *testing.T) {
+	newJob := func(nodes []string, plugins ...*datatype.Plugin) *datatype.Job {
+		job := datatype.NewJob("test", "user", "")
+		job.Plugins = plugins
+		job.ScienceRules = []string{"sampler: True"}
+		job.AddNodes(nodes)
+		return job
+	}
+	sampler := func(args ...string) *datatype.Plugin {
+		return &datatype.Plugin{Name: "sampler", PluginSpec: &datatype.PluginSpec{Image: "sampler:0.1.0", Args: args}}
+	}
+	cloudcover := &datatype.Plugin{Name: "cloudcover", PluginSpec: &datatype.PluginSpec{Image: "cloudcover:0.1.0"}}
+	tests := map[string]struct {
+		Updated     *datatype.Job
+		DryRun      bool
+		WantNodes   []string
+		WantUpdated []string
+		WantRemoved []string
+	}{
+		"nochange": {
+			Updated:   newJob([]string{"W001", "W002"}, sampler()),
+			WantNodes: []string{"W001", "W002"},
+		},
+		"args": {
+			Updated:     newJob([]string{"W001", "W002"}, sampler("-stream", "top")),
+			WantNodes:   []string{"W001", "W002"},
+			WantUpdated: []string{"W001", "W002"},
+		},
+		"addPlugin": {
+			Updated:     newJob([]string{"W001", "W002"}, sampler(), cloudcover),
+			WantNodes:   []string{"W001", "W002"},
+			WantUpdated: []string{"W001", "W002"},
+		},
+		"replaceNode": {
+			Updated:     newJob([]string{"W001", "W003"}, sampler()),
+			WantNodes:   []string{"W001", "W003"},
+			WantUpdated: []string{"W003"},
+			WantRemoved: []string{"W002"},
+		},
+		"dropNode": {
+			Updated:     newJob([]string{"W001"}, sampler()),
+			WantNodes:   []string{"W001"},
+			WantRemoved: []string{"W002"},
+		},
+		"dryrun": {
+			Updated:     newJob([]string{"W001", "W003"}, sampler()),
+			DryRun:      true,
+			WantNodes:   []string{"W001", "W002"},
+			WantUpdated: []string{"W003"},
+			WantRemoved: []string{"W002"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cs := newTestCloudScheduler(t)
+			jobID := submitTestJob(t, cs, []string{"W001", "W002"}, nil)
+			oldJob, err := cs.GoalManager.GetJob(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldGoal := cs.getRunningScienceGoal(oldJob)
+			oldSubGoals := map[string]string{}
+			for _, nodeName := range oldGoal.GetSubjectNodes() {
+				oldSubGoals[nodeName] = subGoalSpec(oldGoal.GetMySubGoal(nodeName))
+			}
+			events := make(chan datatype.Event, 10)
+			cs.GoalManager.Notifier.SubscribeWithOptions(events, interfacing.SubscriptionOptions{
+				EventTypes: []datatype.EventType{datatype.EventGoalStatusUpdated},
+			})
+			result, errorList := cs.EditJob(oldJob, test.Updated, test.DryRun)
+			if len(errorList) > 0 {
+				t.Fatalf("Failed to edit job: %v", errorList)
+			}
+			sort.Strings(result.NodesUpdated)
+			sort.Strings(result.NodesRemoved)
+			if !equalStrings(result.NodesUpdated, test.WantUpdated) || !equalStrings(result.NodesRemoved, test.WantRemoved) {
+				t.Errorf("Wrong nodes: expected %v updated and %v removed, but %v and %v",
+					test.WantUpdated, test.WantRemoved, result.NodesUpdated, result.NodesRemoved)
+			}
+			// Only nodes updated or removed are sent the science goal
+			wantSent := append(append([]string{}, test.WantUpdated...), test.WantRemoved...)
+			if test.DryRun {
+				wantSent = nil
+			}
+			sort.Strings(wantSent)
+			var sent []string
+			select {
+			case event := <-events:
+				sent = strings.Split(event.GetEntry("nodes"), ",")
+				sort.Strings(sent)
+			case <-time.After(100 * time.Millisecond):
+			}
+			if !equalStrings(sent, wantSent) {
+				t.Errorf("Wrong nodes sent the science goal: expected %v, but %v", wantSent, sent)
+			}
+			job, err := cs.GoalManager.GetJob(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			goal := cs.getRunningScienceGoal(job)
+			if goal == nil || goal.ID != oldGoal.ID {
+				t.Fatalf("Job must keep running its science goal %q: %v", oldGoal.ID, goal)
+			}
+			nodes := goal.GetSubjectNodes()
+			sort.Strings(nodes)
+			if !equalStrings(nodes, test.WantNodes) {
+				t.Errorf("Wrong nodes of science goal: expected %v, but %v", test.WantNodes, nodes)
+			}
+			// Sub goals of nodes not updated are kept as they were
+			updated := map[string]bool{}
+			for _, nodeName := range test.WantUpdated {
+				updated[nodeName] = true
+			}
+			for _, nodeName := range nodes {
+				if updated[nodeName] && !test.DryRun {
+					continue
+				}
+				if spec := subGoalSpec(goal.GetMySubGoal(nodeName)); spec != oldSubGoals[nodeName] {
+					t.Errorf("Sub goal of %s must be kept: expected %s, but %s", nodeName, oldSubGoals[nodeName], spec)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentNodeEditsOfRunningJob(t *testing.T) {
+	// Adding and dropping nodes at the same time must not lose either edit
+	for i := 0; i < 20; i++ {
+		cs := newTestCloudScheduler(t)
+		jobID := submitTestJob(t, cs, []string{"W001", "W002"}, nil)
+		events := make(chan datatype.Event, 10)
+		cs.GoalManager.Notifier.SubscribeWithOptions(events, interfacing.SubscriptionOptions{
+			EventTypes: []datatype.EventType{datatype.EventGoalStatusUpdated},
+		})
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, _, errorList := cs.AddNodesToJob(jobID, []string{"W003"}, nil); len(errorList) > 0 {
+				t.Errorf("Failed to add node: %v", errorList)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			if _, errorList := cs.DropNodesFromJob(jobID, []string{"W001"}, nil); len(errorList) > 0 {
+				t.Errorf("Failed to drop node: %v", errorList)
+			}
+		}()
+		close(start)
+		wg.Wait()
+		jobNodes, goalNodes := nodesOfJob(t, cs, jobID)
+		if want := []string{"W002", "W003"}; !equalStrings(jobNodes, want) || !equalStrings(goalNodes, want) {
+			t.Fatalf("Wrong nodes: expected %v, but job has %v and science goal has %v", want, jobNodes, goalNodes)
+		}
+		// Each edit sends the science goal only to the node it changes
+		var sent []string
+		for j := 0; j < 2; j++ {
+			select {
+			case event := <-events:
+				sent = append(sent, event.GetEntry("nodes"))
+			case <-time.After(time.Second):
+				t.Fatalf("Expected 2 updates of the science goal, but got %v", sent)
+			}
+		}
+		sort.Strings(sent)
+		if want := []string{"W001", "W003"}; !equalStrings(sent, want) {
+			t.Fatalf("Wrong nodes sent the science goal: expected %v, but %v", want, sent)
+		}
+	}
+}
+
+func TestConfigureGoalsOverTLSOnly(t *testing.T) {
+	tests := map[string]struct {
+		GoalsOverTLSOnly bool
+		WantError        bool
+	}{
+		"withouttlsonly": {},
+		"tlsonlywithoutport": {
+			GoalsOverTLSOnly: true,
+			WantError:        true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			for _, dir := range []string{"nodes", "plugins"} {
+				if err := os.Mkdir(path.Join(dataDir, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cs := NewCloudSchedulerBuilder(&CloudSchedulerConfig{
+				Name:             "test",
+				DataDir:          dataDir,
+				NoRabbitMQ:       true,
+				GoalsOverTLSOnly: tc.GoalsOverTLSOnly,
+			}).
+				AddGoalManager().
+				AddAPIServer().
+				Build()
+			t.Cleanup(func() { cs.GoalManager.CloseJobDB() })
+			err := cs.Configure()
+			if tc.WantError && err == nil {
+				t.Errorf("Expected an error, but got none")
+			} else if !tc.WantError && err != nil {
+				t.Errorf("Expected no error, but got %s", err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// ConflictChecker finds conflicts between a new sub goal and sub goals of other active jobs on the same node
+type ConflictChecker struct {
+	exclusiveHardware map[string]bool
+}
+
+func NewConflictChecker(exclusiveHardware []string) *ConflictChecker {
+	cc := &ConflictChecker{
+		exclusiveHardware: make(map[string]bool),
+	}
+	for _, hardware := range exclusiveHardware {
+		if hardware = strings.TrimSpace(hardware); hardware != "" {
+			cc.exclusiveHardware[hardware] = true
+		}
+	}
+	return cc
+}
+
+// FindConflicts compares plugins of the sub goal with plugins of other active science goals on the node.
+// Goals of the job itself are not compared. getManifest returns the plugin manifest
+// used to find hardware requirements; it may return nil if the manifest is unknown.
+func (cc *ConflictChecker) FindConflicts(jobID string, subGoal *datatype.SubGoal, activeGoals []*datatype.ScienceGoal, getManifest func(*datatype.Plugin) *datatype.PluginManifest) (conflicts []datatype.Conflict) {
+	for _, otherGoal := range activeGoals {
+		if otherGoal.JobID == jobID {
+			continue
+		}
+		otherSubGoal := otherGoal.GetMySubGoal(subGoal.Name)
+		if otherSubGoal == nil {
+			continue
+		}
+		for _, plugin := range subGoal.Plugins {
+			for _, otherPlugin := range otherSubGoal.Plugins {
+				conflict := datatype.Conflict{
+					Node:        subGoal.Name,
+					Plugin:      plugin.Name,
+					OtherJobID:  otherGoal.JobID,
+					OtherPlugin: otherPlugin.Name,
+				}
+				if plugin.Name == otherPlugin.Name {
+					conflict.Type = datatype.ConflictPluginName
+					conflicts = append(conflicts, conflict)
+				}
+				if sameSpec(plugin.PluginSpec, otherPlugin.PluginSpec) {
+					conflict.Type = datatype.ConflictDuplicateSpec
+					conflicts = append(conflicts, conflict)
+				}
+				for _, hardware := range cc.sharedExclusiveHardware(getManifest(plugin), getManifest(otherPlugin)) {
+					conflict.Type = datatype.ConflictExclusiveHardware
+					conflict.Hardware = hardware
+					conflicts = append(conflicts, conflict)
+				}
+			}
+		}
+	}
+	return
+}
+
+func (cc *ConflictChecker) sharedExclusiveHardware(a *datatype.PluginManifest, b *datatype.PluginManifest) (shared []string) {
+	if a == nil || b == nil {
+		return
+	}
+	for hardware := range a.Hardware {
+		if !cc.exclusiveHardware[hardware] {
+			continue
+		}
+		if _, exist := b.Hardware[hardware]; exist {
+			shared = append(shared, hardware)
+		}
+	}
+	return
+}
+
+// sameSpec compares two plugin specs by their JSON encoding.
+// JSON encoding sorts map keys so that the same specs give the same encoding.
+func sameSpec(a *datatype.PluginSpec, b *datatype.PluginSpec) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	encodedB, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(encodedA) == string(encodedB)
+}
@@ -0,0 +1,78 @@
+package cloudscheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestConflictCheckerFindConflicts(t *testing.T) {
+	newPlugin := func(name string, image string, args ...string) *datatype.Plugin {
+		return &datatype.Plugin{
+			Name: name,
+			PluginSpec: &datatype.PluginSpec{
+				Image: image,
+				Args:  args,
+			},
+		}
+	}
+	newGoal := func(jobID string, plugins ...*datatype.Plugin) *datatype.ScienceGoal {
+		return datatype.NewScienceGoalBuilder("test", jobID).
+			AddSubGoal("W001", plugins, []string{}).Build()
+	}
+	manifests := map[string]*datatype.PluginManifest{
+		"camera-app:0.1.0": {Hardware: map[string]bool{"camera": true}},
+		"gpu-app:0.1.0":    {Hardware: map[string]bool{"gpu": true}},
+		"gpu-app:0.2.0":    {Hardware: map[string]bool{"gpu": true}},
+	}
+	getManifest := func(plugin *datatype.Plugin) *datatype.PluginManifest {
+		return manifests[plugin.PluginSpec.Image]
+	}
+	tests := map[string]struct {
+		New    *datatype.ScienceGoal
+		Active []*datatype.ScienceGoal
+		Want   []datatype.ConflictType
+	}{
+		"noconflict": {
+			New:    newGoal("1", newPlugin("app-a", "camera-app:0.1.0")),
+			Active: []*datatype.ScienceGoal{newGoal("2", newPlugin("app-b", "camera-app:0.1.0", "-stream", "top"))},
+		},
+		"samejob": {
+			New:    newGoal("1", newPlugin("app-a", "gpu-app:0.1.0")),
+			Active: []*datatype.ScienceGoal{newGoal("1", newPlugin("app-a", "gpu-app:0.1.0"))},
+		},
+		"pluginname": {
+			New:    newGoal("1", newPlugin("app-a", "camera-app:0.1.0")),
+			Active: []*datatype.ScienceGoal{newGoal("2", newPlugin("app-a", "camera-app:0.1.0", "-stream", "top"))},
+			Want:   []datatype.ConflictType{datatype.ConflictPluginName},
+		},
+		"duplicatespec": {
+			New:    newGoal("1", newPlugin("app-a", "camera-app:0.1.0", "-stream", "top")),
+			Active: []*datatype.ScienceGoal{newGoal("2", newPlugin("app-b", "camera-app:0.1.0", "-stream", "top"))},
+			Want:   []datatype.ConflictType{datatype.ConflictDuplicateSpec},
+		},
+		"exclusivehardware": {
+			New:    newGoal("1", newPlugin("app-a", "gpu-app:0.1.0")),
+			Active: []*datatype.ScienceGoal{newGoal("2", newPlugin("app-b", "gpu-app:0.2.0"))},
+			Want:   []datatype.ConflictType{datatype.ConflictExclusiveHardware},
+		},
+		"othernode": {
+			New: newGoal("1", newPlugin("app-a", "gpu-app:0.1.0")),
+			Active: []*datatype.ScienceGoal{datatype.NewScienceGoalBuilder("test", "2").
+				AddSubGoal("W002", []*datatype.Plugin{newPlugin("app-a", "gpu-app:0.1.0")}, []string{}).Build()},
+		},
+	}
+	cc := NewConflictChecker([]string{"gpu"})
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got []datatype.ConflictType
+			for _, conflict := range cc.FindConflicts("1", tc.New.GetMySubGoal("W001"), tc.Active, getManifest) {
+				got = append(got, conflict.Type)
+			}
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("Conflicts mismatch: wanted %v, got %v", tc.Want, got)
+			}
+		})
+	}
+}
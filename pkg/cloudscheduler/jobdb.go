@@ -0,0 +1,301 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+const (
+	jobDBFileName    = "job.db"
+	metaBucketName   = "meta"
+	schemaVersionKey = "schema_version"
+	// importBucketName holds jobs of an archive while they are migrated for import
+	importBucketName = "import"
+)
+
+// jobDBMigration upgrades the job database by one schema version.
+// Migrations work on raw JSON records instead of datatype.Job so that
+// they keep working after fields of the struct change.
+type jobDBMigration struct {
+	description string
+	migrate     func(jobs *bolt.Bucket) error
+}
+
+// jobDBMigrations lists migrations in order. The schema version of a database
+// is the number of migrations applied to it. New migrations are appended
+// at the end and released migrations must not change.
+var jobDBMigrations = []jobDBMigration{
+	{
+		description: "Set created_at of jobs created before it was recorded",
+		migrate: func(jobs *bolt.Bucket) error {
+			return updateJobRecords(jobs, func(record map[string]interface{}) bool {
+				if createdAt, _ := record["created_at"].(string); createdAt != "" && createdAt != (time.Time{}).Format(time.RFC3339) {
+					return false
+				}
+				record["created_at"] = record["last_updated"]
+				return true
+			})
+		},
+	},
+}
+
+// LatestJobDBSchemaVersion is the schema version of the job database this build uses
+var LatestJobDBSchemaVersion = len(jobDBMigrations)
+
+// JobArchive is a portable JSON archive of the job database.
+// Jobs are kept as stored so that an archive of an older schema version
+// is migrated when it is imported.
+type JobArchive struct {
+	SchemaVersion int               `json:"schema_version"`
+	ExportedAt    time.Time         `json:"exported_at"`
+	JobSequence   uint64            `json:"job_sequence"`
+	Jobs          []json.RawMessage `json:"jobs"`
+}
+
+// updateJobRecords rewrites job records that f changes
+func updateJobRecords(jobs *bolt.Bucket, f func(record map[string]interface{}) bool) error {
+	updated := make(map[string][]byte)
+	err := jobs.ForEach(func(k, v []byte) error {
+		var record map[string]interface{}
+		if err := json.Unmarshal(v, &record); err != nil {
+			return fmt.Errorf("Failed to parse job %q: %s", string(k), err.Error())
+		}
+		if !f(record) {
+			return nil
+		}
+		blob, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		updated[string(k)] = blob
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Buckets must not be changed while iterating them
+	for k, v := range updated {
+		if err := jobs.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getSchemaVersion(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket([]byte(metaBucketName))
+	if meta == nil {
+		return 0, nil
+	}
+	v := meta.Get([]byte(schemaVersionKey))
+	if v == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(v))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid schema version %q of job database", string(v))
+	}
+	return version, nil
+}
+
+func setSchemaVersion(tx *bolt.Tx, version int) error {
+	meta, err := tx.CreateBucketIfNotExists([]byte(metaBucketName))
+	if err != nil {
+		return err
+	}
+	return meta.Put([]byte(schemaVersionKey), []byte(strconv.Itoa(version)))
+}
+
+// migrateJobs applies pending migrations to the job database in the transaction
+func migrateJobs(tx *bolt.Tx) error {
+	version, err := getSchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	if version > LatestJobDBSchemaVersion {
+		return fmt.Errorf("Job database has schema version %d newer than %d supported by this version", version, LatestJobDBSchemaVersion)
+	}
+	jobs, err := tx.CreateBucketIfNotExists([]byte(jobBucketName))
+	if err != nil {
+		return err
+	}
+	for ; version < LatestJobDBSchemaVersion; version++ {
+		m := jobDBMigrations[version]
+		logger.Info.Printf("Migrating job database to schema version %d: %s", version+1, m.description)
+		if err := m.migrate(jobs); err != nil {
+			return fmt.Errorf("Failed to migrate job database to schema version %d: %s", version+1, err.Error())
+		}
+	}
+	return setSchemaVersion(tx, version)
+}
+
+// migrateJobDB brings the job database to the latest schema version.
+// A copy of the database is made before migrating jobs. All migrations
+// are applied in a single transaction and nothing changes if any fails.
+func migrateJobDB(db *bolt.DB) error {
+	err := db.View(func(tx *bolt.Tx) error {
+		version, err := getSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		jobs := tx.Bucket([]byte(jobBucketName))
+		if version >= LatestJobDBSchemaVersion || jobs == nil || jobs.Stats().KeyN < 1 {
+			return nil
+		}
+		backupPath := fmt.Sprintf("%s.v%d.bak", db.Path(), version)
+		logger.Info.Printf("Backing up job database of schema version %d to %s", version, backupPath)
+		return tx.CopyFile(backupPath, 0600)
+	})
+	if err != nil {
+		return err
+	}
+	return db.Update(migrateJobs)
+}
+
+func exportJobs(tx *bolt.Tx) (*JobArchive, error) {
+	version, err := getSchemaVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+	archive := &JobArchive{
+		SchemaVersion: version,
+		ExportedAt:    time.Now().UTC(),
+		Jobs:          []json.RawMessage{},
+	}
+	jobs := tx.Bucket([]byte(jobBucketName))
+	if jobs == nil {
+		return archive, nil
+	}
+	archive.JobSequence = jobs.Sequence()
+	err = jobs.ForEach(func(k, v []byte) error {
+		// Values are valid only in the transaction
+		archive.Jobs = append(archive.Jobs, append(json.RawMessage{}, v...))
+		return nil
+	})
+	return archive, err
+}
+
+// ExportJobs exports jobs in the job database to an archive
+func (cgm *CloudGoalManager) ExportJobs() (archive *JobArchive, err error) {
+	err = cgm.jobDB.View(func(tx *bolt.Tx) error {
+		archive, err = exportJobs(tx)
+		return err
+	})
+	return
+}
+
+// SnapshotJobDB writes a consistent copy of the job database to w
+// while the database stays available
+func (cgm *CloudGoalManager) SnapshotJobDB(w io.Writer) error {
+	return cgm.jobDB.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(w)
+		return err
+	})
+}
+
+func openJobDBFile(dataPath string, readOnly bool) (*bolt.DB, error) {
+	dbPath := path.Join(dataPath, jobDBFileName)
+	if readOnly {
+		if _, err := os.Stat(dbPath); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: readOnly})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("Job database %s is in use. Stop the cloud scheduler or use its snapshot API", dbPath)
+	}
+	return db, err
+}
+
+// ExportJobDB exports jobs in the job database under dataPath to an archive.
+// The database must not be in use by a cloud scheduler.
+func ExportJobDB(dataPath string) (archive *JobArchive, err error) {
+	db, err := openJobDBFile(dataPath, true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		archive, err = exportJobs(tx)
+		return err
+	})
+	return
+}
+
+// ImportJobDB imports jobs in the archive to the job database under dataPath
+// and migrates them to the latest schema version. If overwrite is set, jobs in the
+// archive replace jobs of the same ID in the database and other jobs are kept;
+// otherwise the database must have no job.
+// The database must not be in use by a cloud scheduler.
+func ImportJobDB(dataPath string, archive *JobArchive, overwrite bool) error {
+	if archive.SchemaVersion > LatestJobDBSchemaVersion {
+		return fmt.Errorf("Archive has schema version %d newer than %d supported by this version", archive.SchemaVersion, LatestJobDBSchemaVersion)
+	}
+	db, err := openJobDBFile(dataPath, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		if jobs := tx.Bucket([]byte(jobBucketName)); jobs != nil && jobs.Stats().KeyN > 0 {
+			if !overwrite {
+				return fmt.Errorf("Job database already has %d jobs", jobs.Stats().KeyN)
+			}
+		}
+		// Jobs kept in the database are brought to the latest schema version first
+		if err := migrateJobs(tx); err != nil {
+			return err
+		}
+		jobs := tx.Bucket([]byte(jobBucketName))
+		// Jobs in the archive are migrated apart from the jobs in the database
+		staged, err := tx.CreateBucket([]byte(importBucketName))
+		if err != nil {
+			return err
+		}
+		sequence := jobs.Sequence()
+		if archive.JobSequence > sequence {
+			sequence = archive.JobSequence
+		}
+		for _, blob := range archive.Jobs {
+			var record struct {
+				JobID string `json:"job_id"`
+			}
+			if err := json.Unmarshal(blob, &record); err != nil {
+				return fmt.Errorf("Failed to parse job in archive: %s", err.Error())
+			}
+			if record.JobID == "" {
+				return fmt.Errorf("Job in archive has no job_id")
+			}
+			if id, err := strconv.ParseUint(record.JobID, 10, 64); err == nil && id > sequence {
+				sequence = id
+			}
+			if err := staged.Put([]byte(record.JobID), blob); err != nil {
+				return err
+			}
+		}
+		for version := archive.SchemaVersion; version < LatestJobDBSchemaVersion; version++ {
+			m := jobDBMigrations[version]
+			if err := m.migrate(staged); err != nil {
+				return fmt.Errorf("Failed to migrate archive to schema version %d: %s", version+1, err.Error())
+			}
+		}
+		if err := staged.ForEach(func(k, v []byte) error {
+			return jobs.Put(k, v)
+		}); err != nil {
+			return err
+		}
+		if err := tx.DeleteBucket([]byte(importBucketName)); err != nil {
+			return err
+		}
+		// New jobs must not reuse IDs of imported jobs
+		return jobs.SetSequence(sequence)
+	})
+}
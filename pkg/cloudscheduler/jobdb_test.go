@@ -0,0 +1,226 @@
+package cloudscheduler
+
+import (
+	"encoding/json"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func newTestGoalManager(t *testing.T, dataDir string) *CloudGoalManager {
+	cs := NewCloudSchedulerBuilder(&CloudSchedulerConfig{DataDir: dataDir}).
+		AddGoalManager().
+		Build()
+	if err := cs.GoalManager.OpenJobDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cs.GoalManager.CloseJobDB() })
+	return cs.GoalManager
+}
+
+func TestMigrateJobDB(t *testing.T) {
+	lastUpdated := "2022-06-01T10:00:00Z"
+	tests := map[string]struct {
+		SchemaVersion int
+		Record        map[string]interface{}
+		CreatedAt     string
+		Error         bool
+	}{
+		"missing": {
+			Record:    map[string]interface{}{"job_id": "1", "last_updated": lastUpdated},
+			CreatedAt: lastUpdated,
+		},
+		"zero": {
+			Record:    map[string]interface{}{"job_id": "1", "last_updated": lastUpdated, "created_at": "0001-01-01T00:00:00Z"},
+			CreatedAt: lastUpdated,
+		},
+		"set": {
+			Record:    map[string]interface{}{"job_id": "1", "last_updated": lastUpdated, "created_at": "2022-05-01T10:00:00Z"},
+			CreatedAt: "2022-05-01T10:00:00Z",
+		},
+		"newer": {
+			SchemaVersion: LatestJobDBSchemaVersion + 1,
+			Record:        map[string]interface{}{"job_id": "1", "last_updated": lastUpdated},
+			Error:         true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, err := bolt.Open(path.Join(t.TempDir(), jobDBFileName), 0600, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			err = db.Update(func(tx *bolt.Tx) error {
+				jobs, err := tx.CreateBucket([]byte(jobBucketName))
+				if err != nil {
+					return err
+				}
+				blob, _ := json.Marshal(tc.Record)
+				if err := jobs.Put([]byte("1"), blob); err != nil {
+					return err
+				}
+				if tc.SchemaVersion > 0 {
+					return setSchemaVersion(tx, tc.SchemaVersion)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = migrateJobDB(db)
+			if tc.Error {
+				if err == nil {
+					t.Errorf("Wanted an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			db.View(func(tx *bolt.Tx) error {
+				version, _ := getSchemaVersion(tx)
+				if version != LatestJobDBSchemaVersion {
+					t.Errorf("Schema version mismatch: wanted %d, got %d", LatestJobDBSchemaVersion, version)
+				}
+				var record map[string]interface{}
+				json.Unmarshal(tx.Bucket([]byte(jobBucketName)).Get([]byte("1")), &record)
+				if record["created_at"] != tc.CreatedAt {
+					t.Errorf("created_at mismatch: wanted %s, got %v", tc.CreatedAt, record["created_at"])
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestExportImportJobDB(t *testing.T) {
+	tests := map[string]struct {
+		Jobs      int
+		Existing  int
+		Overwrite bool
+		Error     bool
+	}{
+		"empty": {
+			Jobs: 0,
+		},
+		"jobs": {
+			Jobs: 3,
+		},
+		"existing": {
+			Jobs:     2,
+			Existing: 1,
+			Error:    true,
+		},
+		"overwrite": {
+			Jobs:      2,
+			Existing:  1,
+			Overwrite: true,
+		},
+		// Jobs not in the archive stay in the database
+		"overwritekeeps": {
+			Jobs:      1,
+			Existing:  3,
+			Overwrite: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			src := newTestGoalManager(t, t.TempDir())
+			for i := 0; i < tc.Jobs; i++ {
+				src.AddJob(&datatype.Job{Name: "test"})
+			}
+			archive, err := src.ExportJobs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(archive.Jobs) != tc.Jobs || archive.SchemaVersion != LatestJobDBSchemaVersion {
+				t.Fatalf("Archive mismatch: wanted %d jobs of version %d, got %d of version %d",
+					tc.Jobs, LatestJobDBSchemaVersion, len(archive.Jobs), archive.SchemaVersion)
+			}
+			// Archives go through JSON when exported to a file
+			blob, _ := json.Marshal(archive)
+			archive = &JobArchive{}
+			if err := json.Unmarshal(blob, archive); err != nil {
+				t.Fatal(err)
+			}
+
+			dstDir := t.TempDir()
+			if tc.Existing > 0 {
+				dst := newTestGoalManager(t, dstDir)
+				for i := 0; i < tc.Existing; i++ {
+					dst.AddJob(&datatype.Job{Name: "existing"})
+				}
+				dst.CloseJobDB()
+			}
+			err = ImportJobDB(dstDir, archive, tc.Overwrite)
+			if tc.Error {
+				if err == nil {
+					t.Errorf("Wanted an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := newTestGoalManager(t, dstDir)
+			jobs := dst.GetJobs()
+			wantJobs := tc.Jobs
+			if tc.Existing > wantJobs {
+				wantJobs = tc.Existing
+			}
+			if len(jobs) != wantJobs {
+				t.Errorf("Job count mismatch: wanted %d, got %d", wantJobs, len(jobs))
+			}
+			for _, job := range jobs {
+				wantName := "test"
+				if id, _ := strconv.Atoi(job.JobID); id > tc.Jobs {
+					wantName = "existing"
+				}
+				if job.Name != wantName || job.CreatedAt.Equal(time.Time{}) {
+					t.Errorf("Job %s was not imported as exported: %+v", job.JobID, job)
+				}
+			}
+			// New jobs continue the sequence of imported jobs
+			want := len(jobs) + 1
+			if got := dst.AddJob(&datatype.Job{Name: "new"}); got != strconv.Itoa(want) {
+				t.Errorf("Job ID mismatch: wanted %d, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestImportOldArchiveOverwrite(t *testing.T) {
+	dataDir := t.TempDir()
+	dst := newTestGoalManager(t, dataDir)
+	dst.AddJob(&datatype.Job{Name: "existing"})
+	dst.AddJob(&datatype.Job{Name: "existing"})
+	dst.CloseJobDB()
+	lastUpdated := "2022-06-01T10:00:00Z"
+	archive := &JobArchive{
+		SchemaVersion: 0,
+		JobSequence:   1,
+		Jobs:          []json.RawMessage{json.RawMessage(`{"job_id": "1", "name": "old", "last_updated": "` + lastUpdated + `"}`)},
+	}
+	if err := ImportJobDB(dataDir, archive, true); err != nil {
+		t.Fatal(err)
+	}
+	dst = newTestGoalManager(t, dataDir)
+	old, err := dst.GetJob("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.Name != "old" || old.CreatedAt.Format(time.RFC3339) != lastUpdated {
+		t.Errorf("Job in archive was not migrated when imported: %+v", old)
+	}
+	if kept, err := dst.GetJob("2"); err != nil || kept.Name != "existing" {
+		t.Errorf("Job not in archive must be kept: %+v (%v)", kept, err)
+	}
+	if got := dst.AddJob(&datatype.Job{Name: "new"}); got != "3" {
+		t.Errorf("Job ID mismatch: wanted 3, got %s", got)
+	}
+}
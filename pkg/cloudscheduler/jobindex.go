@@ -0,0 +1,344 @@
+package cloudscheduler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const (
+	JobSortByID      = "id"
+	JobSortByName    = "name"
+	JobSortByCreated = "created"
+	JobSortByUpdated = "updated"
+)
+
+// sortableTimeFormat formats time in a fixed width so that formatted times sort as strings
+const sortableTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// JobQuery structs filters, sort order, and page of a job listing
+type JobQuery struct {
+	Statuses      []datatype.JobStatus
+	User          string
+	Node          string
+	NameContains  string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	SortBy        string
+	Descending    bool
+	// Limit is the maximum number of jobs in a page. Zero means no limit
+	Limit int
+	// Cursor is the next_cursor returned with the previous page
+	Cursor string
+}
+
+// jobQueryParameters are query parameters understood by ParseJobQuery
+var jobQueryParameters = []string{
+	"status", "user", "node", "name",
+	"created_after", "created_before", "updated_after", "updated_before",
+	"sort", "limit", "cursor",
+}
+
+// hasJobQuery returns true if any query parameter of ParseJobQuery is given
+func hasJobQuery(values url.Values) bool {
+	for _, key := range jobQueryParameters {
+		if _, exist := values[key]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseJobQuery parses query parameters of a job listing request.
+//
+// Supported parameters are status (comma-separated), user, node, name (substring),
+// created_after, created_before, updated_after, updated_before (RFC3339),
+// sort (id, name, created, or updated; prefix with - for descending), limit, and cursor.
+func ParseJobQuery(values url.Values) (*JobQuery, error) {
+	q := &JobQuery{
+		User:         values.Get("user"),
+		Node:         values.Get("node"),
+		NameContains: values.Get("name"),
+		SortBy:       JobSortByID,
+		Cursor:       values.Get("cursor"),
+	}
+	if v := values.Get("status"); v != "" {
+		for _, status := range strings.Split(v, ",") {
+			q.Statuses = append(q.Statuses, datatype.JobStatus(strings.TrimSpace(status)))
+		}
+	}
+	for key, t := range map[string]*time.Time{
+		"created_after":  &q.CreatedAfter,
+		"created_before": &q.CreatedBefore,
+		"updated_after":  &q.UpdatedAfter,
+		"updated_before": &q.UpdatedBefore,
+	} {
+		if v := values.Get(key); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to parse %s: %s", key, err.Error())
+			}
+			*t = parsed
+		}
+	}
+	if v := values.Get("sort"); v != "" {
+		if strings.HasPrefix(v, "-") {
+			q.Descending = true
+			v = v[1:]
+		}
+		switch v {
+		case JobSortByID, JobSortByName, JobSortByCreated, JobSortByUpdated:
+			q.SortBy = v
+		default:
+			return nil, fmt.Errorf("Unknown sort key %q", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("Invalid limit %q", v)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// jobIndexEntry holds fields of a job used to filter and sort jobs
+type jobIndexEntry struct {
+	jobID       string
+	name        string
+	user        string
+	status      datatype.JobStatus
+	nodes       map[string]bool
+	createdAt   time.Time
+	lastUpdated time.Time
+}
+
+func (e *jobIndexEntry) sortKey(sortBy string) string {
+	switch sortBy {
+	case JobSortByName:
+		return strings.ToLower(e.name)
+	case JobSortByCreated:
+		return e.createdAt.UTC().Format(sortableTimeFormat)
+	case JobSortByUpdated:
+		return e.lastUpdated.UTC().Format(sortableTimeFormat)
+	default:
+		return ""
+	}
+}
+
+// paddedID returns the job ID padded with zeros so that numeric IDs sort as strings
+func (e *jobIndexEntry) paddedID() string {
+	if id, err := strconv.ParseUint(e.jobID, 10, 64); err == nil {
+		return fmt.Sprintf("%020d", id)
+	}
+	return e.jobID
+}
+
+func (e *jobIndexEntry) matches(q *JobQuery) bool {
+	if len(q.Statuses) > 0 {
+		found := false
+		for _, status := range q.Statuses {
+			if e.status == status {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.User != "" && e.user != q.User {
+		return false
+	}
+	if q.Node != "" && !e.nodes[strings.ToLower(q.Node)] {
+		return false
+	}
+	if q.NameContains != "" && !strings.Contains(strings.ToLower(e.name), strings.ToLower(q.NameContains)) {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !e.createdAt.After(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && (e.createdAt.IsZero() || !e.createdAt.Before(q.CreatedBefore)) {
+		return false
+	}
+	if !q.UpdatedAfter.IsZero() && !e.lastUpdated.After(q.UpdatedAfter) {
+		return false
+	}
+	if !q.UpdatedBefore.IsZero() && !e.lastUpdated.Before(q.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// JobIndex keeps fields of all jobs in memory to query jobs without scanning the job database.
+// Jobs are indexed by status, user, and node.
+type JobIndex struct {
+	mu       sync.RWMutex
+	entries  map[string]*jobIndexEntry
+	byStatus map[string]map[string]bool
+	byUser   map[string]map[string]bool
+	byNode   map[string]map[string]bool
+}
+
+func NewJobIndex() *JobIndex {
+	return &JobIndex{
+		entries:  make(map[string]*jobIndexEntry),
+		byStatus: make(map[string]map[string]bool),
+		byUser:   make(map[string]map[string]bool),
+		byNode:   make(map[string]map[string]bool),
+	}
+}
+
+// Put adds the job to the index or updates the job in the index.
+// It returns the status of the job before the update if the job was in the index.
+func (ji *JobIndex) Put(job *datatype.Job) (previous datatype.JobStatus, existed bool) {
+	entry := &jobIndexEntry{
+		jobID:       job.JobID,
+		name:        job.Name,
+		user:        job.User,
+		status:      job.Status,
+		nodes:       make(map[string]bool),
+		createdAt:   job.CreatedAt,
+		lastUpdated: job.LastUpdated,
+	}
+	for nodeName := range job.Nodes {
+		entry.nodes[strings.ToLower(nodeName)] = true
+	}
+	if job.ScienceGoal != nil {
+		for _, subGoal := range job.ScienceGoal.SubGoals {
+			entry.nodes[strings.ToLower(subGoal.Name)] = true
+		}
+	}
+	ji.mu.Lock()
+	defer ji.mu.Unlock()
+	if old, exist := ji.entries[job.JobID]; exist {
+		previous, existed = old.status, true
+	}
+	ji.remove(job.JobID)
+	ji.entries[entry.jobID] = entry
+	addToSet(ji.byStatus, string(entry.status), entry.jobID)
+	addToSet(ji.byUser, entry.user, entry.jobID)
+	for nodeName := range entry.nodes {
+		addToSet(ji.byNode, nodeName, entry.jobID)
+	}
+	return
+}
+
+func (ji *JobIndex) remove(jobID string) {
+	entry, exist := ji.entries[jobID]
+	if !exist {
+		return
+	}
+	delete(ji.byStatus[string(entry.status)], jobID)
+	delete(ji.byUser[entry.user], jobID)
+	for nodeName := range entry.nodes {
+		delete(ji.byNode[nodeName], jobID)
+	}
+	delete(ji.entries, jobID)
+}
+
+// Query returns IDs of jobs matched with the query in the requested order.
+// If more jobs follow the page, nextCursor is set to query the next page.
+func (ji *JobIndex) Query(q *JobQuery) (jobIDs []string, nextCursor string, err error) {
+	var afterKey string
+	if q.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, "", fmt.Errorf("Invalid cursor %q", q.Cursor)
+		}
+		afterKey = string(decoded)
+	}
+	ji.mu.RLock()
+	type keyedEntry struct {
+		key   string
+		jobID string
+	}
+	var matched []keyedEntry
+	for jobID := range ji.candidates(q) {
+		entry := ji.entries[jobID]
+		if entry.matches(q) {
+			matched = append(matched, keyedEntry{
+				key:   entry.sortKey(q.SortBy) + "\x00" + entry.paddedID(),
+				jobID: jobID,
+			})
+		}
+	}
+	ji.mu.RUnlock()
+	sort.Slice(matched, func(i, j int) bool {
+		if q.Descending {
+			return matched[i].key > matched[j].key
+		}
+		return matched[i].key < matched[j].key
+	})
+	start := 0
+	if afterKey != "" {
+		start = sort.Search(len(matched), func(i int) bool {
+			if q.Descending {
+				return matched[i].key < afterKey
+			}
+			return matched[i].key > afterKey
+		})
+	}
+	end := len(matched)
+	if q.Limit > 0 && start+q.Limit < end {
+		end = start + q.Limit
+		nextCursor = base64.RawURLEncoding.EncodeToString([]byte(matched[end-1].key))
+	}
+	for _, m := range matched[start:end] {
+		jobIDs = append(jobIDs, m.jobID)
+	}
+	return
+}
+
+// candidates returns the smallest set of job IDs from the indices used by the query.
+// It must be called with the lock held.
+func (ji *JobIndex) candidates(q *JobQuery) map[string]bool {
+	var sets []map[string]bool
+	if len(q.Statuses) > 0 {
+		union := make(map[string]bool)
+		for _, status := range q.Statuses {
+			for jobID := range ji.byStatus[string(status)] {
+				union[jobID] = true
+			}
+		}
+		sets = append(sets, union)
+	}
+	if q.User != "" {
+		sets = append(sets, ji.byUser[q.User])
+	}
+	if q.Node != "" {
+		sets = append(sets, ji.byNode[strings.ToLower(q.Node)])
+	}
+	if len(sets) < 1 {
+		all := make(map[string]bool, len(ji.entries))
+		for jobID := range ji.entries {
+			all[jobID] = true
+		}
+		return all
+	}
+	smallest := sets[0]
+	for _, set := range sets[1:] {
+		if len(set) < len(smallest) {
+			smallest = set
+		}
+	}
+	return smallest
+}
+
+func addToSet(sets map[string]map[string]bool, key string, jobID string) {
+	if _, exist := sets[key]; !exist {
+		sets[key] = make(map[string]bool)
+	}
+	sets[key][jobID] = true
+}
@@ -0,0 +1,102 @@
+package cloudscheduler
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestJobIndexQuery(t *testing.T) {
+	base := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	newJob := func(jobID string, name string, user string, status datatype.JobStatus, node string, age int) *datatype.Job {
+		job := datatype.NewJob(name, user, jobID)
+		job.AddNodes([]string{node})
+		job.Status = status
+		job.CreatedAt = base.Add(time.Duration(age) * time.Hour)
+		job.LastUpdated = job.CreatedAt
+		return job
+	}
+	ji := NewJobIndex()
+	for _, job := range []*datatype.Job{
+		newJob("1", "imagesampler", "alice", datatype.JobRunning, "W001", 1),
+		newJob("2", "cloudcover", "bob", datatype.JobRemoved, "W002", 2),
+		newJob("10", "birdsong", "alice", datatype.JobSubmitted, "W002", 3),
+		newJob("3", "imagesampler-top", "bob", datatype.JobRunning, "W001", 4),
+	} {
+		ji.Put(job)
+	}
+	// Jobs are re-indexed when updated
+	ji.Put(newJob("2", "cloudcover", "bob", datatype.JobRunning, "W003", 2))
+	tests := map[string]struct {
+		Query string
+		Want  []string
+	}{
+		"all": {
+			Query: "",
+			Want:  []string{"1", "2", "3", "10"},
+		},
+		"status": {
+			Query: "status=Running,Submitted&sort=-id",
+			Want:  []string{"10", "3", "2", "1"},
+		},
+		"userandnode": {
+			Query: "user=alice&node=w002",
+			Want:  []string{"10"},
+		},
+		"reindexednode": {
+			Query: "node=W002",
+			Want:  []string{"10"},
+		},
+		"name": {
+			Query: "name=Sampler&sort=name",
+			Want:  []string{"1", "3"},
+		},
+		"created": {
+			Query: "created_after=2022-01-01T01:30:00Z&created_before=2022-01-01T03:30:00Z&sort=-created",
+			Want:  []string{"10", "2"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tc.Query)
+			q, err := ParseJobQuery(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := ji.Query(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.Want) {
+				t.Errorf("Jobs mismatch: wanted %v, got %v", tc.Want, got)
+			}
+		})
+	}
+}
+
+func TestJobIndexQueryPages(t *testing.T) {
+	ji := NewJobIndex()
+	for _, jobID := range []string{"1", "2", "3", "4", "5"} {
+		ji.Put(datatype.NewJob("test", "alice", jobID))
+	}
+	q := &JobQuery{SortBy: JobSortByID, Limit: 2}
+	var pages [][]string
+	for {
+		jobIDs, nextCursor, err := ji.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, jobIDs)
+		if nextCursor == "" {
+			break
+		}
+		q.Cursor = nextCursor
+	}
+	want := [][]string{{"1", "2"}, {"3", "4"}, {"5"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("Pages mismatch: wanted %v, got %v", want, pages)
+	}
+}
@@ -0,0 +1,195 @@
+package cloudscheduler
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// Labels of validation failures by check
+const (
+	validationCheckManifest = "manifest"
+	validationCheckQuota    = "quota"
+	validationCheckConflict = "conflict"
+	validationCheckCapacity = "capacity"
+)
+
+// Metrics holds Prometheus metrics of the cloud scheduler.
+// Metrics are updated as things happen so that scraping does not touch the job database.
+type Metrics struct {
+	jobsGrandTotal     prometheus.Gauge
+	jobsTotal          *prometheus.GaugeVec
+	subscribers        *prometheus.GaugeVec
+	pushes             *prometheus.CounterVec
+	droppedPushes      *prometheus.CounterVec
+	validationFailures *prometheus.CounterVec
+	eventsReceived     *prometheus.CounterVec
+	goalPropagation    prometheus.Histogram
+	apiRequestDuration *prometheus.HistogramVec
+
+	// pendingGoals holds when goals were pushed to nodes, by node and goal ID,
+	// until the nodes report back that they received the goals
+	pendingGoals map[string]map[string]time.Time
+	mu           sync.Mutex
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		jobsGrandTotal: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scheduler_jobs_total",
+			Help: "Total number of jobs in the scheduler",
+		}),
+		jobsTotal: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scheduler_jobs_count",
+			Help: "Number of jobs per status",
+		}, []string{"status"}),
+		subscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scheduler_sse_subscribers",
+			Help: "Number of nodes connected to the goal stream",
+		}, []string{"node"}),
+		pushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_goal_pushes_total",
+			Help: "Number of goal updates pushed to subscribers of nodes",
+		}, []string{"node"}),
+		droppedPushes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_goal_pushes_dropped_total",
+			Help: "Number of goal updates dropped because subscribers of nodes were not ready",
+		}, []string{"node"}),
+		validationFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_validation_failures_total",
+			Help: "Number of job validations failed per check",
+		}, []string{"check"}),
+		eventsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_events_received_total",
+			Help: "Number of events received from nodes per type",
+		}, []string{"type"}),
+		goalPropagation: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "scheduler_goal_propagation_seconds",
+			Help:    "Time from pushing a goal to a node until the node reports it received the goal",
+			Buckets: []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+		}),
+		apiRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scheduler_api_request_duration_seconds",
+			Help:    "Latency of API requests per route",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		pendingGoals: make(map[string]map[string]time.Time),
+	}
+	// Statuses are exported even if no job is in the status
+	for _, status := range []string{"submitted", "running", "completed"} {
+		m.jobsTotal.WithLabelValues(status)
+	}
+	return m
+}
+
+// Register registers all metrics to the registry
+func (m *Metrics) Register(reg prometheus.Registerer) {
+	reg.MustRegister(
+		m.jobsGrandTotal,
+		m.jobsTotal,
+		m.subscribers,
+		m.pushes,
+		m.droppedPushes,
+		m.validationFailures,
+		m.eventsReceived,
+		m.goalPropagation,
+		m.apiRequestDuration,
+	)
+}
+
+// jobStatusLabel groups job statuses into the labels exported in scheduler_jobs_count
+func jobStatusLabel(status datatype.JobStatus) string {
+	// TODO: Do we count removed jobs for the completed jobs?
+	switch status {
+	case datatype.JobCreated, datatype.JobDrafted, datatype.JobSuspended, datatype.JobSubmitted:
+		return "submitted"
+	case datatype.JobRunning:
+		return "running"
+	case datatype.JobComplete, datatype.JobRemoved:
+		return "completed"
+	}
+	return ""
+}
+
+// JobStatusChanged updates the job counts. existed is false if the job is new
+func (m *Metrics) JobStatusChanged(previous datatype.JobStatus, existed bool, current datatype.JobStatus) {
+	if !existed {
+		m.jobsGrandTotal.Inc()
+	} else if label := jobStatusLabel(previous); label != "" {
+		m.jobsTotal.WithLabelValues(label).Dec()
+	}
+	if label := jobStatusLabel(current); label != "" {
+		m.jobsTotal.WithLabelValues(label).Inc()
+	}
+}
+
+func (m *Metrics) SubscriberAdded(nodeName string) {
+	m.subscribers.WithLabelValues(nodeName).Inc()
+}
+
+func (m *Metrics) SubscriberRemoved(nodeName string) {
+	m.subscribers.WithLabelValues(nodeName).Dec()
+}
+
+func (m *Metrics) Pushed(nodeName string, dropped bool) {
+	if dropped {
+		m.droppedPushes.WithLabelValues(nodeName).Inc()
+	} else {
+		m.pushes.WithLabelValues(nodeName).Inc()
+	}
+}
+
+func (m *Metrics) ValidationFailed(check string) {
+	m.validationFailures.WithLabelValues(check).Inc()
+}
+
+func (m *Metrics) EventReceived(event *datatype.Event) {
+	m.eventsReceived.WithLabelValues(string(event.Type)).Inc()
+}
+
+func (m *Metrics) ObserveAPIRequest(route string, method string, code int, d time.Duration) {
+	m.apiRequestDuration.WithLabelValues(route, method, strconv.Itoa(code)).Observe(d.Seconds())
+}
+
+// GoalsPushed records when goals were pushed to the node. Goals already waiting
+// for the node to report keep the time of their first push, and goals no longer
+// assigned to the node are forgotten.
+func (m *Metrics) GoalsPushed(nodeName string, goalIDs []string, t time.Time) {
+	nodeName = strings.ToLower(nodeName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	previous := m.pendingGoals[nodeName]
+	pending := make(map[string]time.Time)
+	for _, goalID := range goalIDs {
+		if pushedAt, exist := previous[goalID]; exist {
+			pending[goalID] = pushedAt
+		} else {
+			pending[goalID] = t
+		}
+	}
+	if len(pending) > 0 {
+		m.pendingGoals[nodeName] = pending
+	} else {
+		delete(m.pendingGoals, nodeName)
+	}
+}
+
+// GoalReceived observes propagation latency of the goal if it was pushed to the node
+func (m *Metrics) GoalReceived(nodeName string, goalID string, t time.Time) {
+	nodeName = strings.ToLower(nodeName)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pushedAt, exist := m.pendingGoals[nodeName][goalID]
+	if !exist {
+		return
+	}
+	m.goalPropagation.Observe(t.Sub(pushedAt).Seconds())
+	delete(m.pendingGoals[nodeName], goalID)
+	if len(m.pendingGoals[nodeName]) < 1 {
+		delete(m.pendingGoals, nodeName)
+	}
+}
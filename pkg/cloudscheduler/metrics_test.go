@@ -0,0 +1,116 @@
+package cloudscheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestMetricsJobCounts(t *testing.T) {
+	tests := map[string]struct {
+		Statuses  map[string][]datatype.JobStatus
+		Total     float64
+		Submitted float64
+		Running   float64
+		Completed float64
+	}{
+		"created": {
+			Statuses:  map[string][]datatype.JobStatus{"1": {datatype.JobCreated}},
+			Total:     1,
+			Submitted: 1,
+		},
+		"running": {
+			Statuses: map[string][]datatype.JobStatus{
+				"1": {datatype.JobCreated, datatype.JobSubmitted, datatype.JobRunning},
+				"2": {datatype.JobCreated, datatype.JobSubmitted},
+			},
+			Total:     2,
+			Submitted: 1,
+			Running:   1,
+		},
+		"removed": {
+			Statuses: map[string][]datatype.JobStatus{
+				"1": {datatype.JobCreated, datatype.JobSubmitted, datatype.JobRunning, datatype.JobRemoved},
+				"2": {datatype.JobCreated, datatype.JobSuspended, datatype.JobRemoved},
+			},
+			Total:     2,
+			Completed: 2,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewMetrics()
+			ji := NewJobIndex()
+			for jobID, statuses := range tc.Statuses {
+				for _, status := range statuses {
+					previous, existed := ji.Put(&datatype.Job{JobID: jobID, Status: status})
+					m.JobStatusChanged(previous, existed, status)
+				}
+			}
+			if got := testutil.ToFloat64(m.jobsGrandTotal); got != tc.Total {
+				t.Errorf("Total mismatch: wanted %v, got %v", tc.Total, got)
+			}
+			for label, want := range map[string]float64{
+				"submitted": tc.Submitted,
+				"running":   tc.Running,
+				"completed": tc.Completed,
+			} {
+				if got := testutil.ToFloat64(m.jobsTotal.WithLabelValues(label)); got != want {
+					t.Errorf("%s mismatch: wanted %v, got %v", label, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricsGoalPropagation(t *testing.T) {
+	pushedAt := time.Now()
+	tests := map[string]struct {
+		Pushed   [][]string
+		Received []string
+		Want     uint64
+	}{
+		"received": {
+			Pushed:   [][]string{{"goal-a", "goal-b"}},
+			Received: []string{"goal-a", "goal-b"},
+			Want:     2,
+		},
+		"notpushed": {
+			Pushed:   [][]string{{"goal-a"}},
+			Received: []string{"goal-b"},
+			Want:     0,
+		},
+		"receivedonce": {
+			Pushed:   [][]string{{"goal-a"}},
+			Received: []string{"goal-a", "goal-a"},
+			Want:     1,
+		},
+		"goalremoved": {
+			Pushed:   [][]string{{"goal-a", "goal-b"}, {"goal-b"}},
+			Received: []string{"goal-a", "goal-b"},
+			Want:     1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewMetrics()
+			for _, goalIDs := range tc.Pushed {
+				m.GoalsPushed("W001", goalIDs, pushedAt)
+			}
+			for _, goalID := range tc.Received {
+				m.GoalReceived("w001", goalID, pushedAt.Add(time.Second))
+			}
+			var metric dto.Metric
+			if err := m.goalPropagation.Write(&metric); err != nil {
+				t.Fatal(err)
+			}
+			count := metric.GetHistogram().GetSampleCount()
+			if count != tc.Want {
+				t.Errorf("Observation count mismatch: wanted %d, got %d", tc.Want, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package cloudscheduler
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// NodeIdentityMapper maps identities in client certificates of nodes to node VSNs.
+//
+// An identity is the common name (CN) or a DNS subject alternative name (SAN)
+// of a certificate. Without an identity file, identities are the VSNs of nodes.
+// With an identity file, only identities listed in the file are mapped to the VSN given
+// in the file, for example,
+//
+//	node-000048b02d15bc7c.beehive: W023
+type NodeIdentityMapper struct {
+	identities map[string]string
+}
+
+func NewNodeIdentityMapper() *NodeIdentityMapper {
+	return &NodeIdentityMapper{}
+}
+
+// Load loads the identity file. Nothing is loaded if filePath is empty
+func (m *NodeIdentityMapper) Load(filePath string) error {
+	if filePath == "" {
+		return nil
+	}
+	blob, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	var identities map[string]string
+	if err := yaml.Unmarshal(blob, &identities); err != nil {
+		return fmt.Errorf("Failed to parse node identity file %s: %s", filePath, err.Error())
+	}
+	m.identities = make(map[string]string)
+	for identity, vsn := range identities {
+		m.identities[strings.ToLower(identity)] = strings.ToLower(vsn)
+	}
+	logger.Info.Printf("Loaded %d node identities from %s", len(m.identities), filePath)
+	return nil
+}
+
+// VSNs returns VSNs of the nodes the certificate identifies
+func (m *NodeIdentityMapper) VSNs(cert *x509.Certificate) (vsns []string) {
+	identities := append([]string{cert.Subject.CommonName}, cert.DNSNames...)
+	for _, identity := range identities {
+		identity = strings.ToLower(identity)
+		if identity == "" {
+			continue
+		}
+		if m.identities == nil {
+			vsns = append(vsns, identity)
+		} else if vsn, exist := m.identities[identity]; exist {
+			vsns = append(vsns, vsn)
+		}
+	}
+	return
+}
+
+// Authorize returns true if the certificate identifies the node
+func (m *NodeIdentityMapper) Authorize(cert *x509.Certificate, vsn string) bool {
+	vsn = strings.ToLower(vsn)
+	for _, v := range m.VSNs(cert) {
+		if v == vsn {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package cloudscheduler
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/internal/testcert"
+)
+
+func TestNodeIdentityMapper(t *testing.T) {
+	tests := map[string]struct {
+		Identities string
+		CommonName string
+		DNSNames   []string
+		VSN        string
+		Authorized bool
+	}{
+		"commonname": {
+			CommonName: "W001",
+			VSN:        "w001",
+			Authorized: true,
+		},
+		"san": {
+			CommonName: "node",
+			DNSNames:   []string{"w002", "w001"},
+			VSN:        "W001",
+			Authorized: true,
+		},
+		"othernode": {
+			CommonName: "W001",
+			VSN:        "W002",
+			Authorized: false,
+		},
+		"mapped": {
+			Identities: "node-0001.beehive: W001\n",
+			CommonName: "node-0001.beehive",
+			VSN:        "W001",
+			Authorized: true,
+		},
+		"mappedsan": {
+			Identities: "node-0001.beehive: W001\n",
+			CommonName: "node",
+			DNSNames:   []string{"node-0001.beehive"},
+			VSN:        "W001",
+			Authorized: true,
+		},
+		"notmapped": {
+			Identities: "node-0001.beehive: W001\n",
+			CommonName: "W001",
+			VSN:        "W001",
+			Authorized: false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := NewNodeIdentityMapper()
+			if tc.Identities != "" {
+				filePath := path.Join(t.TempDir(), "identities.yaml")
+				os.WriteFile(filePath, []byte(tc.Identities), 0600)
+				if err := m.Load(filePath); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cert := &x509.Certificate{
+				Subject:  pkix.Name{CommonName: tc.CommonName},
+				DNSNames: tc.DNSNames,
+			}
+			if got := m.Authorize(cert, tc.VSN); got != tc.Authorized {
+				t.Errorf("Authorization mismatch: wanted %v, got %v", tc.Authorized, got)
+			}
+		})
+	}
+}
+
+func TestAPIServerGoalsOverTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcert.New(t, dir, "ca", &x509.Certificate{Subject: pkix.Name{CommonName: "test-ca"}}, nil)
+	otherCA := testcert.New(t, dir, "otherca", &x509.Certificate{Subject: pkix.Name{CommonName: "other-ca"}}, nil)
+	server := testcert.New(t, dir, "server", &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "cloudscheduler"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}, ca)
+	w001 := testcert.New(t, dir, "w001", &x509.Certificate{Subject: pkix.Name{CommonName: "W001"}}, ca)
+	w002 := testcert.New(t, dir, "w002", &x509.Certificate{Subject: pkix.Name{CommonName: "node"}, DNSNames: []string{"w002"}}, ca)
+	untrusted := testcert.New(t, dir, "untrusted", &x509.Certificate{Subject: pkix.Name{CommonName: "W001"}}, otherCA)
+
+	cs := NewCloudSchedulerBuilder(&CloudSchedulerConfig{
+		Name:             "test",
+		PushNotification: true,
+		GoalsOverTLSOnly: true,
+	}).
+		AddGoalManager().
+		AddAPIServer().
+		Build()
+	cs.APIServer.ConfigureAPIs(nil)
+	if err := cs.APIServer.ConfigureTLS(0, server.CertPath, server.KeyPath, ca.CertPath); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cs.APIServer.tlsServer.ServeTLS(listener, "", "")
+	plainListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cs.APIServer.server.Serve(plainListener)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		cs.APIServer.Shutdown(ctx)
+	}()
+
+	tests := map[string]struct {
+		Plain  bool
+		Cert   *testcert.Certificate
+		RootCA *testcert.Certificate
+		Path   string
+		Status int
+		Error  bool
+	}{
+		"commonname": {
+			Cert:   w001,
+			Path:   "/api/v1/goals/W001",
+			Status: http.StatusOK,
+		},
+		"san": {
+			Cert:   w002,
+			Path:   "/api/v1/goals/W002",
+			Status: http.StatusOK,
+		},
+		"othernode": {
+			Cert:   w001,
+			Path:   "/api/v1/goals/W002",
+			Status: http.StatusForbidden,
+		},
+		"otherstream": {
+			Cert:   w002,
+			Path:   "/api/v1/goals/W001/stream",
+			Status: http.StatusForbidden,
+		},
+		"nocert": {
+			Path:   "/api/v1/goals/W001",
+			Status: http.StatusUnauthorized,
+		},
+		"nocertroot": {
+			Path:   "/",
+			Status: http.StatusOK,
+		},
+		// Clients do not present certificates the server does not accept
+		"untrusted": {
+			Cert:   untrusted,
+			Path:   "/api/v1/goals/W001",
+			Status: http.StatusUnauthorized,
+		},
+		"untrustedserver": {
+			Cert:   w001,
+			RootCA: otherCA,
+			Path:   "/api/v1/goals/W001",
+			Error:  true,
+		},
+		"plain": {
+			Plain:  true,
+			Path:   "/api/v1/goals/W001",
+			Status: http.StatusForbidden,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var r *interfacing.HTTPRequest
+			if tc.Plain {
+				r = interfacing.NewHTTPRequest(fmt.Sprintf("http://%s", plainListener.Addr().String()))
+			} else {
+				var certPath, keyPath string
+				if tc.Cert != nil {
+					certPath, keyPath = tc.Cert.CertPath, tc.Cert.KeyPath
+				}
+				rootCA := ca
+				if tc.RootCA != nil {
+					rootCA = tc.RootCA
+				}
+				tlsConfig, err := interfacing.NewClientTLSConfig(rootCA.CertPath, certPath, keyPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = interfacing.NewHTTPRequestWithTLS(fmt.Sprintf("https://%s", listener.Addr().String()), tlsConfig)
+			}
+			resp, err := r.RequestGet(tc.Path, nil, nil)
+			if tc.Error {
+				if err == nil {
+					resp.Body.Close()
+					t.Errorf("Wanted an error, got status %d", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.Status {
+				t.Errorf("Status mismatch: wanted %d, got %d", tc.Status, resp.StatusCode)
+			}
+		})
+	}
+}
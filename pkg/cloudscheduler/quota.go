@@ -0,0 +1,229 @@
+package cloudscheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"gopkg.in/yaml.v2"
+)
+
+const quotaReloadInterval = 30 * time.Second
+
+// Quota structs limits applied to jobs of a user.
+//
+// A zero value means the limit is not set and is inherited from the group or default quota.
+// A negative value means unlimited.
+type Quota struct {
+	MaxActiveJobs        int `json:"max_active_jobs" yaml:"maxActiveJobs,omitempty"`
+	MaxNodesPerJob       int `json:"max_nodes_per_job" yaml:"maxNodesPerJob,omitempty"`
+	MaxPluginsPerNode    int `json:"max_plugins_per_node" yaml:"maxPluginsPerNode,omitempty"`
+	MaxPrivilegedPlugins int `json:"max_privileged_plugins" yaml:"maxPrivilegedPlugins,omitempty"`
+}
+
+// override applies limits set in the other quota
+func (q Quota) override(other Quota) Quota {
+	if other.MaxActiveJobs != 0 {
+		q.MaxActiveJobs = other.MaxActiveJobs
+	}
+	if other.MaxNodesPerJob != 0 {
+		q.MaxNodesPerJob = other.MaxNodesPerJob
+	}
+	if other.MaxPluginsPerNode != 0 {
+		q.MaxPluginsPerNode = other.MaxPluginsPerNode
+	}
+	if other.MaxPrivilegedPlugins != 0 {
+		q.MaxPrivilegedPlugins = other.MaxPrivilegedPlugins
+	}
+	return q
+}
+
+// Check returns a list of errors if the job exceeds the quota when it becomes active.
+// The usage must not include the job itself.
+func (q Quota) Check(usage *QuotaUsage, job *datatype.Job) (errorList []error) {
+	if exceeds(usage.ActiveJobs+1, q.MaxActiveJobs) {
+		errorList = append(errorList, fmt.Errorf("User %q exceeds the quota of %d active jobs", job.User, q.MaxActiveJobs))
+	}
+	if exceeds(len(job.Nodes), q.MaxNodesPerJob) {
+		errorList = append(errorList, fmt.Errorf("Job selects %d nodes exceeding the quota of %d nodes per job", len(job.Nodes), q.MaxNodesPerJob))
+	}
+	if job.ScienceGoal == nil {
+		return
+	}
+	privilegedPlugins := usage.PrivilegedPlugins
+	for _, subGoal := range job.ScienceGoal.SubGoals {
+		if n := usage.PluginsPerNode[subGoal.Name] + len(subGoal.Plugins); exceeds(n, q.MaxPluginsPerNode) {
+			errorList = append(errorList, fmt.Errorf("User %q would run %d plugins on %s exceeding the quota of %d plugins per node", job.User, n, subGoal.Name, q.MaxPluginsPerNode))
+		}
+		privilegedPlugins += countPrivilegedPlugins(subGoal)
+	}
+	if exceeds(privilegedPlugins, q.MaxPrivilegedPlugins) {
+		errorList = append(errorList, fmt.Errorf("User %q would run %d privileged plugins exceeding the quota of %d", job.User, privilegedPlugins, q.MaxPrivilegedPlugins))
+	}
+	return
+}
+
+func exceeds(value int, limit int) bool {
+	return limit > 0 && value > limit
+}
+
+func countPrivilegedPlugins(subGoal *datatype.SubGoal) (count int) {
+	for _, plugin := range subGoal.Plugins {
+		if plugin.PluginSpec != nil && plugin.PluginSpec.Privileged {
+			count += 1
+		}
+	}
+	return
+}
+
+// QuotaUsage structs current use of resources by active jobs of a user
+type QuotaUsage struct {
+	ActiveJobs        int            `json:"active_jobs"`
+	PluginsPerNode    map[string]int `json:"plugins_per_node"`
+	PrivilegedPlugins int            `json:"privileged_plugins"`
+}
+
+// NewQuotaUsage counts use of resources by active jobs of the user.
+// Jobs whose ID is in excludeJobIDs are not counted.
+func NewQuotaUsage(user string, jobs []*datatype.Job, excludeJobIDs ...string) *QuotaUsage {
+	usage := &QuotaUsage{
+		PluginsPerNode: make(map[string]int),
+	}
+	excluded := make(map[string]bool)
+	for _, jobID := range excludeJobIDs {
+		excluded[jobID] = true
+	}
+	for _, job := range jobs {
+		if job.User != user || excluded[job.JobID] {
+			continue
+		}
+		switch job.Status {
+		case datatype.JobSubmitted, datatype.JobRunning:
+		default:
+			continue
+		}
+		usage.ActiveJobs += 1
+		if job.ScienceGoal == nil {
+			continue
+		}
+		for _, subGoal := range job.ScienceGoal.SubGoals {
+			usage.PluginsPerNode[subGoal.Name] += len(subGoal.Plugins)
+			usage.PrivilegedPlugins += countPrivilegedPlugins(subGoal)
+		}
+	}
+	return usage
+}
+
+// QuotaGroup structs a quota applied to each member of the group.
+// Members are not limited together; each member is checked against the quota
+// with the member's own active jobs only.
+type QuotaGroup struct {
+	Members []string `yaml:"members"`
+	Quota   `yaml:",inline"`
+}
+
+// QuotaConfig structs quotas loaded from the quota file
+//
+// A user gets the default quota, overridden by quotas of groups the user belongs to,
+// and then overridden by the user's own quota.
+type QuotaConfig struct {
+	Default Quota                 `yaml:"default"`
+	Groups  map[string]QuotaGroup `yaml:"groups"`
+	Users   map[string]Quota      `yaml:"users"`
+}
+
+// QuotaManager holds quotas and reloads them when the quota file changes
+type QuotaManager struct {
+	filePath     string
+	config       QuotaConfig
+	lastModified time.Time
+	mu           sync.RWMutex
+}
+
+func NewQuotaManager(filePath string) *QuotaManager {
+	return &QuotaManager{
+		filePath: filePath,
+	}
+}
+
+// Load reads the quota file if it has changed since the last load.
+// If no quota file is given, no quota is applied to users.
+func (qm *QuotaManager) Load() error {
+	if qm.filePath == "" {
+		return nil
+	}
+	info, err := os.Stat(qm.filePath)
+	if err != nil {
+		return err
+	}
+	qm.mu.RLock()
+	unchanged := info.ModTime().Equal(qm.lastModified)
+	qm.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+	blob, err := os.ReadFile(qm.filePath)
+	if err != nil {
+		return err
+	}
+	var config QuotaConfig
+	if err := yaml.Unmarshal(blob, &config); err != nil {
+		return fmt.Errorf("Failed to parse quota file %s: %s", qm.filePath, err.Error())
+	}
+	qm.mu.Lock()
+	qm.config = config
+	qm.lastModified = info.ModTime()
+	qm.mu.Unlock()
+	logger.Info.Printf("Quotas loaded from %s", qm.filePath)
+	return nil
+}
+
+// Run periodically reloads the quota file so that changes apply without restarting
+func (qm *QuotaManager) Run(ctx context.Context) {
+	if qm.filePath == "" {
+		return
+	}
+	ticker := time.NewTicker(quotaReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := qm.Load(); err != nil {
+				logger.Error.Printf("Failed to reload quotas: %s", err.Error())
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetQuota returns the quota applied to the user
+func (qm *QuotaManager) GetQuota(user string) Quota {
+	qm.mu.RLock()
+	defer qm.mu.RUnlock()
+	q := qm.config.Default
+	// Groups are applied in the order of their names to get the same quota every time
+	groupNames := make([]string, 0, len(qm.config.Groups))
+	for name := range qm.config.Groups {
+		groupNames = append(groupNames, name)
+	}
+	sort.Strings(groupNames)
+	for _, name := range groupNames {
+		group := qm.config.Groups[name]
+		for _, member := range group.Members {
+			if member == user {
+				q = q.override(group.Quota)
+				break
+			}
+		}
+	}
+	if userQuota, exist := qm.config.Users[user]; exist {
+		q = q.override(userQuota)
+	}
+	return q
+}
@@ -0,0 +1,164 @@
+package cloudscheduler
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestQuotaManagerGetQuota(t *testing.T) {
+	quotaFile := path.Join(t.TempDir(), "quota.yaml")
+	err := os.WriteFile(quotaFile, []byte(`
+default:
+  maxActiveJobs: 2
+  maxNodesPerJob: 10
+groups:
+  sage:
+    members: [alice]
+    maxActiveJobs: 20
+users:
+  alice:
+    maxNodesPerJob: -1
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qm := NewQuotaManager(quotaFile)
+	if err := qm.Load(); err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		User string
+		Want Quota
+	}{
+		"default": {
+			User: "bob",
+			Want: Quota{MaxActiveJobs: 2, MaxNodesPerJob: 10},
+		},
+		"groupanduser": {
+			User: "alice",
+			Want: Quota{MaxActiveJobs: 20, MaxNodesPerJob: -1},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if q := qm.GetQuota(tc.User); q != tc.Want {
+				t.Errorf("Quota mismatch: wanted %+v, got %+v", tc.Want, q)
+			}
+		})
+	}
+}
+
+func TestQuotaCheck(t *testing.T) {
+	newJob := func(jobID string, status datatype.JobStatus, nodes []string, privileged bool) *datatype.Job {
+		job := datatype.NewJob("test", "alice", jobID)
+		job.AddNodes(nodes)
+		job.Status = status
+		builder := datatype.NewScienceGoalBuilder(job.Name, job.JobID)
+		for _, node := range nodes {
+			builder.AddSubGoal(node, []*datatype.Plugin{
+				{
+					Name:       "imagesampler",
+					PluginSpec: &datatype.PluginSpec{Image: "imagesampler:0.3.0", Privileged: privileged},
+				},
+			}, []string{})
+		}
+		job.ScienceGoal = builder.Build()
+		return job
+	}
+	activeJobs := []*datatype.Job{
+		newJob("1", datatype.JobRunning, []string{"W001", "W002"}, true),
+		newJob("2", datatype.JobRemoved, []string{"W001"}, true),
+	}
+	tests := map[string]struct {
+		Quota     Quota
+		Job       *datatype.Job
+		WantError bool
+	}{
+		"unlimited": {
+			Quota: Quota{},
+			Job:   newJob("3", datatype.JobCreated, []string{"W001"}, true),
+		},
+		"activejobs": {
+			Quota:     Quota{MaxActiveJobs: 1},
+			Job:       newJob("3", datatype.JobCreated, []string{"W001"}, false),
+			WantError: true,
+		},
+		"nodesperjob": {
+			Quota:     Quota{MaxNodesPerJob: 1},
+			Job:       newJob("3", datatype.JobCreated, []string{"W001", "W003"}, false),
+			WantError: true,
+		},
+		"pluginspernode": {
+			Quota:     Quota{MaxPluginsPerNode: 1},
+			Job:       newJob("3", datatype.JobCreated, []string{"W001"}, false),
+			WantError: true,
+		},
+		"pluginspernodeonothernode": {
+			Quota: Quota{MaxPluginsPerNode: 1},
+			Job:   newJob("3", datatype.JobCreated, []string{"W003"}, false),
+		},
+		"privilegedplugins": {
+			Quota:     Quota{MaxPrivilegedPlugins: 2},
+			Job:       newJob("3", datatype.JobCreated, []string{"W003"}, true),
+			WantError: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			usage := NewQuotaUsage("alice", activeJobs, tc.Job.JobID)
+			errorList := tc.Quota.Check(usage, tc.Job)
+			if tc.WantError && len(errorList) == 0 {
+				t.Errorf("Expected quota errors, but got none")
+			} else if !tc.WantError && len(errorList) > 0 {
+				t.Errorf("Expected no quota error, but got %v", errorList)
+			}
+		})
+	}
+}
+
+func TestQuotaGroupAppliesToEachMember(t *testing.T) {
+	quotaFile := path.Join(t.TempDir(), "quota.yaml")
+	err := os.WriteFile(quotaFile, []byte(`
+groups:
+  sage:
+    members: [alice, bob]
+    maxActiveJobs: 1
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qm := NewQuotaManager(quotaFile)
+	if err := qm.Load(); err != nil {
+		t.Fatal(err)
+	}
+	aliceJob := datatype.NewJob("test", "alice", "1")
+	aliceJob.Status = datatype.JobRunning
+	activeJobs := []*datatype.Job{aliceJob}
+	tests := map[string]struct {
+		User      string
+		WantError bool
+	}{
+		"memberwithactivejob": {
+			User:      "alice",
+			WantError: true,
+		},
+		"othermember": {
+			User: "bob",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			job := datatype.NewJob("test", tc.User, "2")
+			usage := NewQuotaUsage(tc.User, activeJobs, job.JobID)
+			errorList := qm.GetQuota(tc.User).Check(usage, job)
+			if tc.WantError && len(errorList) == 0 {
+				t.Errorf("Expected quota errors, but got none")
+			} else if !tc.WantError && len(errorList) > 0 {
+				t.Errorf("Expected no quota error, but got %v", errorList)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
@@ -82,7 +83,7 @@ func (jv *JobValidator) LoadDatabase() error {
 	return nil
 }
 
-// GetNodeNamesByTags returns a list of node names matched with given tags
+// GetNodeNamesByTags returns a sorted list of node names matched with given tags
 func (jv *JobValidator) GetNodeNamesByTags(tags []string) (nodesFound []string) {
 	if len(tags) == 0 {
 		return
@@ -92,5 +93,6 @@ func (jv *JobValidator) GetNodeNamesByTags(tags []string) (nodesFound []string)
 			nodesFound = append(nodesFound, node.Name)
 		}
 	}
+	sort.Strings(nodesFound)
 	return
 }
@@ -0,0 +1,50 @@
+package datatype
+
+// Typed request and response bodies of the /api/v2 API of the cloud scheduler
+
+// ServerInfo structs identity of the cloud scheduler
+type ServerInfo struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+}
+
+// ErrorResponse structs an error returned by the API
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// JobList structs a page of jobs. NextCursor is set if more jobs follow the page
+type JobList struct {
+	Jobs       []*Job `json:"jobs"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// JobSubmitResult structs the result of submitting a job
+type JobSubmitResult struct {
+	Job    *Job              `json:"job"`
+	DryRun bool              `json:"dryrun,omitempty"`
+	Report *ValidationReport `json:"report,omitempty"`
+}
+
+// JobUpdateResult structs the result of replacing a job.
+// Nodes are listed only when the job was running and its science goal got updated in place.
+type JobUpdateResult struct {
+	Job          *Job              `json:"job"`
+	DryRun       bool              `json:"dryrun,omitempty"`
+	NodesUpdated []string          `json:"nodes_updated,omitempty"`
+	NodesRemoved []string          `json:"nodes_removed,omitempty"`
+	Report       *ValidationReport `json:"report,omitempty"`
+}
+
+// NodeSelection structs nodes selected by names and tags
+type NodeSelection struct {
+	Nodes    []string `json:"nodes,omitempty" yaml:"nodes,omitempty"`
+	NodeTags []string `json:"node_tags,omitempty" yaml:"nodeTags,omitempty"`
+}
+
+// JobNodesResult structs the result of adding or removing nodes of a job
+type JobNodesResult struct {
+	JobID  string            `json:"job_id"`
+	Nodes  []string          `json:"nodes"`
+	Report *ValidationReport `json:"report,omitempty"`
+}
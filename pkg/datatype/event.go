@@ -2,6 +2,8 @@ package datatype
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,18 +16,22 @@ type EventBuilder struct {
 	e Event
 }
 
+// Event is a scheduling event. Meta holds the payload of the event in the flat form.
+// Use Payload to get the typed payload
 type Event struct {
-	Type      EventType
-	Timestamp int64
-	Meta      map[string]string
+	Type          EventType
+	Timestamp     int64
+	SchemaVersion int
+	Meta          map[string]string
 }
 
 func NewEventBuilder(eventType EventType) *EventBuilder {
 	return &EventBuilder{
 		e: Event{
-			Type:      eventType,
-			Timestamp: time.Now().UnixNano(),
-			Meta:      map[string]string{},
+			Type:          eventType,
+			Timestamp:     time.Now().UnixNano(),
+			SchemaVersion: EventSchemaVersion,
+			Meta:          map[string]string{},
 		},
 	}
 }
@@ -66,6 +72,22 @@ func (eb *EventBuilder) AddPluginMeta(plugin *Plugin) *EventBuilder {
 		eb.e.Meta["plugin_selector"] = string(selectors)
 	}
 	eb.e.Meta["goal_id"] = plugin.GoalID
+	if profile := plugin.Status.KnobStatus; profile != nil {
+		eb.e.Meta["plugin_profile"] = profile.Name
+		if knobs, err := json.Marshal(profile.Knobs); err == nil {
+			eb.e.Meta["plugin_knobs"] = string(knobs)
+		}
+	}
+	return eb
+}
+
+// AddQueueMeta adds the position of the plugin in the queue of plugins waiting for a slot
+// and how long it has waited. The position is not added if the plugin is not in the queue
+func (eb *EventBuilder) AddQueueMeta(position int, wait time.Duration) *EventBuilder {
+	if position > 0 {
+		eb.e.Meta["queue_position"] = strconv.Itoa(position)
+	}
+	eb.e.Meta["queue_wait_seconds"] = strconv.FormatFloat(wait.Seconds(), 'f', -1, 64)
 	return eb
 }
 
@@ -130,11 +152,27 @@ func (e *Event) ToString() string {
 func NewEventBuilderFromWaggleMessage(m *WaggleMessage) (*EventBuilder, error) {
 	builder := NewEventBuilder(EventType(m.Name))
 	builder.e.Timestamp = m.Timestamp
+	value, ok := m.Value.(string)
+	if !ok {
+		return nil, fmt.Errorf("Value of %q is not an encoded event", m.Name)
+	}
 	var body map[string]string
-	err := json.Unmarshal([]byte(m.Value.(string)), &body)
+	err := json.Unmarshal([]byte(value), &body)
 	if err != nil {
 		return nil, err
 	}
+	// Events from schedulers before payloads were versioned have no version
+	builder.e.SchemaVersion = 0
+	if version, exist := body["schema_version"]; exist {
+		builder.e.SchemaVersion, err = strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schema version %q of %q", version, m.Name)
+		}
+		delete(body, "schema_version")
+	}
+	if body == nil {
+		body = map[string]string{}
+	}
 	builder.e.Meta = body
 	return builder, nil
 }
@@ -146,6 +184,8 @@ func NewEventBuilderFromWaggleMessage(m *WaggleMessage) (*EventBuilder, error) {
 // - Topic name "sys.scheduler" will be used in converted Waggle message
 //
 // - Event.Type, Event.Body, and Event.Meta will be encoded into a JSON blob and be used as a Value in Waggle message
+//
+// - Event.SchemaVersion is encoded as "schema_version" in the JSON blob
 func (e *Event) ToWaggleMessage() *WaggleMessage {
 	// TODO: beehive-influxdb does not handle bytes so body is always string.
 	//       This should be lifted once it accepts bytes.
@@ -163,7 +203,15 @@ func (e *Event) ToWaggleMessage() *WaggleMessage {
 }
 
 func (e *Event) encodeMetaToJson() ([]byte, error) {
-	return json.Marshal(e.Meta)
+	if e.SchemaVersion < 1 {
+		return json.Marshal(e.Meta)
+	}
+	body := make(map[string]string, len(e.Meta)+1)
+	for k, v := range e.Meta {
+		body[k] = v
+	}
+	body["schema_version"] = strconv.Itoa(e.SchemaVersion)
+	return json.Marshal(body)
 }
 
 type EventType string
@@ -178,11 +226,13 @@ const (
 	EventGoalStatusReceivedBulk EventType = "sys.scheduler.status.goal.received.bulk"
 	EventGoalStatusRemoved      EventType = "sys.scheduler.status.goal.removed"
 	EventPluginStatusPromoted   EventType = "sys.scheduler.status.plugin.promoted"
+	EventPluginStatusQueued     EventType = "sys.scheduler.status.plugin.queued"
 	EventPluginStatusScheduled  EventType = "sys.scheduler.status.plugin.scheduled"
 	EventPluginStatusLaunched   EventType = "sys.scheduler.status.plugin.launched"
 	EventPluginStatusComplete   EventType = "sys.scheduler.status.plugin.complete"
 	EventPluginLastExecution    EventType = "sys.scheduler.plugin.lastexecution"
 	EventPluginStatusFailed     EventType = "sys.scheduler.status.plugin.failed"
+	EventPluginStatusPreempted  EventType = "sys.scheduler.status.plugin.preempted"
 	EventFailure                EventType = "sys.scheduler.failure"
 )
 
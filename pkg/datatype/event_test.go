@@ -1,10 +1,17 @@
 package datatype
 
 import (
+	"flag"
+	"os"
+	"path"
 	"reflect"
 	"testing"
 )
 
+const eventSchemaDir = "../../docs/events"
+
+var updateEventSchemas = flag.Bool("update", false, "Update published JSON schemas of events")
+
 func TestEventWaggleConversion(t *testing.T) {
 	tests := map[string]struct {
 		Type    string
@@ -34,3 +41,186 @@ func TestEventWaggleConversion(t *testing.T) {
 		}
 	}
 }
+
+func TestEventPayload(t *testing.T) {
+	tests := map[string]struct {
+		Type    EventType
+		Payload EventPayload
+		Meta    map[string]string
+	}{
+		"goal": {
+			Type:    EventGoalStatusUpdated,
+			Payload: &GoalEventPayload{GoalID: "goal-1", GoalName: "mygoal", Nodes: StringList{"W001", "W002"}},
+			Meta:    map[string]string{"goal_id": "goal-1", "goal_name": "mygoal", "nodes": "W001,W002"},
+		},
+		"plugin": {
+			Type: EventPluginStatusLaunched,
+			Payload: &PluginEventPayload{
+				GoalID:         "goal-1",
+				PluginName:     "plugin-a",
+				PluginSelector: EncodedMap{"zone": "core"},
+				K3SPodNodeName: "ws-nxcore",
+			},
+			Meta: map[string]string{
+				"goal_id":           "goal-1",
+				"plugin_name":       "plugin-a",
+				"plugin_selector":   `{"zone":"core"}`,
+				"k3s_pod_node_name": "ws-nxcore",
+			},
+		},
+		"profile": {
+			Type: EventPluginStatusScheduled,
+			Payload: &PluginEventPayload{
+				GoalID:        "goal-1",
+				PluginName:    "plugin-a",
+				PluginProfile: "unet_cuda",
+				PluginKnobs:   EncodedMap{"cuda": "true"},
+			},
+			Meta: map[string]string{
+				"goal_id":        "goal-1",
+				"plugin_name":    "plugin-a",
+				"plugin_profile": "unet_cuda",
+				"plugin_knobs":   `{"cuda":"true"}`,
+			},
+		},
+		"queue": {
+			Type: EventPluginStatusQueued,
+			Payload: &PluginEventPayload{
+				GoalID:           "goal-1",
+				PluginName:       "plugin-a",
+				QueuePosition:    2,
+				QueueWaitSeconds: 1.5,
+			},
+			Meta: map[string]string{
+				"goal_id":            "goal-1",
+				"plugin_name":        "plugin-a",
+				"queue_position":     "2",
+				"queue_wait_seconds": "1.5",
+			},
+		},
+		"bulk": {
+			Type:    EventGoalStatusReceivedBulk,
+			Payload: &GoalBulkEventPayload{Goals: "[]", Signature: "c2ln"},
+			Meta:    map[string]string{"goals": "[]", "signature": "c2ln"},
+		},
+		"failure": {
+			Type:    EventFailure,
+			Payload: &FailureEventPayload{Reason: "Goals rejected"},
+			Meta:    map[string]string{"reason": "Goals rejected"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			m, err := EncodeEventPayload(test.Type, 1, test.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Consumers of the flat form see the same entries
+			eb, err := NewEventBuilderFromWaggleMessage(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := eb.Build()
+			if e.SchemaVersion != EventSchemaVersion {
+				t.Errorf("Wanted schema version %d, got %d", EventSchemaVersion, e.SchemaVersion)
+			}
+			if !reflect.DeepEqual(test.Meta, e.Meta) {
+				t.Errorf("Wanted entries %v, got %v", test.Meta, e.Meta)
+			}
+			eventType, payload, err := DecodeEventPayload(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if eventType != test.Type {
+				t.Errorf("Wanted type %s, got %s", test.Type, eventType)
+			}
+			if payload.GetSchemaVersion() != EventSchemaVersion {
+				t.Errorf("Wanted payload of schema version %d, got %d", EventSchemaVersion, payload.GetSchemaVersion())
+			}
+			// The decoded payload gives back the same entries
+			if e := NewEventBuilder(test.Type).AddPayload(payload).Build(); !reflect.DeepEqual(test.Meta, e.Meta) {
+				t.Errorf("Wanted entries %v from decoded payload, got %v", test.Meta, e.Meta)
+			}
+		})
+	}
+}
+
+func TestDecodeEventPayload(t *testing.T) {
+	tests := map[string]struct {
+		Name    string
+		Value   string
+		Version int
+		VSN     string
+		Error   bool
+	}{
+		"unversioned": {
+			Name:  string(EventGoalStatusReceived),
+			Value: `{"goal_id":"goal-1","goal_name":"mygoal","vsn":"W001"}`,
+			VSN:   "W001",
+		},
+		"versioned": {
+			Name:    string(EventGoalStatusReceived),
+			Value:   `{"goal_id":"goal-1","goal_name":"mygoal","schema_version":"1"}`,
+			Version: 1,
+		},
+		"newer": {
+			Name:  string(EventGoalStatusReceived),
+			Value: `{"goal_id":"goal-1","schema_version":"99"}`,
+			Error: true,
+		},
+		"badversion": {
+			Name:  string(EventGoalStatusReceived),
+			Value: `{"goal_id":"goal-1","schema_version":"one"}`,
+			Error: true,
+		},
+		"notevent": {
+			Name:  string(EventPluginLastExecution),
+			Value: `{}`,
+			Error: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, payload, err := DecodeEventPayload(NewMessage(test.Name, test.Value, 1, map[string]string{}))
+			if test.Error {
+				if err == nil {
+					t.Errorf("Wanted an error, got payload %+v", payload)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			goal := payload.(*GoalEventPayload)
+			if goal.SchemaVersion != test.Version || goal.GoalID != "goal-1" || goal.VSN != test.VSN {
+				t.Errorf("Wanted goal-1 of schema version %d from %q, got %+v", test.Version, test.VSN, goal)
+			}
+		})
+	}
+}
+
+// TestEventJSONSchemaFiles keeps the published JSON schemas up to date.
+// Run with -update to regenerate them
+func TestEventJSONSchemaFiles(t *testing.T) {
+	for _, eventType := range EventTypesWithPayload() {
+		schema, err := EventJSONSchema(eventType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, '\n')
+		filePath := path.Join(eventSchemaDir, string(eventType)+".json")
+		if *updateEventSchemas {
+			if err := os.WriteFile(filePath, schema, 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		published, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("Schema of %q is not published. Run the test with -update: %s", eventType, err.Error())
+		}
+		if string(published) != string(schema) {
+			t.Errorf("Schema of %q in %s is outdated. Run the test with -update", eventType, filePath)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package datatype
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// EventSchemaVersion is the version of event payloads this build produces.
+// It increases when fields of a payload change incompatibly. Events without
+// the version come from schedulers before payloads were versioned and are of version 0.
+const EventSchemaVersion = 1
+
+// EventPayload is a typed payload of an event.
+//
+// Payloads are carried as a flat JSON object of strings in the value of Waggle messages
+// so that consumers of the flat form, such as Event.Meta, keep working.
+// Fields are tagged with their key in the object and a description for JSON schemas.
+type EventPayload interface {
+	GetSchemaVersion() int
+}
+
+// EventPayloadHeader holds fields common to all payloads
+type EventPayloadHeader struct {
+	SchemaVersion int    `json:"schema_version,string" description:"Version of the event schema"`
+	VSN           string `json:"vsn,omitempty" description:"VSN of the node that sent the event. It is added by the receiver"`
+}
+
+func (h EventPayloadHeader) GetSchemaVersion() int {
+	return h.SchemaVersion
+}
+
+// StringList is a list of strings carried as a comma-separated string
+type StringList []string
+
+func (l StringList) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.Join(l, ","))
+}
+
+func (l *StringList) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*l = nil
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+	return nil
+}
+
+// EncodedMap is a map carried as a JSON-encoded string
+type EncodedMap map[string]string
+
+func (m EncodedMap) MarshalJSON() ([]byte, error) {
+	blob, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(blob))
+}
+
+func (m *EncodedMap) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	*m = nil
+	if s == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(s), (*map[string]string)(m))
+}
+
+// JobEventPayload is the payload of job events
+type JobEventPayload struct {
+	EventPayloadHeader
+	JobID  string `json:"job_id" description:"ID of the job"`
+	Reason string `json:"reason,omitempty" description:"Why the event happened"`
+}
+
+// GoalEventPayload is the payload of science goal events
+type GoalEventPayload struct {
+	EventPayloadHeader
+	GoalID   string     `json:"goal_id" description:"ID of the science goal"`
+	GoalName string     `json:"goal_name" description:"Name of the science goal"`
+	JobID    string     `json:"job_id,omitempty" description:"ID of the job of the science goal"`
+	Nodes    StringList `json:"nodes,omitempty" description:"Comma-separated VSNs of nodes whose goals changed"`
+	Reason   string     `json:"reason,omitempty" description:"Why the event happened"`
+}
+
+// GoalBulkEventPayload is the payload of goals received at once by a node
+type GoalBulkEventPayload struct {
+	EventPayloadHeader
+	Goals     string `json:"goals" description:"JSON-encoded list of science goals of the node"`
+	Signature string `json:"signature,omitempty" description:"Signature of the goals made by the cloud scheduler"`
+}
+
+// PluginEventPayload is the payload of plugin events
+type PluginEventPayload struct {
+	EventPayloadHeader
+	GoalID                  string     `json:"goal_id" description:"ID of the science goal of the plugin"`
+	PluginName              string     `json:"plugin_name" description:"Name of the plugin"`
+	PluginImage             string     `json:"plugin_image,omitempty" description:"Container image of the plugin"`
+	PluginStatusByScheduler string     `json:"plugin_status_by_scheduler,omitempty" description:"Scheduling status of the plugin"`
+	PluginTask              string     `json:"plugin_task,omitempty" description:"Name of the Kubernetes job running the plugin"`
+	PluginArgs              string     `json:"plugin_args,omitempty" description:"Space-separated arguments of the plugin"`
+	PluginSelector          EncodedMap `json:"plugin_selector,omitempty" description:"JSON-encoded node selector of the plugin"`
+	PluginProfile           string     `json:"plugin_profile,omitempty" description:"Name of the profile chosen for the plugin"`
+	PluginKnobs             EncodedMap `json:"plugin_knobs,omitempty" description:"JSON-encoded knobs of the profile chosen for the plugin"`
+	QueuePosition           int        `json:"queue_position,omitempty,string" description:"Position of the plugin in the queue of plugins waiting for a slot"`
+	QueueWaitSeconds        float64    `json:"queue_wait_seconds,omitempty,string" description:"Seconds the plugin has waited in the queue"`
+	K3SJobName              string     `json:"k3s_job_name,omitempty" description:"Name of the Kubernetes job"`
+	K3SJobStatus            string     `json:"k3s_job_status,omitempty" description:"Condition of the Kubernetes job"`
+	K3SPodName              string     `json:"k3s_pod_name,omitempty" description:"Name of the Kubernetes pod"`
+	K3SPodStatus            string     `json:"k3s_pod_status,omitempty" description:"Phase of the Kubernetes pod"`
+	K3SPodNodeName          string     `json:"k3s_pod_node_name,omitempty" description:"Name of the Kubernetes node that ran the pod"`
+	Reason                  string     `json:"reason,omitempty" description:"Why the event happened"`
+}
+
+// FailureEventPayload is the payload of scheduler failures
+type FailureEventPayload struct {
+	EventPayloadHeader
+	Reason     string `json:"reason" description:"What failed"`
+	GoalID     string `json:"goal_id,omitempty" description:"ID of the science goal involved"`
+	GoalName   string `json:"goal_name,omitempty" description:"Name of the science goal involved"`
+	PluginName string `json:"plugin_name,omitempty" description:"Name of the plugin involved"`
+}
+
+// eventPayloads creates an empty payload of each event type
+var eventPayloads = map[EventType]func() EventPayload{
+	EventJobStatusSuspended:     func() EventPayload { return &JobEventPayload{} },
+	EventJobStatusRemoved:       func() EventPayload { return &JobEventPayload{} },
+	EventGoalStatusSubmitted:    func() EventPayload { return &GoalEventPayload{} },
+	EventGoalStatusUpdated:      func() EventPayload { return &GoalEventPayload{} },
+	EventGoalStatusReceived:     func() EventPayload { return &GoalEventPayload{} },
+	EventGoalStatusRemoved:      func() EventPayload { return &GoalEventPayload{} },
+	EventGoalStatusReceivedBulk: func() EventPayload { return &GoalBulkEventPayload{} },
+	EventPluginStatusPromoted:   func() EventPayload { return &PluginEventPayload{} },
+	EventPluginStatusQueued:     func() EventPayload { return &PluginEventPayload{} },
+	EventPluginStatusScheduled:  func() EventPayload { return &PluginEventPayload{} },
+	EventPluginStatusLaunched:   func() EventPayload { return &PluginEventPayload{} },
+	EventPluginStatusComplete:   func() EventPayload { return &PluginEventPayload{} },
+	EventPluginStatusFailed:     func() EventPayload { return &PluginEventPayload{} },
+	EventPluginStatusPreempted:  func() EventPayload { return &PluginEventPayload{} },
+	EventFailure:                func() EventPayload { return &FailureEventPayload{} },
+}
+
+// EventTypesWithPayload returns event types having a typed payload in order
+func EventTypesWithPayload() []EventType {
+	var eventTypes []EventType
+	for t := range eventPayloads {
+		eventTypes = append(eventTypes, t)
+	}
+	sort.Slice(eventTypes, func(i, j int) bool { return eventTypes[i] < eventTypes[j] })
+	return eventTypes
+}
+
+// NewEventPayload returns an empty payload of the event type
+func NewEventPayload(eventType EventType) (EventPayload, error) {
+	newPayload, exist := eventPayloads[eventType]
+	if !exist {
+		return nil, fmt.Errorf("Event type %q has no payload schema", eventType)
+	}
+	return newPayload(), nil
+}
+
+// AddPayload adds fields of the payload to the event. Existing entries
+// of the same keys are replaced. The schema version of the payload is ignored
+func (eb *EventBuilder) AddPayload(payload EventPayload) *EventBuilder {
+	blob, err := json.Marshal(payload)
+	if err != nil {
+		return eb
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(blob, &entries); err != nil {
+		return eb
+	}
+	delete(entries, "schema_version")
+	for k, v := range entries {
+		eb.e.Meta[k] = v
+	}
+	return eb
+}
+
+// Payload decodes entries of the event to the typed payload of its type.
+// It returns an error if the event is of a newer schema version than this build knows
+func (e *Event) Payload() (EventPayload, error) {
+	if e.SchemaVersion > EventSchemaVersion {
+		return nil, fmt.Errorf("Event %q has schema version %d newer than %d", e.Type, e.SchemaVersion, EventSchemaVersion)
+	}
+	payload, err := NewEventPayload(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]string, len(e.Meta)+1)
+	for k, v := range e.Meta {
+		entries[k] = v
+	}
+	entries["schema_version"] = fmt.Sprint(e.SchemaVersion)
+	blob, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, payload); err != nil {
+		return nil, fmt.Errorf("Failed to decode payload of %q: %s", e.Type, err.Error())
+	}
+	return payload, nil
+}
+
+// EncodeEventPayload returns a Waggle message of the event type carrying the payload
+func EncodeEventPayload(eventType EventType, timestamp int64, payload EventPayload) (*WaggleMessage, error) {
+	if _, err := NewEventPayload(eventType); err != nil {
+		return nil, err
+	}
+	eb := NewEventBuilder(eventType).AddPayload(payload)
+	eb.e.Timestamp = timestamp
+	e := eb.Build()
+	m := e.ToWaggleMessage()
+	if m == nil {
+		return nil, fmt.Errorf("Failed to encode payload of %q", eventType)
+	}
+	return m, nil
+}
+
+// DecodeEventPayload returns the event type and typed payload of the Waggle message
+func DecodeEventPayload(m *WaggleMessage) (EventType, EventPayload, error) {
+	eb, err := NewEventBuilderFromWaggleMessage(m)
+	if err != nil {
+		return "", nil, err
+	}
+	e := eb.Build()
+	payload, err := e.Payload()
+	return e.Type, payload, err
+}
+
+// EventJSONSchema returns the JSON schema of the value of Waggle messages of the event type.
+// The value is a JSON object whose properties are all strings
+func EventJSONSchema(eventType EventType) ([]byte, error) {
+	payload, err := NewEventPayload(eventType)
+	if err != nil {
+		return nil, err
+	}
+	properties := map[string]interface{}{}
+	required := []string{}
+	addSchemaProperties(reflect.TypeOf(payload).Elem(), properties, &required)
+	sort.Strings(required)
+	schema := map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"title":                string(eventType),
+		"description":          fmt.Sprintf("Value of Waggle messages named %q, schema version %d", eventType, EventSchemaVersion),
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": true,
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func addSchemaProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			addSchemaProperties(f.Type, properties, required)
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "" || tag[0] == "-" {
+			continue
+		}
+		properties[tag[0]] = map[string]string{
+			"type":        "string",
+			"description": f.Tag.Get("description"),
+		}
+		omitEmpty := false
+		for _, option := range tag[1:] {
+			if option == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		if !omitEmpty {
+			*required = append(*required, tag[0])
+		}
+	}
+}
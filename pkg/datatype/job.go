@@ -32,8 +32,11 @@ type Job struct {
 	Nodes           map[string]interface{} `json:"nodes" yaml:"nodes"`
 	ScienceRules    []string               `json:"science_rules" yaml:"scienceRules"`
 	SuccessCriteria []string               `json:"success_criteria" yaml:"successCriteria"`
+	Priority        int                    `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Weight          float64                `json:"weight,omitempty" yaml:"weight,omitempty"`
 	ScienceGoal     *ScienceGoal           `json:"science_goal,omitempty" yaml:"scienceGoal,omitempty"`
 	Status          JobStatus              `json:"status" yaml:"status"`
+	CreatedAt       time.Time              `json:"created_at" yaml:"createdAt"`
 	LastUpdated     time.Time              `json:"last_updated" yaml:"lastUpdated"`
 }
 
@@ -57,6 +60,9 @@ func (j *Job) UpdateStatus(newStatus JobStatus) {
 }
 
 func (j *Job) AddNodes(nodeNames []string) {
+	if j.Nodes == nil {
+		j.Nodes = make(map[string]interface{})
+	}
 	for _, nodeName := range nodeNames {
 		if _, exist := j.Nodes[nodeName]; !exist {
 			j.Nodes[nodeName] = 1
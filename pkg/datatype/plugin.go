@@ -14,6 +14,9 @@ type Plugin struct {
 	Status     PluginStatus `json:"status,omitempty" yaml:"status,omitempty"`
 	DataShims  []*DataShim  `json:"datathims,omitempty" yaml:"datashims,omitempty"`
 	GoalID     string       `json:"goal_id,omitempty" yaml:"goalID,omitempty"`
+	// Profiles lists profiles the plugin can run with on the node.
+	// The node scheduler chooses one of them when it runs the plugin
+	Profiles []Profile `json:"profiles,omitempty" yaml:"profiles,omitempty"`
 }
 
 type PluginSpec struct {
@@ -26,8 +29,18 @@ type PluginSpec struct {
 	Entrypoint  string            `json:"entrypoint,omitempty" yaml:"entrypoint,omitempty"`
 	Env         map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
 	DevelopMode bool              `json:"develop,omitempty" yaml:"develop,omitempty"`
+	// Resource overrides the resource required by the profile chosen for the plugin
+	Resource *Resource `json:"resource,omitempty" yaml:"resource,omitempty"`
+	// Priority of the plugin between 0 and MaxPluginPriority. Plugins of higher
+	// priority run first and may preempt plugins of lower priority
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// Exclusive plugins run alone on the node with the exclusivity filter of scheduling policies
+	Exclusive bool `json:"exclusive,omitempty" yaml:"exclusive,omitempty"`
 }
 
+// MaxPluginPriority is the highest priority of plugins
+const MaxPluginPriority = 100
+
 func (ps *PluginSpec) GetImageTag() (string, error) {
 	name := path.Base(ps.Image)
 	parts := strings.Split(name, ":")
@@ -49,6 +62,9 @@ type PluginStatus struct {
 	SchedulingStatus SchedulingStatus `json:"scheduling,omitempty" yaml:"scheduling,omitempty"`
 	KnobStatus       *Profile         `json:"knob,omitempty" yaml:"knob,omitempty"`
 	Since            time.Time        `json:"since,omitempty" yaml:"since,omitempty"`
+	// Reason tells why the plugin stays in the scheduling status, for example,
+	// why a Ready plugin is not scheduled
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
 }
 
 // ContextStatus represents contextual status of a plugin
@@ -104,9 +120,31 @@ type PluginCredential struct {
 func (p *Plugin) UpdatePluginSchedulingStatus(status SchedulingStatus) error {
 	p.Status.SchedulingStatus = status
 	p.Status.Since = time.Now()
+	p.Status.Reason = ""
 	return nil
 }
 
+// GetPriority returns the priority of the plugin
+func (p *Plugin) GetPriority() int {
+	if p.PluginSpec == nil {
+		return 0
+	}
+	return p.PluginSpec.Priority
+}
+
+// GetRequiredResource returns the resource the plugin requires to run.
+// It is the resource given in the plugin spec if any, or the requirement of
+// the profile chosen for the plugin. No resource is required if neither is given
+func (p *Plugin) GetRequiredResource() Resource {
+	if p.PluginSpec != nil && p.PluginSpec.Resource != nil {
+		return *p.PluginSpec.Resource
+	}
+	if p.Status.KnobStatus != nil {
+		return p.Status.KnobStatus.Require
+	}
+	return Resource{}
+}
+
 // GetMetaInformation returns a dictionary of plugin information.
 // func (p *Plugin) GetMetaInformation() map[string]string {
 // 	meta := make(map[string]string)
@@ -138,7 +176,7 @@ func (p *Plugin) UpdatePluginContext(status ContextStatus) error {
 
 // Profile structs a name with knobs
 type Profile struct {
-	Name    string            `yaml:"name,omitempty"`
-	Knobs   map[string]string `yaml:"knobs,omitempty"`
-	Require Resource          `yaml:"require,omitempty"`
+	Name    string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Knobs   map[string]string `json:"knobs,omitempty" yaml:"knobs,omitempty"`
+	Require Resource          `json:"require,omitempty" yaml:"require,omitempty"`
 }
@@ -1,6 +1,7 @@
 package datatype
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,6 +17,15 @@ type Resource struct {
 	gpuMemInMega int    `json:"-" yaml:"-"`
 }
 
+// NewResource returns a resource of CPU in millicores and memory and GPU memory in Mi
+func NewResource(cpuInMilli int, memInMega int, gpuMemInMega int) Resource {
+	return Resource{
+		CPU:       fmt.Sprintf("%dm", cpuInMilli),
+		Memory:    fmt.Sprintf("%dMi", memInMega),
+		GPUMemory: fmt.Sprintf("%dMi", gpuMemInMega),
+	}
+}
+
 func (r *Resource) CanAccommodate(c *Resource) bool {
 	r.convert()
 	c.convert()
@@ -28,6 +38,61 @@ func (r *Resource) CanAccommodate(c *Resource) bool {
 	}
 }
 
+// Subtract returns the resource left after c is taken out of r.
+// Quantities not given in c are not taken out and no quantity goes below zero
+func (r *Resource) Subtract(c *Resource) Resource {
+	r.convert()
+	c.convert()
+	return NewResource(
+		nonNegative(r.cpuInMilli-nonNegative(c.cpuInMilli)),
+		nonNegative(r.memInMega-nonNegative(c.memInMega)),
+		nonNegative(r.gpuMemInMega-nonNegative(c.gpuMemInMega)),
+	)
+}
+
+// Add returns the resource of r and c together. Quantities not given are taken as zero
+func (r *Resource) Add(c *Resource) Resource {
+	r.convert()
+	c.convert()
+	return NewResource(
+		nonNegative(r.cpuInMilli)+nonNegative(c.cpuInMilli),
+		nonNegative(r.memInMega)+nonNegative(c.memInMega),
+		nonNegative(r.gpuMemInMega)+nonNegative(c.gpuMemInMega),
+	)
+}
+
+// String returns the resource in a human readable form
+func (r *Resource) String() string {
+	r.convert()
+	return fmt.Sprintf("cpu %dm, memory %dMi, gpu memory %dMi",
+		nonNegative(r.cpuInMilli), r.memInMega, r.gpuMemInMega)
+}
+
+func nonNegative(v int) int {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
+
+// CPUInMilli returns CPU in millicores. It returns -1 if CPU is not a valid quantity
+func (r *Resource) CPUInMilli() int {
+	r.convert()
+	return r.cpuInMilli
+}
+
+// MemoryInMega returns memory in Mi
+func (r *Resource) MemoryInMega() int {
+	r.convert()
+	return r.memInMega
+}
+
+// GPUMemoryInMega returns GPU memory in Mi
+func (r *Resource) GPUMemoryInMega() int {
+	r.convert()
+	return r.gpuMemInMega
+}
+
 func (r *Resource) convert() {
 	if strings.HasSuffix(r.CPU, "m") {
 		if cpuInInt, err := strconv.Atoi(r.CPU[:len(r.CPU)-1]); err == nil {
@@ -56,13 +121,13 @@ func (r *Resource) convert() {
 	value, unit = splitValueAndUnit(r.GPUMemory)
 	switch unit {
 	case "Ki":
-		r.gpuMemInMega = value * 1024
+		r.gpuMemInMega = int(value / 1024.)
 	case "Mi":
 		r.gpuMemInMega = value
 	case "Gi":
-		r.gpuMemInMega = int(value / 1024.)
+		r.gpuMemInMega = value * 1024
 	case "Ti":
-		r.gpuMemInMega = int(value / 1024. / 1024.)
+		r.gpuMemInMega = value * 1024 * 1024
 	}
 }
 
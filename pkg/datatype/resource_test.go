@@ -27,6 +27,22 @@ func TestResourceConversion(t *testing.T) {
 				GpuMemory: 8000,
 			},
 		},
+		"gpuMemoryInGi": {
+			input: &Resource{
+				CPU:       "1.5",
+				Memory:    "512Mi",
+				GPUMemory: "4Gi",
+			},
+			want: struct {
+				CPU       int
+				Memory    int
+				GpuMemory int
+			}{
+				CPU:       1500,
+				Memory:    512,
+				GpuMemory: 4 * 1024,
+			},
+		},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -44,3 +60,71 @@ func TestResourceConversion(t *testing.T) {
 		})
 	}
 }
+
+func TestResourceSubtract(t *testing.T) {
+	tests := map[string]struct {
+		from Resource
+		take Resource
+		want Resource
+	}{
+		"all": {
+			from: NewResource(4000, 8192, 4096),
+			take: Resource{CPU: "1", Memory: "1Gi", GPUMemory: "1024Mi"},
+			want: NewResource(3000, 7168, 3072),
+		},
+		"notGiven": {
+			from: NewResource(4000, 8192, 4096),
+			take: Resource{Memory: "1Gi"},
+			want: NewResource(4000, 7168, 4096),
+		},
+		"belowZero": {
+			from: NewResource(500, 8192, 0),
+			take: Resource{CPU: "1000m", GPUMemory: "1Gi"},
+			want: NewResource(0, 8192, 0),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			left := tc.from.Subtract(&tc.take)
+			if left.CPU != tc.want.CPU || left.Memory != tc.want.Memory || left.GPUMemory != tc.want.GPUMemory {
+				t.Errorf("Wrong resource left: expected %q, but %q", tc.want.String(), left.String())
+			}
+			// Anything not required fits to what is left
+			if !left.CanAccommodate(&Resource{}) {
+				t.Errorf("Empty requirement does not fit to %q", left.String())
+			}
+		})
+	}
+}
+
+func TestResourceAdd(t *testing.T) {
+	tests := map[string]struct {
+		to   Resource
+		give Resource
+		want Resource
+	}{
+		"all": {
+			to:   NewResource(3000, 7168, 3072),
+			give: Resource{CPU: "1", Memory: "1Gi", GPUMemory: "1024Mi"},
+			want: NewResource(4000, 8192, 4096),
+		},
+		"notGiven": {
+			to:   NewResource(4000, 7168, 4096),
+			give: Resource{Memory: "1Gi"},
+			want: NewResource(4000, 8192, 4096),
+		},
+		"fromEmpty": {
+			to:   Resource{},
+			give: Resource{CPU: "500m"},
+			want: NewResource(500, 0, 0),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.to.Add(&tc.give)
+			if got.CPU != tc.want.CPU || got.Memory != tc.want.Memory || got.GPUMemory != tc.want.GPUMemory {
+				t.Errorf("Wrong resource: expected %q, but %q", tc.want.String(), got.String())
+			}
+		})
+	}
+}
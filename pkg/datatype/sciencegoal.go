@@ -15,9 +15,16 @@ type ScienceGoalBuilder struct {
 
 func NewScienceGoalBuilder(goalName string, jobID string) *ScienceGoalBuilder {
 	id, _ := uuid.NewV4()
+	return NewScienceGoalBuilderWithID(goalName, jobID, id.String())
+}
+
+// NewScienceGoalBuilderWithID returns a builder that keeps given goal ID.
+// This is useful when a science goal is rebuilt for an existing job and
+// nodes need to recognize the goal they are already running.
+func NewScienceGoalBuilderWithID(goalName string, jobID string, goalID string) *ScienceGoalBuilder {
 	return &ScienceGoalBuilder{
 		sg: ScienceGoal{
-			ID:    id.String(),
+			ID:    goalID,
 			JobID: jobID,
 			Name:  goalName,
 		},
@@ -25,17 +32,21 @@ func NewScienceGoalBuilder(goalName string, jobID string) *ScienceGoalBuilder {
 }
 
 func (sgb *ScienceGoalBuilder) AddSubGoal(nodeID string, plugins []*Plugin, scienceRules []string) *ScienceGoalBuilder {
-	subGoal := &SubGoal{
-		Name:         nodeID,
-		Plugins:      plugins,
-		ScienceRules: scienceRules,
-	}
-	subGoal.ApplyGoalIDToPlugins(sgb.sg.ID)
-	err := subGoal.AddChecksum()
-	if err != nil {
+	if err := sgb.sg.AddSubGoal(nodeID, plugins, scienceRules); err != nil {
 		return nil
 	}
-	sgb.sg.SubGoals = append(sgb.sg.SubGoals, subGoal)
+	return sgb
+}
+
+// SetUser sets the user who owns the science goal
+func (sgb *ScienceGoalBuilder) SetUser(user string) *ScienceGoalBuilder {
+	sgb.sg.User = user
+	return sgb
+}
+
+// SetWeight sets the weight of the science goal in fair-share scheduling
+func (sgb *ScienceGoalBuilder) SetWeight(weight float64) *ScienceGoalBuilder {
+	sgb.sg.Weight = weight
 	return sgb
 }
 
@@ -48,10 +59,21 @@ type ScienceGoal struct {
 	ID         string     `json:"id" yaml:"id"`
 	JobID      string     `json:"job_id" yaml:"jobID"`
 	Name       string     `json:"name,omitempty" yaml:"name,omitempty"`
+	User       string     `json:"user,omitempty" yaml:"user,omitempty"`
+	Weight     float64    `json:"weight,omitempty" yaml:"weight,omitempty"`
 	SubGoals   []*SubGoal `json:"sub_goals,omitempty" yaml:"subgoals,omitempty"`
 	Conditions []string   `json:"conditions,omitempty" yaml:"conditions,omitempty"`
 }
 
+// GetWeight returns the weight of the science goal in fair-share scheduling.
+// Goals without weight weigh 1
+func (g *ScienceGoal) GetWeight() float64 {
+	if g.Weight <= 0 {
+		return 1
+	}
+	return g.Weight
+}
+
 // GetMySubGoal returns the subgoal assigned to node
 func (g *ScienceGoal) GetMySubGoal(nodeName string) *SubGoal {
 	for _, subGoal := range g.SubGoals {
@@ -70,11 +92,40 @@ func (g *ScienceGoal) ShowMyScienceGoal(nodeName string) *ScienceGoal {
 		ID:         g.ID,
 		JobID:      g.JobID,
 		Name:       g.Name,
+		User:       g.User,
+		Weight:     g.Weight,
 		SubGoals:   []*SubGoal{&mySubgoal},
 		Conditions: g.Conditions,
 	}
 }
 
+// AddSubGoal creates a sub goal for the node and adds it to the science goal
+func (g *ScienceGoal) AddSubGoal(nodeName string, plugins []*Plugin, scienceRules []string) error {
+	subGoal := &SubGoal{
+		Name:         nodeName,
+		Plugins:      plugins,
+		ScienceRules: scienceRules,
+	}
+	subGoal.ApplyGoalIDToPlugins(g.ID)
+	if err := subGoal.AddChecksum(); err != nil {
+		return err
+	}
+	g.SubGoals = append(g.SubGoals, subGoal)
+	return nil
+}
+
+// DropSubGoal removes the sub goal assigned to the node.
+// It returns false if the node does not have a sub goal.
+func (g *ScienceGoal) DropSubGoal(nodeName string) bool {
+	for i, subGoal := range g.SubGoals {
+		if strings.ToLower(subGoal.Name) == strings.ToLower(nodeName) {
+			g.SubGoals = append(g.SubGoals[:i], g.SubGoals[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // GetSubjectNodes returns a list of nodes subject to run this science goal
 func (g *ScienceGoal) GetSubjectNodes() (nodes []string) {
 	for _, subGoal := range g.SubGoals {
@@ -83,6 +134,32 @@ func (g *ScienceGoal) GetSubjectNodes() (nodes []string) {
 	return
 }
 
+// DiffSubGoals compares the science goal with a newer version of it node by node.
+// It returns nodes whose sub goal is new or changed in the newer goal and
+// nodes that no longer have a sub goal in the newer goal. All nodes are changed
+// if the owner or weight of the goal changes.
+func (g *ScienceGoal) DiffSubGoals(newGoal *ScienceGoal) (changed []string, removed []string) {
+	goalChanged := g.User != newGoal.User || g.Weight != newGoal.Weight
+	for _, newSubGoal := range newGoal.SubGoals {
+		oldSubGoal := g.GetMySubGoal(newSubGoal.Name)
+		if oldSubGoal == nil || goalChanged {
+			changed = append(changed, newSubGoal.Name)
+			continue
+		}
+		oldSubGoal.AddChecksum()
+		newSubGoal.AddChecksum()
+		if !oldSubGoal.CompareChecksum(newSubGoal) {
+			changed = append(changed, newSubGoal.Name)
+		}
+	}
+	for _, oldSubGoal := range g.SubGoals {
+		if newGoal.GetMySubGoal(oldSubGoal.Name) == nil {
+			removed = append(removed, oldSubGoal.Name)
+		}
+	}
+	return
+}
+
 // SubGoal structs node-specific goal along with conditions and rules
 type SubGoal struct {
 	Name         string    `json:"name" yaml:"name"`
@@ -115,8 +192,32 @@ type SubGoal struct {
 // 	return &subGoal
 // }
 
+// AddChecksum calculates a checksum of the sub goal content.
+// Status of plugins is excluded as it changes while the sub goal runs.
 func (sg *SubGoal) AddChecksum() error {
-	specjson, err := json.Marshal(sg)
+	type pluginContent struct {
+		Name       string      `json:"name"`
+		PluginSpec *PluginSpec `json:"plugin_spec"`
+		DataShims  []*DataShim `json:"datashims,omitempty"`
+		GoalID     string      `json:"goal_id,omitempty"`
+	}
+	content := struct {
+		Name         string           `json:"name"`
+		Plugins      []*pluginContent `json:"plugins"`
+		ScienceRules []string         `json:"science_rules"`
+	}{
+		Name:         sg.Name,
+		ScienceRules: sg.ScienceRules,
+	}
+	for _, p := range sg.Plugins {
+		content.Plugins = append(content.Plugins, &pluginContent{
+			Name:       p.Name,
+			PluginSpec: p.PluginSpec,
+			DataShims:  p.DataShims,
+			GoalID:     p.GoalID,
+		})
+	}
+	specjson, err := json.Marshal(content)
 	if err != nil {
 		// We cannot proceed anymore
 		return err
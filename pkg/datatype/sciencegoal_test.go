@@ -0,0 +1,99 @@
+package datatype
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScienceGoalDiffSubGoals(t *testing.T) {
+	newPlugin := func(name string, args ...string) *Plugin {
+		p := &Plugin{
+			Name: name,
+			PluginSpec: &PluginSpec{
+				Image: "registry.sagecontinuum.org/theone/imagesampler:0.3.0",
+				Args:  args,
+			},
+		}
+		p.UpdatePluginSchedulingStatus(Waiting)
+		return p
+	}
+	rules := []string{"imagesampler: True"}
+	tests := map[string]struct {
+		Old         *ScienceGoal
+		New         *ScienceGoal
+		WantChanged []string
+		WantRemoved []string
+	}{
+		"nochange": {
+			Old: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler", "-stream", "top")}, rules).Build(),
+			New: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler", "-stream", "top")}, rules).Build(),
+		},
+		"changeonenode": {
+			Old: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler", "-stream", "top")}, rules).
+				AddSubGoal("W002", []*Plugin{newPlugin("imagesampler", "-stream", "top")}, rules).Build(),
+			New: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler", "-stream", "top")}, rules).
+				AddSubGoal("W002", []*Plugin{newPlugin("imagesampler", "-stream", "bottom")}, rules).Build(),
+			WantChanged: []string{"W002"},
+		},
+		"addandremovenode": {
+			Old: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler")}, rules).
+				AddSubGoal("W002", []*Plugin{newPlugin("imagesampler")}, rules).Build(),
+			New: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W002", []*Plugin{newPlugin("imagesampler")}, rules).
+				AddSubGoal("W003", []*Plugin{newPlugin("imagesampler")}, rules).Build(),
+			WantChanged: []string{"W003"},
+			WantRemoved: []string{"W001"},
+		},
+		"changeweight": {
+			Old: NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler")}, rules).
+				AddSubGoal("W002", []*Plugin{newPlugin("imagesampler")}, rules).Build(),
+			New: NewScienceGoalBuilderWithID("test", "1", "goal").SetWeight(2).
+				AddSubGoal("W001", []*Plugin{newPlugin("imagesampler")}, rules).
+				AddSubGoal("W002", []*Plugin{newPlugin("imagesampler")}, rules).Build(),
+			WantChanged: []string{"W001", "W002"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			changed, removed := tc.Old.DiffSubGoals(tc.New)
+			if !reflect.DeepEqual(changed, tc.WantChanged) {
+				t.Errorf("Changed nodes mismatch: wanted %v, got %v", tc.WantChanged, changed)
+			}
+			if !reflect.DeepEqual(removed, tc.WantRemoved) {
+				t.Errorf("Removed nodes mismatch: wanted %v, got %v", tc.WantRemoved, removed)
+			}
+		})
+	}
+}
+
+func TestScienceGoalDropSubGoal(t *testing.T) {
+	tests := map[string]struct {
+		NodeName  string
+		WantFound bool
+		WantNodes []string
+	}{
+		"drop":            {NodeName: "W002", WantFound: true, WantNodes: []string{"W001", "W003"}},
+		"caseinsensitive": {NodeName: "w001", WantFound: true, WantNodes: []string{"W002", "W003"}},
+		"notfound":        {NodeName: "W004", WantFound: false, WantNodes: []string{"W001", "W002", "W003"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			goal := NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W001", []*Plugin{}, nil).
+				AddSubGoal("W002", []*Plugin{}, nil).
+				AddSubGoal("W003", []*Plugin{}, nil).Build()
+			if found := goal.DropSubGoal(test.NodeName); found != test.WantFound {
+				t.Errorf("Wanted %t, got %t", test.WantFound, found)
+			}
+			if nodes := goal.GetSubjectNodes(); !reflect.DeepEqual(nodes, test.WantNodes) {
+				t.Errorf("Wanted %v, got %v", test.WantNodes, nodes)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package datatype
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GoalSignatureHeader carries the signature of goals in HTTP requests and responses
+const GoalSignatureHeader = "X-Goal-Signature"
+
+// goalSigningMessage binds goals to the node so that goals signed for one node
+// are not accepted by another node. Surrounding whitespace of the payload
+// is not signed as transports may add or strip it
+func goalSigningMessage(nodeName string, payload []byte) []byte {
+	message := []byte(strings.ToLower(nodeName) + "\n")
+	return append(message, bytes.TrimSpace(payload)...)
+}
+
+// SignGoals returns the base64-encoded ed25519 signature of the goal payload for the node
+func SignGoals(key ed25519.PrivateKey, nodeName string, payload []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(key, goalSigningMessage(nodeName, payload)))
+}
+
+// VerifyGoals returns an error if the signature is not of the goal payload for the node
+func VerifyGoals(key ed25519.PublicKey, nodeName string, payload []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("Goals are not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("Failed to decode goal signature: %s", err.Error())
+	}
+	if !ed25519.Verify(key, goalSigningMessage(nodeName, payload), sig) {
+		return fmt.Errorf("Goal signature does not match")
+	}
+	return nil
+}
+
+func readPEM(filePath string) (*pem.Block, error) {
+	blob, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(blob)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data found in %s", filePath)
+	}
+	return block, nil
+}
+
+// LoadGoalSigningKey loads a PEM-encoded PKCS #8 ed25519 private key, for example, created by
+//
+//	openssl genpkey -algorithm ed25519 -out goal-signing.key
+func LoadGoalSigningKey(filePath string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(filePath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse goal signing key %s: %s", filePath, err.Error())
+	}
+	if k, ok := key.(ed25519.PrivateKey); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("Goal signing key %s is not an ed25519 key", filePath)
+}
+
+// LoadGoalVerificationKey loads a PEM-encoded PKIX ed25519 public key, for example, created by
+//
+//	openssl pkey -in goal-signing.key -pubout -out goal-signing.pub
+func LoadGoalVerificationKey(filePath string) (ed25519.PublicKey, error) {
+	block, err := readPEM(filePath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse goal verification key %s: %s", filePath, err.Error())
+	}
+	if k, ok := key.(ed25519.PublicKey); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("Goal verification key %s is not an ed25519 key", filePath)
+}
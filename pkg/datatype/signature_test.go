@@ -0,0 +1,115 @@
+package datatype
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestVerifyGoals(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	payload := []byte(`[{"id":"goal","name":"test"}]`)
+	signature := SignGoals(key, "W001", payload)
+	tests := map[string]struct {
+		Key       ed25519.PublicKey
+		NodeName  string
+		Payload   []byte
+		Signature string
+		Valid     bool
+	}{
+		"valid": {
+			Key:       pub,
+			NodeName:  "W001",
+			Payload:   payload,
+			Signature: signature,
+			Valid:     true,
+		},
+		"lowercase": {
+			Key:       pub,
+			NodeName:  "w001",
+			Payload:   payload,
+			Signature: signature,
+			Valid:     true,
+		},
+		"whitespace": {
+			Key:       pub,
+			NodeName:  "W001",
+			Payload:   append(append([]byte(" "), payload...), '\n'),
+			Signature: signature,
+			Valid:     true,
+		},
+		"othernode": {
+			Key:       pub,
+			NodeName:  "W002",
+			Payload:   payload,
+			Signature: signature,
+		},
+		"tampered": {
+			Key:       pub,
+			NodeName:  "W001",
+			Payload:   []byte(`[{"id":"goal","name":"evil"}]`),
+			Signature: signature,
+		},
+		"otherkey": {
+			Key:       otherPub,
+			NodeName:  "W001",
+			Payload:   payload,
+			Signature: signature,
+		},
+		"unsigned": {
+			Key:      pub,
+			NodeName: "W001",
+			Payload:  payload,
+		},
+		"malformed": {
+			Key:       pub,
+			NodeName:  "W001",
+			Payload:   payload,
+			Signature: "not base64!",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := VerifyGoals(tc.Key, tc.NodeName, tc.Payload, tc.Signature)
+			if tc.Valid && err != nil {
+				t.Errorf("Wanted a valid signature, got %s", err.Error())
+			} else if !tc.Valid && err == nil {
+				t.Errorf("Wanted an invalid signature, got none")
+			}
+		})
+	}
+}
+
+func TestLoadGoalKeys(t *testing.T) {
+	dir := t.TempDir()
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	keyPath := path.Join(dir, "goal-signing.key")
+	pubPath := path.Join(dir, "goal-signing.pub")
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600)
+	os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0600)
+	loadedKey, err := LoadGoalSigningKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadedPub, err := LoadGoalVerificationKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("[]")
+	if err := VerifyGoals(loadedPub, "W001", payload, SignGoals(loadedKey, "W001", payload)); err != nil {
+		t.Errorf("Loaded keys do not match: %s", err.Error())
+	}
+	if _, err := LoadGoalSigningKey(pubPath); err == nil {
+		t.Errorf("Wanted an error loading a public key as the signing key, got none")
+	}
+	if _, err := LoadGoalVerificationKey(keyPath); err == nil {
+		t.Errorf("Wanted an error loading a private key as the verification key, got none")
+	}
+}
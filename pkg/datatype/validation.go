@@ -0,0 +1,128 @@
+package datatype
+
+import (
+	"fmt"
+	"math"
+)
+
+// ValidationReport structs findings of a job validation that do not reject the job
+type ValidationReport struct {
+	Conflicts []Conflict                `json:"conflicts,omitempty"`
+	Warnings  []string                  `json:"warnings,omitempty"`
+	Capacity  []*NodeCapacityProjection `json:"capacity,omitempty"`
+}
+
+type ConflictType string
+
+const (
+	// ConflictPluginName indicates plugins of different jobs have the same name on a node.
+	// Kubernetes Job names come from plugin names so the plugins cannot run together
+	ConflictPluginName ConflictType = "plugin_name"
+	// ConflictDuplicateSpec indicates different jobs run the same plugin spec on a node
+	ConflictDuplicateSpec ConflictType = "duplicate_spec"
+	// ConflictExclusiveHardware indicates different jobs require the same exclusive hardware on a node
+	ConflictExclusiveHardware ConflictType = "exclusive_hardware"
+)
+
+// Conflict structs a conflict between a plugin of a job and a plugin of other active job on a node
+type Conflict struct {
+	Type        ConflictType `json:"type"`
+	Node        string       `json:"node"`
+	Plugin      string       `json:"plugin"`
+	OtherJobID  string       `json:"other_job_id"`
+	OtherPlugin string       `json:"other_plugin"`
+	Hardware    string       `json:"hardware,omitempty"`
+}
+
+// IsFatal returns true if the conflict prevents the plugins from running on the node
+func (c Conflict) IsFatal() bool {
+	return c.Type == ConflictPluginName
+}
+
+func (c Conflict) String() string {
+	switch c.Type {
+	case ConflictPluginName:
+		return fmt.Sprintf("%s: plugin name %q is already used by job %q", c.Node, c.Plugin, c.OtherJobID)
+	case ConflictDuplicateSpec:
+		return fmt.Sprintf("%s: plugin %q has the same spec as plugin %q of job %q", c.Node, c.Plugin, c.OtherPlugin, c.OtherJobID)
+	case ConflictExclusiveHardware:
+		return fmt.Sprintf("%s: plugin %q and plugin %q of job %q both require exclusive hardware %s", c.Node, c.Plugin, c.OtherPlugin, c.OtherJobID, c.Hardware)
+	default:
+		return fmt.Sprintf("%s: plugin %q conflicts with plugin %q of job %q", c.Node, c.Plugin, c.OtherPlugin, c.OtherJobID)
+	}
+}
+
+// DeviceLoad structs projected load of plugins placed on a device.
+// CPU is in millicores and memory is in Mi. Expected load is weighted by
+// duty cycles of plugins while peak load assumes all plugins run at the same time.
+type DeviceLoad struct {
+	Device            string   `json:"device"`
+	Capacity          Resource `json:"capacity"`
+	ExpectedCPU       float64  `json:"expected_cpu"`
+	ExpectedMemory    float64  `json:"expected_memory"`
+	ExpectedGPUMemory float64  `json:"expected_gpu_memory"`
+	PeakCPU           int      `json:"peak_cpu"`
+	PeakMemory        int      `json:"peak_memory"`
+	PeakGPUMemory     int      `json:"peak_gpu_memory"`
+	Plugins           []string `json:"plugins,omitempty"`
+}
+
+// exceeded returns names of resources whose given load exceeds capacity of the device.
+// Resources with unknown capacity are not checked.
+func (d *DeviceLoad) exceeded(cpu float64, memory float64, gpuMemory float64) (resources []string) {
+	if c := d.Capacity.CPUInMilli(); c > 0 && cpu > float64(c) {
+		resources = append(resources, "cpu")
+	}
+	if c := d.Capacity.MemoryInMega(); c > 0 && memory > float64(c) {
+		resources = append(resources, "memory")
+	}
+	if c := d.Capacity.GPUMemoryInMega(); c > 0 && gpuMemory > float64(c) {
+		resources = append(resources, "gpu_memory")
+	}
+	return
+}
+
+// Utilization returns the highest ratio of the given load to capacity of the device
+func (d *DeviceLoad) Utilization(cpu float64, memory float64, gpuMemory float64) (ratio float64) {
+	if c := d.Capacity.CPUInMilli(); c > 0 {
+		ratio = math.Max(ratio, cpu/float64(c))
+	}
+	if c := d.Capacity.MemoryInMega(); c > 0 {
+		ratio = math.Max(ratio, memory/float64(c))
+	}
+	if c := d.Capacity.GPUMemoryInMega(); c > 0 {
+		ratio = math.Max(ratio, gpuMemory/float64(c))
+	}
+	return
+}
+
+// NodeCapacityProjection structs projected load on devices of a node
+type NodeCapacityProjection struct {
+	Node     string        `json:"node"`
+	Devices  []*DeviceLoad `json:"devices"`
+	Unplaced []string      `json:"unplaced,omitempty"`
+}
+
+// Oversubscribed returns descriptions of devices whose expected load exceeds their capacity
+func (p *NodeCapacityProjection) Oversubscribed() (messages []string) {
+	for _, d := range p.Devices {
+		if resources := d.exceeded(d.ExpectedCPU, d.ExpectedMemory, d.ExpectedGPUMemory); len(resources) > 0 {
+			messages = append(messages, fmt.Sprintf("%s (%s) would be oversubscribed in %v by %v", p.Node, d.Device, resources, d.Plugins))
+		}
+	}
+	return
+}
+
+// Overcommitted returns descriptions of devices that are not oversubscribed,
+// but cannot run all of their plugins at the same time
+func (p *NodeCapacityProjection) Overcommitted() (messages []string) {
+	for _, d := range p.Devices {
+		if len(d.exceeded(d.ExpectedCPU, d.ExpectedMemory, d.ExpectedGPUMemory)) > 0 {
+			continue
+		}
+		if resources := d.exceeded(float64(d.PeakCPU), float64(d.PeakMemory), float64(d.PeakGPUMemory)); len(resources) > 0 {
+			messages = append(messages, fmt.Sprintf("%s (%s) cannot run %v at the same time due to %v; plugins may wait for resources", p.Node, d.Device, d.Plugins, resources))
+		}
+	}
+	return
+}
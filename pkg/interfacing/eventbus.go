@@ -0,0 +1,177 @@
+package interfacing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+// EventBus delivers Waggle messages between schedulers and the Waggle data pipeline.
+//
+// Topic patterns follow AMQP topic wildcards on message names: words are separated by ".",
+// "*" matches exactly one word and "#" matches zero or more words, for example,
+// "sys.scheduler.#" matches all scheduling events.
+type EventBus interface {
+	// Publish publishes the message to the scope, for example, "node" or "all"
+	Publish(message *datatype.WaggleMessage, scope string) error
+	// Subscribe delivers messages whose name matches the topic pattern to ch until the bus is closed.
+	// The bus does not close ch
+	Subscribe(topicPattern string, ch chan *datatype.WaggleMessage) error
+	// Close stops subscriptions and waits for pending publishes until ctx is done
+	Close(ctx context.Context) error
+}
+
+// MatchTopic returns true if the topic matches the topic pattern
+func MatchTopic(topicPattern string, topic string) bool {
+	return matchWords(strings.Split(topicPattern, "."), strings.Split(topic, "."))
+}
+
+func matchWords(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		// "#" takes zero or more words
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
+
+// topicSubscription is a subscription of a topic pattern used by event bus implementations
+type topicSubscription struct {
+	topicPattern string
+	ch           chan *datatype.WaggleMessage
+}
+
+// SubscribeEvents subscribes scheduling events matching the topic pattern on the bus
+// and delivers them to ch until ctx is done. The VSN of the sender is added to events
+func SubscribeEvents(ctx context.Context, bus EventBus, topicPattern string, ch chan *datatype.Event) error {
+	messages := make(chan *datatype.WaggleMessage)
+	if err := bus.Subscribe(topicPattern, messages); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-messages:
+				eventBuilder, err := datatype.NewEventBuilderFromWaggleMessage(message)
+				if err != nil {
+					logger.Debug.Printf("Failed to parse %v: %s", message, err.Error())
+					continue
+				}
+				if vsn, exist := message.Meta["vsn"]; exist {
+					eventBuilder.AddEntry("vsn", vsn)
+				}
+				event := eventBuilder.Build()
+				select {
+				case ch <- &event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// MemoryEventBus delivers messages within the process. It is used for tests, simulation,
+// and when no message broker is available
+type MemoryEventBus struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	mu            sync.Mutex
+	closed        bool
+	subscriptions []topicSubscription
+	publishes     sync.WaitGroup
+}
+
+func NewMemoryEventBus() *MemoryEventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryEventBus{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Publish delivers the message to subscribers of matching topics. It blocks
+// until all subscribers receive the message or the bus is closed
+func (bus *MemoryEventBus) Publish(message *datatype.WaggleMessage, scope string) error {
+	bus.mu.Lock()
+	if bus.closed {
+		bus.mu.Unlock()
+		return fmt.Errorf("Event bus is closed")
+	}
+	bus.publishes.Add(1)
+	subscriptions := append([]topicSubscription{}, bus.subscriptions...)
+	bus.mu.Unlock()
+	defer bus.publishes.Done()
+	// Subscribers get their own copy as if the message went through a broker
+	blob := datatype.Dump(message)
+	for _, s := range subscriptions {
+		if !MatchTopic(s.topicPattern, message.Name) {
+			continue
+		}
+		m, err := datatype.Load(blob)
+		if err != nil {
+			return err
+		}
+		select {
+		case s.ch <- m:
+		case <-bus.ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (bus *MemoryEventBus) Subscribe(topicPattern string, ch chan *datatype.WaggleMessage) error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.closed {
+		return fmt.Errorf("Event bus is closed")
+	}
+	bus.subscriptions = append(bus.subscriptions, topicSubscription{topicPattern: topicPattern, ch: ch})
+	return nil
+}
+
+func (bus *MemoryEventBus) Close(ctx context.Context) error {
+	bus.mu.Lock()
+	if bus.closed {
+		bus.mu.Unlock()
+		return nil
+	}
+	bus.closed = true
+	bus.mu.Unlock()
+	bus.cancel()
+	return waitPublishes(ctx, &bus.publishes, "memory")
+}
+
+// waitPublishes waits for pending publishes until ctx is done
+func waitPublishes(ctx context.Context, publishes *sync.WaitGroup, name string) error {
+	flushed := make(chan struct{})
+	go func() {
+		publishes.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("Pending publishes to %s did not finish: %s", name, ctx.Err().Error())
+	}
+}
@@ -0,0 +1,125 @@
+package interfacing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := map[string]struct {
+		Pattern string
+		Topic   string
+		Match   bool
+	}{
+		"exact":       {Pattern: "sys.scheduler.status", Topic: "sys.scheduler.status", Match: true},
+		"different":   {Pattern: "sys.scheduler.status", Topic: "sys.scheduler.failure", Match: false},
+		"star":        {Pattern: "sys.*.status", Topic: "sys.scheduler.status", Match: true},
+		"starempty":   {Pattern: "sys.scheduler.*", Topic: "sys.scheduler", Match: false},
+		"startoomany": {Pattern: "sys.*", Topic: "sys.scheduler.status", Match: false},
+		"hash":        {Pattern: "sys.scheduler.#", Topic: "sys.scheduler.status.goal.received", Match: true},
+		"hashzero":    {Pattern: "sys.scheduler.#", Topic: "sys.scheduler", Match: true},
+		"hashmiddle":  {Pattern: "sys.#.received", Topic: "sys.scheduler.status.goal.received", Match: true},
+		"hashnomatch": {Pattern: "sys.#.received", Topic: "sys.scheduler.status.goal.updated", Match: false},
+		"hashonly":    {Pattern: "#", Topic: "env.temperature", Match: true},
+		"prefix":      {Pattern: "sys.scheduler", Topic: "sys.scheduler.status", Match: false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := MatchTopic(test.Pattern, test.Topic); got != test.Match {
+				t.Errorf("MatchTopic(%q, %q) = %v, want %v", test.Pattern, test.Topic, got, test.Match)
+			}
+		})
+	}
+}
+
+func TestMemoryEventBus(t *testing.T) {
+	tests := map[string]struct {
+		Pattern  string
+		Names    []string
+		Received []string
+	}{
+		"all": {
+			Pattern:  "sys.scheduler.#",
+			Names:    []string{"sys.scheduler.status.goal.received", "sys.scheduler.failure"},
+			Received: []string{"sys.scheduler.status.goal.received", "sys.scheduler.failure"},
+		},
+		"filtered": {
+			Pattern:  "sys.scheduler.status.plugin.*",
+			Names:    []string{"sys.scheduler.status.goal.received", "sys.scheduler.status.plugin.launched", "env.temperature"},
+			Received: []string{"sys.scheduler.status.plugin.launched"},
+		},
+		"none": {
+			Pattern: "sys.scheduler.#",
+			Names:   []string{"env.temperature"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bus := NewMemoryEventBus()
+			ch := make(chan *datatype.WaggleMessage, len(test.Names))
+			if err := bus.Subscribe(test.Pattern, ch); err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range test.Names {
+				if err := bus.Publish(datatype.NewMessage(n, "value", time.Now().UnixNano(), map[string]string{"vsn": "W001"}), "all"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			close(ch)
+			var received []string
+			for m := range ch {
+				if m.Meta["vsn"] != "W001" {
+					t.Errorf("Message %q lost its meta: %v", m.Name, m.Meta)
+				}
+				received = append(received, m.Name)
+			}
+			if len(received) != len(test.Received) {
+				t.Fatalf("Received %v, want %v", received, test.Received)
+			}
+			for i := range received {
+				if received[i] != test.Received[i] {
+					t.Errorf("Received %v, want %v", received, test.Received)
+				}
+			}
+			if err := bus.Close(context.Background()); err != nil {
+				t.Error(err)
+			}
+			if err := bus.Publish(datatype.NewMessage("sys.scheduler.failure", "", 0, nil), "all"); err == nil {
+				t.Error("Publish succeeded after the bus closed")
+			}
+		})
+	}
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	bus := NewMemoryEventBus()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := make(chan *datatype.Event)
+	if err := SubscribeEvents(ctx, bus, "sys.scheduler.#", ch); err != nil {
+		t.Fatal(err)
+	}
+	event := datatype.NewEventBuilder(datatype.EventGoalStatusReceived).AddReason("test").Build()
+	message := event.ToWaggleMessage()
+	message.Meta["vsn"] = "W001"
+	go bus.Publish(message, "all")
+	select {
+	case event := <-ch:
+		if event.Type != datatype.EventGoalStatusReceived {
+			t.Errorf("Received event %q, want %q", event.Type, datatype.EventGoalStatusReceived)
+		}
+		if vsn := event.GetEntry("vsn"); vsn != "W001" {
+			t.Errorf("Event has vsn %q, want W001", vsn)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No event received")
+	}
+	// Publishes must not block after the subscriber stops
+	cancel()
+	if err := bus.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -3,6 +3,8 @@ package interfacing
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -31,6 +33,19 @@ func NewHTTPRequest(baseURL string) *HTTPRequest {
 	}
 }
 
+// NewHTTPRequestWithTLS returns a HTTPRequest that uses tlsConfig for HTTPS connections
+func NewHTTPRequestWithTLS(baseURL string, tlsConfig *tls.Config) *HTTPRequest {
+	return &HTTPRequest{
+		BaseURL: baseURL,
+		c: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+		},
+	}
+}
+
 func (r *HTTPRequest) RequestGet(subPath string, queries url.Values, header map[string]string) (*http.Response, error) {
 	url, err := url.Parse(r.BaseURL)
 	if err != nil {
@@ -61,6 +76,23 @@ func (r *HTTPRequest) RequestPost(subPath string, body []byte) (*http.Response,
 	return http.Post(url.String(), "application/json", bytes.NewBuffer(body))
 }
 
+func (r *HTTPRequest) RequestDelete(subPath string, body []byte, header map[string]string) (*http.Response, error) {
+	url, err := url.Parse(r.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %q: %s", r.BaseURL, err.Error())
+	}
+	url.Path = path.Join(url.Path, subPath)
+	req, err := http.NewRequest("DELETE", url.String(), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Add(k, v)
+	}
+	return r.c.Do(req)
+}
+
 func (r *HTTPRequest) RequestPostFromFile(subPath string, filePath string) (*http.Response, error) {
 	url, err := url.Parse(r.BaseURL)
 	if err != nil {
@@ -108,66 +140,78 @@ func (r *HTTPRequest) ParseJSONHTTPResponse(resp *http.Response) (body map[strin
 	return body, nil
 }
 
-func (r *HTTPRequest) Subscribe(streamPath string, ch chan *datatype.Event, keepRetry bool) error {
+// Subscribe receives events from the server-sent event stream at streamPath
+// and keeps reconnecting until ctx is done
+func (r *HTTPRequest) Subscribe(ctx context.Context, streamPath string, ch chan *datatype.Event, keepRetry bool) error {
 	operation := func() error {
-		resp, err := r.RequestGet(streamPath, nil, nil)
+		u, err := url.Parse(r.BaseURL)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("Failed to parse %q: %s", r.BaseURL, err.Error()))
+		}
+		u.Path = path.Join(u.Path, streamPath)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		resp, err := r.c.Do(req)
 		if err != nil {
 			return err
 		}
+		defer resp.Body.Close()
 		if resp.StatusCode != 200 {
 			return fmt.Errorf("could not connect to stream: %s", http.StatusText(resp.StatusCode))
 		}
-		defer resp.Body.Close()
-		// patternEvent := regexp.MustCompile(`event:(.*?)\n`)
-		// patternData := regexp.MustCompile(`data:(.*?)\n`)
 		reader := bufio.NewScanner(resp.Body)
 		reader.Split(ScanEvent)
-		// var e *datatype.Event
-		for {
-			if reader.Scan() {
-				line := reader.Text()
-				logger.Debug.Printf("stream received: %s", line)
-				eStart := strings.Index(line, "event:")
-				eEnd := strings.Index(line, "data:")
-				e := line[eStart+6 : eEnd]
-				e = strings.Trim(e, " ")
-				d := line[eEnd+5:]
-				event := datatype.NewEventBuilder(datatype.EventType(e)).AddEntry("goals", d).Build()
-				ch <- &event
-				// if match := patternEvent.FindStringSubmatch(line); len(match) > 0 {
-				// 	// if e != nil {
-				// 	// 	fmt.Println("something is wrong")
-				// 	// }
-				// 	fmt.Printf("%s", match[1])
-				// }
-				// if match := patternData.FindStringSubmatch(line); len(match) > 0 {
-				// 	// if e != nil {
-				// 	// 	fmt.Println("something is wrong")
-				// 	// }
-				// 	fmt.Printf("%s", match[1])
-				// }
+		for reader.Scan() {
+			line := reader.Text()
+			logger.Debug.Printf("stream received: %s", line)
+			eStart := strings.Index(line, "event:")
+			eEnd := strings.Index(line, "data:")
+			if eStart < 0 || eEnd < eStart {
+				logger.Debug.Printf("Skipping a malformed event: %s", line)
+				continue
+			}
+			e := line[eStart+6 : eEnd]
+			e = strings.Trim(e, " ")
+			d := line[eEnd+5:]
+			eventBuilder := datatype.NewEventBuilder(datatype.EventType(e)).AddEntry("goals", d)
+			// The signature of goals, if any, comes before the event
+			if sStart := strings.Index(line[:eStart], "signature:"); sStart > -1 {
+				eventBuilder.AddEntry("signature", strings.TrimSpace(line[sStart+10:eStart]))
 			}
-			if err := reader.Err(); err != nil {
-				// reader.Scan returned false indicating an error
-				return fmt.Errorf("Streaming encountered EOF or an error and considered as closed")
+			event := eventBuilder.Build()
+			select {
+			case ch <- &event:
+			case <-ctx.Done():
+				return nil
 			}
-			// event := reader.Text()
-			// fmt.Printf("event received: %s", event)
-			// for _, line := range strings.Split(event, "\n") {
-			// 	if strings.
-			// }
-			// line, _ := reader.ReadSlice("\n\n")
-			// fmt.Printf("event received: %s", line)
 		}
+		// The stream is closed by the server or failed
+		if err := reader.Err(); err != nil {
+			return fmt.Errorf("Streaming failed: %s", err.Error())
+		}
+		return fmt.Errorf("Streaming encountered EOF and considered as closed")
 	}
 	go func() {
 		for {
-			err := backoff.Retry(operation, backoff.NewExponentialBackOff())
+			err := backoff.Retry(operation, backoff.WithContext(backoff.NewExponentialBackOff(), ctx))
+			if ctx.Err() != nil {
+				logger.Info.Printf("Stopped subscribing %q", streamPath)
+				return
+			}
 			logger.Error.Printf("Failed to subscribe %q: %s", streamPath, err.Error())
-			time.Sleep(5 * time.Second)
+			if !keepRetry {
+				return
+			}
 			logger.Info.Printf("Retrying to connect to %q in 5 seconds...", streamPath)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				logger.Info.Printf("Stopped subscribing %q", streamPath)
+				return
+			}
 		}
-
 	}()
 	return nil
 }
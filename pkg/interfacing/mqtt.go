@@ -0,0 +1,208 @@
+package interfacing
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+)
+
+const mqttPublishTimeout = 10 * time.Second
+
+// MQTTEventBus delivers messages through a MQTT broker for sites without AMQP.
+//
+// Messages are published to "<topic prefix>/<scope>/<message name>" where dots of
+// the message name become topic levels, for example, "waggle/all/sys/scheduler/status/goal/received".
+type MQTTEventBus struct {
+	BrokerURI     string
+	topicPrefix   string
+	client        mqtt.Client
+	ctx           context.Context
+	cancel        context.CancelFunc
+	mu            sync.Mutex
+	closed        bool
+	connectToken  mqtt.Token
+	subscriptions []topicSubscription
+	publishes     sync.WaitGroup
+}
+
+// NewMQTTEventBus returns a MQTT event bus. The broker URI has the form of
+// "tcp://host:1883" or "ssl://host:8883" and tlsConfig is used for the latter
+func NewMQTTEventBus(brokerURI string, username string, password string, clientID string, topicPrefix string, tlsConfig *tls.Config) *MQTTEventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := &MQTTEventBus{
+		BrokerURI:   brokerURI,
+		topicPrefix: strings.TrimSuffix(topicPrefix, "/"),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+	options := mqtt.NewClientOptions().
+		AddBroker(brokerURI).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetOnConnectHandler(bus.onConnect).
+		SetConnectionLostHandler(func(c mqtt.Client, err error) {
+			logger.Error.Printf("Lost connection to MQTT broker %s: %s", brokerURI, err.Error())
+		})
+	if tlsConfig != nil {
+		options.SetTLSConfig(tlsConfig)
+	}
+	bus.client = mqtt.NewClient(options)
+	return bus
+}
+
+// NewMQTTTLSConfig returns the TLS configuration for the broker URI. It returns nil
+// if the URI does not use TLS, for example, "ssl://", and no certificate is given
+func NewMQTTTLSConfig(brokerURI string, cacertPath string, certPath string, keyPath string) (*tls.Config, error) {
+	useTLS := cacertPath != "" || certPath != ""
+	for _, scheme := range []string{"ssl://", "tls://", "mqtts://", "wss://"} {
+		if strings.HasPrefix(brokerURI, scheme) {
+			useTLS = true
+		}
+	}
+	if !useTLS {
+		return nil, nil
+	}
+	return NewClientTLSConfig(cacertPath, certPath, keyPath)
+}
+
+// topicLevels prepends the topic prefix if set
+func (bus *MQTTEventBus) topicLevels(levels ...string) string {
+	if bus.topicPrefix != "" {
+		levels = append([]string{bus.topicPrefix}, levels...)
+	}
+	return strings.Join(levels, "/")
+}
+
+// topic returns the MQTT topic of the message name in the scope
+func (bus *MQTTEventBus) topic(scope string, name string) string {
+	return bus.topicLevels(scope, strings.ReplaceAll(name, ".", "/"))
+}
+
+// topicFilter returns the MQTT topic filter of the topic pattern in any scope.
+// MQTT allows "#" only at the end. A pattern having "#" in the middle is
+// subscribed up to the "#" and filtered when messages arrive
+func (bus *MQTTEventBus) topicFilter(topicPattern string) string {
+	words := strings.Split(topicPattern, ".")
+	levels := []string{"+"}
+	for _, word := range words {
+		if word == "#" {
+			levels = append(levels, "#")
+			break
+		} else if word == "*" {
+			levels = append(levels, "+")
+		} else {
+			levels = append(levels, word)
+		}
+	}
+	return bus.topicLevels(levels...)
+}
+
+// connect starts connecting to the broker once and returns the token
+// completing when the client connects. The client keeps retrying until then
+func (bus *MQTTEventBus) connect() mqtt.Token {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.connectToken == nil {
+		logger.Debug.Printf("Connecting to MQTT broker %s...", bus.BrokerURI)
+		bus.connectToken = bus.client.Connect()
+	}
+	return bus.connectToken
+}
+
+// onConnect subscribes all topics as the broker does not keep subscriptions of clean sessions
+func (bus *MQTTEventBus) onConnect(c mqtt.Client) {
+	logger.Info.Printf("Connected to MQTT broker %s", bus.BrokerURI)
+	bus.mu.Lock()
+	subscriptions := append([]topicSubscription{}, bus.subscriptions...)
+	bus.mu.Unlock()
+	for _, s := range subscriptions {
+		bus.subscribe(s)
+	}
+}
+
+func (bus *MQTTEventBus) subscribe(s topicSubscription) {
+	filter := bus.topicFilter(s.topicPattern)
+	token := bus.client.Subscribe(filter, 1, func(c mqtt.Client, m mqtt.Message) {
+		message, err := datatype.Load(m.Payload())
+		if err != nil {
+			logger.Debug.Printf("Failed to load message from %q: %s", m.Topic(), err.Error())
+			return
+		}
+		if !MatchTopic(s.topicPattern, message.Name) {
+			return
+		}
+		select {
+		case s.ch <- message:
+		case <-bus.ctx.Done():
+		}
+	})
+	go func() {
+		if token.WaitTimeout(mqttPublishTimeout) && token.Error() != nil {
+			logger.Error.Printf("Failed to subscribe %q: %s", filter, token.Error().Error())
+		}
+	}()
+}
+
+func (bus *MQTTEventBus) Publish(message *datatype.WaggleMessage, scope string) error {
+	bus.mu.Lock()
+	if bus.closed {
+		bus.mu.Unlock()
+		return fmt.Errorf("MQTT event bus is closed")
+	}
+	bus.publishes.Add(1)
+	bus.mu.Unlock()
+	defer bus.publishes.Done()
+	// Messages published before connecting are dropped as the session is clean
+	if !bus.connect().WaitTimeout(mqttPublishTimeout) {
+		return fmt.Errorf("Timed out connecting to MQTT broker %s", bus.BrokerURI)
+	}
+	topic := bus.topic(scope, message.Name)
+	token := bus.client.Publish(topic, 1, false, datatype.Dump(message))
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return fmt.Errorf("Timed out publishing to %q on MQTT broker %s", topic, bus.BrokerURI)
+	}
+	return token.Error()
+}
+
+func (bus *MQTTEventBus) Subscribe(topicPattern string, ch chan *datatype.WaggleMessage) error {
+	s := topicSubscription{topicPattern: topicPattern, ch: ch}
+	bus.mu.Lock()
+	if bus.closed {
+		bus.mu.Unlock()
+		return fmt.Errorf("MQTT event bus is closed")
+	}
+	bus.subscriptions = append(bus.subscriptions, s)
+	bus.mu.Unlock()
+	// Topics are subscribed when the client connects
+	if bus.client.IsConnectionOpen() {
+		bus.subscribe(s)
+	}
+	bus.connect()
+	return nil
+}
+
+func (bus *MQTTEventBus) Close(ctx context.Context) error {
+	bus.mu.Lock()
+	if bus.closed {
+		bus.mu.Unlock()
+		return nil
+	}
+	bus.closed = true
+	bus.mu.Unlock()
+	bus.cancel()
+	err := waitPublishes(ctx, &bus.publishes, bus.BrokerURI)
+	bus.client.Disconnect(250)
+	return err
+}
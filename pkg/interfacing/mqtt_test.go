@@ -0,0 +1,228 @@
+package interfacing
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// testMQTTBroker is a minimal MQTT broker forwarding publishes to subscribers at QoS 0
+type testMQTTBroker struct {
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[net.Conn][]string
+	topics   []string
+}
+
+func newTestMQTTBroker(t *testing.T) *testMQTTBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testMQTTBroker{listener: l, clients: make(map[net.Conn][]string)}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testMQTTBroker) URI() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *testMQTTBroker) write(conn net.Conn, p packets.ControlPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.Write(conn)
+}
+
+func (b *testMQTTBroker) serve(conn net.Conn) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, conn)
+		b.mu.Unlock()
+		conn.Close()
+	}()
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *packets.ConnectPacket:
+			b.mu.Lock()
+			b.clients[conn] = nil
+			b.mu.Unlock()
+			b.write(conn, packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			b.mu.Lock()
+			b.clients[conn] = append(b.clients[conn], p.Topics...)
+			b.mu.Unlock()
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = make([]byte, len(p.Topics))
+			b.write(conn, ack)
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				b.write(conn, ack)
+			}
+			b.mu.Lock()
+			b.topics = append(b.topics, p.TopicName)
+			var receivers []net.Conn
+			for c, filters := range b.clients {
+				for _, f := range filters {
+					if matchMQTTFilter(f, p.TopicName) {
+						receivers = append(receivers, c)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			for _, c := range receivers {
+				forward := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				forward.TopicName = p.TopicName
+				forward.Payload = p.Payload
+				b.write(c, forward)
+			}
+		case *packets.PingreqPacket:
+			b.write(conn, packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *testMQTTBroker) subscribed() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, filters := range b.clients {
+		n += len(filters)
+	}
+	return n
+}
+
+func (b *testMQTTBroker) publishedTopics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.topics...)
+}
+
+func matchMQTTFilter(filter string, topic string) bool {
+	f, levels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i := range f {
+		if f[i] == "#" {
+			return true
+		}
+		if i >= len(levels) || (f[i] != "+" && f[i] != levels[i]) {
+			return false
+		}
+	}
+	return len(f) == len(levels)
+}
+
+func TestMQTTEventBusTopicFilter(t *testing.T) {
+	tests := map[string]struct {
+		Prefix  string
+		Pattern string
+		Filter  string
+	}{
+		"hash":       {Prefix: "waggle", Pattern: "sys.scheduler.#", Filter: "waggle/+/sys/scheduler/#"},
+		"star":       {Prefix: "waggle", Pattern: "sys.*.status", Filter: "waggle/+/sys/+/status"},
+		"hashmiddle": {Prefix: "waggle", Pattern: "sys.#.received", Filter: "waggle/+/sys/#"},
+		"noprefix":   {Prefix: "", Pattern: "sys.scheduler.#", Filter: "+/sys/scheduler/#"},
+		"slash":      {Prefix: "waggle/", Pattern: "env.temperature", Filter: "waggle/+/env/temperature"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bus := NewMQTTEventBus("tcp://localhost:1883", "", "", "test", test.Prefix, nil)
+			if got := bus.topicFilter(test.Pattern); got != test.Filter {
+				t.Errorf("topicFilter(%q) = %q, want %q", test.Pattern, got, test.Filter)
+			}
+		})
+	}
+}
+
+func TestMQTTEventBus(t *testing.T) {
+	tests := map[string]struct {
+		Pattern  string
+		Names    []string
+		Received []string
+	}{
+		"all": {
+			Pattern:  "sys.scheduler.#",
+			Names:    []string{"sys.scheduler.status.goal.received", "env.temperature", "sys.scheduler.failure"},
+			Received: []string{"sys.scheduler.status.goal.received", "sys.scheduler.failure"},
+		},
+		"hashmiddle": {
+			Pattern:  "sys.#.received",
+			Names:    []string{"sys.scheduler.status.goal.updated", "sys.scheduler.status.goal.received"},
+			Received: []string{"sys.scheduler.status.goal.received"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			broker := newTestMQTTBroker(t)
+			receiver := NewMQTTEventBus(broker.URI(), "", "", "receiver", "waggle", nil)
+			sender := NewMQTTEventBus(broker.URI(), "", "", "sender", "waggle", nil)
+			ch := make(chan *datatype.WaggleMessage, len(test.Names))
+			if err := receiver.Subscribe(test.Pattern, ch); err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for broker.subscribed() < 1 {
+				if time.Now().After(deadline) {
+					t.Fatal("Receiver did not subscribe")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			for _, n := range test.Names {
+				if err := sender.Publish(datatype.NewMessage(n, "value", time.Now().UnixNano(), map[string]string{"vsn": "W001"}), "all"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, want := range test.Received {
+				select {
+				case m := <-ch:
+					if m.Name != want {
+						t.Errorf("Received %q, want %q", m.Name, want)
+					}
+					if m.Meta["vsn"] != "W001" {
+						t.Errorf("Message %q lost its meta: %v", m.Name, m.Meta)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("Did not receive %q", want)
+				}
+			}
+			select {
+			case m := <-ch:
+				t.Errorf("Received unexpected message %q", m.Name)
+			case <-time.After(100 * time.Millisecond):
+			}
+			topics := broker.publishedTopics()
+			if len(topics) != len(test.Names) || topics[0] != "waggle/all/"+strings.ReplaceAll(test.Names[0], ".", "/") {
+				t.Errorf("Published to %v", topics)
+			}
+			for _, bus := range []*MQTTEventBus{sender, receiver} {
+				if err := bus.Close(context.Background()); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
@@ -1,30 +1,289 @@
 package interfacing
 
 import (
+	"fmt"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
 )
 
+// defaultSubscriptionBufferSize is the number of events buffered for a subscriber
+// in addition to its channel
+const defaultSubscriptionBufferSize = 100
+
+// OverflowPolicy decides what happens to an event when the buffer of a subscriber is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Notify wait until the subscriber has room for the event
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest event in the buffer to make room for the event
+	OverflowDropOldest
+	// OverflowError drops the event and makes Notify return an error
+	OverflowError
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "dropoldest"
+	case OverflowError:
+		return "error"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// SubscriptionOptions configures a subscription. The zero value subscribes
+// all events with the default buffer size and blocks on overflow
+type SubscriptionOptions struct {
+	// Name identifies the subscriber in metrics
+	Name string
+	// EventTypes filters events to deliver. All events are delivered if empty
+	EventTypes []datatype.EventType
+	// BufferSize is the number of events buffered before the overflow policy applies
+	BufferSize int
+	Overflow   OverflowPolicy
+}
+
+// Subscription delivers events from a Notifier to the channel of a subscriber.
+//
+// Events are buffered and delivered to the channel in order so that
+// a slow subscriber does not hold up the notifier or other subscribers
+// unless the subscription blocks on overflow.
+type Subscription struct {
+	name       string
+	ch         chan datatype.Event
+	eventTypes map[datatype.EventType]bool
+	overflow   OverflowPolicy
+	buffer     chan datatype.Event
+	done       chan struct{}
+	mu         sync.Mutex
+	dropped    uint64
+}
+
+// Name returns the name of the subscriber
+func (s *Subscription) Name() string {
+	return s.name
+}
+
+// key identifies the subscriber in metrics
+func (s *Subscription) key() [2]string {
+	return [2]string{s.name, s.overflow.String()}
+}
+
+func (s *Subscription) accepts(e datatype.Event) bool {
+	if len(s.eventTypes) == 0 {
+		return true
+	}
+	return s.eventTypes[e.Type]
+}
+
+// Dropped returns the number of events dropped for overflow
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Buffered returns the number of events waiting to be delivered
+func (s *Subscription) Buffered() int {
+	return len(s.buffer)
+}
+
+func (s *Subscription) drop() {
+	s.mu.Lock()
+	s.dropped++
+	s.mu.Unlock()
+}
+
+// push puts the event in the buffer following the overflow policy
+func (s *Subscription) push(e datatype.Event) error {
+	switch s.overflow {
+	case OverflowDropOldest:
+		for {
+			select {
+			case s.buffer <- e:
+				return nil
+			case <-s.done:
+				return nil
+			default:
+			}
+			select {
+			case dropped := <-s.buffer:
+				s.drop()
+				logger.Error.Printf("Subscriber %q is full. Dropped %q", s.name, dropped.Type)
+			default:
+			}
+		}
+	case OverflowError:
+		select {
+		case s.buffer <- e:
+			return nil
+		case <-s.done:
+			return nil
+		default:
+			s.drop()
+			return fmt.Errorf("Subscriber %q is full. Dropped %q", s.name, e.Type)
+		}
+	default:
+		select {
+		case s.buffer <- e:
+		case <-s.done:
+		}
+		return nil
+	}
+}
+
+// run delivers buffered events to the channel of the subscriber until unsubscribed
+func (s *Subscription) run() {
+	for {
+		select {
+		case e := <-s.buffer:
+			select {
+			case s.ch <- e:
+			case <-s.done:
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Notifier delivers events to subscribers
 type Notifier struct {
-	subscribers map[chan datatype.Event]struct{}
-	rm          sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	// unsubscribedDrops keeps dropped counts of unsubscribed subscribers
+	// by name and policy so that the counts do not go backwards
+	unsubscribedDrops map[[2]string]uint64
+	rm                sync.RWMutex
 }
 
 func NewNotifier() *Notifier {
 	return &Notifier{
-		subscribers: map[chan datatype.Event]struct{}{},
+		subscriptions:     map[*Subscription]struct{}{},
+		unsubscribedDrops: map[[2]string]uint64{},
 	}
 }
 
-func (n *Notifier) Subscribe(sub chan datatype.Event) {
-	n.subscribers[sub] = struct{}{}
+// Subscribe delivers all events to sub. Notify blocks when the subscriber falls behind
+func (n *Notifier) Subscribe(sub chan datatype.Event) *Subscription {
+	return n.SubscribeWithOptions(sub, SubscriptionOptions{})
 }
 
-func (n *Notifier) Notify(e datatype.Event) {
+// SubscribeWithOptions delivers events to sub as configured in options
+func (n *Notifier) SubscribeWithOptions(sub chan datatype.Event, options SubscriptionOptions) *Subscription {
+	bufferSize := options.BufferSize
+	if bufferSize < 1 {
+		bufferSize = defaultSubscriptionBufferSize
+	}
+	s := &Subscription{
+		name:       options.Name,
+		ch:         sub,
+		eventTypes: make(map[datatype.EventType]bool),
+		overflow:   options.Overflow,
+		buffer:     make(chan datatype.Event, bufferSize),
+		done:       make(chan struct{}),
+	}
+	for _, t := range options.EventTypes {
+		s.eventTypes[t] = true
+	}
+	n.rm.Lock()
+	n.subscriptions[s] = struct{}{}
+	n.rm.Unlock()
+	go s.run()
+	return s
+}
+
+// Unsubscribe stops delivering events to the subscription. Events not delivered yet are discarded.
+// The channel of the subscriber is not closed
+func (n *Notifier) Unsubscribe(s *Subscription) {
+	n.rm.Lock()
+	defer n.rm.Unlock()
+	if _, exist := n.subscriptions[s]; exist {
+		delete(n.subscriptions, s)
+		close(s.done)
+		n.unsubscribedDrops[s.key()] += s.Dropped()
+	}
+}
+
+// Subscriptions returns the current subscriptions
+func (n *Notifier) Subscriptions() []*Subscription {
 	n.rm.RLock()
-	for s := range n.subscribers {
-		s <- e
+	defer n.rm.RUnlock()
+	subscriptions := make([]*Subscription, 0, len(n.subscriptions))
+	for s := range n.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions
+}
+
+// Notify delivers the event to subscribers accepting the event type.
+// It returns an error if any subscriber with OverflowError could not take the event
+func (n *Notifier) Notify(e datatype.Event) error {
+	var errorList []error
+	for _, s := range n.Subscriptions() {
+		if !s.accepts(e) {
+			continue
+		}
+		if err := s.push(e); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	if len(errorList) > 0 {
+		return fmt.Errorf("Failed to notify %q: %v", e.Type, errorList)
+	}
+	return nil
+}
+
+// NotifierCollector exposes dropped and buffered events of notifiers to Prometheus
+type NotifierCollector struct {
+	notifiers map[string]*Notifier
+	dropped   *prometheus.Desc
+	buffered  *prometheus.Desc
+}
+
+// NewNotifierCollector returns a collector of the notifiers by name
+func NewNotifierCollector(notifiers map[string]*Notifier) *NotifierCollector {
+	return &NotifierCollector{
+		notifiers: notifiers,
+		dropped: prometheus.NewDesc(
+			"scheduler_notifier_events_dropped_total",
+			"Number of events dropped because subscribers were full",
+			[]string{"notifier", "subscriber", "policy"}, nil),
+		buffered: prometheus.NewDesc(
+			"scheduler_notifier_events_buffered",
+			"Number of events waiting to be delivered to subscribers",
+			[]string{"notifier", "subscriber", "policy"}, nil),
+	}
+}
+
+func (c *NotifierCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.dropped
+	ch <- c.buffered
+}
+
+func (c *NotifierCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, n := range c.notifiers {
+		// Subscribers of the same name are summed up
+		dropped, buffered := map[[2]string]uint64{}, map[[2]string]int{}
+		n.rm.RLock()
+		for key, v := range n.unsubscribedDrops {
+			dropped[key] = v
+		}
+		for s := range n.subscriptions {
+			dropped[s.key()] += s.Dropped()
+			buffered[s.key()] += s.Buffered()
+		}
+		n.rm.RUnlock()
+		for key, v := range dropped {
+			ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(v), name, key[0], key[1])
+			ch <- prometheus.MustNewConstMetric(c.buffered, prometheus.GaugeValue, float64(buffered[key]), name, key[0], key[1])
+		}
 	}
-	n.rm.RUnlock()
 }
@@ -0,0 +1,194 @@
+package interfacing
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func newTestEvent(eventType datatype.EventType, reason string) datatype.Event {
+	return datatype.NewEventBuilder(eventType).AddReason(reason).Build()
+}
+
+// receiveReasons receives n events from ch and returns their reasons
+func receiveReasons(t *testing.T, ch chan datatype.Event, n int) []string {
+	var reasons []string
+	for i := 0; i < n; i++ {
+		select {
+		case e := <-ch:
+			reasons = append(reasons, e.GetReason())
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Received %v, wanted %d events", reasons, n)
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("Received unexpected event %q", e.GetReason())
+	case <-time.After(50 * time.Millisecond):
+	}
+	return reasons
+}
+
+func TestNotifier(t *testing.T) {
+	tests := map[string]struct {
+		Options  SubscriptionOptions
+		Events   []datatype.Event
+		Received []string
+		Dropped  uint64
+		Errors   int
+	}{
+		"all": {
+			Events:   []datatype.Event{newTestEvent(datatype.EventGoalStatusReceived, "1"), newTestEvent(datatype.EventFailure, "2")},
+			Received: []string{"1", "2"},
+		},
+		"filtered": {
+			Options: SubscriptionOptions{EventTypes: []datatype.EventType{datatype.EventFailure}},
+			Events: []datatype.Event{
+				newTestEvent(datatype.EventGoalStatusReceived, "1"),
+				newTestEvent(datatype.EventFailure, "2"),
+				newTestEvent(datatype.EventPluginStatusLaunched, "3"),
+				newTestEvent(datatype.EventFailure, "4"),
+			},
+			Received: []string{"2", "4"},
+		},
+		"dropoldest": {
+			Options: SubscriptionOptions{BufferSize: 2, Overflow: OverflowDropOldest},
+			Events: []datatype.Event{
+				newTestEvent(datatype.EventFailure, "1"),
+				newTestEvent(datatype.EventFailure, "2"),
+				newTestEvent(datatype.EventFailure, "3"),
+				newTestEvent(datatype.EventFailure, "4"),
+				newTestEvent(datatype.EventFailure, "5"),
+			},
+			// The first event is held for delivery while the buffer overflows
+			Received: []string{"1", "4", "5"},
+			Dropped:  2,
+		},
+		"error": {
+			Options: SubscriptionOptions{BufferSize: 2, Overflow: OverflowError},
+			Events: []datatype.Event{
+				newTestEvent(datatype.EventFailure, "1"),
+				newTestEvent(datatype.EventFailure, "2"),
+				newTestEvent(datatype.EventFailure, "3"),
+				newTestEvent(datatype.EventFailure, "4"),
+				newTestEvent(datatype.EventFailure, "5"),
+			},
+			Received: []string{"1", "2", "3"},
+			Dropped:  2,
+			Errors:   2,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			n := NewNotifier()
+			// The subscriber does not receive until all events are notified
+			ch := make(chan datatype.Event)
+			s := n.SubscribeWithOptions(ch, test.Options)
+			defer n.Unsubscribe(s)
+			errors := 0
+			for i, e := range test.Events {
+				if err := n.Notify(e); err != nil {
+					errors++
+				}
+				if i == 0 {
+					waitFor(t, "the first event to leave the buffer", func() bool { return s.Buffered() == 0 })
+				}
+			}
+			if errors != test.Errors {
+				t.Errorf("Notify failed %d times, want %d", errors, test.Errors)
+			}
+			if received := receiveReasons(t, ch, len(test.Received)); fmt.Sprint(received) != fmt.Sprint(test.Received) {
+				t.Errorf("Received %v, want %v", received, test.Received)
+			}
+			if dropped := s.Dropped(); dropped != test.Dropped {
+				t.Errorf("Dropped %d, want %d", dropped, test.Dropped)
+			}
+		})
+	}
+}
+
+func TestNotifierSlowSubscriber(t *testing.T) {
+	n := NewNotifier()
+	stuck := n.SubscribeWithOptions(make(chan datatype.Event), SubscriptionOptions{BufferSize: 1, Overflow: OverflowDropOldest})
+	ch := make(chan datatype.Event, 10)
+	n.Subscribe(ch)
+	notified := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			n.Notify(newTestEvent(datatype.EventFailure, fmt.Sprint(i)))
+		}
+		close(notified)
+	}()
+	select {
+	case <-notified:
+	case <-time.After(5 * time.Second):
+		t.Fatal("A stuck subscriber blocked Notify")
+	}
+	if received := receiveReasons(t, ch, 10); len(received) != 10 {
+		t.Errorf("Received %v, want 10 events", received)
+	}
+	if stuck.Dropped() == 0 {
+		t.Error("The stuck subscriber dropped no event")
+	}
+}
+
+func TestNotifierUnsubscribe(t *testing.T) {
+	n := NewNotifier()
+	ch := make(chan datatype.Event)
+	s := n.SubscribeWithOptions(ch, SubscriptionOptions{BufferSize: 1})
+	n.Notify(newTestEvent(datatype.EventFailure, "1"))
+	waitFor(t, "the event to leave the buffer", func() bool { return s.Buffered() == 0 })
+	n.Notify(newTestEvent(datatype.EventFailure, "2"))
+	// Notify blocks on the full buffer until the subscriber is gone
+	blocked := make(chan struct{})
+	go func() {
+		n.Notify(newTestEvent(datatype.EventFailure, "3"))
+		close(blocked)
+	}()
+	select {
+	case <-blocked:
+		t.Fatal("Notify did not block on the full buffer")
+	case <-time.After(50 * time.Millisecond):
+	}
+	n.Unsubscribe(s)
+	select {
+	case <-blocked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify stayed blocked after unsubscribe")
+	}
+	if err := n.Notify(newTestEvent(datatype.EventFailure, "4")); err != nil {
+		t.Error(err)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("Received %q after unsubscribe", e.GetReason())
+	case <-time.After(50 * time.Millisecond):
+	}
+	if len(n.Subscriptions()) != 0 {
+		t.Errorf("Notifier has %d subscriptions after unsubscribe", len(n.Subscriptions()))
+	}
+}
+
+func TestNotifierCollector(t *testing.T) {
+	n := NewNotifier()
+	s := n.SubscribeWithOptions(make(chan datatype.Event), SubscriptionOptions{Name: "scheduler", BufferSize: 1, Overflow: OverflowError})
+	n.Notify(newTestEvent(datatype.EventFailure, "1"))
+	waitFor(t, "the event to leave the buffer", func() bool { return s.Buffered() == 0 })
+	for i := 0; i < 3; i++ {
+		n.Notify(newTestEvent(datatype.EventFailure, "2"))
+	}
+	n.Unsubscribe(s)
+	expected := `
+# HELP scheduler_notifier_events_dropped_total Number of events dropped because subscribers were full
+# TYPE scheduler_notifier_events_dropped_total counter
+scheduler_notifier_events_dropped_total{notifier="resourcemanager",policy="error",subscriber="scheduler"} 2
+`
+	c := NewNotifierCollector(map[string]*Notifier{"resourcemanager": n})
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "scheduler_notifier_events_dropped_total"); err != nil {
+		t.Error(err)
+	}
+}
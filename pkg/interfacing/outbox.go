@@ -0,0 +1,326 @@
+package interfacing
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"gopkg.in/cenkalti/backoff.v1"
+)
+
+const outboxBucketName = "outbox"
+
+// outboxRecord is a message waiting in the outbox
+type outboxRecord struct {
+	Scope    string                  `json:"scope"`
+	Message  *datatype.WaggleMessage `json:"message"`
+	QueuedAt time.Time               `json:"queued_at"`
+}
+
+// Outbox keeps messages on disk until the event bus accepts them.
+//
+// Messages are delivered in the order they are published. A message is removed
+// from the outbox only after the event bus returns no error on publishing it,
+// for example, when RabbitMQ confirms it. Failed deliveries are retried with backoff.
+// The oldest messages are dropped when the outbox has more than maxMessages
+// or when they are older than maxAge.
+//
+// Publish does not wait for the disk. Messages are written by a writer that puts
+// all messages published since its last write in one transaction, so that a burst
+// of messages costs one sync to disk. Messages published right before the process
+// crashes may be lost if the writer has not written them yet. Messages written
+// survive crashes and restarts.
+type Outbox struct {
+	bus         EventBus
+	db          *bolt.DB
+	maxMessages int
+	maxAge      time.Duration
+	wakeUp      chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+	// mu guards messages written to disk
+	mu      sync.Mutex
+	stored  int
+	dropped uint64
+	// pendingMu guards messages waiting for the writer
+	pendingMu   sync.Mutex
+	pending     [][]byte
+	closed      bool
+	writeSignal chan struct{}
+	writerDone  chan struct{}
+}
+
+// NewOutbox opens the outbox at dbPath and starts delivering messages
+// left from before to the event bus. No limit applies if maxMessages or maxAge is zero
+func NewOutbox(dbPath string, bus EventBus, maxMessages int, maxAge time.Duration) (*Outbox, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open outbox %s: %s", dbPath, err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ob := &Outbox{
+		bus:         bus,
+		db:          db,
+		maxMessages: maxMessages,
+		maxAge:      maxAge,
+		wakeUp:      make(chan struct{}, 1),
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		writeSignal: make(chan struct{}, 1),
+		writerDone:  make(chan struct{}),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(outboxBucketName))
+		if err != nil {
+			return err
+		}
+		ob.stored = b.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if ob.stored > 0 {
+		logger.Info.Printf("Outbox %s has %d messages to deliver", dbPath, ob.stored)
+	}
+	go ob.write()
+	go ob.deliver()
+	return ob, nil
+}
+
+// Backlog returns the number of messages waiting in the outbox
+func (ob *Outbox) Backlog() int {
+	ob.pendingMu.Lock()
+	pending := len(ob.pending)
+	ob.pendingMu.Unlock()
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.stored + pending
+}
+
+// Dropped returns the number of messages dropped for the size or age limit
+func (ob *Outbox) Dropped() uint64 {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.dropped
+}
+
+// Publish queues the message for the writer to append it to the outbox
+func (ob *Outbox) Publish(message *datatype.WaggleMessage, scope string) error {
+	blob, err := json.Marshal(outboxRecord{Scope: scope, Message: message, QueuedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	ob.pendingMu.Lock()
+	defer ob.pendingMu.Unlock()
+	if ob.closed {
+		return fmt.Errorf("Outbox is closed")
+	}
+	ob.pending = append(ob.pending, blob)
+	select {
+	case ob.writeSignal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// write appends queued messages to the outbox until the outbox is closed.
+// Messages queued before the outbox is closed are written before it returns
+func (ob *Outbox) write() {
+	defer close(ob.writerDone)
+	for {
+		select {
+		case <-ob.writeSignal:
+			ob.writePending()
+		case <-ob.ctx.Done():
+			ob.writePending()
+			return
+		}
+	}
+}
+
+// writePending appends all queued messages to the outbox in one transaction
+func (ob *Outbox) writePending() {
+	ob.pendingMu.Lock()
+	batch := ob.pending
+	ob.pending = nil
+	ob.pendingMu.Unlock()
+	if len(batch) < 1 {
+		return
+	}
+	ob.mu.Lock()
+	dropped := 0
+	err := ob.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(outboxBucketName))
+		for _, blob := range batch {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := b.Put(outboxKey(seq), blob); err != nil {
+				return err
+			}
+		}
+		if ob.maxMessages < 1 {
+			return nil
+		}
+		// Cursors may skip keys after deleting one. It starts over each time
+		for ob.stored+len(batch)-dropped > ob.maxMessages {
+			k, _ := b.Cursor().First()
+			if k == nil {
+				break
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			dropped++
+		}
+		return nil
+	})
+	if err != nil {
+		ob.mu.Unlock()
+		logger.Error.Printf("Failed to write %d messages to outbox: %s", len(batch), err.Error())
+		return
+	}
+	ob.stored += len(batch) - dropped
+	ob.dropped += uint64(dropped)
+	ob.mu.Unlock()
+	if dropped > 0 {
+		logger.Error.Printf("Outbox is full. Dropped %d oldest messages", dropped)
+	}
+	select {
+	case ob.wakeUp <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe subscribes the topic pattern on the event bus
+func (ob *Outbox) Subscribe(topicPattern string, ch chan *datatype.WaggleMessage) error {
+	return ob.bus.Subscribe(topicPattern, ch)
+}
+
+// Close stops delivering messages and closes the event bus.
+// Messages not delivered stay on disk and are delivered when the outbox opens again
+func (ob *Outbox) Close(ctx context.Context) error {
+	ob.pendingMu.Lock()
+	if ob.closed {
+		ob.pendingMu.Unlock()
+		return nil
+	}
+	ob.closed = true
+	ob.pendingMu.Unlock()
+	ob.cancel()
+	var err error
+	for _, done := range []chan struct{}{ob.writerDone, ob.done} {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = fmt.Errorf("Outbox delivery did not stop: %s", ctx.Err().Error())
+		}
+	}
+	if busErr := ob.bus.Close(ctx); busErr != nil && err == nil {
+		err = busErr
+	}
+	if backlog := ob.Backlog(); backlog > 0 {
+		logger.Info.Printf("Outbox keeps %d messages not delivered", backlog)
+	}
+	if dbErr := ob.db.Close(); dbErr != nil && err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+// deliver publishes messages in the outbox in order until the outbox is closed
+func (ob *Outbox) deliver() {
+	defer close(ob.done)
+	retry := backoff.NewExponentialBackOff()
+	// Messages are kept until they expire and so are retried forever
+	retry.MaxElapsedTime = 0
+	retry.MaxInterval = 1 * time.Minute
+	for {
+		key, blob, err := ob.oldest()
+		if err != nil {
+			logger.Error.Printf("Failed to read outbox: %s", err.Error())
+		} else if key == nil {
+			select {
+			case <-ob.wakeUp:
+				continue
+			case <-ob.ctx.Done():
+				return
+			}
+		} else {
+			var record outboxRecord
+			if decodeErr := json.Unmarshal(blob, &record); decodeErr != nil || record.Message == nil {
+				// A broken record would block the outbox forever
+				logger.Error.Printf("Dropped broken record %x in outbox", key)
+				err = ob.remove(key, true)
+			} else if ob.maxAge > 0 && time.Since(record.QueuedAt) > ob.maxAge {
+				logger.Error.Printf("Dropped %q queued at %s as it expired", record.Message.Name, record.QueuedAt.Format(time.RFC3339))
+				err = ob.remove(key, true)
+			} else if err = ob.bus.Publish(record.Message, record.Scope); err != nil {
+				logger.Error.Printf("Failed to deliver %q: %s", record.Message.Name, err.Error())
+			} else {
+				retry.Reset()
+				err = ob.remove(key, false)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		select {
+		case <-time.After(retry.NextBackOff()):
+		case <-ob.ctx.Done():
+			return
+		}
+	}
+}
+
+// oldest returns the oldest record in the outbox or nil key if empty
+func (ob *Outbox) oldest() (key []byte, blob []byte, err error) {
+	err = ob.db.View(func(tx *bolt.Tx) error {
+		k, v := tx.Bucket([]byte(outboxBucketName)).Cursor().First()
+		if k != nil {
+			// Keys and values are valid only in the transaction
+			key, blob = append([]byte{}, k...), append([]byte{}, v...)
+		}
+		return nil
+	})
+	return
+}
+
+// remove removes the record from the outbox. The record may have been dropped
+// for the size limit while it was being delivered
+func (ob *Outbox) remove(key []byte, drop bool) error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(outboxBucketName))
+		if b.Get(key) == nil {
+			return nil
+		}
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+		ob.stored--
+		if drop {
+			ob.dropped++
+		}
+		return nil
+	})
+}
+
+// outboxKey keeps records in the order of sequence
+func outboxKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
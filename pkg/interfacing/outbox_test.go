@@ -0,0 +1,146 @@
+package interfacing
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// testFlakyBus fails publishes while down and records accepted messages
+type testFlakyBus struct {
+	mu       sync.Mutex
+	down     bool
+	accepted []string
+}
+
+func (bus *testFlakyBus) setDown(down bool) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.down = down
+}
+
+func (bus *testFlakyBus) Accepted() []string {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	return append([]string{}, bus.accepted...)
+}
+
+func (bus *testFlakyBus) Publish(message *datatype.WaggleMessage, scope string) error {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.down {
+		return fmt.Errorf("Broker is down")
+	}
+	bus.accepted = append(bus.accepted, message.Name)
+	return nil
+}
+
+func (bus *testFlakyBus) Subscribe(topicPattern string, ch chan *datatype.WaggleMessage) error {
+	return nil
+}
+
+func (bus *testFlakyBus) Close(ctx context.Context) error {
+	return nil
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	tests := map[string]struct {
+		MaxMessages int
+		MaxAge      time.Duration
+		Published   []string
+		Delivered   []string
+		Dropped     uint64
+	}{
+		"inorder": {
+			Published: []string{"a", "b", "c"},
+			Delivered: []string{"a", "b", "c"},
+		},
+		"full": {
+			MaxMessages: 2,
+			Published:   []string{"a", "b", "c", "d"},
+			Delivered:   []string{"c", "d"},
+			Dropped:     2,
+		},
+		"expired": {
+			MaxAge:    time.Nanosecond,
+			Published: []string{"a", "b"},
+			Dropped:   2,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dbPath := path.Join(t.TempDir(), "outbox.db")
+			bus := &testFlakyBus{down: true}
+			outbox, err := NewOutbox(dbPath, bus, test.MaxMessages, test.MaxAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, n := range test.Published {
+				if err := outbox.Publish(datatype.NewMessage(n, "value", time.Now().UnixNano(), map[string]string{}), "all"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Nothing is delivered while the broker is down and the outbox keeps
+			// messages across restarts
+			if err := outbox.Close(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			dropped := outbox.Dropped()
+			if accepted := bus.Accepted(); len(accepted) > 0 {
+				t.Fatalf("Delivered %v while the broker was down", accepted)
+			}
+			bus.setDown(false)
+			outbox, err = NewOutbox(dbPath, bus, test.MaxMessages, test.MaxAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer outbox.Close(context.Background())
+			waitFor(t, "the outbox to drain", func() bool { return outbox.Backlog() == 0 })
+			accepted := bus.Accepted()
+			if fmt.Sprint(accepted) != fmt.Sprint(test.Delivered) {
+				t.Errorf("Delivered %v, want %v", accepted, test.Delivered)
+			}
+			if dropped += outbox.Dropped(); dropped != test.Dropped {
+				t.Errorf("Dropped %d, want %d", dropped, test.Dropped)
+			}
+		})
+	}
+}
+
+func TestOutboxRetry(t *testing.T) {
+	bus := &testFlakyBus{down: true}
+	outbox, err := NewOutbox(path.Join(t.TempDir(), "outbox.db"), bus, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outbox.Close(context.Background())
+	for _, n := range []string{"a", "b"} {
+		if err := outbox.Publish(datatype.NewMessage(n, "value", time.Now().UnixNano(), map[string]string{}), "all"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(100 * time.Millisecond)
+	if backlog := outbox.Backlog(); backlog != 2 {
+		t.Errorf("Backlog is %d while the broker is down, want 2", backlog)
+	}
+	bus.setDown(false)
+	waitFor(t, "the outbox to drain", func() bool { return outbox.Backlog() == 0 })
+	if accepted := bus.Accepted(); fmt.Sprint(accepted) != "[a b]" {
+		t.Errorf("Delivered %v, want [a b]", accepted)
+	}
+}
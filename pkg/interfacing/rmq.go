@@ -1,10 +1,13 @@
 package interfacing
 
 import (
-	"crypto/tls"
+	"context"
 	"crypto/x509"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/streadway/amqp"
@@ -18,60 +21,188 @@ type RabbitMQHandler struct {
 	rabbitmqUsername string
 	rabbitmqPassword string
 	cacertPath       string
-	rabbitmqConn     *amqp.Connection
-	rabbitmqChan     *amqp.Channel
-	appID            string
+	certPath         string
+	keyPath          string
+	serverName       string
+	// externalAuth authenticates with the client certificate instead of the username and password
+	externalAuth bool
+	rabbitmqConn *amqp.Connection
+	rabbitmqChan *amqp.Channel
+	appID        string
+	// ctx is cancelled when the handler is closed to stop subscriptions
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	closed    bool
+	publishes sync.WaitGroup
+	// Messages of subscribed topics are consumed from the queue bound to the exchange
+	subscribeExchange string
+	subscribeQueue    string
+	subscriptions     []topicSubscription
+	consuming         bool
+	// Publishes go through a channel in confirm mode one at a time
+	// so that each confirmation matches its publish
+	publishMu       sync.Mutex
+	publishChan     *amqp.Channel
+	publishConfirms chan amqp.Confirmation
 }
 
+// publishConfirmTimeout is how long a publish waits for RabbitMQ to confirm it
+const publishConfirmTimeout = 10 * time.Second
+
 func NewRabbitMQHandler(rabbitmqURI string, rabbitmqUsername string, rabbitmqPassword string, cacertPath string, appID string) *RabbitMQHandler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &RabbitMQHandler{
 		RabbitmqURI:      rabbitmqURI,
 		rabbitmqUsername: rabbitmqUsername,
 		rabbitmqPassword: rabbitmqPassword,
 		cacertPath:       cacertPath,
 		appID:            appID,
+		ctx:              ctx,
+		cancel:           cancel,
+		// Beehive routes messages from nodes to the exchange
+		subscribeExchange: "waggle.msg",
+		subscribeQueue:    "to-scheduler",
 	}
 }
 
-func (rh *RabbitMQHandler) Connect() error {
-	// If cacert is given it attempts TLS connection
-	if rh.cacertPath == "" {
-		caCert, err := ioutil.ReadFile(rh.cacertPath)
-		if err != nil {
-			return err
-		}
-		rootCAs := x509.NewCertPool()
-		rootCAs.AppendCertsFromPEM(caCert)
-		tlsConf := &tls.Config{
-			RootCAs:            rootCAs,
-			InsecureSkipVerify: true,
-		}
-		amqpAddress := fmt.Sprintf("amqps://%s:%s@%s", rh.rabbitmqUsername, rh.rabbitmqPassword, rh.RabbitmqURI)
-		logger.Debug.Printf("Connecting to %s...", rh.RabbitmqURI)
-		conn, err := amqp.DialTLS(amqpAddress, tlsConf)
-		if err != nil {
-			return err
-		}
-		rh.rabbitmqConn = conn
-		ch, err := conn.Channel()
-		if err != nil {
-			return err
-		}
-		rh.rabbitmqChan = ch
-	} else {
-		amqpAddress := fmt.Sprintf("amqp://%s:%s@%s", rh.rabbitmqUsername, rh.rabbitmqPassword, rh.RabbitmqURI)
-		logger.Debug.Printf("Connecting to %s...", rh.RabbitmqURI)
-		conn, err := amqp.Dial(amqpAddress)
+// beginPublish registers a publish so that Close waits for it.
+// It fails if the handler is closed.
+func (rh *RabbitMQHandler) beginPublish() error {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	if rh.closed {
+		return fmt.Errorf("RabbitMQ handler is closed")
+	}
+	rh.publishes.Add(1)
+	return nil
+}
+
+// Close stops subscriptions and waits for pending publishes to finish
+// before closing the connection. Publishes after Close fail.
+// It returns an error if ctx is done before the pending publishes finish.
+func (rh *RabbitMQHandler) Close(ctx context.Context) (err error) {
+	rh.mu.Lock()
+	if rh.closed {
+		rh.mu.Unlock()
+		return nil
+	}
+	rh.closed = true
+	rh.mu.Unlock()
+	rh.cancel()
+	err = waitPublishes(ctx, &rh.publishes, rh.RabbitmqURI)
+	if rh.rabbitmqChan != nil {
+		rh.rabbitmqChan.Close()
+	}
+	if rh.rabbitmqConn != nil && !rh.rabbitmqConn.IsClosed() {
+		rh.rabbitmqConn.Close()
+	}
+	return
+}
+
+// SetClientCertificate sets the client certificate presented over TLS
+func (rh *RabbitMQHandler) SetClientCertificate(certPath string, keyPath string) {
+	rh.certPath = certPath
+	rh.keyPath = keyPath
+}
+
+// SetExternalAuth sets whether the client certificate authenticates the client
+// with the EXTERNAL mechanism. The username and password are not used if set
+func (rh *RabbitMQHandler) SetExternalAuth(externalAuth bool) {
+	rh.externalAuth = externalAuth
+}
+
+// SetServerName overrides the server name verified in the server certificate.
+// The host of the RabbitMQ URI is verified by default
+func (rh *RabbitMQHandler) SetServerName(serverName string) {
+	rh.serverName = serverName
+}
+
+// useTLS returns true if a CA certificate or client certificate is given,
+// or the RabbitMQ URI has the amqps scheme
+func (rh *RabbitMQHandler) useTLS() bool {
+	return rh.cacertPath != "" || rh.certPath != "" || strings.HasPrefix(rh.RabbitmqURI, "amqps://")
+}
+
+// externalAuth authenticates with the client certificate presented over TLS
+type externalAuth struct{}
+
+func (auth *externalAuth) Mechanism() string {
+	return "EXTERNAL"
+}
+
+func (auth *externalAuth) Response() string {
+	return ""
+}
+
+// dialConfig returns the address and configuration to connect to RabbitMQ
+func (rh *RabbitMQHandler) dialConfig() (string, amqp.Config, error) {
+	config := amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(rh.RabbitmqURI, "amqps://"), "amqp://")
+	if rh.externalAuth && rh.certPath == "" {
+		return "", config, fmt.Errorf("EXTERNAL authentication to RabbitMQ at %s requires a client certificate", host)
+	}
+	scheme := "amqp"
+	if rh.useTLS() {
+		scheme = "amqps"
+		tlsConfig, err := NewClientTLSConfig(rh.cacertPath, rh.certPath, rh.keyPath)
 		if err != nil {
-			return err
+			return "", config, fmt.Errorf("Failed to configure TLS for RabbitMQ at %s: %s", host, err.Error())
 		}
-		rh.rabbitmqConn = conn
-		ch, err := conn.Channel()
-		if err != nil {
-			return err
+		tlsConfig.ServerName = rh.serverName
+		config.TLSClientConfig = tlsConfig
+		if rh.externalAuth {
+			config.SASL = []amqp.Authentication{&externalAuth{}}
+			return fmt.Sprintf("%s://%s", scheme, host), config, nil
 		}
-		rh.rabbitmqChan = ch
 	}
+	userInfo := url.UserPassword(rh.rabbitmqUsername, rh.rabbitmqPassword).String()
+	return fmt.Sprintf("%s://%s@%s", scheme, userInfo, host), config, nil
+}
+
+// connectionError explains why connecting to RabbitMQ failed
+func (rh *RabbitMQHandler) connectionError(err error) error {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return fmt.Errorf("Certificate of RabbitMQ at %s is not signed by a trusted CA. Check the CA certificate: %s", rh.RabbitmqURI, err.Error())
+	case errors.As(err, &hostname):
+		return fmt.Errorf("Certificate of RabbitMQ at %s does not match the server name. Check the server name: %s", rh.RabbitmqURI, err.Error())
+	case errors.As(err, &invalid):
+		return fmt.Errorf("Certificate of RabbitMQ at %s is invalid: %s", rh.RabbitmqURI, err.Error())
+	case (err == amqp.ErrSASL || err == amqp.ErrCredentials) && rh.externalAuth:
+		return fmt.Errorf("RabbitMQ at %s refused EXTERNAL authentication with the client certificate %s: %s", rh.RabbitmqURI, rh.certPath, err.Error())
+	case err == amqp.ErrSASL || err == amqp.ErrCredentials:
+		return fmt.Errorf("RabbitMQ at %s refused authentication of user %q: %s", rh.RabbitmqURI, rh.rabbitmqUsername, err.Error())
+	default:
+		return fmt.Errorf("Failed to connect to RabbitMQ at %s: %s", rh.RabbitmqURI, err.Error())
+	}
+}
+
+// Connect connects to RabbitMQ. The connection is over TLS if a CA certificate
+// or client certificate is given, or the RabbitMQ URI has the amqps scheme.
+// The server certificate is always verified
+func (rh *RabbitMQHandler) Connect() error {
+	amqpAddress, config, err := rh.dialConfig()
+	if err != nil {
+		return err
+	}
+	logger.Debug.Printf("Connecting to %s (TLS: %t)...", rh.RabbitmqURI, config.TLSClientConfig != nil)
+	conn, err := amqp.DialConfig(amqpAddress, config)
+	if err != nil {
+		return rh.connectionError(err)
+	}
+	rh.rabbitmqConn = conn
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	rh.rabbitmqChan = ch
 	return nil
 }
 
@@ -125,24 +256,14 @@ func (rh *RabbitMQHandler) DeclareQueueAndConnectToExchange(exchangeName string,
 }
 
 func (rh *RabbitMQHandler) SendYAML(routingKey string, message []byte) error {
-	exchange := "scheduler"
-	if rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
-		err := rh.Connect()
-		if err != nil {
-			return err
-		}
+	if err := rh.beginPublish(); err != nil {
+		return err
 	}
-	err := rh.rabbitmqChan.Publish(
-		exchange,
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/yaml",
-			Body:        message,
-		},
-	)
-	return err
+	defer rh.publishes.Done()
+	return rh.publishConfirmed("scheduler", routingKey, amqp.Publishing{
+		ContentType: "application/yaml",
+		Body:        message,
+	})
 }
 
 // SendWaggleMessage delivers a Waggle message to Waggle data pipeline
@@ -150,26 +271,83 @@ func (rh *RabbitMQHandler) SendYAML(routingKey string, message []byte) error {
 // The message is sent to the "to-validator" exchange
 func (rh *RabbitMQHandler) SendWaggleMessage(message *datatype.WaggleMessage, scope string) error {
 	logger.Debug.Println(string(datatype.Dump(message)))
-	exchange := "to-validator"
+	if err := rh.beginPublish(); err != nil {
+		return err
+	}
+	defer rh.publishes.Done()
+	return rh.publishConfirmed("to-validator", scope, amqp.Publishing{
+		Body:         datatype.Dump(message),
+		DeliveryMode: 2,
+		UserId:       rh.userID(),
+		AppId:        rh.appID,
+	})
+}
+
+// userID returns the user that RabbitMQ validates in published messages.
+// The user of EXTERNAL authentication comes from the client certificate and is not validated
+func (rh *RabbitMQHandler) userID() string {
+	if rh.externalAuth {
+		return ""
+	}
+	return rh.rabbitmqUsername
+}
+
+// publishConfirmed publishes the message and waits until RabbitMQ confirms it.
+// It returns an error if RabbitMQ rejects the message or does not confirm it in time
+func (rh *RabbitMQHandler) publishConfirmed(exchange string, routingKey string, message amqp.Publishing) error {
+	rh.publishMu.Lock()
+	defer rh.publishMu.Unlock()
+	if rh.publishChan == nil || rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
+		if err := rh.openPublishChannel(); err != nil {
+			return err
+		}
+	}
+	if err := rh.publishChan.Publish(exchange, routingKey, false, false, message); err != nil {
+		rh.closePublishChannel()
+		return err
+	}
+	select {
+	case confirm, ok := <-rh.publishConfirms:
+		if !ok {
+			rh.closePublishChannel()
+			return fmt.Errorf("Channel to %s closed before the publish was confirmed", rh.RabbitmqURI)
+		}
+		if !confirm.Ack {
+			return fmt.Errorf("RabbitMQ at %s rejected the message to %q", rh.RabbitmqURI, exchange)
+		}
+		return nil
+	case <-time.After(publishConfirmTimeout):
+		// A late confirmation would be taken for the next publish
+		rh.closePublishChannel()
+		return fmt.Errorf("RabbitMQ at %s did not confirm the message to %q in %s", rh.RabbitmqURI, exchange, publishConfirmTimeout)
+	}
+}
+
+// openPublishChannel opens a channel in confirm mode for publishes
+func (rh *RabbitMQHandler) openPublishChannel() error {
 	if rh.rabbitmqConn == nil || rh.rabbitmqConn.IsClosed() {
-		err := rh.Connect()
-		if err != nil {
+		if err := rh.Connect(); err != nil {
 			return err
 		}
 	}
-	err := rh.rabbitmqChan.Publish(
-		exchange,
-		scope,
-		false,
-		false,
-		amqp.Publishing{
-			Body:         datatype.Dump(message),
-			DeliveryMode: 2,
-			UserId:       rh.rabbitmqUsername,
-			AppId:        rh.appID,
-		},
-	)
-	return err
+	ch, err := rh.rabbitmqConn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return fmt.Errorf("Failed to enable publisher confirms: %s", err.Error())
+	}
+	rh.publishChan = ch
+	rh.publishConfirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	return nil
+}
+
+func (rh *RabbitMQHandler) closePublishChannel() {
+	if rh.publishChan != nil {
+		rh.publishChan.Close()
+	}
+	rh.publishChan = nil
 }
 
 func (rh *RabbitMQHandler) GetReceiver(queueName string) (<-chan amqp.Delivery, error) {
@@ -191,42 +369,86 @@ func (rh *RabbitMQHandler) GetReceiver(queueName string) (<-chan amqp.Delivery,
 	return msgs, err
 }
 
-// SubscribeEvents subscribes scheduling events from target exchange
-// it will attempt to reconnect if connection is closed
-func (rh *RabbitMQHandler) SubscribeEvents(exchange string, queueName string, ch chan *datatype.Event) error {
+// Publish publishes the message to the Waggle data pipeline
+func (rh *RabbitMQHandler) Publish(message *datatype.WaggleMessage, scope string) error {
+	return rh.SendWaggleMessage(message, scope)
+}
+
+// Subscribe binds the topic pattern to the subscription queue of the handler.
+// Messages consumed from the queue are delivered to subscriptions of matching topics.
+// It reconnects if the connection is closed
+func (rh *RabbitMQHandler) Subscribe(topicPattern string, ch chan *datatype.WaggleMessage) error {
+	rh.mu.Lock()
+	if rh.closed {
+		rh.mu.Unlock()
+		return fmt.Errorf("RabbitMQ handler is closed")
+	}
+	rh.subscriptions = append(rh.subscriptions, topicSubscription{topicPattern: topicPattern, ch: ch})
+	consuming := rh.consuming
+	rh.consuming = true
+	rh.mu.Unlock()
+	if consuming {
+		// The consumer binds all patterns when it (re)connects. The new pattern
+		// needs binding to the queue in use
+		_, err := rh.DeclareQueueAndConnectToExchange(rh.subscribeExchange, rh.subscribeQueue, topicPattern)
+		return err
+	}
+	go rh.consume()
+	return nil
+}
+
+func (rh *RabbitMQHandler) getSubscriptions() []topicSubscription {
+	rh.mu.Lock()
+	defer rh.mu.Unlock()
+	return append([]topicSubscription{}, rh.subscriptions...)
+}
+
+// consume delivers messages from the subscription queue until the handler is closed
+func (rh *RabbitMQHandler) consume() {
 	operation := func() error {
-		q, err := rh.DeclareQueueAndConnectToExchange(exchange, queueName, "sys.scheduler.#")
-		if err != nil {
-			return err
+		for _, s := range rh.getSubscriptions() {
+			if _, err := rh.DeclareQueueAndConnectToExchange(rh.subscribeExchange, rh.subscribeQueue, s.topicPattern); err != nil {
+				return err
+			}
 		}
-		c, err := rh.GetReceiver(q.Name)
+		c, err := rh.GetReceiver(rh.subscribeQueue)
 		if err != nil {
 			return err
 		}
 		for msg := range c {
-			if waggleMessage, err := datatype.Load(msg.Body); err == nil {
-				eventBuilder, err := datatype.NewEventBuilderFromWaggleMessage(waggleMessage)
-				if err != nil {
-					logger.Debug.Printf("Failed to parse %v: %s", waggleMessage, err.Error())
-				} else {
-					if vsn, exist := waggleMessage.Meta["vsn"]; exist {
-						eventBuilder.AddEntry("vsn", vsn)
-					}
-					event := eventBuilder.Build()
-					ch <- &event
+			waggleMessage, err := datatype.Load(msg.Body)
+			if err != nil {
+				logger.Debug.Printf("Failed to load message from %q: %s", rh.subscribeExchange, err.Error())
+				continue
+			}
+			for _, s := range rh.getSubscriptions() {
+				if !MatchTopic(s.topicPattern, waggleMessage.Name) {
+					continue
+				}
+				select {
+				case s.ch <- waggleMessage:
+				case <-rh.ctx.Done():
+					return nil
 				}
 			}
 		}
 		return nil
 	}
-	go func() {
-		for {
-			err := backoff.Retry(operation, backoff.NewExponentialBackOff())
-			logger.Error.Printf("Failed to subscribe %q: %s", exchange, err.Error())
-			time.Sleep(5 * time.Second)
-			logger.Info.Printf("Retrying to connect to %q in 5 seconds...", exchange)
+	for {
+		err := backoff.Retry(operation, backoff.WithContext(backoff.NewExponentialBackOff(), rh.ctx))
+		if rh.ctx.Err() != nil {
+			logger.Info.Printf("Stopped subscribing %q", rh.subscribeExchange)
+			return
 		}
-
-	}()
-	return nil
+		if err != nil {
+			logger.Error.Printf("Failed to subscribe %q: %s", rh.subscribeExchange, err.Error())
+		}
+		logger.Info.Printf("Retrying to connect to %q in 5 seconds...", rh.subscribeExchange)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-rh.ctx.Done():
+			logger.Info.Printf("Stopped subscribing %q", rh.subscribeExchange)
+			return
+		}
+	}
 }
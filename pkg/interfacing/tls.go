@@ -0,0 +1,45 @@
+package interfacing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// LoadCertPool loads PEM-encoded CA certificates into a certificate pool
+func LoadCertPool(caCertPath string) (*x509.CertPool, error) {
+	blob, err := ioutil.ReadFile(caCertPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(blob) {
+		return nil, fmt.Errorf("No certificate found in %s", caCertPath)
+	}
+	return pool, nil
+}
+
+// NewClientTLSConfig returns a TLS configuration for clients. The server
+// certificate is verified against the CA certificate if given, or the system
+// roots otherwise. The client certificate is presented if certPath and keyPath are given.
+func NewClientTLSConfig(caCertPath string, certPath string, keyPath string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if caCertPath != "" {
+		pool, err := LoadCertPool(caCertPath)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load client certificate: %s", err.Error())
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -1,6 +1,7 @@
 package nodescheduler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,8 +11,11 @@ import (
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler/policy"
 	yaml "gopkg.in/yaml.v2"
 	// "github.com/urfave/negroni"
 )
@@ -26,25 +30,46 @@ type APIServer struct {
 	port          int
 	mainRouter    *mux.Router
 	nodeScheduler *NodeScheduler
+	server        *http.Server
 }
 
 func NewAPIServer() *APIServer {
 	return &APIServer{}
 }
 
-func (api *APIServer) Run() {
-	api_address_port := "0.0.0.0:8080"
-	logger.Info.Printf("API server starts at %q...", api_address_port)
+func (api *APIServer) ConfigureAPIs(prometheusGatherer *prometheus.Registry) {
 	api.mainRouter = mux.NewRouter()
 	r := api.mainRouter
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintln(w, `{"id": "Node Scheduler (`+api.nodeScheduler.NodeID+`)", "version":"`+api.version+`"}`)
 	})
 	api_route := r.PathPrefix("/api/v1").Subrouter()
+	if prometheusGatherer != nil {
+		api_route.Handle("/system/metrics", promhttp.HandlerFor(prometheusGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})).Methods(http.MethodGet)
+	}
 	api_route.Handle("/kb/rules", http.HandlerFunc(api.handlerRules)).Methods(http.MethodGet, http.MethodPost)
 	api_route.Handle("/kb/senses", http.HandlerFunc(api.handlerSenses)).Methods(http.MethodGet, http.MethodPost, http.MethodDelete)
 	api_route.Handle("/goals", http.HandlerFunc(api.handlerGoals)).Methods(http.MethodGet, http.MethodPost, http.MethodPut)
-	logger.Info.Fatalln(http.ListenAndServe(api_address_port, r))
+	api_route.Handle("/policy/accounting", http.HandlerFunc(api.handlerPolicyAccounting)).Methods(http.MethodGet)
+	api.server = &http.Server{
+		Addr:    "0.0.0.0:8080",
+		Handler: r,
+	}
+}
+
+// Run serves the API until Shutdown is called
+func (api *APIServer) Run() error {
+	logger.Info.Printf("API server starts at %q...", api.server.Addr)
+	if err := api.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting requests and waits for in-flight requests to finish until ctx is done
+func (api *APIServer) Shutdown(ctx context.Context) error {
+	logger.Info.Println("API server is shutting down...")
+	return api.server.Shutdown(ctx)
 }
 
 func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -123,6 +148,11 @@ func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 			return
 		} else {
 			logger.Debug.Printf("%s", string(blob))
+			if err := api.nodeScheduler.GoalManager.VerifyGoals(blob, r.Header.Get(datatype.GoalSignatureHeader)); err != nil {
+				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+				respondJSON(w, http.StatusForbidden, response.ToJson())
+				return
+			}
 			err = json.Unmarshal(blob, &newGoals)
 			if err != nil {
 				response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
@@ -146,6 +176,11 @@ func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			fmt.Println(err)
 		}
+		if err := api.nodeScheduler.GoalManager.VerifyGoals(yamlFile, r.Header.Get(datatype.GoalSignatureHeader)); err != nil {
+			response := datatype.NewAPIMessageBuilder().AddError(err.Error()).Build()
+			respondJSON(w, http.StatusForbidden, response.ToJson())
+			return
+		}
 		var jobTemplates []datatype.JobTemplate
 		_ = yaml.Unmarshal(yamlFile, &jobTemplates)
 		for _, j := range jobTemplates {
@@ -165,3 +200,18 @@ func (api *APIServer) handlerGoals(w http.ResponseWriter, r *http.Request) {
 		respondJSON(w, http.StatusOK, "")
 	}
 }
+
+// handlerPolicyAccounting returns the accounting state of the scheduling policy,
+// for example, runtime consumed by users and goals in the fair-share policy
+func (api *APIServer) handlerPolicyAccounting(w http.ResponseWriter, r *http.Request) {
+	var state interface{}
+	if accounting, ok := api.nodeScheduler.SchedulingPolicy.(policy.AccountingSchedulingPolicy); ok {
+		state = accounting.GetAccounting()
+	}
+	if state == nil {
+		response := datatype.NewAPIMessageBuilder().AddError(fmt.Sprintf("Policy %q does not keep accounting", api.nodeScheduler.Config.SchedulingPolicy)).Build()
+		respondJSON(w, http.StatusNotFound, response.ToJson())
+		return
+	}
+	respondJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,60 @@
+package nodescheduler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler/policy"
+)
+
+func TestHandlerPolicyAccounting(t *testing.T) {
+	goal := datatype.NewScienceGoalBuilderWithID("test", "1", "goal").SetUser("alice").Build()
+	fairShare := policy.NewFairShareSchedulingPolicy(policy.Config{})
+	fairShare.RecordRuntime(goal, nil, time.Minute)
+	tests := map[string]struct {
+		Policy     string
+		Pipeline   policy.PipelineConfig
+		WantStatus int
+	}{
+		"fairshare": {Policy: "fairshare", WantStatus: http.StatusOK},
+		"default":   {Policy: "default", WantStatus: http.StatusNotFound},
+		"pipelinewithoutfairshare": {
+			Policy:     "pipeline",
+			Pipeline:   policy.PipelineConfig{Scores: []policy.StageConfig{{Name: "age"}}},
+			WantStatus: http.StatusNotFound,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ns := &NodeScheduler{Config: &NodeSchedulerConfig{SchedulingPolicy: test.Policy}}
+			if test.Policy == "fairshare" {
+				ns.SchedulingPolicy = fairShare
+			} else {
+				var err error
+				if ns.SchedulingPolicy, err = policy.NewSchedulingPolicy(test.Policy, policy.Config{Pipeline: test.Pipeline}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			api := &APIServer{nodeScheduler: ns}
+			w := httptest.NewRecorder()
+			api.handlerPolicyAccounting(w, httptest.NewRequest(http.MethodGet, "/api/v1/policy/accounting", nil))
+			if w.Code != test.WantStatus {
+				t.Fatalf("Wrong status: expected %d, but %d", test.WantStatus, w.Code)
+			}
+			if test.WantStatus != http.StatusOK {
+				return
+			}
+			var state policy.FairShareState
+			if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.Users["alice"].Runtime <= 0 || state.Goals["goal"].User != "alice" {
+				t.Errorf("Wrong accounting state: %+v", state)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package nodescheduler
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
@@ -10,22 +12,80 @@ import (
 )
 
 type NodeSchedulerConfig struct {
-	Name             string `json:"nodename" yaml:"nodeName"`
-	Version          string
-	NoRabbitMQ       bool   `json:"no_rabbitmq" yaml:"noRabbitMQ"`
-	RabbitmqURI      string `json:"rabbitmq_uri" yaml:"rabbimqURI"`
-	RabbitmqUsername string `json:"rabbitmq_username" yaml:"rabbitMQUsername"`
-	RabbitmqPassword string `json:"rabbitmq_password" yaml:"rabbitMQPassword"`
-	Kubeconfig       string `json:"kubeconfig" yaml:"kubeConfig"`
-	InCluster        bool   `json:"in_cluster" yaml:"inCluster"`
-	RuleCheckerURI   string `json:"rulechecker_uri" yaml:"ruleCheckerURI"`
-	Simulate         bool   `json:"simulate" yaml:"simulate"`
-	GoalStreamURL    string `json:"goalstream_URI" yaml:"goalStreamURL"`
-	SchedulingPolicy string `json:"policy" yaml:"policy"`
+	Name               string `json:"nodename" yaml:"nodeName"`
+	Version            string
+	NoRabbitMQ         bool   `json:"no_rabbitmq" yaml:"noRabbitMQ"`
+	RabbitmqURI        string `json:"rabbitmq_uri" yaml:"rabbimqURI"`
+	RabbitmqUsername   string `json:"rabbitmq_username" yaml:"rabbitMQUsername"`
+	RabbitmqPassword   string `json:"rabbitmq_password" yaml:"rabbitMQPassword"`
+	RabbitmqCaCertPath string `json:"rabbitmq_cacert_path" yaml:"rabbitMQCacertPath"`
+	RabbitmqCertPath   string `json:"rabbitmq_cert_path" yaml:"rabbitMQCertPath"`
+	RabbitmqKeyPath    string `json:"rabbitmq_key_path" yaml:"rabbitMQKeyPath"`
+	RabbitmqServerName string `json:"rabbitmq_server_name" yaml:"rabbitMQServerName"`
+	// RabbitmqAuthExternal authenticates with the client certificate instead of the username
+	RabbitmqAuthExternal bool `json:"rabbitmq_auth_external" yaml:"rabbitMQAuthExternal"`
+	// EventBus is either "rabbitmq" or "mqtt". Events stay in the process if NoRabbitMQ is set
+	EventBus        string `json:"event_bus" yaml:"eventBus"`
+	MQTTBrokerURI   string `json:"mqtt_broker_uri" yaml:"mqttBrokerURI"`
+	MQTTUsername    string `json:"mqtt_username" yaml:"mqttUsername"`
+	MQTTPassword    string `json:"mqtt_password" yaml:"mqttPassword"`
+	MQTTCaCertPath  string `json:"mqtt_cacert_path" yaml:"mqttCacertPath"`
+	MQTTCertPath    string `json:"mqtt_cert_path" yaml:"mqttCertPath"`
+	MQTTKeyPath     string `json:"mqtt_key_path" yaml:"mqttKeyPath"`
+	MQTTTopicPrefix string `json:"mqtt_topic_prefix" yaml:"mqttTopicPrefix"`
+	Kubeconfig      string `json:"kubeconfig" yaml:"kubeConfig"`
+	InCluster       bool   `json:"in_cluster" yaml:"inCluster"`
+	RuleCheckerURI  string `json:"rulechecker_uri" yaml:"ruleCheckerURI"`
+	Simulate        bool   `json:"simulate" yaml:"simulate"`
+	GoalStreamURL   string `json:"goalstream_URI" yaml:"goalStreamURL"`
+	// GoalStreamCACertPath verifies the cloud scheduler over HTTPS. The node presents
+	// its certificate if GoalStreamCertPath and GoalStreamKeyPath are given
+	GoalStreamCACertPath string `json:"goalstream_cacert_path" yaml:"goalStreamCacertPath"`
+	GoalStreamCertPath   string `json:"goalstream_cert_path" yaml:"goalStreamCertPath"`
+	GoalStreamKeyPath    string `json:"goalstream_key_path" yaml:"goalStreamKeyPath"`
+	// GoalVerificationKeyPath is the pinned ed25519 public key of the cloud scheduler.
+	// Goals not signed with the key are rejected if given
+	GoalVerificationKeyPath string `json:"goal_verification_key_path" yaml:"goalVerificationKeyPath"`
+	SchedulingPolicy        string `json:"policy" yaml:"policy"`
+	// ResourceLimitRatio is the ratio of resource limits to requests of plugins.
+	// Plugins have no limit if zero, the default. Otherwise, it must be at least 1
+	ResourceLimitRatio float64 `json:"resource_limit_ratio" yaml:"resourceLimitRatio"`
+	// ProfilePreference lists names of plugin profiles in the order of preference
+	ProfilePreference []string `json:"profile_preference" yaml:"profilePreference"`
+	// KnobInjection passes knobs of the chosen profile to plugins as either "env" or "args"
+	KnobInjection string `json:"knob_injection" yaml:"knobInjection"`
+	// FairShareHalfLife is the time in seconds it takes for runtime consumed by plugins
+	// to count half in the fair-share policy
+	FairShareHalfLife int `json:"fair_share_half_life" yaml:"fairShareHalfLife"`
+	// ConcurrencyLimits limits plugins running at the same time. Plugins wait in a queue for a slot
+	ConcurrencyLimits ConcurrencyLimits `json:"concurrency_limits" yaml:"concurrencyLimits"`
+	// Pipeline composes the "pipeline" policy from filter and score stages
+	Pipeline policy.PipelineConfig `json:"pipeline" yaml:"pipeline"`
+	// OutboxPath keeps events on disk until the event bus accepts them if given.
+	// Events are sent in background and lost when the event bus is down if empty.
+	// The oldest events are dropped when there are more than OutboxMaxEvents
+	// or when they are older than OutboxMaxAge in seconds. No limit applies if zero
+	OutboxPath      string `json:"outbox_path" yaml:"outboxPath"`
+	OutboxMaxEvents int    `json:"outbox_max_events" yaml:"outboxMaxEvents"`
+	OutboxMaxAge    int    `json:"outbox_max_age" yaml:"outboxMaxAge"`
+	// TerminatePluginsOnShutdown terminates running plugins when the scheduler shuts down.
+	// Otherwise, plugins run to completion and are cleaned up when the scheduler starts again
+	TerminatePluginsOnShutdown bool `json:"terminate_plugins_on_shutdown" yaml:"terminatePluginsOnShutdown"`
+}
+
+// policyConfig returns the config of scheduling policies
+func (c *NodeSchedulerConfig) policyConfig() policy.Config {
+	return policy.Config{
+		ProfilePreference: c.ProfilePreference,
+		FairShareHalfLife: time.Duration(c.FairShareHalfLife) * time.Second,
+		Pipeline:          c.Pipeline,
+	}
 }
 
 type NodeSchedulerBuilder struct {
 	nodeScheduler *NodeScheduler
+	// eventBus is shared by components as a MQTT broker allows one connection per client ID
+	eventBus interfacing.EventBus
 }
 
 func NewNodeSchedulerBuilder(config *NodeSchedulerConfig) *NodeSchedulerBuilder {
@@ -34,7 +94,7 @@ func NewNodeSchedulerBuilder(config *NodeSchedulerConfig) *NodeSchedulerBuilder
 			Version:                     config.Version,
 			NodeID:                      strings.ToLower(config.Name),
 			Config:                      config,
-			SchedulingPolicy:            policy.GetSchedulingPolicyByName(config.SchedulingPolicy),
+			Metrics:                     NewMetrics(),
 			chanContextEventToScheduler: make(chan datatype.EventPluginContext, maxChannelBuffer),
 			chanFromGoalManager:         make(chan datatype.Event, maxChannelBuffer),
 			chanFromResourceManager:     make(chan datatype.Event, maxChannelBuffer),
@@ -44,6 +104,7 @@ func NewNodeSchedulerBuilder(config *NodeSchedulerConfig) *NodeSchedulerBuilder
 			chanPluginToResourceManager: make(chan *datatype.Plugin, maxChannelBuffer),
 			chanNeedScheduling:          make(chan datatype.Event, maxChannelBuffer),
 			chanAPIServerToGoalManager:  make(chan *datatype.ScienceGoal, maxChannelBuffer),
+			slots:                       newPluginSlots(config.ConcurrencyLimits),
 		},
 	}
 }
@@ -56,40 +117,46 @@ func (nsb *NodeSchedulerBuilder) AddGoalManager(appID string) *NodeSchedulerBuil
 		Simulate:      nsb.nodeScheduler.Config.Simulate,
 		Notifier:      interfacing.NewNotifier(),
 	}
-	if !nsb.nodeScheduler.Config.NoRabbitMQ {
-		logger.Info.Printf("Using RabbitMQ at %s with user %s", nsb.nodeScheduler.Config.RabbitmqURI, nsb.nodeScheduler.Config.RabbitmqUsername)
-		nsb.nodeScheduler.GoalManager.SetRMQHandler(interfacing.NewRabbitMQHandler(
-			nsb.nodeScheduler.Config.RabbitmqURI,
-			nsb.nodeScheduler.Config.RabbitmqUsername,
-			nsb.nodeScheduler.Config.RabbitmqPassword,
-			"",
-			appID),
-		)
-	}
-	nsb.nodeScheduler.GoalManager.Notifier.Subscribe(nsb.nodeScheduler.chanFromGoalManager)
+	nsb.nodeScheduler.GoalManager.SetEventBus(nsb.getEventBus(appID))
+	// Goals must not be lost and so the goal manager waits for the scheduler
+	nsb.nodeScheduler.GoalManager.Notifier.SubscribeWithOptions(nsb.nodeScheduler.chanFromGoalManager, interfacing.SubscriptionOptions{
+		Name: "scheduler",
+	})
 	return nsb
 }
 
 func (nsb *NodeSchedulerBuilder) AddResourceManager() *NodeSchedulerBuilder {
 	nsb.nodeScheduler.ResourceManager = &ResourceManager{
-		Namespace:     "ses",
-		Clientset:     nil,
-		MetricsClient: nil,
-		Simulate:      nsb.nodeScheduler.Config.Simulate,
-		Notifier:      interfacing.NewNotifier(),
-		runner:        "nodescheduler",
+		Namespace:          "ses",
+		Clientset:          nil,
+		MetricsClient:      nil,
+		Simulate:           nsb.nodeScheduler.Config.Simulate,
+		Notifier:           interfacing.NewNotifier(),
+		runner:             "nodescheduler",
+		ResourceLimitRatio: nsb.nodeScheduler.Config.ResourceLimitRatio,
+		KnobInjection:      nsb.nodeScheduler.Config.KnobInjection,
 	}
-	nsb.nodeScheduler.ResourceManager.Notifier.Subscribe(nsb.nodeScheduler.chanFromResourceManager)
+	// Events changing the state of plugins or goals must reach the scheduler and so
+	// the watch loop waits once the buffer is full. Informational events go through
+	// the same subscription so that the scheduler gets events of a plugin in order
+	nsb.nodeScheduler.ResourceManager.Notifier.SubscribeWithOptions(nsb.nodeScheduler.chanFromResourceManager, interfacing.SubscriptionOptions{
+		Name: "scheduler",
+		EventTypes: []datatype.EventType{
+			datatype.EventPluginStatusLaunched,
+			datatype.EventPluginStatusComplete,
+			datatype.EventPluginStatusFailed,
+			datatype.EventPluginStatusPreempted,
+			datatype.EventGoalStatusReceivedBulk,
+			datatype.EventFailure,
+		},
+		BufferSize: 1000,
+		Overflow:   interfacing.OverflowBlock,
+	})
 	return nsb
 }
 
 func (nsb *NodeSchedulerBuilder) AddKnowledgebase() *NodeSchedulerBuilder {
-	nsb.nodeScheduler.Knowledgebase = &KnowledgeBase{
-		nodeID:         nsb.nodeScheduler.Config.Name,
-		rules:          make(map[string][]string),
-		measures:       map[string]interface{}{},
-		ruleCheckerURI: nsb.nodeScheduler.Config.RuleCheckerURI,
-	}
+	nsb.nodeScheduler.Knowledgebase = NewKnowledgeBase(nsb.nodeScheduler.Config.Name, nsb.nodeScheduler.Config.RuleCheckerURI)
 	return nsb
 }
 
@@ -102,15 +169,54 @@ func (nsb *NodeSchedulerBuilder) AddAPIServer() *NodeSchedulerBuilder {
 }
 
 func (nsb *NodeSchedulerBuilder) AddLoggerToBeehive(appID string) *NodeSchedulerBuilder {
-	nsb.nodeScheduler.LogToBeehive = interfacing.NewRabbitMQHandler(
-		nsb.nodeScheduler.Config.RabbitmqURI,
-		nsb.nodeScheduler.Config.RabbitmqUsername,
-		nsb.nodeScheduler.Config.RabbitmqPassword,
-		"",
-		appID)
+	nsb.nodeScheduler.LogToBeehive = nsb.getEventBus(appID)
 	return nsb
 }
 
+// getEventBus returns the event bus of the configured type. Messages stay
+// in the process if NoRabbitMQ is set. If the event bus cannot be created,
+// it returns nil and Configure reports the error
+func (nsb *NodeSchedulerBuilder) getEventBus(appID string) interfacing.EventBus {
+	if nsb.eventBus != nil || nsb.nodeScheduler.eventBusErr != nil {
+		return nsb.eventBus
+	}
+	config := nsb.nodeScheduler.Config
+	switch {
+	case config.NoRabbitMQ:
+		logger.Info.Printf("No message broker is used. Events stay in the scheduler")
+		nsb.eventBus = interfacing.NewMemoryEventBus()
+	case config.EventBus == "mqtt":
+		logger.Info.Printf("Using MQTT broker at %s with user %s", config.MQTTBrokerURI, config.MQTTUsername)
+		tlsConfig, err := interfacing.NewMQTTTLSConfig(config.MQTTBrokerURI, config.MQTTCaCertPath, config.MQTTCertPath, config.MQTTKeyPath)
+		if err != nil {
+			nsb.nodeScheduler.eventBusErr = fmt.Errorf("Failed to configure TLS for MQTT: %s", err.Error())
+			return nil
+		}
+		nsb.eventBus = interfacing.NewMQTTEventBus(
+			config.MQTTBrokerURI,
+			config.MQTTUsername,
+			config.MQTTPassword,
+			"nodescheduler-"+nsb.nodeScheduler.NodeID,
+			config.MQTTTopicPrefix,
+			tlsConfig)
+	case config.EventBus == "" || config.EventBus == "rabbitmq":
+		logger.Info.Printf("Using RabbitMQ at %s with user %s", config.RabbitmqURI, config.RabbitmqUsername)
+		rh := interfacing.NewRabbitMQHandler(
+			config.RabbitmqURI,
+			config.RabbitmqUsername,
+			config.RabbitmqPassword,
+			config.RabbitmqCaCertPath,
+			appID)
+		rh.SetClientCertificate(config.RabbitmqCertPath, config.RabbitmqKeyPath)
+		rh.SetExternalAuth(config.RabbitmqAuthExternal)
+		rh.SetServerName(config.RabbitmqServerName)
+		nsb.eventBus = rh
+	default:
+		nsb.nodeScheduler.eventBusErr = fmt.Errorf("Unknown event bus %q: must be \"rabbitmq\" or \"mqtt\"", config.EventBus)
+	}
+	return nsb.eventBus
+}
+
 func (nsb *NodeSchedulerBuilder) Build() *NodeScheduler {
 	return nsb.nodeScheduler
 }
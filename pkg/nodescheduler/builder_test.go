@@ -0,0 +1,78 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestResourceManagerEventsToScheduler(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W001"}).
+		AddResourceManager().
+		Build()
+	notifier := ns.ResourceManager.Notifier
+	// The completion is followed by more informational events than the scheduler buffers.
+	// The watch loop waits for the scheduler rather than drops any of them
+	go func() {
+		notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusComplete).Build())
+		for i := 0; i < 3000; i++ {
+			notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusLaunched).Build())
+		}
+	}()
+	received := 0
+	timeout := time.After(5 * time.Second)
+	for received < 3001 {
+		select {
+		case event := <-ns.chanFromResourceManager:
+			if received == 0 && event.Type != datatype.EventPluginStatusComplete {
+				t.Fatalf("Expected the completion first, but got %s", event.Type)
+			}
+			received++
+		case <-timeout:
+			t.Fatalf("Events were dropped: received %d of 3001", received)
+		}
+	}
+}
+
+func TestResourceManagerEventsToSchedulerInOrder(t *testing.T) {
+	ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{Name: "W001"}).
+		AddResourceManager().
+		Build()
+	notifier := ns.ResourceManager.Notifier
+	subscribers := map[string]bool{}
+	for _, s := range notifier.Subscriptions() {
+		if subscribers[s.Name()] {
+			t.Errorf("Subscription name %q is used more than once", s.Name())
+		}
+		subscribers[s.Name()] = true
+	}
+	const plugins = 500
+	go func() {
+		for i := 0; i < plugins; i++ {
+			plugin := fmt.Sprintf("plugin-%d", i)
+			notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusLaunched).AddEntry("plugin_name", plugin).Build())
+			notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusComplete).AddEntry("plugin_name", plugin).Build())
+		}
+	}()
+	launched := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for completed := 0; completed < plugins; {
+		select {
+		case event := <-ns.chanFromResourceManager:
+			plugin := event.GetEntry("plugin_name")
+			switch event.Type {
+			case datatype.EventPluginStatusLaunched:
+				launched[plugin] = true
+			case datatype.EventPluginStatusComplete:
+				if !launched[plugin] {
+					t.Fatalf("Completion of %s arrived before its launch", plugin)
+				}
+				completed++
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for events of plugins")
+		}
+	}
+}
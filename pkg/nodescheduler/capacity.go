@@ -0,0 +1,280 @@
+package nodescheduler
+
+import (
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+const (
+	// gpuMemoryResourceName is the extended resource that nodes advertise for GPU memory
+	gpuMemoryResourceName apiv1.ResourceName = "sagecontinuum.org/gpu-memory"
+	// gpuNodeSelector is the node label of nodes having GPU. Plugins requiring GPU memory
+	// are placed on the nodes if no node advertises gpuMemoryResourceName
+	gpuNodeSelector = "resource.gpu"
+	mega            = 1024 * 1024
+)
+
+// unlimitedResource is used when resource of the cluster is not known.
+// It is large enough to fit any plugin
+var unlimitedResource = datatype.NewResource(999000000, 999999*1024, 999999*1024)
+
+// pluginTaskLabel is the pod label naming the plugin the pod runs
+const pluginTaskLabel = "sagecontinuum.org/plugin-task"
+
+// nodeResource is the resource available on a schedulable node of the cluster
+type nodeResource struct {
+	name      string
+	labels    map[string]string
+	available datatype.Resource
+	// taken is the resource taken by pods of each plugin on the node
+	taken map[string]datatype.Resource
+}
+
+// clusterResource is the resource available on each schedulable node of the cluster
+type clusterResource struct {
+	nodes []*nodeResource
+	// gpuMemoryAdvertised is true if any node advertises gpuMemoryResourceName
+	gpuMemoryAdvertised bool
+	// unlimited is true if resource of the cluster is not known. Any plugin fits
+	unlimited bool
+}
+
+// availableResource returns allocatable resource of each schedulable node minus
+// resource taken by the pods on the node. A pod takes the larger of what it requests
+// and what it uses in the metrics. Pods not yet assigned to a node take nothing.
+//
+// GPU memory is not limited if no node advertises it as gpuMemoryResourceName
+func availableResource(nodes []apiv1.Node, pods []apiv1.Pod, podMetrics []metricsv1beta1.PodMetrics) *clusterResource {
+	cluster := &clusterResource{}
+	allocatable := map[string]apiv1.ResourceList{}
+	taken := map[string]apiv1.ResourceList{}
+	takenByPlugin := map[string]map[string]apiv1.ResourceList{}
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		allocatable[node.Name] = node.Status.Allocatable
+		taken[node.Name] = apiv1.ResourceList{}
+		takenByPlugin[node.Name] = map[string]apiv1.ResourceList{}
+		if _, advertised := node.Status.Allocatable[gpuMemoryResourceName]; advertised {
+			cluster.gpuMemoryAdvertised = true
+		}
+	}
+	usage := map[string]apiv1.ResourceList{}
+	for _, m := range podMetrics {
+		used := apiv1.ResourceList{}
+		for _, c := range m.Containers {
+			addResourceList(used, c.Usage)
+		}
+		usage[m.Namespace+"/"+m.Name] = used
+	}
+	for _, pod := range pods {
+		if _, schedulable := allocatable[pod.Spec.NodeName]; !schedulable {
+			continue
+		}
+		switch pod.Status.Phase {
+		case apiv1.PodSucceeded, apiv1.PodFailed:
+			continue
+		}
+		podTaken := podRequests(&pod)
+		for name, quantity := range usage[pod.Namespace+"/"+pod.Name] {
+			if requested, exist := podTaken[name]; !exist || quantity.Cmp(requested) > 0 {
+				podTaken[name] = quantity.DeepCopy()
+			}
+		}
+		addResourceList(taken[pod.Spec.NodeName], podTaken)
+		if pluginName, exist := pod.Labels[pluginTaskLabel]; exist {
+			byPlugin := takenByPlugin[pod.Spec.NodeName]
+			if _, exist := byPlugin[pluginName]; !exist {
+				byPlugin[pluginName] = apiv1.ResourceList{}
+			}
+			addResourceList(byPlugin[pluginName], podTaken)
+		}
+	}
+	for _, node := range nodes {
+		if _, schedulable := allocatable[node.Name]; !schedulable {
+			continue
+		}
+		n := &nodeResource{
+			name:      node.Name,
+			labels:    node.Labels,
+			available: cluster.toResource(subtractResourceList(allocatable[node.Name], taken[node.Name])),
+			taken:     map[string]datatype.Resource{},
+		}
+		for pluginName, list := range takenByPlugin[node.Name] {
+			n.taken[pluginName] = cluster.toResource(list)
+		}
+		cluster.nodes = append(cluster.nodes, n)
+	}
+	return cluster
+}
+
+// toResource converts the resource list to a resource. Negative quantities are zero
+func (c *clusterResource) toResource(list apiv1.ResourceList) datatype.Resource {
+	value := func(name apiv1.ResourceName) int64 {
+		quantity := list[name]
+		if name == apiv1.ResourceCPU {
+			return max64(quantity.MilliValue(), 0)
+		}
+		return max64(quantity.Value(), 0) / mega
+	}
+	r := datatype.NewResource(
+		int(value(apiv1.ResourceCPU)),
+		int(value(apiv1.ResourceMemory)),
+		int(value(gpuMemoryResourceName)),
+	)
+	if !c.gpuMemoryAdvertised {
+		r.GPUMemory = unlimitedResource.GPUMemory
+	}
+	return r
+}
+
+// total returns the resource available in the cluster. Scheduling policies see the
+// cluster as a whole and plugins they select are fitted to nodes by fit
+func (c *clusterResource) total() datatype.Resource {
+	if c.unlimited {
+		return unlimitedResource
+	}
+	total := datatype.NewResource(0, 0, 0)
+	for _, n := range c.nodes {
+		total = total.Add(&n.available)
+	}
+	if !c.gpuMemoryAdvertised {
+		total.GPUMemory = unlimitedResource.GPUMemory
+	}
+	return total
+}
+
+// release gives the resource taken by pods of the plugin back to their nodes
+func (c *clusterResource) release(plugin *datatype.Plugin) {
+	for _, n := range c.nodes {
+		if taken, exist := n.taken[plugin.Name]; exist {
+			n.available = n.available.Add(&taken)
+			delete(n.taken, plugin.Name)
+		}
+	}
+}
+
+// fit places the plugins in order on the first node that their node selector
+// selects and that has enough resource left. It returns the plugins placed on
+// a node and the plugins that fit on no node
+func (c *clusterResource) fit(plugins []*datatype.Plugin) (fitted []*datatype.Plugin, unfitted []*datatype.Plugin) {
+	if c.unlimited {
+		return plugins, nil
+	}
+	for _, plugin := range plugins {
+		require := plugin.GetRequiredResource()
+		selector := nodeSelectorForPlugin(plugin, c.gpuMemoryAdvertised)
+		var node *nodeResource
+		for _, n := range c.nodes {
+			if matchLabels(n.labels, selector) && n.available.CanAccommodate(&require) {
+				node = n
+				break
+			}
+		}
+		if node == nil {
+			unfitted = append(unfitted, plugin)
+			continue
+		}
+		node.available = node.available.Subtract(&require)
+		fitted = append(fitted, plugin)
+	}
+	return
+}
+
+// nodeSelectorForPlugin returns the node selector of the plugin pod. Selectors
+// given by users take precedence over the selector for resource of the plugin
+func nodeSelectorForPlugin(plugin *datatype.Plugin, gpuMemoryAdvertised bool) map[string]string {
+	nodeSelector := nodeSelectorForConfig(plugin.PluginSpec)
+	require := plugin.GetRequiredResource()
+	_, resourceSelector := resourcesForPlugin(plugin, 0, require.GPUMemoryInMega() > 0 && gpuMemoryAdvertised)
+	for k, v := range resourceSelector {
+		if _, exist := nodeSelector[k]; !exist {
+			nodeSelector[k] = v
+		}
+	}
+	return nodeSelector
+}
+
+// resourcesForPlugin returns resource requirements of the plugin container and the node
+// selector that places the plugin on a node having the resource. Limits are the requests
+// multiplied by limitRatio and are not set if limitRatio is zero. GPU memory is requested as
+// gpuMemoryResourceName if nodes advertise it. Otherwise, nodes are selected by gpuNodeSelector
+func resourcesForPlugin(plugin *datatype.Plugin, limitRatio float64, gpuMemoryAdvertised bool) (apiv1.ResourceRequirements, map[string]string) {
+	requirements := apiv1.ResourceRequirements{
+		Limits:   apiv1.ResourceList{},
+		Requests: apiv1.ResourceList{},
+	}
+	selector := map[string]string{}
+	require := plugin.GetRequiredResource()
+	if cpu := int64(require.CPUInMilli()); cpu > 0 {
+		requirements.Requests[apiv1.ResourceCPU] = *resource.NewMilliQuantity(cpu, resource.DecimalSI)
+		if limitRatio > 0 {
+			requirements.Limits[apiv1.ResourceCPU] = *resource.NewMilliQuantity(int64(float64(cpu)*limitRatio), resource.DecimalSI)
+		}
+	}
+	if memory := int64(require.MemoryInMega()); memory > 0 {
+		requirements.Requests[apiv1.ResourceMemory] = *resource.NewQuantity(memory*mega, resource.BinarySI)
+		if limitRatio > 0 {
+			requirements.Limits[apiv1.ResourceMemory] = *resource.NewQuantity(int64(float64(memory)*limitRatio)*mega, resource.BinarySI)
+		}
+	}
+	if gpuMemory := int64(require.GPUMemoryInMega()); gpuMemory > 0 {
+		if gpuMemoryAdvertised {
+			// Extended resources cannot be overcommitted and so their limit is the request
+			requirements.Requests[gpuMemoryResourceName] = *resource.NewQuantity(gpuMemory*mega, resource.BinarySI)
+			requirements.Limits[gpuMemoryResourceName] = *resource.NewQuantity(gpuMemory*mega, resource.BinarySI)
+		} else {
+			selector[gpuNodeSelector] = "true"
+		}
+	}
+	return requirements, selector
+}
+
+// podRequests returns resource requested by the pod. As Kubernetes does,
+// init containers count only when they request more than the containers do
+func podRequests(pod *apiv1.Pod) apiv1.ResourceList {
+	requests := apiv1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		addResourceList(requests, c.Resources.Requests)
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, quantity := range c.Resources.Requests {
+			if requested, exist := requests[name]; !exist || quantity.Cmp(requested) > 0 {
+				requests[name] = quantity.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+func addResourceList(list apiv1.ResourceList, toAdd apiv1.ResourceList) {
+	for name, quantity := range toAdd {
+		if q, exist := list[name]; exist {
+			q.Add(quantity)
+			list[name] = q
+		} else {
+			list[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+func subtractResourceList(list apiv1.ResourceList, toSubtract apiv1.ResourceList) apiv1.ResourceList {
+	left := apiv1.ResourceList{}
+	addResourceList(left, list)
+	for name, quantity := range toSubtract {
+		q := left[name]
+		q.Sub(quantity)
+		left[name] = q
+	}
+	return left
+}
+
+func max64(a int64, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,299 @@
+package nodescheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+func newTestNode(name string, cpu string, memory string, unschedulable bool) apiv1.Node {
+	return apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       apiv1.NodeSpec{Unschedulable: unschedulable},
+		Status: apiv1.NodeStatus{
+			Allocatable: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse(cpu),
+				apiv1.ResourceMemory: resource.MustParse(memory),
+			},
+		},
+	}
+}
+
+func newTestPod(name string, nodeName string, phase apiv1.PodPhase, cpu string, memory string) apiv1.Pod {
+	requests := apiv1.ResourceList{}
+	if cpu != "" {
+		requests[apiv1.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		requests[apiv1.ResourceMemory] = resource.MustParse(memory)
+	}
+	return apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ses"},
+		Spec: apiv1.PodSpec{
+			NodeName: nodeName,
+			Containers: []apiv1.Container{
+				{Name: name, Resources: apiv1.ResourceRequirements{Requests: requests}},
+			},
+		},
+		Status: apiv1.PodStatus{Phase: phase},
+	}
+}
+
+func newTestPodMetrics(name string, cpu string, memory string) metricsv1beta1.PodMetrics {
+	return metricsv1beta1.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ses"},
+		Containers: []metricsv1beta1.ContainerMetrics{
+			{
+				Name: name,
+				Usage: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse(cpu),
+					apiv1.ResourceMemory: resource.MustParse(memory),
+				},
+			},
+		},
+	}
+}
+
+func TestAvailableResource(t *testing.T) {
+	tests := map[string]struct {
+		Nodes      []apiv1.Node
+		Pods       []apiv1.Pod
+		PodMetrics []metricsv1beta1.PodMetrics
+		Want       datatype.Resource
+	}{
+		"empty": {
+			Nodes: []apiv1.Node{newTestNode("nxcore", "8", "16Gi", false)},
+			Want:  datatype.Resource{CPU: "8000m", Memory: "16384Mi"},
+		},
+		"requests": {
+			Nodes: []apiv1.Node{
+				newTestNode("nxcore", "8", "16Gi", false),
+				newTestNode("rpi", "4", "4Gi", false),
+			},
+			Pods: []apiv1.Pod{
+				newTestPod("a", "nxcore", apiv1.PodRunning, "1500m", "2Gi"),
+				newTestPod("b", "rpi", apiv1.PodPending, "500m", ""),
+				newTestPod("unassigned", "", apiv1.PodPending, "1", "1Gi"),
+				newTestPod("done", "nxcore", apiv1.PodSucceeded, "1", "1Gi"),
+			},
+			Want: datatype.Resource{CPU: "10000m", Memory: "18432Mi"},
+		},
+		"unschedulable": {
+			Nodes: []apiv1.Node{
+				newTestNode("nxcore", "8", "16Gi", false),
+				newTestNode("rpi", "4", "4Gi", true),
+			},
+			Pods: []apiv1.Pod{newTestPod("b", "rpi", apiv1.PodRunning, "500m", "")},
+			Want: datatype.Resource{CPU: "8000m", Memory: "16384Mi"},
+		},
+		"metrics": {
+			Nodes: []apiv1.Node{newTestNode("nxcore", "8", "16Gi", false)},
+			Pods: []apiv1.Pod{
+				newTestPod("a", "nxcore", apiv1.PodRunning, "1", "1Gi"),
+				newTestPod("b", "nxcore", apiv1.PodRunning, "", ""),
+			},
+			PodMetrics: []metricsv1beta1.PodMetrics{
+				// a uses less CPU but more memory than it requests
+				newTestPodMetrics("a", "200m", "3Gi"),
+				newTestPodMetrics("b", "2", "1Gi"),
+			},
+			Want: datatype.Resource{CPU: "5000m", Memory: "12288Mi"},
+		},
+		"overcommitted": {
+			Nodes: []apiv1.Node{newTestNode("nxcore", "1", "1Gi", false)},
+			Pods:  []apiv1.Pod{newTestPod("a", "nxcore", apiv1.PodRunning, "2", "2Gi")},
+			Want:  datatype.Resource{CPU: "0m", Memory: "0Mi"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := availableResource(test.Nodes, test.Pods, test.PodMetrics).total()
+			if got.CPU != test.Want.CPU || got.Memory != test.Want.Memory {
+				t.Errorf("Wrong available resource: expected %q, but %q", test.Want.String(), got.String())
+			}
+			if got.GPUMemory != unlimitedResource.GPUMemory {
+				t.Errorf("GPU memory must not be limited if not advertised: %q", got.GPUMemory)
+			}
+		})
+	}
+}
+
+func TestAvailableGPUMemory(t *testing.T) {
+	node := newTestNode("nxcore", "8", "16Gi", false)
+	node.Status.Allocatable[gpuMemoryResourceName] = resource.MustParse("8Gi")
+	pod := newTestPod("a", "nxcore", apiv1.PodRunning, "", "")
+	pod.Spec.Containers[0].Resources.Requests[gpuMemoryResourceName] = resource.MustParse("3Gi")
+	got := availableResource([]apiv1.Node{node}, []apiv1.Pod{pod}, nil).total()
+	if got.GPUMemory != "5120Mi" {
+		t.Errorf("Wrong available GPU memory: expected %q, but %q", "5120Mi", got.GPUMemory)
+	}
+}
+
+func TestClusterResourceFit(t *testing.T) {
+	newPlugin := func(name string, cpu string, memory string, node string) *datatype.Plugin {
+		return &datatype.Plugin{
+			Name: name,
+			PluginSpec: &datatype.PluginSpec{
+				Image:    "waggle/" + name,
+				Node:     node,
+				Resource: &datatype.Resource{CPU: cpu, Memory: memory},
+			},
+		}
+	}
+	rpi := newTestNode("rpi", "4", "4Gi", false)
+	rpi.Labels = map[string]string{"k3s.io/hostname": "rpi"}
+	nxcore := newTestNode("nxcore", "4", "8Gi", false)
+	nxcore.Labels = map[string]string{"k3s.io/hostname": "nxcore", gpuNodeSelector: "true"}
+	gpuPlugin := newPlugin("gpu", "1", "1Gi", "")
+	gpuPlugin.PluginSpec.Resource.GPUMemory = "1Gi"
+	tests := map[string]struct {
+		Pods         []apiv1.Pod
+		Plugins      []*datatype.Plugin
+		WantFitted   []string
+		WantUnfitted []string
+	}{
+		"fitsonenode": {
+			Plugins:    []*datatype.Plugin{newPlugin("a", "3", "1Gi", ""), newPlugin("b", "3", "1Gi", "")},
+			WantFitted: []string{"a", "b"},
+		},
+		// 6 CPU are available in total, but no node has 5
+		"splitacrossnodes": {
+			Plugins:      []*datatype.Plugin{newPlugin("a", "5", "1Gi", "")},
+			WantUnfitted: []string{"a"},
+		},
+		"filled": {
+			Plugins:      []*datatype.Plugin{newPlugin("a", "3", "1Gi", ""), newPlugin("b", "3", "1Gi", ""), newPlugin("c", "3", "1Gi", "")},
+			WantFitted:   []string{"a", "b"},
+			WantUnfitted: []string{"c"},
+		},
+		"selectednode": {
+			Pods:         []apiv1.Pod{newTestPod("x", "rpi", apiv1.PodRunning, "3", "")},
+			Plugins:      []*datatype.Plugin{newPlugin("a", "2", "1Gi", "rpi"), newPlugin("b", "2", "1Gi", "nxcore")},
+			WantFitted:   []string{"b"},
+			WantUnfitted: []string{"a"},
+		},
+		"gpuselector": {
+			Pods:         []apiv1.Pod{newTestPod("x", "nxcore", apiv1.PodRunning, "4", "")},
+			Plugins:      []*datatype.Plugin{gpuPlugin},
+			WantUnfitted: []string{"gpu"},
+		},
+	}
+	names := func(plugins []*datatype.Plugin) (n []string) {
+		for _, p := range plugins {
+			n = append(n, p.Name)
+		}
+		return
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cluster := availableResource([]apiv1.Node{rpi, nxcore}, test.Pods, nil)
+			fitted, unfitted := cluster.fit(test.Plugins)
+			if !reflect.DeepEqual(names(fitted), test.WantFitted) || !reflect.DeepEqual(names(unfitted), test.WantUnfitted) {
+				t.Errorf("Wrong fit: expected %v and %v not fitting, but %v and %v", test.WantFitted, test.WantUnfitted, names(fitted), names(unfitted))
+			}
+		})
+	}
+}
+
+func TestClusterResourceRelease(t *testing.T) {
+	pod := newTestPod("sampler-abc", "rpi", apiv1.PodRunning, "3", "1Gi")
+	pod.Labels = map[string]string{pluginTaskLabel: "sampler"}
+	cluster := availableResource([]apiv1.Node{newTestNode("rpi", "4", "4Gi", false)}, []apiv1.Pod{pod}, nil)
+	preemptor := &datatype.Plugin{Name: "detector", PluginSpec: &datatype.PluginSpec{Resource: &datatype.Resource{CPU: "2"}}}
+	if fitted, _ := cluster.fit([]*datatype.Plugin{preemptor}); len(fitted) > 0 {
+		t.Fatal("Plugin must not fit before the sampler is released")
+	}
+	cluster.release(&datatype.Plugin{Name: "sampler"})
+	if got := cluster.total(); got.CPU != "4000m" || got.Memory != "4096Mi" {
+		t.Errorf("Wrong available resource after release: %q", got.String())
+	}
+	if fitted, _ := cluster.fit([]*datatype.Plugin{preemptor}); len(fitted) != 1 {
+		t.Error("Plugin must fit after the sampler is released")
+	}
+}
+
+func TestResourcesForPlugin(t *testing.T) {
+	newPlugin := func(profile *datatype.Resource, override *datatype.Resource) *datatype.Plugin {
+		plugin := &datatype.Plugin{
+			Name:       "test",
+			PluginSpec: &datatype.PluginSpec{Image: "waggle/test", Resource: override},
+		}
+		if profile != nil {
+			plugin.Status.KnobStatus = &datatype.Profile{Name: "default", Require: *profile}
+		}
+		return plugin
+	}
+	tests := map[string]struct {
+		Plugin              *datatype.Plugin
+		LimitRatio          float64
+		GPUMemoryAdvertised bool
+		WantRequests        map[apiv1.ResourceName]string
+		WantLimits          map[apiv1.ResourceName]string
+		WantSelector        map[string]string
+	}{
+		"noprofile": {
+			Plugin:     newPlugin(nil, nil),
+			LimitRatio: 2,
+		},
+		"profile": {
+			Plugin:       newPlugin(&datatype.Resource{CPU: "1500m", Memory: "1Gi"}, nil),
+			LimitRatio:   2,
+			WantRequests: map[apiv1.ResourceName]string{apiv1.ResourceCPU: "1500m", apiv1.ResourceMemory: "1Gi"},
+			WantLimits:   map[apiv1.ResourceName]string{apiv1.ResourceCPU: "3", apiv1.ResourceMemory: "2Gi"},
+		},
+		"nolimit": {
+			Plugin:       newPlugin(&datatype.Resource{CPU: "1", Memory: "512Mi"}, nil),
+			WantRequests: map[apiv1.ResourceName]string{apiv1.ResourceCPU: "1", apiv1.ResourceMemory: "512Mi"},
+		},
+		"override": {
+			Plugin:       newPlugin(&datatype.Resource{CPU: "4", Memory: "4Gi"}, &datatype.Resource{Memory: "256Mi"}),
+			LimitRatio:   1,
+			WantRequests: map[apiv1.ResourceName]string{apiv1.ResourceMemory: "256Mi"},
+			WantLimits:   map[apiv1.ResourceName]string{apiv1.ResourceMemory: "256Mi"},
+		},
+		"gpuSelector": {
+			Plugin:       newPlugin(&datatype.Resource{GPUMemory: "2Gi"}, nil),
+			LimitRatio:   2,
+			WantSelector: map[string]string{gpuNodeSelector: "true"},
+		},
+		"gpuResource": {
+			Plugin:              newPlugin(&datatype.Resource{GPUMemory: "2Gi"}, nil),
+			LimitRatio:          2,
+			GPUMemoryAdvertised: true,
+			WantRequests:        map[apiv1.ResourceName]string{gpuMemoryResourceName: "2Gi"},
+			WantLimits:          map[apiv1.ResourceName]string{gpuMemoryResourceName: "2Gi"},
+		},
+	}
+	compare := func(t *testing.T, what string, got apiv1.ResourceList, want map[apiv1.ResourceName]string) {
+		if len(got) != len(want) {
+			t.Errorf("Wrong %s: expected %v, but %v", what, want, got)
+			return
+		}
+		for name, quantity := range want {
+			q, exist := got[name]
+			if !exist || q.Cmp(resource.MustParse(quantity)) != 0 {
+				t.Errorf("Wrong %s of %s: expected %s, but %s", what, name, quantity, q.String())
+			}
+		}
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			requirements, selector := resourcesForPlugin(test.Plugin, test.LimitRatio, test.GPUMemoryAdvertised)
+			compare(t, "requests", requirements.Requests, test.WantRequests)
+			compare(t, "limits", requirements.Limits, test.WantLimits)
+			if len(selector) != len(test.WantSelector) {
+				t.Fatalf("Wrong node selector: expected %v, but %v", test.WantSelector, selector)
+			}
+			for k, v := range test.WantSelector {
+				if selector[k] != v {
+					t.Errorf("Wrong node selector: expected %v, but %v", test.WantSelector, selector)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// KnobInjectionEnv passes knobs to plugins as environment variables
+	KnobInjectionEnv = "env"
+	// KnobInjectionArgs passes knobs to plugins as arguments
+	KnobInjectionArgs = "args"
+
+	knobEnvPrefix = "WAGGLE_PLUGIN_KNOB_"
+)
+
+var invalidEnvNameCharacters = regexp.MustCompile("[^A-Z0-9_]")
+
+// knobsForPlugin returns environment variables and arguments that pass the profile chosen for the plugin.
+// The name of the profile is always given in WAGGLE_PLUGIN_PROFILE. Knobs are given as either
+// WAGGLE_PLUGIN_KNOB_<KNOB> environment variables or --<knob>=<value> arguments in the order of knob names
+func knobsForPlugin(plugin *datatype.Plugin, injection string) (envs []apiv1.EnvVar, args []string) {
+	profile := plugin.Status.KnobStatus
+	if profile == nil {
+		return
+	}
+	envs = append(envs, apiv1.EnvVar{
+		Name:  "WAGGLE_PLUGIN_PROFILE",
+		Value: profile.Name,
+	})
+	var knobs []string
+	for knob := range profile.Knobs {
+		knobs = append(knobs, knob)
+	}
+	sort.Strings(knobs)
+	for _, knob := range knobs {
+		switch injection {
+		case KnobInjectionArgs:
+			args = append(args, fmt.Sprintf("--%s=%s", knob, profile.Knobs[knob]))
+		default:
+			envs = append(envs, apiv1.EnvVar{
+				Name:  knobEnvPrefix + invalidEnvNameCharacters.ReplaceAllString(strings.ToUpper(knob), "_"),
+				Value: profile.Knobs[knob],
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package nodescheduler
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestKnobsForPlugin(t *testing.T) {
+	profile := &datatype.Profile{
+		Name:  "unet_cuda",
+		Knobs: map[string]string{"model": "unet_module", "cuda": "true", "batch-size": "4"},
+	}
+	tests := map[string]struct {
+		Profile   *datatype.Profile
+		Injection string
+		WantEnvs  []apiv1.EnvVar
+		WantArgs  []string
+	}{
+		"noprofile": {
+			Injection: KnobInjectionEnv,
+		},
+		"env": {
+			Profile:   profile,
+			Injection: KnobInjectionEnv,
+			WantEnvs: []apiv1.EnvVar{
+				{Name: "WAGGLE_PLUGIN_PROFILE", Value: "unet_cuda"},
+				{Name: "WAGGLE_PLUGIN_KNOB_BATCH_SIZE", Value: "4"},
+				{Name: "WAGGLE_PLUGIN_KNOB_CUDA", Value: "true"},
+				{Name: "WAGGLE_PLUGIN_KNOB_MODEL", Value: "unet_module"},
+			},
+		},
+		"args": {
+			Profile:   profile,
+			Injection: KnobInjectionArgs,
+			WantEnvs:  []apiv1.EnvVar{{Name: "WAGGLE_PLUGIN_PROFILE", Value: "unet_cuda"}},
+			WantArgs:  []string{"--batch-size=4", "--cuda=true", "--model=unet_module"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plugin := &datatype.Plugin{Name: "test", PluginSpec: &datatype.PluginSpec{Image: "waggle/test"}}
+			plugin.Status.KnobStatus = test.Profile
+			envs, args := knobsForPlugin(plugin, test.Injection)
+			if !reflect.DeepEqual(envs, test.WantEnvs) {
+				t.Errorf("Wrong envs: expected %v, but %v", test.WantEnvs, envs)
+			}
+			if !reflect.DeepEqual(args, test.WantArgs) {
+				t.Errorf("Wrong args: expected %v, but %v", test.WantArgs, args)
+			}
+		})
+	}
+}
@@ -1,7 +1,8 @@
 package nodescheduler
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -9,36 +10,41 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
 	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
 )
 
-type KnowledgeBase struct {
-	nodeID         string
-	rules          map[string][]string
-	measures       map[string]interface{}
-	ruleCheckerURI string
+// RuleEvaluator evaluates conditions of science rules of goals
+type RuleEvaluator interface {
+	// AddMeasure stores the value of a measure that rules may look up
+	AddMeasure(name string, value interface{}, timestamp time.Time) error
+	// Evaluate returns whether the condition of a rule of the goal is true
+	Evaluate(goalID string, condition string) (bool, error)
+	// Forget drops what rules of the goal remember, such as cronjobs
+	Forget(goalID string)
 }
 
-func NewKnowledgeBase(nodeID string, ruleCheckerURI string) *KnowledgeBase {
-	return &KnowledgeBase{
-		nodeID:         nodeID,
-		rules:          make(map[string][]string),
-		measures:       map[string]interface{}{},
-		ruleCheckerURI: ruleCheckerURI,
-	}
+// measureTopicPattern matches all messages of the node data stream that science rules may look up
+const measureTopicPattern = "#"
+
+type KnowledgeBase struct {
+	nodeID    string
+	rules     map[string][]string
+	evaluator RuleEvaluator
 }
 
-func (kb *KnowledgeBase) add(obj interface{}, k string, v interface{}) {
-	currentKB := obj.(map[string]interface{})
-	keys := strings.SplitN(k, ".", 2)
-	if len(keys) == 1 {
-		currentKB[keys[0]] = v
+// NewKnowledgeBase returns a knowledge base evaluating science rules in the scheduler.
+// If ruleCheckerURI is given, rules are evaluated by the science rule checker at the URI instead
+func NewKnowledgeBase(nodeID string, ruleCheckerURI string) *KnowledgeBase {
+	var evaluator RuleEvaluator
+	if ruleCheckerURI != "" {
+		evaluator = newHTTPRuleEvaluator(ruleCheckerURI)
 	} else {
-		if nextKB, exist := currentKB[keys[0]]; !exist {
-			currentKB[keys[0]] = map[string]interface{}{}
-			kb.add(currentKB[keys[0]], keys[1], v)
-		} else {
-			kb.add(nextKB, keys[1], v)
-		}
+		evaluator = newNativeRuleEvaluator()
+	}
+	return &KnowledgeBase{
+		nodeID:    nodeID,
+		rules:     make(map[string][]string),
+		evaluator: evaluator,
 	}
 }
 
@@ -51,79 +57,74 @@ func (kb *KnowledgeBase) DropRules(goalID string) {
 	if _, exist := kb.rules[goalID]; exist {
 		delete(kb.rules, goalID)
 	}
+	kb.evaluator.Forget(goalID)
 }
 
 func (kb *KnowledgeBase) AddRawMeasure(k string, v interface{}) {
-	logger.Debug.Printf("Added raw measure %q:%s", k, v)
-	// kb.add(kb.measures, k, v)
-	r := interfacing.NewHTTPRequest(kb.ruleCheckerURI)
-	data, _ := json.Marshal(map[string]interface{}{
-		"key":   k,
-		"value": v,
-	})
-	resp, err := r.RequestPost("store", data)
-
-	body, err := r.ParseJSONHTTPResponse(resp)
-	if err != nil {
-
+	logger.Debug.Printf("Added raw measure %q:%v", k, v)
+	if err := kb.evaluator.AddMeasure(k, v, time.Now()); err != nil {
+		logger.Error.Printf("Failed to add measure %q: %s", k, err.Error())
 	}
-	logger.Debug.Printf("%v", body)
-	// logger.Debug.Printf("Added raw measure %q:%s", k, v.(string))
-	// v, err := strconv.ParseFloat(v.(string), 64)
-	// if err != nil {
-	// 	kb.measures[k] = v.(string)
-	// } else {
-	// 	kb.measures[k] = v
-	// }
 }
 
+// AddMeasure adds the value of a Waggle message as a measure of the message name
 func (kb *KnowledgeBase) AddMeasure(v *datatype.WaggleMessage) {
+	if err := kb.evaluator.AddMeasure(v.Name, v.Value, time.Unix(0, v.Timestamp)); err != nil {
+		logger.Error.Printf("Failed to add measure %q: %s", v.Name, err.Error())
+	}
+}
 
+// SubscribeMeasures feeds messages of the node data stream published on the bus to the rule evaluator
+// until ctx is done. Nothing is subscribed if rules are evaluated by the science rule checker
+// as the checker reads the data stream by itself
+func (kb *KnowledgeBase) SubscribeMeasures(ctx context.Context, bus interfacing.EventBus) error {
+	if _, native := kb.evaluator.(*nativeRuleEvaluator); !native {
+		return nil
+	}
+	messages := make(chan *datatype.WaggleMessage, 100)
+	if err := bus.Subscribe(measureTopicPattern, messages); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message := <-messages:
+				kb.AddMeasure(message)
+			}
+		}
+	}()
+	return nil
 }
 
-func (kb *KnowledgeBase) EvaluateRule(rule string) (string, error) {
+// EvaluateRule returns the plugin name of the rule of the goal if its condition is true.
+// It returns an empty string if the condition is false
+func (kb *KnowledgeBase) EvaluateRule(goalID string, rule string) (string, error) {
 	condition, result, err := parseRule(rule)
 	if err != nil {
 		return "", fmt.Errorf("Failed to parse rule")
 	}
-	r := interfacing.NewHTTPRequest(kb.ruleCheckerURI)
-	data, _ := json.Marshal(map[string]interface{}{
-		"rule": condition,
-	})
-	resp, err := r.RequestPost("evaluate", data)
+	v, err := kb.evaluator.Evaluate(goalID, condition)
 	if err != nil {
-		return "", fmt.Errorf("Failed to get data from checker: %s", err.Error())
+		return "", err
 	}
-	body, err := r.ParseJSONHTTPResponse(resp)
-	if err != nil {
-		return "", fmt.Errorf("Failed to parse response: %s", err.Error())
-	}
-	if r, exists := body["response"]; exists {
-		if r.(string) == "failed" {
-			return "", fmt.Errorf("Failed to evaluate rule: %s", body["error"])
-		}
-	}
-	if v, exists := body["result"]; exists {
-		if v.(bool) == true {
-			return result, nil
-		} else {
-			return "", nil
-		}
-	} else {
-		return "", fmt.Errorf("Response does not contain result: %v", body)
+	if v {
+		return result, nil
 	}
-	// if parser.Evaluate(condition, kb.measures) {
-	// 	return result, nil
-	// } else {
-	// 	return "", nil
-	// }
+	return "", nil
 }
 
 func (kb *KnowledgeBase) EvaluateGoal(goalID string) (results []string, err error) {
 	if rules, exist := kb.rules[goalID]; exist {
 		for _, rule := range rules {
-			if result, err := kb.EvaluateRule(rule); err != nil {
-				logger.Error.Printf("Failed to evaluate rule %q: %s", rule, err.Error())
+			if result, err := kb.EvaluateRule(goalID, rule); err != nil {
+				// measures that are not published yet are not an error of the rule
+				if errors.Is(err, sciencerule.ErrNoMeasure) {
+					logger.Debug.Printf("Rule %q is not evaluated: %s", rule, err.Error())
+				} else {
+					logger.Error.Printf("Failed to evaluate rule %q: %s", rule, err.Error())
+				}
 			} else if result != "" {
 				results = append(results, result)
 			}
@@ -151,7 +152,7 @@ func duration() time.Duration {
 }
 
 func parseRule(r string) (condition string, result string, err error) {
-	sp := strings.Split(r, ":")
+	sp := strings.SplitN(r, ":", 2)
 	if len(sp) == 2 {
 		return strings.TrimSpace(sp[1]), strings.TrimSpace(sp[0]), nil
 	}
@@ -1,6 +1,14 @@
 package nodescheduler
 
-import "testing"
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
 
 func TestKnowledgeBaseEvaluate(t *testing.T) {
 	// NOTE(sean) I noticed that this test seems to be missing something during setup and
@@ -43,7 +51,7 @@ func TestKnowledgeBaseEvaluate(t *testing.T) {
 			kb := NewKnowledgeBase("W000", "")
 			kb.AddRawMeasure(tc.Input.K, tc.Input.V)
 			for _, r := range tc.Rule {
-				result, err := kb.EvaluateRule(r)
+				result, err := kb.EvaluateRule("", r)
 				if err != nil {
 					t.Fatal(err.Error())
 				} else {
@@ -56,3 +64,95 @@ func TestKnowledgeBaseEvaluate(t *testing.T) {
 		})
 	}
 }
+
+func TestKnowledgeBaseEvaluateGoal(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 3, 0, 0, time.UTC)
+	tests := map[string]struct {
+		Rules    []string
+		Measures map[string]interface{}
+		// Wants are plugins promoted at each evaluation
+		Wants [][]string
+	}{
+		"always": {
+			Rules: []string{"a: True", "b: False"},
+			Wants: [][]string{{"a"}, {"a"}},
+		},
+		"measure": {
+			Rules:    []string{"a: v('env.raingauge.uint') > 3", "b: v('env.raingauge.uint') > 10"},
+			Measures: map[string]interface{}{"env.raingauge.uint": 5.},
+			Wants:    [][]string{{"a"}},
+		},
+		"noMeasure": {
+			Rules: []string{"a: v('env.none') > 3", "b: True"},
+			Wants: [][]string{{"b"}},
+		},
+		"invalidRule": {
+			Rules: []string{"a: v(", "b", "c: True"},
+			Wants: [][]string{{"c"}},
+		},
+		"cronjob": {
+			// evaluated at 12:03 and 12:10
+			Rules: []string{"a: cronjob('a', '*/10 * * * *')"},
+			Wants: [][]string{nil, {"a"}},
+		},
+		"event": {
+			Rules:    []string{"a: e('env.event.traffic')"},
+			Measures: map[string]interface{}{"env.event.traffic": true},
+			Wants:    [][]string{{"a"}, nil},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			kb := NewKnowledgeBase("W000", "")
+			evaluator := kb.evaluator.(*nativeRuleEvaluator)
+			now := start
+			evaluator.now = func() time.Time { return now }
+			goal := datatype.NewScienceGoalBuilderWithID("test", "1", "goal").
+				AddSubGoal("W000", nil, test.Rules).
+				Build()
+			kb.AddRulesFromScienceGoal(goal)
+			for k, v := range test.Measures {
+				kb.AddMeasure(datatype.NewMessage(k, v, start.UnixNano(), nil))
+			}
+			for i, want := range test.Wants {
+				now = start.Add(time.Duration(i) * 7 * time.Minute)
+				got, err := kb.EvaluateGoal(goal.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if strings.Join(got, ",") != strings.Join(want, ",") {
+					t.Errorf("Wrong plugins at evaluation %d: expected %v, but %v", i, want, got)
+				}
+			}
+			kb.DropRules(goal.ID)
+			if _, err := kb.EvaluateGoal(goal.ID); err == nil {
+				t.Errorf("Evaluating dropped rules must fail")
+			}
+		})
+	}
+}
+
+func TestKnowledgeBaseSubscribeMeasures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := interfacing.NewMemoryEventBus()
+	defer bus.Close(context.Background())
+	kb := NewKnowledgeBase("W000", "")
+	if err := kb.SubscribeMeasures(ctx, bus); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Publish(datatype.NewMessage("env.raingauge.uint", 5., time.Now().UnixNano(), nil), "node"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		result, err := kb.EvaluateRule("goal", "a: v('env.raingauge.uint') > 3")
+		if err == nil && result == "a" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Measure from the data stream was not evaluated: %q %v", result, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
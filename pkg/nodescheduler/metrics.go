@@ -0,0 +1,51 @@
+package nodescheduler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
+
+// Metrics holds Prometheus metrics of the node scheduler
+type Metrics struct {
+	registry *prometheus.Registry
+	outbox   *interfacing.Outbox
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "scheduler_outbox_backlog",
+			Help: "Number of events waiting in the outbox to be delivered",
+		}, func() float64 {
+			if m.outbox == nil {
+				return 0
+			}
+			return float64(m.outbox.Backlog())
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "scheduler_outbox_dropped_total",
+			Help: "Number of events dropped from the outbox because it was full or they expired",
+		}, func() float64 {
+			if m.outbox == nil {
+				return 0
+			}
+			return float64(m.outbox.Dropped())
+		}),
+	)
+	return m
+}
+
+// SetOutbox sets the outbox whose backlog is reported
+func (m *Metrics) SetOutbox(outbox *interfacing.Outbox) {
+	m.outbox = outbox
+}
+
+// RegisterNotifiers reports dropped and buffered events of the notifiers by name
+func (m *Metrics) RegisterNotifiers(notifiers map[string]*interfacing.Notifier) {
+	m.registry.MustRegister(interfacing.NewNotifierCollector(notifiers))
+}
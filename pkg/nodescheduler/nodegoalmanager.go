@@ -1,6 +1,8 @@
 package nodescheduler
 
 import (
+	"context"
+	"crypto/ed25519"
 	"fmt"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
@@ -16,8 +18,11 @@ type NodeGoalManager struct {
 	Notifier      *interfacing.Notifier
 	Simulate      bool
 	chanGoalQueue chan *datatype.ScienceGoal
-	rmqHandler    *interfacing.RabbitMQHandler
+	eventBus      interfacing.EventBus
 	GoalWatcher   watch.Interface
+	// GoalVerificationKey verifies signatures of goals if set.
+	// Goals without a valid signature are rejected
+	GoalVerificationKey ed25519.PublicKey
 }
 
 // GetScienceGoalByID returns the goal of given goal name
@@ -38,9 +43,9 @@ func (ngm *NodeGoalManager) GetScienceGoalByName(goalName string) (*datatype.Sci
 	return nil, fmt.Errorf("The goal Name %s does not exist", goalName)
 }
 
-// SetRMQHandler sets a RabbitMQ handler used for transferring goals to edge schedulers
-func (ngm *NodeGoalManager) SetRMQHandler(rmqHandler *interfacing.RabbitMQHandler) {
-	ngm.rmqHandler = rmqHandler
+// SetEventBus sets an event bus used for transferring goals to edge schedulers
+func (ngm *NodeGoalManager) SetEventBus(eventBus interfacing.EventBus) {
+	ngm.eventBus = eventBus
 }
 
 // DropGoal drops given goal from the list
@@ -65,6 +70,20 @@ func (ngm *NodeGoalManager) DropGoal(goalID string) error {
 	}
 }
 
+// VerifyGoals returns an error if goals in the payload are not signed with the verification key.
+// Rejected goals are reported as a failure event. Any goal is accepted if no verification key is set
+func (ngm *NodeGoalManager) VerifyGoals(payload []byte, signature string) error {
+	if ngm.GoalVerificationKey == nil {
+		return nil
+	}
+	if err := datatype.VerifyGoals(ngm.GoalVerificationKey, ngm.NodeID, payload, signature); err != nil {
+		ngm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventFailure).
+			AddReason(fmt.Sprintf("Goals rejected: %s", err.Error())).Build())
+		return err
+	}
+	return nil
+}
+
 func (ngm *NodeGoalManager) AddGoal(goal *datatype.ScienceGoal) {
 	ngm.chanGoalQueue <- goal
 }
@@ -93,9 +112,11 @@ func (ngm *NodeGoalManager) SetGoals(goals [](datatype.ScienceGoal)) {
 
 // RunGoalManager handles goal related events from both cloud and local
 // and keeps goals managed up-to-date with the help from the events
-func (ngm *NodeGoalManager) Run(chanToScheduler chan datatype.Event) {
+func (ngm *NodeGoalManager) Run(ctx context.Context, chanToScheduler chan datatype.Event) {
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case scienceGoal := <-ngm.chanGoalQueue:
 			logger.Debug.Printf("Received a goal %q", scienceGoal.Name)
 			if goal, err := ngm.GetScienceGoalByName(scienceGoal.Name); err == nil {
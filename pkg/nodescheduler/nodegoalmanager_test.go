@@ -0,0 +1,69 @@
+package nodescheduler
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+)
+
+func TestNodeGoalManagerVerifyGoals(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	payload := []byte(`[]`)
+	tests := map[string]struct {
+		Key       ed25519.PublicKey
+		Signature string
+		Accepted  bool
+	}{
+		"nokey": {
+			Accepted: true,
+		},
+		"signed": {
+			Key:       pub,
+			Signature: datatype.SignGoals(key, "W001", payload),
+			Accepted:  true,
+		},
+		"unsigned": {
+			Key: pub,
+		},
+		"othernode": {
+			Key:       pub,
+			Signature: datatype.SignGoals(key, "W002", payload),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ngm := &NodeGoalManager{
+				NodeID:              "w001",
+				Notifier:            interfacing.NewNotifier(),
+				GoalVerificationKey: tc.Key,
+			}
+			ch := make(chan datatype.Event, 1)
+			ngm.Notifier.Subscribe(ch)
+			err := ngm.VerifyGoals(payload, tc.Signature)
+			if tc.Accepted {
+				if err != nil {
+					t.Errorf("Wanted goals accepted, got %s", err.Error())
+				}
+				if len(ch) > 0 {
+					t.Errorf("Wanted no event, got %s", (<-ch).Type)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Wanted goals rejected, got accepted")
+			}
+			select {
+			case event := <-ch:
+				if event.Type != datatype.EventFailure || event.GetReason() == "" {
+					t.Errorf("Wanted a failure event with the reason, got %s %q", event.Type, event.GetReason())
+				}
+			case <-time.After(time.Second):
+				t.Errorf("Wanted a failure event, got none")
+			}
+		})
+	}
+}
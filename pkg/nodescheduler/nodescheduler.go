@@ -1,8 +1,13 @@
 package nodescheduler
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
@@ -13,6 +18,8 @@ import (
 
 const (
 	maxChannelBuffer = 100
+	// gracefulShutdownTimeout is shorter than the default grace period of Kubernetes pods
+	gracefulShutdownTimeout = 20 * time.Second
 )
 
 type NodeScheduler struct {
@@ -24,7 +31,8 @@ type NodeScheduler struct {
 	GoalManager                 *NodeGoalManager
 	APIServer                   *APIServer
 	SchedulingPolicy            policy.SchedulingPolicy
-	LogToBeehive                *interfacing.RabbitMQHandler
+	LogToBeehive                interfacing.EventBus
+	Metrics                     *Metrics
 	chanContextEventToScheduler chan datatype.EventPluginContext
 	chanFromGoalManager         chan datatype.Event
 	chanFromResourceManager     chan datatype.Event
@@ -34,6 +42,11 @@ type NodeScheduler struct {
 	chanPluginToResourceManager chan *datatype.Plugin
 	chanNeedScheduling          chan datatype.Event
 	chanAPIServerToGoalManager  chan *datatype.ScienceGoal
+	slots                       *pluginSlots
+	goalStreamURL               *url.URL
+	goalStreamTLSConfig         *tls.Config
+	// eventBusErr is the error creating the event bus, reported by Configure
+	eventBusErr error
 }
 
 // func NewNodeScheduler(simulate bool) &NodeScheduler {
@@ -61,6 +74,63 @@ type NodeScheduler struct {
 //
 // - "wes-ses-goal" configmap that accepts user goals
 func (ns *NodeScheduler) Configure() (err error) {
+	ns.Metrics.RegisterNotifiers(map[string]*interfacing.Notifier{
+		"goalmanager":     ns.GoalManager.Notifier,
+		"resourcemanager": ns.ResourceManager.Notifier,
+	})
+	if ns.Config.GoalVerificationKeyPath != "" {
+		ns.GoalManager.GoalVerificationKey, err = datatype.LoadGoalVerificationKey(ns.Config.GoalVerificationKeyPath)
+		if err != nil {
+			return
+		}
+		logger.Info.Printf("Goals are accepted only if signed by the key %s", ns.Config.GoalVerificationKeyPath)
+	}
+	if r := ns.Config.ResourceLimitRatio; r != 0 && r < 1 {
+		return fmt.Errorf("Resource limit ratio %g must be 0 or at least 1", r)
+	}
+	if ns.Config.FairShareHalfLife < 0 {
+		return fmt.Errorf("Fair-share half life %d must not be negative", ns.Config.FairShareHalfLife)
+	}
+	if ns.Config.SchedulingPolicy == "" {
+		ns.Config.SchedulingPolicy = "default"
+	}
+	// The policy is created only here so that an unknown policy fails rather than falls back to another
+	ns.SchedulingPolicy, err = policy.NewSchedulingPolicy(ns.Config.SchedulingPolicy, ns.Config.policyConfig())
+	if err != nil {
+		return
+	}
+	if err = ns.Config.ConcurrencyLimits.Validate(); err != nil {
+		return
+	}
+	switch ns.Config.KnobInjection {
+	case "", KnobInjectionEnv, KnobInjectionArgs:
+	default:
+		return fmt.Errorf("Unknown knob injection %q: must be %q or %q", ns.Config.KnobInjection, KnobInjectionEnv, KnobInjectionArgs)
+	}
+	switch ns.Config.EventBus {
+	case "", "rabbitmq", "mqtt":
+	default:
+		return fmt.Errorf("Unknown event bus %q: must be \"rabbitmq\" or \"mqtt\"", ns.Config.EventBus)
+	}
+	if ns.eventBusErr != nil {
+		return ns.eventBusErr
+	}
+	if ns.Config.OutboxPath != "" && !ns.Config.NoRabbitMQ {
+		if err := os.MkdirAll(filepath.Dir(ns.Config.OutboxPath), 0755); err != nil {
+			return fmt.Errorf("Failed to create directory of the outbox %s: %s", ns.Config.OutboxPath, err.Error())
+		}
+		outbox, err := interfacing.NewOutbox(
+			ns.Config.OutboxPath,
+			ns.LogToBeehive,
+			ns.Config.OutboxMaxEvents,
+			time.Duration(ns.Config.OutboxMaxAge)*time.Second)
+		if err != nil {
+			return err
+		}
+		logger.Info.Printf("Events are kept in the outbox %s until delivered", ns.Config.OutboxPath)
+		ns.LogToBeehive = outbox
+		ns.Metrics.SetOutbox(outbox)
+	}
 	if ns.Config.Simulate {
 		return
 	}
@@ -74,27 +144,57 @@ func (ns *NodeScheduler) Configure() (err error) {
 	}
 	if ns.Config.GoalStreamURL != "" {
 		logger.Info.Printf("Subscribing goal downstream from %s", ns.Config.GoalStreamURL)
-		u, err := url.Parse(ns.Config.GoalStreamURL)
+		// The subscription starts when the scheduler runs
+		ns.goalStreamURL, err = url.Parse(ns.Config.GoalStreamURL)
 		if err != nil {
 			return err
 		}
-		s := interfacing.NewHTTPRequest(u.Scheme + "://" + u.Host)
-		s.Subscribe(u.Path, ns.chanFromCloudScheduler, true)
+		if ns.goalStreamURL.Scheme == "https" {
+			ns.goalStreamTLSConfig, err = interfacing.NewClientTLSConfig(ns.Config.GoalStreamCACertPath, ns.Config.GoalStreamCertPath, ns.Config.GoalStreamKeyPath)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return
 }
 
-// Run handles communications between components for scheduling
-func (ns *NodeScheduler) Run() {
-	go ns.GoalManager.Run(ns.chanFromGoalManager)
+// Run handles communications between components for scheduling until ctx is done
+// and then shuts down the scheduler. It returns an error if the API server fails
+// or the shutdown does not go cleanly.
+func (ns *NodeScheduler) Run(ctx context.Context) error {
+	go ns.GoalManager.Run(ctx, ns.chanFromGoalManager)
 	// go ns.Knowledgebase.Run()
-	go ns.ResourceManager.Run(ns.chanPluginToResourceManager)
-	go ns.APIServer.Run()
+	if ns.LogToBeehive != nil {
+		if err := ns.Knowledgebase.SubscribeMeasures(ctx, ns.LogToBeehive); err != nil {
+			logger.Error.Printf("Failed to subscribe measures for science rules: %s", err.Error())
+		}
+	}
+	go ns.ResourceManager.Run(ctx, ns.chanPluginToResourceManager)
+	ns.APIServer.ConfigureAPIs(ns.Metrics.registry)
+	chanAPIServerError := make(chan error, 1)
+	go func() {
+		chanAPIServerError <- ns.APIServer.Run()
+	}()
+	if ns.goalStreamURL != nil {
+		s := interfacing.NewHTTPRequestWithTLS(ns.goalStreamURL.Scheme+"://"+ns.goalStreamURL.Host, ns.goalStreamTLSConfig)
+		s.Subscribe(ctx, ns.goalStreamURL.Path, ns.chanFromCloudScheduler, true)
+	}
 
 	// TODO: We generate a 30-second timer to (re)-evaluate given science rules
 	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			logger.Info.Printf("Node scheduler %s is shutting down...", ns.NodeID)
+			return ns.shutdown()
+		case err := <-chanAPIServerError:
+			logger.Error.Printf("API server stopped unexpectedly: %v", err)
+			if shutdownErr := ns.shutdown(); shutdownErr != nil {
+				logger.Error.Printf("%s", shutdownErr.Error())
+			}
+			return fmt.Errorf("API server stopped: %v", err)
 		case <-ticker.C:
 			logger.Debug.Print("Rule evaluation triggered")
 			triggerScheduling := false
@@ -152,11 +252,14 @@ func (ns *NodeScheduler) Run() {
 				} else {
 					ns.Knowledgebase.AddRulesFromScienceGoal(sg)
 					ns.chanNeedScheduling <- event
-					go ns.LogToBeehive.SendWaggleMessage(event.ToWaggleMessage(), "all")
+					ns.publishToBeehive(event.ToWaggleMessage(), "all")
 				}
 			case datatype.EventGoalStatusRemoved:
 				// TODO: Clean up plugins associated to the goal
-				go ns.LogToBeehive.SendWaggleMessage(event.ToWaggleMessage(), "all")
+				ns.Knowledgebase.DropRules(event.GetGoalID())
+				ns.publishToBeehive(event.ToWaggleMessage(), "all")
+			case datatype.EventFailure:
+				ns.publishToBeehive(event.ToWaggleMessage(), "all")
 			}
 		case event := <-ns.chanFromResourceManager:
 			logger.Debug.Printf("%s", event.ToString())
@@ -169,7 +272,7 @@ func (ns *NodeScheduler) Run() {
 					pluginName := event.GetPluginName()
 					plugin := scienceGoal.GetMySubGoal(ns.NodeID).GetPlugin(pluginName)
 					if plugin != nil {
-						go ns.LogToBeehive.SendWaggleMessage(event.ToWaggleMessage(), "all")
+						ns.publishToBeehive(event.ToWaggleMessage(), "all")
 					}
 				}
 			case datatype.EventPluginStatusComplete:
@@ -185,7 +288,7 @@ func (ns *NodeScheduler) Run() {
 					event.Timestamp,
 					map[string]string{},
 				)
-				go ns.LogToBeehive.SendWaggleMessage(message, "node")
+				ns.publishToBeehive(message, "node")
 				fallthrough
 			case datatype.EventPluginStatusFailed:
 				scienceGoal, err := ns.GoalManager.GetScienceGoalByID(event.GetGoalID())
@@ -195,25 +298,37 @@ func (ns *NodeScheduler) Run() {
 					pluginName := event.GetPluginName()
 					plugin := scienceGoal.GetMySubGoal(ns.NodeID).GetPlugin(pluginName)
 					if plugin != nil {
+						ns.recordRuntime(scienceGoal, plugin)
 						plugin.UpdatePluginSchedulingStatus(datatype.Waiting)
-						go ns.LogToBeehive.SendWaggleMessage(event.ToWaggleMessage(), "all")
+						ns.publishToBeehive(event.ToWaggleMessage(), "all")
+					}
+				}
+				ns.chanNeedScheduling <- event
+			case datatype.EventPluginStatusPreempted:
+				scienceGoal, err := ns.GoalManager.GetScienceGoalByID(event.GetGoalID())
+				if err != nil {
+					logger.Error.Printf("Could not get goal to update plugin status: %q", err.Error())
+				} else {
+					pluginName := event.GetPluginName()
+					plugin := scienceGoal.GetMySubGoal(ns.NodeID).GetPlugin(pluginName)
+					if plugin != nil {
+						// Preempted plugins wait for resource to run again
+						if plugin.Status.SchedulingStatus == datatype.Running {
+							ns.recordRuntime(scienceGoal, plugin)
+							plugin.UpdatePluginSchedulingStatus(datatype.Ready)
+						}
+						ns.publishToBeehive(event.ToWaggleMessage(), "all")
 					}
 				}
 				ns.chanNeedScheduling <- event
 			case datatype.EventFailure:
 				logger.Debug.Printf("Error reported from resource manager: %q", event.GetReason())
-				go ns.LogToBeehive.SendWaggleMessage(event.ToWaggleMessage(), "all")
+				ns.publishToBeehive(event.ToWaggleMessage(), "all")
 				ns.chanNeedScheduling <- event
 			case datatype.EventGoalStatusReceivedBulk:
 				logger.Debug.Printf("A bulk goal is received")
-				ns.ResourceManager.CleanUp()
-				data := event.GetEntry("goals")
-				var goals []datatype.ScienceGoal
-				err := json.Unmarshal([]byte(data), &goals)
-				if err != nil {
-					logger.Error.Printf("Failed to load bulk goals %q", err.Error())
-				} else {
-					ns.GoalManager.SetGoals(goals)
+				if err := ns.loadBulkGoals(event); err != nil {
+					logger.Error.Printf("Rejected bulk goals: %s", err.Error())
 				}
 			}
 			// case scheduledScienceGoal := <-ns.chanRunGoal:
@@ -250,10 +365,14 @@ func (ns *NodeScheduler) Run() {
 			// 	}
 		case event := <-ns.chanFromCloudScheduler:
 			logger.Debug.Printf("%s", event.ToString())
-			goals := event.GetEntry("goals")
+			data := map[string]string{"goals": event.GetEntry("goals")}
+			// The signature is verified when goals are loaded from the configmap
+			if signature := event.GetEntry("signature"); signature != "" {
+				data["signature"] = signature
+			}
 			err := ns.ResourceManager.CreateConfigMap(
 				configMapNameForGoals,
-				map[string]string{"goals": goals},
+				data,
 				"default",
 				true,
 			)
@@ -270,34 +389,194 @@ func (ns *NodeScheduler) Run() {
 			// 	events := ns.SchedulingPolicy.SimpleScheduler.PromotePlugins(subGoal)
 			// 	for _, e := range events {
 			// 		logger.Debug.Printf("%s: %q", e.ToString(), e.GetPluginName())
-			// 		go ns.LogToBeehive.SendWaggleMessage(e.ToWaggleMessage(), "all")
+			// 		ns.publishToBeehive(e.ToWaggleMessage(), "all")
 			// 	}
 			// }
 			// Select the best task
+			cluster, err := ns.ResourceManager.getClusterResource()
+			if err != nil {
+				logger.Error.Printf("Failed to get available resource. Skipping scheduling: %s", err.Error())
+				continue
+			}
+			availableResource := cluster.total()
+			logger.Debug.Printf("Available resource: %s", availableResource.String())
+			var preempted []*datatype.Plugin
+			if preemptive, ok := ns.SchedulingPolicy.(policy.PreemptiveSchedulingPolicy); ok {
+				preempted = ns.preemptPlugins(preemptive, cluster)
+			}
 			plugins, err := ns.SchedulingPolicy.SelectBestPlugins(
 				ns.GoalManager.ScienceGoals,
-				datatype.Resource{
-					CPU:       "999000m",
-					Memory:    "999999Gi",
-					GPUMemory: "999999Gi",
-				},
+				cluster.total(),
 				ns.GoalManager.NodeID,
 			)
 			if err != nil {
 				logger.Error.Printf("Failed to get the best task to run %q", err.Error())
 			} else {
-				for _, plugin := range plugins {
-					// if ns.ResourceManager.WillItFit(plugin) {
-					e := datatype.NewEventBuilder(datatype.EventPluginStatusScheduled).AddReason("Fits to resource").AddPluginMeta(plugin).Build()
+				// The policy sees resource of the whole cluster. Plugins that fit on no node wait
+				plugins, unfitted := cluster.fit(plugins)
+				for _, plugin := range unfitted {
+					plugin.Status.Reason = "No node has enough resource"
+					logger.Debug.Printf("Plugin %q fits on no node", plugin.Name)
+				}
+				// Plugins being preempted give their slots to the plugins preempting them
+				running := excludePlugins(ns.runningPlugins(), preempted)
+				allocation := ns.slots.allocate(plugins, running, time.Now())
+				// Plugins moving in the queue are announced again with their new position
+				for _, q := range append(allocation.Queued, allocation.Moved...) {
+					e := datatype.NewEventBuilder(datatype.EventPluginStatusQueued).AddReason(q.reason).AddPluginMeta(q.plugin).AddQueueMeta(ns.slots.position(q.plugin), 0).Build()
 					logger.Debug.Printf("%s: %q (%q)", e.ToString(), e.GetPluginName(), e.GetReason())
-					go ns.LogToBeehive.SendWaggleMessage(e.ToWaggleMessage(), "all")
+					ns.publishToBeehive(e.ToWaggleMessage(), "all")
+				}
+				for _, admitted := range allocation.Admitted {
+					plugin := admitted.plugin
+					e := datatype.NewEventBuilder(datatype.EventPluginStatusScheduled).AddReason("Fits to resource").AddPluginMeta(plugin).AddQueueMeta(0, admitted.waited).Build()
+					logger.Debug.Printf("%s: %q (%q)", e.ToString(), e.GetPluginName(), e.GetReason())
+					ns.publishToBeehive(e.ToWaggleMessage(), "all")
 					plugin.UpdatePluginSchedulingStatus(datatype.Running)
+					if err := ns.ResourceManager.AssignJob(plugin); err != nil {
+						logger.Error.Printf("Failed to name Kubernetes Job for %q: %s", plugin.Name, err.Error())
+					}
 					go ns.ResourceManager.LaunchAndWatchPlugin(plugin)
-					// } else {
-					// 	logger.Debug.Printf("Resource is not availble for plugin %q", plugin.Name)
-					// }
 				}
 			}
 		}
 	}
 }
+
+// loadBulkGoals replaces goals of the node with the goals given in the event.
+// Plugins of the existing goals are terminated only after the new goals are verified
+// so that a forged or unsigned configmap does not stop plugins running
+func (ns *NodeScheduler) loadBulkGoals(event datatype.Event) error {
+	data := event.GetEntry("goals")
+	if err := ns.GoalManager.VerifyGoals([]byte(data), event.GetEntry("signature")); err != nil {
+		return err
+	}
+	var goals []datatype.ScienceGoal
+	if err := json.Unmarshal([]byte(data), &goals); err != nil {
+		return fmt.Errorf("Failed to load bulk goals: %s", err.Error())
+	}
+	ns.ResourceManager.CleanUp()
+	ns.GoalManager.SetGoals(goals)
+	return nil
+}
+
+// preemptPlugins stops running plugins the policy selects to preempt and returns the
+// plugins being preempted. Resource the plugins take is given back to the cluster resource
+func (ns *NodeScheduler) preemptPlugins(preemptive policy.PreemptiveSchedulingPolicy, cluster *clusterResource) []*datatype.Plugin {
+	preemptions, err := preemptive.SelectPluginsToPreempt(
+		ns.GoalManager.ScienceGoals,
+		cluster.total(),
+		ns.GoalManager.NodeID,
+	)
+	if err != nil {
+		logger.Error.Printf("Failed to select plugins to preempt %q", err.Error())
+		return nil
+	}
+	var preempted []*datatype.Plugin
+	for _, preemption := range preemptions {
+		reason := fmt.Sprintf("Preempted by %q of priority %d", preemption.PreemptedBy.Name, preemption.PreemptedBy.GetPriority())
+		if err := ns.ResourceManager.PreemptPlugin(preemption.Plugin, reason); err != nil {
+			logger.Error.Printf("Failed to preempt plugin %q: %s", preemption.Plugin.Name, err.Error())
+			continue
+		}
+		logger.Info.Printf("Plugin %q is being preempted: %s", preemption.Plugin.Name, reason)
+		cluster.release(preemption.Plugin)
+		preempted = append(preempted, preemption.Plugin)
+	}
+	return preempted
+}
+
+// excludePlugins returns the plugins except the excluded ones
+func excludePlugins(plugins []*datatype.Plugin, excluded []*datatype.Plugin) (remaining []*datatype.Plugin) {
+	for _, plugin := range plugins {
+		found := false
+		for _, e := range excluded {
+			if plugin == e {
+				found = true
+				break
+			}
+		}
+		if !found {
+			remaining = append(remaining, plugin)
+		}
+	}
+	return
+}
+
+// runningPlugins returns plugins running on the node
+func (ns *NodeScheduler) runningPlugins() (plugins []*datatype.Plugin) {
+	for _, goal := range ns.GoalManager.ScienceGoals {
+		subGoal := goal.GetMySubGoal(ns.NodeID)
+		if subGoal == nil {
+			continue
+		}
+		for _, plugin := range subGoal.Plugins {
+			if plugin.Status.SchedulingStatus == datatype.Running {
+				plugins = append(plugins, plugin)
+			}
+		}
+	}
+	return
+}
+
+// recordRuntime accounts the runtime of the plugin that stopped running if the policy keeps track of it
+func (ns *NodeScheduler) recordRuntime(scienceGoal *datatype.ScienceGoal, plugin *datatype.Plugin) {
+	accounting, ok := ns.SchedulingPolicy.(policy.AccountingSchedulingPolicy)
+	if !ok || plugin.Status.SchedulingStatus != datatype.Running {
+		return
+	}
+	accounting.RecordRuntime(scienceGoal, plugin, time.Since(plugin.Status.Since))
+}
+
+// publishToBeehive publishes the message to Beehive. Messages are written to the outbox
+// in order if it is configured. Otherwise, they are sent in background
+func (ns *NodeScheduler) publishToBeehive(message *datatype.WaggleMessage, scope string) {
+	if message == nil {
+		return
+	}
+	publish := func() {
+		if err := ns.LogToBeehive.Publish(message, scope); err != nil {
+			logger.Error.Printf("Failed to publish %q: %s", message.Name, err.Error())
+		}
+	}
+	if _, durable := ns.LogToBeehive.(*interfacing.Outbox); durable {
+		publish()
+	} else {
+		go publish()
+	}
+}
+
+// shutdown stops the node scheduler within gracefulShutdownTimeout.
+// Running plugins are left running by default; they run to completion as
+// Kubernetes jobs and the next scheduler cleans up whatever is left when it
+// receives goals. They are terminated if TerminatePluginsOnShutdown is set.
+// Pending messages to Beehive are flushed last so that plugin events are not lost.
+// Messages not delivered by then stay in the outbox if configured.
+func (ns *NodeScheduler) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), gracefulShutdownTimeout)
+	defer cancel()
+	var errorList []error
+	if err := ns.APIServer.Shutdown(ctx); err != nil {
+		errorList = append(errorList, fmt.Errorf("Failed to shut down API server: %s", err.Error()))
+	}
+	switch {
+	case ns.Config.Simulate:
+	case ns.Config.TerminatePluginsOnShutdown:
+		logger.Info.Println("Terminating running plugins...")
+		if err := ns.ResourceManager.CleanUp(); err != nil {
+			errorList = append(errorList, fmt.Errorf("Failed to terminate plugins: %s", err.Error()))
+		}
+	default:
+		logger.Info.Println("Leaving running plugins to run to completion")
+	}
+	if ns.LogToBeehive != nil {
+		if err := ns.LogToBeehive.Close(ctx); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	if len(errorList) > 0 {
+		return fmt.Errorf("Node scheduler %s did not shut down cleanly: %v", ns.NodeID, errorList)
+	}
+	logger.Info.Printf("Node scheduler %s stopped", ns.NodeID)
+	return nil
+}
@@ -0,0 +1,160 @@
+package nodescheduler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"path"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/nodescheduler/policy"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestLoadBulkGoalsKeepsPluginsOnRejection(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	payload := `[]`
+	tests := map[string]struct {
+		Signature string
+		Accepted  bool
+	}{
+		"signed": {
+			Signature: datatype.SignGoals(key, "W001", []byte(payload)),
+			Accepted:  true,
+		},
+		"unsigned": {},
+		"badlysigned": {
+			Signature: datatype.SignGoals(key, "W002", []byte(payload)),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			labels := map[string]string{"app": "sampler"}
+			clientset := fake.NewSimpleClientset(
+				&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: "sampler", Namespace: "ses"},
+					Spec:       batchv1.JobSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+				},
+				&apiv1.Pod{
+					ObjectMeta: metav1.ObjectMeta{Name: "sampler-abcde", Namespace: "ses", Labels: labels},
+					Status:     apiv1.PodStatus{Phase: apiv1.PodRunning},
+				},
+			)
+			ns := &NodeScheduler{
+				ResourceManager: &ResourceManager{
+					Namespace: "ses",
+					Clientset: clientset,
+				},
+				GoalManager: &NodeGoalManager{
+					NodeID:              "w001",
+					Notifier:            interfacing.NewNotifier(),
+					GoalVerificationKey: pub,
+				},
+			}
+			event := datatype.NewEventBuilder(datatype.EventGoalStatusReceivedBulk).
+				AddEntry("goals", payload).
+				AddEntry("signature", tc.Signature).Build()
+			err := ns.loadBulkGoals(event)
+			if tc.Accepted && err != nil {
+				t.Fatalf("Wanted goals accepted, got %s", err.Error())
+			}
+			if !tc.Accepted && err == nil {
+				t.Fatal("Wanted goals rejected, got accepted")
+			}
+			jobs, err := clientset.BatchV1().Jobs("ses").List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if running := len(jobs.Items) > 0; running == tc.Accepted {
+				t.Errorf("Wrong plugin state: running %t after goals accepted %t", running, tc.Accepted)
+			}
+		})
+	}
+}
+
+func TestConfigureEventBus(t *testing.T) {
+	tests := map[string]struct {
+		NoRabbitMQ bool
+		EventBus   string
+		MQTTCACert string
+		WantErr    bool
+	}{
+		"inprocess": {NoRabbitMQ: true},
+		"default":   {},
+		"rabbitmq":  {EventBus: "rabbitmq"},
+		"mqtt":      {EventBus: "mqtt"},
+		"unknown":   {EventBus: "kafka", WantErr: true},
+		"mqttbadcacert": {
+			EventBus:   "mqtt",
+			MQTTCACert: path.Join(t.TempDir(), "missing.crt"),
+			WantErr:    true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{
+				Name:           "W001",
+				Simulate:       true,
+				NoRabbitMQ:     test.NoRabbitMQ,
+				EventBus:       test.EventBus,
+				MQTTBrokerURI:  "tcp://localhost:1883",
+				MQTTCaCertPath: test.MQTTCACert,
+			}).
+				AddGoalManager("test").
+				AddResourceManager().
+				AddLoggerToBeehive("test").
+				Build()
+			err := ns.Configure()
+			if (err != nil) != test.WantErr {
+				t.Fatalf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+			if !test.WantErr && ns.LogToBeehive == nil {
+				t.Errorf("Event bus must be set")
+			}
+		})
+	}
+}
+
+func TestConfigureSchedulingPolicy(t *testing.T) {
+	tests := map[string]struct {
+		Policy  string
+		WantErr bool
+	}{
+		"default":   {Policy: "default"},
+		"empty":     {Policy: ""},
+		"fairshare": {Policy: "fairshare"},
+		"unknown":   {Policy: "fastest", WantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			ns := NewNodeSchedulerBuilder(&NodeSchedulerConfig{
+				Name:             "W001",
+				SchedulingPolicy: test.Policy,
+				Simulate:         true,
+				NoRabbitMQ:       true,
+			}).
+				AddGoalManager("test").
+				AddResourceManager().
+				Build()
+			err := ns.Configure()
+			if (err != nil) != test.WantErr {
+				t.Fatalf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+			if test.WantErr {
+				if ns.SchedulingPolicy != nil {
+					t.Errorf("Unknown policy must not fall back to %T", ns.SchedulingPolicy)
+				}
+				return
+			}
+			_, accounting := ns.SchedulingPolicy.(policy.AccountingSchedulingPolicy)
+			if accounting != (test.Policy == "fairshare") {
+				t.Errorf("Wrong policy %T for %q", ns.SchedulingPolicy, test.Policy)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package policy
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 )
 
@@ -8,42 +11,94 @@ type SchedulingPolicy interface {
 	SelectBestPlugins(map[string]*datatype.ScienceGoal, datatype.Resource, string) ([]*datatype.Plugin, error)
 }
 
-func GetSchedulingPolicyByName(policyName string) SchedulingPolicy {
-	switch policyName {
-	case "default":
-		return NewSimpleSchedulingPolicy()
-	case "roundrobin":
-		return NewRoundRobinSchedulingPolicy()
-	default:
-		return NewSimpleSchedulingPolicy()
+// PreemptiveSchedulingPolicy is a scheduling policy that stops running plugins
+// to make room for plugins that need to run first
+type PreemptiveSchedulingPolicy interface {
+	SchedulingPolicy
+	// SelectPluginsToPreempt returns running plugins to stop. The scheduler stops them
+	// and gives their resource back before it calls SelectBestPlugins
+	SelectPluginsToPreempt(map[string]*datatype.ScienceGoal, datatype.Resource, string) ([]Preemption, error)
+}
+
+// Preemption structs a running plugin to stop for another plugin
+type Preemption struct {
+	Plugin      *datatype.Plugin
+	PreemptedBy *datatype.Plugin
+}
+
+// Config configures scheduling policies
+type Config struct {
+	// ProfilePreference lists names of plugin profiles in the order of preference.
+	// Names may have wildcards, for example, "*_cuda". Profiles not listed are
+	// preferred less in the order given to the plugin
+	ProfilePreference []string
+	// FairShareHalfLife is the time it takes for runtime consumed by plugins to count half
+	// in the fair-share policy. DefaultFairShareHalfLife is used if not given
+	FairShareHalfLife time.Duration
+	// Pipeline composes the "pipeline" policy
+	Pipeline PipelineConfig
+}
+
+// SchedulingPolicyFactory creates a scheduling policy with the config
+type SchedulingPolicyFactory func(config Config) (SchedulingPolicy, error)
+
+var schedulingPolicies = map[string]SchedulingPolicyFactory{
+	"default": func(config Config) (SchedulingPolicy, error) {
+		return NewSimpleSchedulingPolicy(config), nil
+	},
+	"roundrobin": func(config Config) (SchedulingPolicy, error) {
+		return NewRoundRobinSchedulingPolicy(config), nil
+	},
+	"priority": func(config Config) (SchedulingPolicy, error) {
+		return NewPrioritySchedulingPolicy(config), nil
+	},
+	"fairshare": func(config Config) (SchedulingPolicy, error) {
+		return NewFairShareSchedulingPolicy(config), nil
+	},
+	"pipeline": func(config Config) (SchedulingPolicy, error) {
+		return NewPipelineSchedulingPolicy(config)
+	},
+}
+
+// RegisterSchedulingPolicy makes a scheduling policy available by the name
+func RegisterSchedulingPolicy(name string, factory SchedulingPolicyFactory) {
+	schedulingPolicies[name] = factory
+}
+
+// NewSchedulingPolicy returns the scheduling policy of the name. It returns an error
+// if no policy has the name or the policy cannot be created with the config
+func NewSchedulingPolicy(policyName string, config Config) (SchedulingPolicy, error) {
+	factory, exist := schedulingPolicies[policyName]
+	if !exist {
+		return nil, fmt.Errorf("No scheduling policy %q", policyName)
 	}
+	return factory(config)
 }
 
+// mustPipeline returns the pipeline of built-in stages. It panics if a stage cannot be created
+// as built-in policies are fixed compositions of built-in stages
+func mustPipeline(config Config, pipeline PipelineConfig) *PipelineSchedulingPolicy {
+	config.Pipeline = pipeline
+	ps, err := NewPipelineSchedulingPolicy(config)
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+// SimpleSchedulingPolicy is DefaultPipeline
 type SimpleSchedulingPolicy struct {
+	pipeline *PipelineSchedulingPolicy
 }
 
-func NewSimpleSchedulingPolicy() *SimpleSchedulingPolicy {
-	return &SimpleSchedulingPolicy{}
+func NewSimpleSchedulingPolicy(config Config) *SimpleSchedulingPolicy {
+	return &SimpleSchedulingPolicy{pipeline: mustPipeline(config, DefaultPipeline)}
 }
 
 // SelectBestPlugins returns the best plugin to run at the time
-// For SimpleSchedulingPolicy, it returns the oldest plugin amongst "ready" plugins
+// For SimpleSchedulingPolicy, it returns "ready" plugins that fit to the available resource from the oldest
 func (ss *SimpleSchedulingPolicy) SelectBestPlugins(scienceGoals map[string]*datatype.ScienceGoal, availableResource datatype.Resource, nodeID string) (pluginsToRun []*datatype.Plugin, err error) {
-	// var selectedPlugin *datatype.Plugin
-	for _, goal := range scienceGoals {
-		subGoal := goal.GetMySubGoal(nodeID)
-		for _, plugin := range subGoal.Plugins {
-			if plugin.Status.SchedulingStatus == datatype.Ready {
-				pluginsToRun = append(pluginsToRun, plugin)
-				// if selectedPlugin == nil {
-				// 	selectedPlugin = plugin
-				// } else if selectedPlugin.Status.Since.After(plugin.Status.Since) {
-				// 	selectedPlugin = plugin
-				// }
-			}
-		}
-	}
-	return pluginsToRun, nil
+	return ss.pipeline.SelectBestPlugins(scienceGoals, availableResource, nodeID)
 }
 
 // func (ss *SimpleSchedulingPolicy) PromotePlugins(subGoal *datatype.SubGoal) (events []datatype.Event) {
@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// DefaultFairShareHalfLife is the default time it takes for runtime consumed by plugins to count half
+const DefaultFairShareHalfLife = time.Hour
+
+// fairShareMinimumRuntime is the decayed runtime in seconds below which a share is forgotten
+const fairShareMinimumRuntime = 0.001
+
+// AccountingSchedulingPolicy is a scheduling policy that keeps track of runtime consumed by plugins
+type AccountingSchedulingPolicy interface {
+	SchedulingPolicy
+	// RecordRuntime accounts the runtime of the plugin of the goal that stopped running
+	RecordRuntime(*datatype.ScienceGoal, *datatype.Plugin, time.Duration)
+	// GetAccounting returns the accounting state of the policy. It returns nil
+	// if the policy does not keep track of runtime
+	GetAccounting() interface{}
+}
+
+// FairShareState structs the accounting state of the fair-share policy.
+// Runtime of shares is decayed to the time of the state
+type FairShareState struct {
+	Timestamp time.Time                 `json:"timestamp"`
+	HalfLife  string                    `json:"half_life"`
+	Users     map[string]FairShareUsage `json:"users"`
+	Goals     map[string]FairShareUsage `json:"goals"`
+}
+
+// FairShareUsage structs runtime consumed by a share. Share is runtime divided by weight
+// and the share with the smallest is the most under-served
+type FairShareUsage struct {
+	Name    string  `json:"name,omitempty"`
+	User    string  `json:"user,omitempty"`
+	Runtime float64 `json:"runtime_seconds"`
+	Weight  float64 `json:"weight"`
+	Share   float64 `json:"share"`
+}
+
+// decayingRuntime is runtime in seconds that halves every half life
+type decayingRuntime struct {
+	seconds   float64
+	updatedAt time.Time
+}
+
+func (d *decayingRuntime) valueAt(now time.Time, halfLife time.Duration) float64 {
+	elapsed := now.Sub(d.updatedAt)
+	if elapsed <= 0 {
+		return d.seconds
+	}
+	return d.seconds * math.Exp2(-float64(elapsed)/float64(halfLife))
+}
+
+func (d *decayingRuntime) add(seconds float64, now time.Time, halfLife time.Duration) {
+	d.seconds = d.valueAt(now, halfLife) + seconds
+	d.updatedAt = now
+}
+
+// fairShareAccounting keeps runtime consumed by users and goals decaying over time
+type fairShareAccounting struct {
+	halfLife time.Duration
+	mutex    sync.Mutex
+	users    map[string]*decayingRuntime
+	goals    map[string]*decayingRuntime
+	// goalInfo keeps name, owner and weight of goals last seen for reporting
+	goalInfo map[string]FairShareUsage
+	now      func() time.Time
+}
+
+func newFairShareAccounting(halfLife time.Duration) *fairShareAccounting {
+	if halfLife <= 0 {
+		halfLife = DefaultFairShareHalfLife
+	}
+	return &fairShareAccounting{
+		halfLife: halfLife,
+		users:    make(map[string]*decayingRuntime),
+		goals:    make(map[string]*decayingRuntime),
+		goalInfo: make(map[string]FairShareUsage),
+		now:      time.Now,
+	}
+}
+
+// RecordRuntime accounts the runtime of the plugin to its goal and the user of the goal
+func (fa *fairShareAccounting) RecordRuntime(goal *datatype.ScienceGoal, plugin *datatype.Plugin, runtime time.Duration) {
+	if goal == nil || runtime <= 0 {
+		return
+	}
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	now := fa.now()
+	if _, exist := fa.goals[goal.ID]; !exist {
+		fa.goals[goal.ID] = &decayingRuntime{updatedAt: now}
+	}
+	fa.goals[goal.ID].add(runtime.Seconds(), now, fa.halfLife)
+	if _, exist := fa.users[goal.User]; !exist {
+		fa.users[goal.User] = &decayingRuntime{updatedAt: now}
+	}
+	fa.users[goal.User].add(runtime.Seconds(), now, fa.halfLife)
+	fa.goalInfo[goal.ID] = FairShareUsage{Name: goal.Name, User: goal.User, Weight: goal.GetWeight()}
+}
+
+// GetAccounting returns runtime consumed by users and goals at the time
+func (fa *fairShareAccounting) GetAccounting() interface{} {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	now := fa.now()
+	fa.forgetServed(now)
+	state := FairShareState{
+		Timestamp: now,
+		HalfLife:  fa.halfLife.String(),
+		Users:     make(map[string]FairShareUsage),
+		Goals:     make(map[string]FairShareUsage),
+	}
+	for user, runtime := range fa.users {
+		seconds := runtime.valueAt(now, fa.halfLife)
+		state.Users[user] = FairShareUsage{Runtime: seconds, Weight: 1, Share: seconds}
+	}
+	for goalID, runtime := range fa.goals {
+		usage := fa.goalInfo[goalID]
+		usage.Runtime = runtime.valueAt(now, fa.halfLife)
+		usage.Share = usage.Runtime / usage.Weight
+		state.Goals[goalID] = usage
+	}
+	return state
+}
+
+// currentShares returns shares of users and goals at the time including runtime of plugins running at the time
+func (fa *fairShareAccounting) currentShares(scienceGoals map[string]*datatype.ScienceGoal, nodeID string, now time.Time) (userShares map[string]float64, goalShares map[string]float64) {
+	fa.mutex.Lock()
+	defer fa.mutex.Unlock()
+	fa.forgetServed(now)
+	userShares = make(map[string]float64)
+	goalShares = make(map[string]float64)
+	for user, runtime := range fa.users {
+		userShares[user] = runtime.valueAt(now, fa.halfLife)
+	}
+	for goalID, runtime := range fa.goals {
+		goalShares[goalID] = runtime.valueAt(now, fa.halfLife)
+	}
+	for _, plugin := range runningPlugins(scienceGoals, nodeID) {
+		if running := now.Sub(plugin.Status.Since).Seconds(); running > 0 {
+			userShares[userOfPlugin(scienceGoals, plugin)] += running
+			goalShares[plugin.GoalID] += running
+		}
+	}
+	for goalID, goal := range scienceGoals {
+		goalShares[goalID] /= goal.GetWeight()
+		if _, exist := fa.goals[goalID]; exist {
+			fa.goalInfo[goalID] = FairShareUsage{Name: goal.Name, User: goal.User, Weight: goal.GetWeight()}
+		}
+	}
+	return
+}
+
+// forgetServed removes shares whose runtime has decayed away
+func (fa *fairShareAccounting) forgetServed(now time.Time) {
+	for user, runtime := range fa.users {
+		if runtime.valueAt(now, fa.halfLife) < fairShareMinimumRuntime {
+			delete(fa.users, user)
+		}
+	}
+	for goalID, runtime := range fa.goals {
+		if runtime.valueAt(now, fa.halfLife) < fairShareMinimumRuntime {
+			delete(fa.goals, goalID)
+			delete(fa.goalInfo, goalID)
+		}
+	}
+}
+
+// fairSharePipeline runs "ready" plugins that fit from the most under-served share
+var fairSharePipeline = PipelineConfig{
+	Filters: []StageConfig{{Name: "resourcefit"}},
+	Scores:  []StageConfig{{Name: "fairshare"}},
+}
+
+// FairShareSchedulingPolicy selects plugins by fairSharePipeline and reports
+// the accounting of its fairshare stage
+type FairShareSchedulingPolicy struct {
+	pipeline   *PipelineSchedulingPolicy
+	accounting *fairShareAccounting
+}
+
+func NewFairShareSchedulingPolicy(config Config) *FairShareSchedulingPolicy {
+	pipeline := mustPipeline(config, fairSharePipeline)
+	accounting := pipeline.scores[0].stage.(*fairShareScore).fairShareAccounting
+	// Cycles run at the time of the accounting
+	pipeline.now = func() time.Time { return accounting.now() }
+	return &FairShareSchedulingPolicy{pipeline: pipeline, accounting: accounting}
+}
+
+// SelectBestPlugins returns the best plugin to run at the time
+// It returns "ready" plugins that fit to the available resource from the most under-served share.
+// Users are served equally and goals of a user are served by their weight. Runtime of plugins
+// counts less as time goes and plugins running at the time count for how long they have run.
+// Plugins of the same share are returned from the oldest
+func (fs *FairShareSchedulingPolicy) SelectBestPlugins(scienceGoals map[string]*datatype.ScienceGoal, availableResource datatype.Resource, nodeID string) (pluginsToRun []*datatype.Plugin, err error) {
+	return fs.pipeline.SelectBestPlugins(scienceGoals, availableResource, nodeID)
+}
+
+// RecordRuntime accounts the runtime of the plugin to its goal and the user of the goal
+func (fs *FairShareSchedulingPolicy) RecordRuntime(goal *datatype.ScienceGoal, plugin *datatype.Plugin, runtime time.Duration) {
+	fs.accounting.RecordRuntime(goal, plugin, runtime)
+}
+
+// GetAccounting returns runtime consumed by users and goals at the time
+func (fs *FairShareSchedulingPolicy) GetAccounting() interface{} {
+	return fs.accounting.GetAccounting()
+}
+
+func userOfPlugin(scienceGoals map[string]*datatype.ScienceGoal, plugin *datatype.Plugin) string {
+	if goal, exist := scienceGoals[plugin.GoalID]; exist {
+		return goal.User
+	}
+	return ""
+}
@@ -0,0 +1,182 @@
+package policy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func newTestGoal(name string, user string, weight float64, plugins ...*datatype.Plugin) *datatype.ScienceGoal {
+	return datatype.NewScienceGoalBuilderWithID(name, "", name).SetUser(user).SetWeight(weight).
+		AddSubGoal(testNodeID, plugins, []string{}).Build()
+}
+
+func goalsOf(goals ...*datatype.ScienceGoal) map[string]*datatype.ScienceGoal {
+	scienceGoals := make(map[string]*datatype.ScienceGoal)
+	for _, goal := range goals {
+		scienceGoals[goal.ID] = goal
+	}
+	return scienceGoals
+}
+
+func TestFairShareSelectBestPlugins(t *testing.T) {
+	now := time.Now()
+	type runtime struct {
+		Goal    string
+		Runtime time.Duration
+		Ago     time.Duration
+	}
+	tests := map[string]struct {
+		Goals     func() []*datatype.ScienceGoal
+		Runtimes  []runtime
+		Available datatype.Resource
+		Want      []string
+	}{
+		"oldestWithoutRuntime": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 0, newTestPlugin("a", datatype.Ready, now, nil)),
+					newTestGoal("g2", "bob", 0, newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil)),
+				}
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "a"},
+		},
+		"underServedGoalFirst": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 0, newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), &datatype.Resource{CPU: "1"})),
+					newTestGoal("g2", "alice", 0, newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1"})),
+				}
+			},
+			Runtimes:  []runtime{{Goal: "g1", Runtime: 10 * time.Minute}},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"b"},
+		},
+		"underServedUserFirst": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 0, newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), nil)),
+					newTestGoal("g2", "alice", 0, newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil)),
+					newTestGoal("g3", "bob", 0, newTestPlugin("c", datatype.Ready, now, nil)),
+				}
+			},
+			// alice has used more than bob although g2 has not
+			Runtimes:  []runtime{{Goal: "g1", Runtime: 10 * time.Minute}, {Goal: "g3", Runtime: time.Minute}},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"c", "b", "a"},
+		},
+		"userBeforeGoal": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 0),
+					newTestGoal("g2", "alice", 0, newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), nil)),
+					newTestGoal("g3", "bob", 0, newTestPlugin("b", datatype.Ready, now, nil)),
+				}
+			},
+			// bob used less than alice and is served first although g3 used more than g2
+			Runtimes:  []runtime{{Goal: "g1", Runtime: 10 * time.Minute}, {Goal: "g3", Runtime: 9 * time.Minute}},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "a"},
+		},
+		"weight": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 4, newTestPlugin("a", datatype.Ready, now, nil)),
+					newTestGoal("g2", "alice", 1, newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil)),
+				}
+			},
+			// g1 used twice as much but weighs 4 times more
+			Runtimes:  []runtime{{Goal: "g1", Runtime: 10 * time.Minute}, {Goal: "g2", Runtime: 5 * time.Minute}},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"a", "b"},
+		},
+		"decay": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 0, newTestPlugin("a", datatype.Ready, now, nil)),
+					newTestGoal("g2", "bob", 0, newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil)),
+				}
+			},
+			// 10 minutes of alice 4 hours ago count less than 2 minutes of bob now
+			Runtimes:  []runtime{{Goal: "g1", Runtime: 10 * time.Minute, Ago: 4 * time.Hour}, {Goal: "g2", Runtime: 2 * time.Minute}},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"a", "b"},
+		},
+		"running": {
+			Goals: func() []*datatype.ScienceGoal {
+				return []*datatype.ScienceGoal{
+					newTestGoal("g1", "alice", 0,
+						newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), nil),
+						newTestPlugin("running", datatype.Running, now.Add(-30*time.Minute), nil)),
+					newTestGoal("g2", "bob", 0, newTestPlugin("b", datatype.Ready, now, nil)),
+				}
+			},
+			Runtimes:  []runtime{{Goal: "g2", Runtime: 10 * time.Minute}},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "a"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			goals := test.Goals()
+			scienceGoals := goalsOf(goals...)
+			policy := NewFairShareSchedulingPolicy(Config{})
+			for _, r := range test.Runtimes {
+				policy.accounting.now = func() time.Time { return now.Add(-r.Ago) }
+				policy.RecordRuntime(scienceGoals[r.Goal], nil, r.Runtime)
+			}
+			policy.accounting.now = func() time.Time { return now }
+			plugins, err := policy.SelectBestPlugins(scienceGoals, test.Available, testNodeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range plugins {
+				got = append(got, p.Name)
+			}
+			if len(got) != len(test.Want) {
+				t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+			}
+			for i := range got {
+				if got[i] != test.Want[i] {
+					t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFairShareAccounting(t *testing.T) {
+	now := time.Now()
+	policy := NewFairShareSchedulingPolicy(Config{FairShareHalfLife: time.Hour})
+	goal := newTestGoal("g1", "alice", 2)
+	policy.accounting.now = func() time.Time { return now.Add(-time.Hour) }
+	policy.RecordRuntime(goal, nil, 20*time.Minute)
+	policy.accounting.now = func() time.Time { return now }
+	policy.RecordRuntime(goal, nil, 10*time.Minute)
+	state, ok := policy.GetAccounting().(FairShareState)
+	if !ok {
+		t.Fatalf("Wrong type of accounting state: %T", policy.GetAccounting())
+	}
+	// 20 minutes an hour ago counts as 10 minutes
+	want := 20 * time.Minute.Seconds()
+	if math.Abs(state.Users["alice"].Runtime-want) > 0.001 {
+		t.Errorf("Wrong runtime of user: expected %g, but %g", want, state.Users["alice"].Runtime)
+	}
+	usage := state.Goals["g1"]
+	if math.Abs(usage.Runtime-want) > 0.001 || math.Abs(usage.Share-want/2) > 0.001 {
+		t.Errorf("Wrong usage of goal: expected runtime %g and share %g, but %+v", want, want/2, usage)
+	}
+	if usage.User != "alice" || usage.Weight != 2 {
+		t.Errorf("Wrong goal info: %+v", usage)
+	}
+	// Runtime decays away
+	policy.accounting.now = func() time.Time { return now.Add(48 * time.Hour) }
+	state = policy.GetAccounting().(FairShareState)
+	if len(state.Users) > 0 || len(state.Goals) > 0 {
+		t.Errorf("Runtime must be forgotten: %+v", state)
+	}
+}
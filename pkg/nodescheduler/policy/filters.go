@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// resourceFitFilter passes plugins whose required resource fits to the resource left in the cycle
+type resourceFitFilter struct{}
+
+func newResourceFitFilter(args map[string]string, config Config) (FilterStage, error) {
+	return &resourceFitFilter{}, nil
+}
+
+func (f *resourceFitFilter) Filter(state *CycleState, plugin *datatype.Plugin) string {
+	_, require, fits := requirementToFit(plugin, &state.Available, state.ProfilePreference)
+	if fits {
+		return ""
+	}
+	if len(plugin.Profiles) < 1 {
+		return fmt.Sprintf("Not enough resource: requires %s but %s available", require.String(), state.Available.String())
+	}
+	return fmt.Sprintf("Not enough resource for any profile: %s available", state.Available.String())
+}
+
+// exclusivityFilter runs exclusive plugins alone. An exclusive plugin passes only if no other plugin
+// runs or is selected, and no plugin passes while an exclusive plugin runs or is selected
+type exclusivityFilter struct{}
+
+func newExclusivityFilter(args map[string]string, config Config) (FilterStage, error) {
+	return &exclusivityFilter{}, nil
+}
+
+func (f *exclusivityFilter) Filter(state *CycleState, plugin *datatype.Plugin) string {
+	others := append(append([]*datatype.Plugin{}, state.Running...), state.Selected...)
+	for _, other := range others {
+		if isExclusive(other) {
+			return fmt.Sprintf("Exclusive plugin %q runs", other.Name)
+		}
+	}
+	if isExclusive(plugin) && len(others) > 0 {
+		return fmt.Sprintf("Exclusive plugin waits for %d plugins to finish", len(others))
+	}
+	return ""
+}
+
+func isExclusive(plugin *datatype.Plugin) bool {
+	return plugin.PluginSpec != nil && plugin.PluginSpec.Exclusive
+}
+
+// maxPluginsFilter passes plugins while fewer than "max" plugins run or are selected.
+// "max" is 1 if not given, which runs one plugin at a time
+type maxPluginsFilter struct {
+	max int
+}
+
+func newMaxPluginsFilter(args map[string]string, config Config) (FilterStage, error) {
+	max := 1
+	if v, exist := args["max"]; exist {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("Invalid max %q: must be a positive number", v)
+		}
+		max = n
+	}
+	return &maxPluginsFilter{max: max}, nil
+}
+
+func (f *maxPluginsFilter) Filter(state *CycleState, plugin *datatype.Plugin) string {
+	if n := len(state.Running) + len(state.Selected); n >= f.max {
+		return fmt.Sprintf("%d plugins run or are selected out of at most %d", n, f.max)
+	}
+	return ""
+}
+
+// timeWindowFilter passes plugins only within a time window of the day in local time of the scheduler.
+// The window is given by "start" and "end" in HH:MM and may cross midnight. It applies to plugins
+// whose name matches "plugins" if given, for example, "*-gpu". Other plugins always pass
+type timeWindowFilter struct {
+	start   time.Duration
+	end     time.Duration
+	plugins string
+}
+
+func newTimeWindowFilter(args map[string]string, config Config) (FilterStage, error) {
+	start, err := parseTimeOfDay(args["start"])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid start: %s", err.Error())
+	}
+	end, err := parseTimeOfDay(args["end"])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid end: %s", err.Error())
+	}
+	if _, err := path.Match(args["plugins"], ""); err != nil {
+		return nil, fmt.Errorf("Invalid plugins %q: %s", args["plugins"], err.Error())
+	}
+	return &timeWindowFilter{start: start, end: end, plugins: args["plugins"]}, nil
+}
+
+func (f *timeWindowFilter) Filter(state *CycleState, plugin *datatype.Plugin) string {
+	if f.plugins != "" {
+		if matched, _ := path.Match(f.plugins, plugin.Name); !matched {
+			return ""
+		}
+	}
+	now := state.Now
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	inWindow := false
+	if f.start <= f.end {
+		inWindow = sinceMidnight >= f.start && sinceMidnight < f.end
+	} else {
+		inWindow = sinceMidnight >= f.start || sinceMidnight < f.end
+	}
+	if inWindow {
+		return ""
+	}
+	return fmt.Sprintf("Outside time window %s-%s", formatTimeOfDay(f.start), formatTimeOfDay(f.end))
+}
+
+// parseTimeOfDay returns the time since midnight of HH:MM
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,275 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func newTestCycleState(now time.Time, available datatype.Resource, plugins ...*datatype.Plugin) *CycleState {
+	goals := newTestGoals(plugins...)
+	return &CycleState{
+		Goals:     goals,
+		NodeID:    testNodeID,
+		Now:       now,
+		Available: available,
+		Running:   runningPlugins(goals, testNodeID),
+		Ready:     readyPlugins(goals, testNodeID),
+	}
+}
+
+func exclusive(plugin *datatype.Plugin) *datatype.Plugin {
+	plugin.PluginSpec.Exclusive = true
+	return plugin
+}
+
+func TestResourceFitFilter(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Plugin    *datatype.Plugin
+		Available datatype.Resource
+		Selected  []*datatype.Plugin
+		WantPass  bool
+	}{
+		"fits": {
+			Plugin:    newTestPlugin("a", datatype.Ready, now, &datatype.Resource{CPU: "1", Memory: "1Gi"}),
+			Available: datatype.NewResource(2000, 2048, 0),
+			WantPass:  true,
+		},
+		"noRequirement": {
+			Plugin:    newTestPlugin("a", datatype.Ready, now, nil),
+			Available: datatype.NewResource(0, 0, 0),
+			WantPass:  true,
+		},
+		"notFit": {
+			Plugin:    newTestPlugin("a", datatype.Ready, now, &datatype.Resource{CPU: "3"}),
+			Available: datatype.NewResource(2000, 2048, 0),
+		},
+		"anyProfileFits": {
+			Plugin:    withProfiles(newTestPlugin("a", datatype.Ready, now, nil), cudaProfile, cpuProfile),
+			Available: datatype.NewResource(2000, 2048, 0),
+			WantPass:  true,
+		},
+		"noProfileFits": {
+			Plugin:    withProfiles(newTestPlugin("a", datatype.Ready, now, nil), cudaProfile, cpuProfile),
+			Available: datatype.NewResource(1000, 1024, 0),
+		},
+	}
+	filter, _ := newResourceFitFilter(nil, Config{})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := newTestCycleState(now, test.Available, test.Plugin)
+			reason := filter.Filter(state, test.Plugin)
+			if (reason == "") != test.WantPass {
+				t.Errorf("Wrong filter result: expected pass %t, but reason %q", test.WantPass, reason)
+			}
+		})
+	}
+}
+
+func TestExclusivityFilter(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Plugins  []*datatype.Plugin
+		Selected []string
+		Plugin   string
+		WantPass bool
+	}{
+		"alone": {
+			Plugins:  []*datatype.Plugin{exclusive(newTestPlugin("a", datatype.Ready, now, nil))},
+			Plugin:   "a",
+			WantPass: true,
+		},
+		"exclusiveWaitsForRunning": {
+			Plugins: []*datatype.Plugin{
+				exclusive(newTestPlugin("a", datatype.Ready, now, nil)),
+				newTestPlugin("b", datatype.Running, now, nil),
+			},
+			Plugin: "a",
+		},
+		"exclusiveWaitsForSelected": {
+			Plugins: []*datatype.Plugin{
+				exclusive(newTestPlugin("a", datatype.Ready, now, nil)),
+				newTestPlugin("b", datatype.Ready, now, nil),
+			},
+			Selected: []string{"b"},
+			Plugin:   "a",
+		},
+		"exclusiveRunning": {
+			Plugins: []*datatype.Plugin{
+				exclusive(newTestPlugin("a", datatype.Running, now, nil)),
+				newTestPlugin("b", datatype.Ready, now, nil),
+			},
+			Plugin: "b",
+		},
+		"nonExclusive": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now, nil),
+				newTestPlugin("b", datatype.Ready, now, nil),
+			},
+			Plugin:   "b",
+			WantPass: true,
+		},
+	}
+	filter, _ := newExclusivityFilter(nil, Config{})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			state := newTestCycleState(now, unlimitedTestResource(), test.Plugins...)
+			var plugin *datatype.Plugin
+			for _, p := range test.Plugins {
+				if p.Name == test.Plugin {
+					plugin = p
+				}
+				for _, s := range test.Selected {
+					if p.Name == s {
+						state.admit(p)
+					}
+				}
+			}
+			reason := filter.Filter(state, plugin)
+			if (reason == "") != test.WantPass {
+				t.Errorf("Wrong filter result: expected pass %t, but reason %q", test.WantPass, reason)
+			}
+		})
+	}
+}
+
+func TestMaxPluginsFilter(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Args     map[string]string
+		Plugins  []*datatype.Plugin
+		Selected []string
+		WantPass bool
+	}{
+		"alone": {
+			Plugins:  []*datatype.Plugin{newTestPlugin("a", datatype.Ready, now, nil)},
+			WantPass: true,
+		},
+		"running": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now, nil),
+				newTestPlugin("b", datatype.Running, now, nil),
+			},
+		},
+		"selected": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now, nil),
+				newTestPlugin("b", datatype.Ready, now, nil),
+			},
+			Selected: []string{"b"},
+		},
+		"underMax": {
+			Args: map[string]string{"max": "3"},
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now, nil),
+				newTestPlugin("b", datatype.Running, now, nil),
+				newTestPlugin("c", datatype.Ready, now, nil),
+			},
+			Selected: []string{"c"},
+			WantPass: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, err := newMaxPluginsFilter(test.Args, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			state := newTestCycleState(now, unlimitedTestResource(), test.Plugins...)
+			for _, p := range test.Plugins {
+				for _, s := range test.Selected {
+					if p.Name == s {
+						state.admit(p)
+					}
+				}
+			}
+			reason := filter.Filter(state, test.Plugins[0])
+			if (reason == "") != test.WantPass {
+				t.Errorf("Wrong filter result: expected pass %t, but reason %q", test.WantPass, reason)
+			}
+		})
+	}
+	if _, err := newMaxPluginsFilter(map[string]string{"max": "0"}, Config{}); err == nil {
+		t.Errorf("Zero max must fail")
+	}
+}
+
+func TestTimeWindowFilter(t *testing.T) {
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2022, 6, 1, hour, minute, 0, 0, time.Local)
+	}
+	tests := map[string]struct {
+		Args     map[string]string
+		Plugin   string
+		Now      time.Time
+		WantPass bool
+	}{
+		"inWindow": {
+			Args:     map[string]string{"start": "09:00", "end": "17:00"},
+			Plugin:   "a",
+			Now:      at(12, 0),
+			WantPass: true,
+		},
+		"beforeWindow": {
+			Args:   map[string]string{"start": "09:00", "end": "17:00"},
+			Plugin: "a",
+			Now:    at(8, 59),
+		},
+		"atEnd": {
+			Args:   map[string]string{"start": "09:00", "end": "17:00"},
+			Plugin: "a",
+			Now:    at(17, 0),
+		},
+		"overMidnight": {
+			Args:     map[string]string{"start": "22:00", "end": "06:00"},
+			Plugin:   "a",
+			Now:      at(1, 30),
+			WantPass: true,
+		},
+		"overMidnightOutside": {
+			Args:   map[string]string{"start": "22:00", "end": "06:00"},
+			Plugin: "a",
+			Now:    at(12, 0),
+		},
+		"otherPlugins": {
+			Args:     map[string]string{"start": "22:00", "end": "06:00", "plugins": "*-gpu"},
+			Plugin:   "sampler",
+			Now:      at(12, 0),
+			WantPass: true,
+		},
+		"matchingPlugins": {
+			Args:   map[string]string{"start": "22:00", "end": "06:00", "plugins": "*-gpu"},
+			Plugin: "detector-gpu",
+			Now:    at(12, 0),
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			filter, err := newTimeWindowFilter(test.Args, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			plugin := newTestPlugin(test.Plugin, datatype.Ready, test.Now, nil)
+			state := newTestCycleState(test.Now, unlimitedTestResource(), plugin)
+			reason := filter.Filter(state, plugin)
+			if (reason == "") != test.WantPass {
+				t.Errorf("Wrong filter result: expected pass %t, but reason %q", test.WantPass, reason)
+			}
+		})
+	}
+	for _, args := range []map[string]string{
+		{"start": "9", "end": "17:00"},
+		{"start": "09:00"},
+		{"start": "09:00", "end": "17:00", "plugins": "["},
+	} {
+		if _, err := newTimeWindowFilter(args, Config{}); err == nil {
+			t.Errorf("Invalid time window %v must fail", args)
+		}
+	}
+}
+
+func unlimitedTestResource() datatype.Resource {
+	return datatype.NewResource(64000, 65536, 65536)
+}
@@ -0,0 +1,247 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// FilterStage decides whether a "ready" plugin can run at the time
+type FilterStage interface {
+	// Filter returns the reason the plugin cannot run. It returns an empty string if the plugin passes
+	Filter(state *CycleState, plugin *datatype.Plugin) string
+}
+
+// ScoreStage scores "ready" plugins. Plugins of the higher total score are considered first
+type ScoreStage interface {
+	// Score returns the score of the plugin between 0 and 1
+	Score(state *CycleState, plugin *datatype.Plugin) float64
+}
+
+// preparingStage is a stage that prepares for a scheduling cycle before plugins are scored
+type preparingStage interface {
+	Prepare(state *CycleState)
+}
+
+// accountingStage is a stage that keeps track of runtime consumed by plugins
+type accountingStage interface {
+	RecordRuntime(*datatype.ScienceGoal, *datatype.Plugin, time.Duration)
+	GetAccounting() interface{}
+}
+
+// FilterStageFactory creates a filter stage with the arguments given in the config
+type FilterStageFactory func(args map[string]string, config Config) (FilterStage, error)
+
+// ScoreStageFactory creates a score stage with the arguments given in the config
+type ScoreStageFactory func(args map[string]string, config Config) (ScoreStage, error)
+
+var (
+	filterStages = map[string]FilterStageFactory{
+		"resourcefit": newResourceFitFilter,
+		"exclusivity": newExclusivityFilter,
+		"timewindow":  newTimeWindowFilter,
+		"maxplugins":  newMaxPluginsFilter,
+	}
+	scoreStages = map[string]ScoreStageFactory{
+		"age":       newAgeScore,
+		"priority":  newPriorityScore,
+		"fairshare": newFairShareScore,
+	}
+)
+
+// RegisterFilterStage makes a filter stage available to pipelines by the name
+func RegisterFilterStage(name string, factory FilterStageFactory) {
+	filterStages[name] = factory
+}
+
+// RegisterScoreStage makes a score stage available to pipelines by the name
+func RegisterScoreStage(name string, factory ScoreStageFactory) {
+	scoreStages[name] = factory
+}
+
+// PipelineConfig composes a scheduling policy from stages
+type PipelineConfig struct {
+	// Filters are applied in the order. A plugin runs only if it passes all of them
+	Filters []StageConfig `json:"filters" yaml:"filters"`
+	// Scores are summed by their weight to order plugins
+	Scores []StageConfig `json:"scores" yaml:"scores"`
+}
+
+// StageConfig configures a stage of a pipeline
+type StageConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Weight of a score stage. Score stages weigh 1 if not given
+	Weight float64           `json:"weight" yaml:"weight"`
+	Args   map[string]string `json:"args" yaml:"args"`
+}
+
+// DefaultPipeline runs "ready" plugins that fit from the oldest as SimpleSchedulingPolicy does
+var DefaultPipeline = PipelineConfig{
+	Filters: []StageConfig{{Name: "resourcefit"}},
+	Scores:  []StageConfig{{Name: "age"}},
+}
+
+// CycleState is what stages see in a scheduling cycle
+type CycleState struct {
+	Goals  map[string]*datatype.ScienceGoal
+	NodeID string
+	Now    time.Time
+	// Available is the resource left after plugins selected so far in the cycle
+	Available datatype.Resource
+	// Running plugins are plugins that run at the time
+	Running []*datatype.Plugin
+	// Ready plugins are the plugins considered in the cycle from the oldest
+	Ready []*datatype.Plugin
+	// Selected plugins are plugins selected so far in the cycle
+	Selected          []*datatype.Plugin
+	ProfilePreference []string
+}
+
+// admit selects the plugin in the cycle. The plugin is given the most preferred profile
+// that fits and the resource it requires is taken out of the available resource
+func (s *CycleState) admit(plugin *datatype.Plugin) {
+	profile, require, fits := requirementToFit(plugin, &s.Available, s.ProfilePreference)
+	if !fits && len(plugin.Profiles) > 0 {
+		preferred := orderProfiles(plugin.Profiles, s.ProfilePreference)[0]
+		candidate := *plugin
+		candidate.Status.KnobStatus = &preferred
+		profile, require = &preferred, candidate.GetRequiredResource()
+	}
+	plugin.Status.KnobStatus = profile
+	plugin.Status.Reason = ""
+	// Without the resourcefit filter the plugin may require more than is left.
+	// Subtract stops each quantity at zero so that Available never goes negative
+	s.Available = s.Available.Subtract(&require)
+	s.Selected = append(s.Selected, plugin)
+}
+
+type weightedScoreStage struct {
+	name   string
+	weight float64
+	stage  ScoreStage
+}
+
+type namedFilterStage struct {
+	name  string
+	stage FilterStage
+}
+
+// PipelineSchedulingPolicy is a scheduling policy composed of filter and score stages
+type PipelineSchedulingPolicy struct {
+	config  Config
+	filters []namedFilterStage
+	scores  []weightedScoreStage
+	now     func() time.Time
+}
+
+// NewPipelineSchedulingPolicy returns a policy composed of the stages in config.Pipeline.
+// DefaultPipeline is used if no stage is given
+func NewPipelineSchedulingPolicy(config Config) (*PipelineSchedulingPolicy, error) {
+	pipeline := config.Pipeline
+	if len(pipeline.Filters) < 1 && len(pipeline.Scores) < 1 {
+		pipeline = DefaultPipeline
+	}
+	ps := &PipelineSchedulingPolicy{config: config, now: time.Now}
+	for _, c := range pipeline.Filters {
+		factory, exist := filterStages[c.Name]
+		if !exist {
+			return nil, fmt.Errorf("No filter stage %q", c.Name)
+		}
+		stage, err := factory(c.Args, config)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create filter stage %q: %s", c.Name, err.Error())
+		}
+		ps.filters = append(ps.filters, namedFilterStage{name: c.Name, stage: stage})
+	}
+	for _, c := range pipeline.Scores {
+		factory, exist := scoreStages[c.Name]
+		if !exist {
+			return nil, fmt.Errorf("No score stage %q", c.Name)
+		}
+		if c.Weight < 0 {
+			return nil, fmt.Errorf("Weight %g of score stage %q must not be negative", c.Weight, c.Name)
+		}
+		stage, err := factory(c.Args, config)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to create score stage %q: %s", c.Name, err.Error())
+		}
+		weight := c.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		ps.scores = append(ps.scores, weightedScoreStage{name: c.Name, weight: weight, stage: stage})
+	}
+	return ps, nil
+}
+
+// SelectBestPlugins returns the best plugin to run at the time
+// It orders "ready" plugins by the weighted sum of their scores, and from the oldest amongst plugins
+// of the same score. Plugins are selected in the order if they pass all filters. Filters see
+// the plugins selected before
+func (ps *PipelineSchedulingPolicy) SelectBestPlugins(scienceGoals map[string]*datatype.ScienceGoal, availableResource datatype.Resource, nodeID string) (pluginsToRun []*datatype.Plugin, err error) {
+	state := &CycleState{
+		Goals:             scienceGoals,
+		NodeID:            nodeID,
+		Now:               ps.now(),
+		Available:         availableResource,
+		Running:           runningPlugins(scienceGoals, nodeID),
+		Ready:             readyPlugins(scienceGoals, nodeID),
+		ProfilePreference: ps.config.ProfilePreference,
+	}
+	for _, s := range ps.scores {
+		if preparing, ok := s.stage.(preparingStage); ok {
+			preparing.Prepare(state)
+		}
+	}
+	scores := make(map[*datatype.Plugin]float64)
+	for _, plugin := range state.Ready {
+		for _, s := range ps.scores {
+			scores[plugin] += s.weight * s.stage.Score(state, plugin)
+		}
+	}
+	plugins := append([]*datatype.Plugin{}, state.Ready...)
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return scores[plugins[i]] > scores[plugins[j]]
+	})
+	for _, plugin := range plugins {
+		reason := ""
+		for _, f := range ps.filters {
+			if reason = f.stage.Filter(state, plugin); reason != "" {
+				break
+			}
+		}
+		if reason != "" {
+			plugin.Status.Reason = reason
+			continue
+		}
+		state.admit(plugin)
+		pluginsToRun = append(pluginsToRun, plugin)
+	}
+	return pluginsToRun, nil
+}
+
+// RecordRuntime gives the runtime of the plugin to stages that keep track of it
+func (ps *PipelineSchedulingPolicy) RecordRuntime(goal *datatype.ScienceGoal, plugin *datatype.Plugin, runtime time.Duration) {
+	for _, s := range ps.scores {
+		if accounting, ok := s.stage.(accountingStage); ok {
+			accounting.RecordRuntime(goal, plugin, runtime)
+		}
+	}
+}
+
+// GetAccounting returns the accounting state of stages that keep track of runtime by their name.
+// It returns nil if no stage keeps track of runtime
+func (ps *PipelineSchedulingPolicy) GetAccounting() interface{} {
+	state := make(map[string]interface{})
+	for _, s := range ps.scores {
+		if accounting, ok := s.stage.(accountingStage); ok {
+			state[s.name] = accounting.GetAccounting()
+		}
+	}
+	if len(state) < 1 {
+		return nil
+	}
+	return state
+}
@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestPipelineSelectBestPlugins(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.Local)
+	tests := map[string]struct {
+		Pipeline  PipelineConfig
+		Plugins   []*datatype.Plugin
+		Available datatype.Resource
+		Want      []string
+		NotRun    []string
+	}{
+		"defaultPipeline": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), &datatype.Resource{CPU: "1500m"}),
+				newTestPlugin("b", datatype.Ready, now.Add(-2*time.Minute), &datatype.Resource{CPU: "1"}),
+				newTestPlugin("c", datatype.Ready, now, &datatype.Resource{Memory: "512Mi"}),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "c"},
+			NotRun:    []string{"a"},
+		},
+		"priorityOverAge": {
+			Pipeline: PipelineConfig{
+				Filters: []StageConfig{{Name: "resourcefit"}},
+				Scores:  []StageConfig{{Name: "age"}, {Name: "priority", Weight: 10}},
+			},
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Hour), &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 50),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"b"},
+			NotRun:    []string{"a"},
+		},
+		"ageOverPriority": {
+			Pipeline: PipelineConfig{
+				Filters: []StageConfig{{Name: "resourcefit"}},
+				Scores:  []StageConfig{{Name: "age", Weight: 10}, {Name: "priority"}},
+			},
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Hour), &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 50),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"a"},
+			NotRun:    []string{"b"},
+		},
+		"exclusive": {
+			Pipeline: PipelineConfig{
+				Filters: []StageConfig{{Name: "resourcefit"}, {Name: "exclusivity"}},
+				Scores:  []StageConfig{{Name: "age"}},
+			},
+			Plugins: []*datatype.Plugin{
+				exclusive(newTestPlugin("a", datatype.Ready, now.Add(-time.Hour), nil)),
+				newTestPlugin("b", datatype.Ready, now, nil),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"a"},
+			NotRun:    []string{"b"},
+		},
+		"timeWindow": {
+			Pipeline: PipelineConfig{
+				Filters: []StageConfig{{Name: "timewindow", Args: map[string]string{"start": "22:00", "end": "06:00", "plugins": "*-gpu"}}},
+			},
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("detector-gpu", datatype.Ready, now.Add(-time.Hour), nil),
+				newTestPlugin("sampler", datatype.Ready, now, nil),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"sampler"},
+			NotRun:    []string{"detector-gpu"},
+		},
+		"noFilter": {
+			Pipeline: PipelineConfig{
+				Scores: []StageConfig{{Name: "age"}},
+			},
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Hour), &datatype.Resource{CPU: "4"}),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"a"},
+		}, "maxPlugins": {
+			Pipeline: PipelineConfig{
+				Filters: []StageConfig{{Name: "maxplugins", Args: map[string]string{"max": "2"}}},
+			},
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now.Add(-time.Hour), nil),
+				newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil),
+				newTestPlugin("c", datatype.Ready, now, nil),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+			Want:      []string{"b"},
+			NotRun:    []string{"c"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			policy, err := NewPipelineSchedulingPolicy(Config{Pipeline: test.Pipeline})
+			if err != nil {
+				t.Fatal(err)
+			}
+			policy.now = func() time.Time { return now }
+			plugins, err := policy.SelectBestPlugins(newTestGoals(test.Plugins...), test.Available, testNodeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range plugins {
+				got = append(got, p.Name)
+			}
+			if len(got) != len(test.Want) {
+				t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+			}
+			for i := range got {
+				if got[i] != test.Want[i] {
+					t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+				}
+			}
+			for _, p := range test.Plugins {
+				for _, name := range test.NotRun {
+					if p.Name == name && p.Status.Reason == "" {
+						t.Errorf("Plugin %q not selected has no reason", p.Name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineWithoutResourceFitKeepsAvailableNonNegative(t *testing.T) {
+	now := time.Now()
+	a := newTestPlugin("a", datatype.Ready, now, &datatype.Resource{CPU: "4", Memory: "512Mi"})
+	b := newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1", Memory: "4Gi"})
+	state := newTestCycleState(now, datatype.NewResource(1000, 2048, 0), a, b)
+	state.admit(a)
+	state.admit(b)
+	if cpu, memory := state.Available.CPUInMilli(), state.Available.MemoryInMega(); cpu != 0 || memory != 0 {
+		t.Errorf("Wrong available resource after overcommitting: expected nothing left, but %q", state.Available.String())
+	}
+	if len(state.Selected) != 2 {
+		t.Errorf("Both plugins must be selected: %d", len(state.Selected))
+	}
+}
+
+func TestNewSchedulingPolicy(t *testing.T) {
+	tests := map[string]struct {
+		Name     string
+		Pipeline PipelineConfig
+		WantErr  bool
+	}{
+		"default":       {Name: "default"},
+		"fairshare":     {Name: "fairshare"},
+		"pipeline":      {Name: "pipeline", Pipeline: PipelineConfig{Scores: []StageConfig{{Name: "fairshare"}}}},
+		"unknownPolicy": {Name: "fastest", WantErr: true},
+		"unknownFilter": {Name: "pipeline", Pipeline: PipelineConfig{Filters: []StageConfig{{Name: "gpu"}}}, WantErr: true},
+		"unknownScore":  {Name: "pipeline", Pipeline: PipelineConfig{Scores: []StageConfig{{Name: "speed"}}}, WantErr: true},
+		"invalidArgs":   {Name: "pipeline", Pipeline: PipelineConfig{Filters: []StageConfig{{Name: "timewindow"}}}, WantErr: true},
+		"negativeWeight": {
+			Name:     "pipeline",
+			Pipeline: PipelineConfig{Scores: []StageConfig{{Name: "age", Weight: -1}}},
+			WantErr:  true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewSchedulingPolicy(test.Name, Config{Pipeline: test.Pipeline})
+			if (err != nil) != test.WantErr {
+				t.Errorf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+		})
+	}
+}
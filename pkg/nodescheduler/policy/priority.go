@@ -0,0 +1,78 @@
+package policy
+
+import (
+	"sort"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// priorityPipeline runs "ready" plugins that fit from the highest priority. Plugins of the same
+// priority score the same and are considered from the oldest
+var priorityPipeline = PipelineConfig{
+	Filters: []StageConfig{{Name: "resourcefit"}},
+	Scores:  []StageConfig{{Name: "priority"}},
+}
+
+// PrioritySchedulingPolicy selects plugins by priorityPipeline. Preemption is not a stage
+// of the pipeline as it stops running plugins before the pipeline selects "ready" plugins
+type PrioritySchedulingPolicy struct {
+	config   Config
+	pipeline *PipelineSchedulingPolicy
+}
+
+func NewPrioritySchedulingPolicy(config Config) *PrioritySchedulingPolicy {
+	return &PrioritySchedulingPolicy{config: config, pipeline: mustPipeline(config, priorityPipeline)}
+}
+
+// SelectBestPlugins returns the best plugin to run at the time
+// It returns "ready" plugins that fit to the available resource from the highest priority.
+// Plugins of the same priority are returned from the oldest
+func (ps *PrioritySchedulingPolicy) SelectBestPlugins(scienceGoals map[string]*datatype.ScienceGoal, availableResource datatype.Resource, nodeID string) (pluginsToRun []*datatype.Plugin, err error) {
+	return ps.pipeline.SelectBestPlugins(scienceGoals, availableResource, nodeID)
+}
+
+// SelectPluginsToPreempt returns running plugins to stop for "ready" plugins of higher priority
+// that do not fit to the available resource. Plugins of the lowest priority are preempted first
+// and the latest started amongst them. Plugins are preempted only if it makes the plugin fit
+func (ps *PrioritySchedulingPolicy) SelectPluginsToPreempt(scienceGoals map[string]*datatype.ScienceGoal, availableResource datatype.Resource, nodeID string) (preemptions []Preemption, err error) {
+	running := runningPlugins(scienceGoals, nodeID)
+	sort.SliceStable(running, func(i, j int) bool {
+		if running[i].GetPriority() != running[j].GetPriority() {
+			return running[i].GetPriority() < running[j].GetPriority()
+		}
+		return running[i].Status.Since.After(running[j].Status.Since)
+	})
+	for _, plugin := range byPriority(readyPlugins(scienceGoals, nodeID)) {
+		if _, require, fits := requirementToFit(plugin, &availableResource, ps.config.ProfilePreference); fits {
+			availableResource = availableResource.Subtract(&require)
+			continue
+		}
+		freed := availableResource
+		var victims []*datatype.Plugin
+		for _, candidate := range running {
+			if candidate.GetPriority() >= plugin.GetPriority() {
+				break
+			}
+			candidateRequire := candidate.GetRequiredResource()
+			freed = freed.Add(&candidateRequire)
+			victims = append(victims, candidate)
+			if _, require, fits := requirementToFit(plugin, &freed, ps.config.ProfilePreference); fits {
+				for _, victim := range victims {
+					preemptions = append(preemptions, Preemption{Plugin: victim, PreemptedBy: plugin})
+				}
+				running = running[len(victims):]
+				availableResource = freed.Subtract(&require)
+				break
+			}
+		}
+	}
+	return
+}
+
+// byPriority orders plugins from the highest priority keeping the order of plugins of the same priority
+func byPriority(plugins []*datatype.Plugin) []*datatype.Plugin {
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return plugins[i].GetPriority() > plugins[j].GetPriority()
+	})
+	return plugins
+}
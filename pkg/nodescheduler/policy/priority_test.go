@@ -0,0 +1,160 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func withPriority(plugin *datatype.Plugin, priority int) *datatype.Plugin {
+	plugin.PluginSpec.Priority = priority
+	return plugin
+}
+
+func TestPrioritySelectBestPlugins(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Plugins   []*datatype.Plugin
+		Available datatype.Resource
+		Want      []string
+	}{
+		"priorityFirst": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), nil),
+				withPriority(newTestPlugin("b", datatype.Ready, now, nil), 10),
+				withPriority(newTestPlugin("c", datatype.Ready, now.Add(time.Minute), nil), 50),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"c", "b", "a"},
+		},
+		"oldestInSamePriority": {
+			Plugins: []*datatype.Plugin{
+				withPriority(newTestPlugin("a", datatype.Ready, now, nil), 10),
+				withPriority(newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil), 10),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "a"},
+		},
+		"higherPriorityTakesResource": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), &datatype.Resource{CPU: "1500m"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plugins, err := NewPrioritySchedulingPolicy(Config{}).SelectBestPlugins(newTestGoals(test.Plugins...), test.Available, testNodeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range plugins {
+				got = append(got, p.Name)
+			}
+			if len(got) != len(test.Want) {
+				t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+			}
+			for i := range got {
+				if got[i] != test.Want[i] {
+					t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPrioritySelectPluginsToPreempt(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Plugins   []*datatype.Plugin
+		Available datatype.Resource
+		Want      map[string]string
+	}{
+		"fits": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+		},
+		"preemptLower": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(500, 2048, 0),
+			Want:      map[string]string{"a": "b"},
+		},
+		"noPreemptSameOrHigher": {
+			Plugins: []*datatype.Plugin{
+				withPriority(newTestPlugin("a", datatype.Running, now, &datatype.Resource{CPU: "1"}), 10),
+				withPriority(newTestPlugin("b", datatype.Running, now, &datatype.Resource{CPU: "1"}), 20),
+				withPriority(newTestPlugin("c", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(0, 2048, 0),
+		},
+		"lowestPriorityFirst": {
+			Plugins: []*datatype.Plugin{
+				withPriority(newTestPlugin("a", datatype.Running, now, &datatype.Resource{CPU: "1"}), 5),
+				newTestPlugin("b", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("c", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(0, 2048, 0),
+			Want:      map[string]string{"b": "c"},
+		},
+		"latestStartedFirst": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now.Add(-time.Minute), &datatype.Resource{CPU: "1"}),
+				newTestPlugin("b", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("c", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(0, 2048, 0),
+			Want:      map[string]string{"b": "c"},
+		},
+		"preemptMany": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now.Add(-time.Minute), &datatype.Resource{CPU: "1"}),
+				newTestPlugin("b", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("c", datatype.Ready, now, &datatype.Resource{CPU: "2"}), 10),
+			},
+			Available: datatype.NewResource(0, 2048, 0),
+			Want:      map[string]string{"a": "c", "b": "c"},
+		},
+		"notEnoughToPreempt": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now, &datatype.Resource{CPU: "4"}), 10),
+			},
+			Available: datatype.NewResource(1000, 2048, 0),
+		},
+		"preemptOncePerPlugin": {
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now, &datatype.Resource{CPU: "1"}),
+				withPriority(newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), &datatype.Resource{CPU: "1"}), 10),
+				withPriority(newTestPlugin("c", datatype.Ready, now, &datatype.Resource{CPU: "1"}), 10),
+			},
+			Available: datatype.NewResource(0, 2048, 0),
+			Want:      map[string]string{"a": "b"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			preemptions, err := NewPrioritySchedulingPolicy(Config{}).SelectPluginsToPreempt(newTestGoals(test.Plugins...), test.Available, testNodeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(preemptions) != len(test.Want) {
+				t.Fatalf("Wrong preemptions: expected %v, but %d preemptions", test.Want, len(preemptions))
+			}
+			for _, p := range preemptions {
+				if by, exist := test.Want[p.Plugin.Name]; !exist || by != p.PreemptedBy.Name {
+					t.Errorf("Unexpected preemption of %q by %q", p.Plugin.Name, p.PreemptedBy.Name)
+				}
+			}
+		})
+	}
+}
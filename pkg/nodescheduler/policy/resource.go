@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"path"
+	"sort"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// readyPlugins returns "ready" plugins of the goals from the oldest
+func readyPlugins(scienceGoals map[string]*datatype.ScienceGoal, nodeID string) (plugins []*datatype.Plugin) {
+	for _, goal := range scienceGoals {
+		subGoal := goal.GetMySubGoal(nodeID)
+		if subGoal == nil {
+			continue
+		}
+		for _, plugin := range subGoal.Plugins {
+			if plugin.Status.SchedulingStatus == datatype.Ready {
+				plugins = append(plugins, plugin)
+			}
+		}
+	}
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return plugins[i].Status.Since.Before(plugins[j].Status.Since)
+	})
+	return
+}
+
+// requirementToFit returns the profile the plugin would run with and the resource it requires.
+// A plugin with profiles is given the most preferred profile that fits to the available resource.
+// It returns false if the plugin does not fit. The plugin does not change
+func requirementToFit(plugin *datatype.Plugin, availableResource *datatype.Resource, profilePreference []string) (*datatype.Profile, datatype.Resource, bool) {
+	if len(plugin.Profiles) < 1 {
+		require := plugin.GetRequiredResource()
+		return plugin.Status.KnobStatus, require, availableResource.CanAccommodate(&require)
+	}
+	for _, profile := range orderProfiles(plugin.Profiles, profilePreference) {
+		profile := profile
+		candidate := *plugin
+		candidate.Status.KnobStatus = &profile
+		require := candidate.GetRequiredResource()
+		if availableResource.CanAccommodate(&require) {
+			return &profile, require, true
+		}
+	}
+	return plugin.Status.KnobStatus, datatype.Resource{}, false
+}
+
+// runningPlugins returns "running" plugins of the goals
+func runningPlugins(scienceGoals map[string]*datatype.ScienceGoal, nodeID string) (plugins []*datatype.Plugin) {
+	for _, goal := range scienceGoals {
+		subGoal := goal.GetMySubGoal(nodeID)
+		if subGoal == nil {
+			continue
+		}
+		for _, plugin := range subGoal.Plugins {
+			if plugin.Status.SchedulingStatus == datatype.Running {
+				plugins = append(plugins, plugin)
+			}
+		}
+	}
+	return
+}
+
+// orderProfiles returns the profiles in the order of preference. Profiles matching
+// an earlier name in the preference come first and the order of profiles is kept otherwise
+func orderProfiles(profiles []datatype.Profile, preference []string) []datatype.Profile {
+	rank := func(profile datatype.Profile) int {
+		for i, pattern := range preference {
+			if matched, _ := path.Match(pattern, profile.Name); matched {
+				return i
+			}
+		}
+		return len(preference)
+	}
+	ordered := append([]datatype.Profile{}, profiles...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return rank(ordered[i]) < rank(ordered[j])
+	})
+	return ordered
+}
@@ -0,0 +1,176 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+const testNodeID = "W001"
+
+func newTestPlugin(name string, status datatype.SchedulingStatus, since time.Time, require *datatype.Resource) *datatype.Plugin {
+	plugin := &datatype.Plugin{
+		Name:       name,
+		PluginSpec: &datatype.PluginSpec{Image: "waggle/" + name},
+		Status: datatype.PluginStatus{
+			SchedulingStatus: status,
+			Since:            since,
+		},
+	}
+	if require != nil {
+		plugin.Status.KnobStatus = &datatype.Profile{Name: "default", Require: *require}
+	}
+	return plugin
+}
+
+var (
+	cudaProfile = datatype.Profile{Name: "unet_cuda", Knobs: map[string]string{"cuda": "true"}, Require: datatype.Resource{CPU: "1", GPUMemory: "2Gi"}}
+	cpuProfile  = datatype.Profile{Name: "unet", Knobs: map[string]string{"cuda": "false"}, Require: datatype.Resource{CPU: "2", Memory: "2Gi"}}
+)
+
+func withProfiles(plugin *datatype.Plugin, profiles ...datatype.Profile) *datatype.Plugin {
+	plugin.Profiles = profiles
+	return plugin
+}
+
+func newTestGoals(plugins ...*datatype.Plugin) map[string]*datatype.ScienceGoal {
+	goal := datatype.NewScienceGoalBuilder("test-goal", "").
+		AddSubGoal(testNodeID, plugins, []string{}).Build()
+	return map[string]*datatype.ScienceGoal{goal.ID: goal}
+}
+
+func TestSelectBestPluginsWithResource(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Policy    SchedulingPolicy
+		Plugins   []*datatype.Plugin
+		Available datatype.Resource
+		Want      []string
+		NotFit    []string
+		Profiles  map[string]string
+	}{
+		"defaultAll": {
+			Policy: NewSimpleSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now, &datatype.Resource{CPU: "1", Memory: "1Gi"}),
+				newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), nil),
+				newTestPlugin("c", datatype.Waiting, now, nil),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "a"},
+		},
+		"defaultOldestFirst": {
+			Policy: NewSimpleSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now, &datatype.Resource{CPU: "1500m"}),
+				newTestPlugin("b", datatype.Ready, now.Add(-time.Minute), &datatype.Resource{CPU: "1"}),
+				newTestPlugin("c", datatype.Ready, now.Add(time.Minute), &datatype.Resource{Memory: "512Mi"}),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b", "c"},
+			NotFit:    []string{"a"},
+		},
+		"defaultGPU": {
+			Policy: NewSimpleSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now, &datatype.Resource{GPUMemory: "4Gi"}),
+			},
+			Available: datatype.NewResource(2000, 2048, 2048),
+			NotFit:    []string{"a"},
+		},
+		"profiles": {
+			Policy: NewSimpleSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				withProfiles(newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), nil), cudaProfile, cpuProfile),
+				withProfiles(newTestPlugin("b", datatype.Ready, now, nil), cudaProfile, cpuProfile),
+			},
+			Available: datatype.NewResource(4000, 4096, 3072),
+			Want:      []string{"a", "b"},
+			Profiles:  map[string]string{"a": "unet_cuda", "b": "unet"},
+		},
+		"profilePreference": {
+			Policy: NewSimpleSchedulingPolicy(Config{ProfilePreference: []string{"unet"}}),
+			Plugins: []*datatype.Plugin{
+				withProfiles(newTestPlugin("a", datatype.Ready, now, nil), cudaProfile, cpuProfile),
+			},
+			Available: datatype.NewResource(4000, 4096, 3072),
+			Want:      []string{"a"},
+			Profiles:  map[string]string{"a": "unet"},
+		},
+		"profilePreferenceWildcard": {
+			Policy: NewRoundRobinSchedulingPolicy(Config{ProfilePreference: []string{"*_cuda"}}),
+			Plugins: []*datatype.Plugin{
+				withProfiles(newTestPlugin("a", datatype.Ready, now, nil), cpuProfile, cudaProfile),
+			},
+			Available: datatype.NewResource(4000, 4096, 3072),
+			Want:      []string{"a"},
+			Profiles:  map[string]string{"a": "unet_cuda"},
+		},
+		"noProfileFits": {
+			Policy: NewSimpleSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				withProfiles(newTestPlugin("a", datatype.Ready, now, nil), cudaProfile, cpuProfile),
+			},
+			Available: datatype.NewResource(1000, 1024, 0),
+			NotFit:    []string{"a"},
+		},
+		"roundrobinFits": {
+			Policy: NewRoundRobinSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Ready, now.Add(-time.Minute), &datatype.Resource{Memory: "4Gi"}),
+				newTestPlugin("b", datatype.Ready, now, &datatype.Resource{Memory: "1Gi"}),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			Want:      []string{"b"},
+			NotFit:    []string{"a"},
+		},
+		"roundrobinRunning": {
+			Policy: NewRoundRobinSchedulingPolicy(Config{}),
+			Plugins: []*datatype.Plugin{
+				newTestPlugin("a", datatype.Running, now, nil),
+				newTestPlugin("b", datatype.Ready, now, nil),
+			},
+			Available: datatype.NewResource(2000, 2048, 0),
+			// b is told it waits for a
+			NotFit: []string{"b"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plugins, err := test.Policy.SelectBestPlugins(newTestGoals(test.Plugins...), test.Available, testNodeID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range plugins {
+				got = append(got, p.Name)
+			}
+			if len(got) != len(test.Want) {
+				t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+			}
+			for i := range got {
+				if got[i] != test.Want[i] {
+					t.Fatalf("Wrong plugins selected: expected %v, but %v", test.Want, got)
+				}
+			}
+			notFit := map[string]bool{}
+			for _, name := range test.NotFit {
+				notFit[name] = true
+			}
+			for _, p := range test.Plugins {
+				if notFit[p.Name] && p.Status.Reason == "" {
+					t.Errorf("Plugin %q does not fit but has no reason", p.Name)
+				}
+				if !notFit[p.Name] && p.Status.Reason != "" {
+					t.Errorf("Plugin %q has unexpected reason %q", p.Name, p.Status.Reason)
+				}
+				if want, exist := test.Profiles[p.Name]; exist {
+					if p.Status.KnobStatus == nil || p.Status.KnobStatus.Name != want {
+						t.Errorf("Plugin %q is given wrong profile: expected %q, but %v", p.Name, want, p.Status.KnobStatus)
+					}
+				}
+			}
+		})
+	}
+}
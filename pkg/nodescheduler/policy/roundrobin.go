@@ -4,39 +4,25 @@ import (
 	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
 )
 
+// roundRobinPipeline runs the oldest "ready" plugin that fits when no plugin runs
+var roundRobinPipeline = PipelineConfig{
+	Filters: []StageConfig{{Name: "maxplugins", Args: map[string]string{"max": "1"}}, {Name: "resourcefit"}},
+	Scores:  []StageConfig{{Name: "age"}},
+}
+
 type RoundRobinSchedulingPolicy struct {
+	pipeline *PipelineSchedulingPolicy
 }
 
-func NewRoundRobinSchedulingPolicy() *RoundRobinSchedulingPolicy {
-	return &RoundRobinSchedulingPolicy{}
+func NewRoundRobinSchedulingPolicy(config Config) *RoundRobinSchedulingPolicy {
+	return &RoundRobinSchedulingPolicy{pipeline: mustPipeline(config, roundRobinPipeline)}
 }
 
 // SelectBestPlugins returns the best plugin to run at the time
-// It returns the oldest plugin amongst "ready" plugins
+// It returns the oldest plugin amongst "ready" plugins that fits to the available resource
+// if no plugin is running
 func (rs *RoundRobinSchedulingPolicy) SelectBestPlugins(scienceGoals map[string]*datatype.ScienceGoal, availableResource datatype.Resource, nodeID string) (pluginsToRun []*datatype.Plugin, err error) {
-	var selectedPlugin *datatype.Plugin
-	for _, goal := range scienceGoals {
-		subGoal := goal.GetMySubGoal(nodeID)
-		for _, plugin := range subGoal.Plugins {
-			// If any plugin is currently running, we don't return other plugins to schedule
-			if plugin.Status.SchedulingStatus == datatype.Running {
-				return
-			}
-			// Pick up the oldest Ready plugin
-			if plugin.Status.SchedulingStatus == datatype.Ready {
-				// pluginsToRun = append(pluginsToRun, plugin)
-				if selectedPlugin == nil {
-					selectedPlugin = plugin
-				} else if selectedPlugin.Status.Since.After(plugin.Status.Since) {
-					selectedPlugin = plugin
-				}
-			}
-		}
-	}
-	if selectedPlugin != nil {
-		pluginsToRun = append(pluginsToRun, selectedPlugin)
-	}
-	return
+	return rs.pipeline.SelectBestPlugins(scienceGoals, availableResource, nodeID)
 }
 
 // func (ss *SimpleSchedulingPolicy) PromotePlugins(subGoal *datatype.SubGoal) (events []datatype.Event) {
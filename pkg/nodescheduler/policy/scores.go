@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// ageScore scores plugins by how long they have been "ready". The oldest plugin in the cycle scores 1
+type ageScore struct{}
+
+func newAgeScore(args map[string]string, config Config) (ScoreStage, error) {
+	return &ageScore{}, nil
+}
+
+func (s *ageScore) Score(state *CycleState, plugin *datatype.Plugin) float64 {
+	var oldest time.Duration
+	for _, p := range state.Ready {
+		if age := state.Now.Sub(p.Status.Since); age > oldest {
+			oldest = age
+		}
+	}
+	age := state.Now.Sub(plugin.Status.Since)
+	if oldest <= 0 || age <= 0 {
+		return 0
+	}
+	return float64(age) / float64(oldest)
+}
+
+// priorityScore scores plugins by their priority. Plugins of MaxPluginPriority score 1
+type priorityScore struct{}
+
+func newPriorityScore(args map[string]string, config Config) (ScoreStage, error) {
+	return &priorityScore{}, nil
+}
+
+func (s *priorityScore) Score(state *CycleState, plugin *datatype.Plugin) float64 {
+	return float64(plugin.GetPriority()) / float64(datatype.MaxPluginPriority)
+}
+
+// fairShareScore scores plugins by how under-served their user and goal are, as the fair-share
+// policy serves them. Users are ranked by their share and goals of a user by their share, and plugins
+// of a more under-served user always score higher. Plugins of the most under-served user and goal score 1.
+// The half life of runtime is given by "halfLife" in seconds, or by the config
+type fairShareScore struct {
+	*fairShareAccounting
+	// Shares are computed once per cycle at the time of the cycle
+	userShares map[string]float64
+	goalShares map[string]float64
+	userRanks  map[string]int
+	ranks      int
+	maxGoal    map[string]float64
+}
+
+func newFairShareScore(args map[string]string, config Config) (ScoreStage, error) {
+	halfLife := config.FairShareHalfLife
+	if v, exist := args["halfLife"]; exist {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("Invalid halfLife %q: must be a positive number of seconds", v)
+		}
+		halfLife = time.Duration(seconds) * time.Second
+	}
+	return &fairShareScore{fairShareAccounting: newFairShareAccounting(halfLife)}, nil
+}
+
+// Prepare computes shares of users and goals of the "ready" plugins at the time of the cycle
+func (s *fairShareScore) Prepare(state *CycleState) {
+	s.userShares, s.goalShares = s.currentShares(state.Goals, state.NodeID, state.Now)
+	s.maxGoal = make(map[string]float64)
+	var shares []float64
+	seen := make(map[float64]bool)
+	for _, p := range state.Ready {
+		user := userOfPlugin(state.Goals, p)
+		if share := s.userShares[user]; !seen[share] {
+			seen[share] = true
+			shares = append(shares, share)
+		}
+		if share := s.goalShares[p.GoalID]; share > s.maxGoal[user] {
+			s.maxGoal[user] = share
+		}
+	}
+	sort.Float64s(shares)
+	s.ranks = len(shares)
+	rankOf := make(map[float64]int)
+	for i, share := range shares {
+		rankOf[share] = i
+	}
+	s.userRanks = make(map[string]int)
+	for _, p := range state.Ready {
+		user := userOfPlugin(state.Goals, p)
+		s.userRanks[user] = rankOf[s.userShares[user]]
+	}
+}
+
+func (s *fairShareScore) Score(state *CycleState, plugin *datatype.Plugin) float64 {
+	user := userOfPlugin(state.Goals, plugin)
+	rank, exist := s.userRanks[user]
+	if !exist {
+		return 0
+	}
+	// Goals of a user take the upper half of the range of the user so that
+	// ranges of users do not overlap
+	var goal float64
+	if max := s.maxGoal[user]; max > 0 {
+		goal = s.goalShares[plugin.GoalID] / max / 2
+	}
+	return 1 - (float64(rank)+goal)/float64(s.ranks)
+}
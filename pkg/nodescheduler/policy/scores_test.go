@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func TestAgeScore(t *testing.T) {
+	now := time.Now()
+	a := newTestPlugin("a", datatype.Ready, now.Add(-10*time.Minute), nil)
+	b := newTestPlugin("b", datatype.Ready, now.Add(-5*time.Minute), nil)
+	c := newTestPlugin("c", datatype.Ready, now, nil)
+	state := newTestCycleState(now, unlimitedTestResource(), a, b, c)
+	score, _ := newAgeScore(nil, Config{})
+	want := map[*datatype.Plugin]float64{a: 1, b: 0.5, c: 0}
+	for plugin, w := range want {
+		if got := score.Score(state, plugin); math.Abs(got-w) > 0.0001 {
+			t.Errorf("Wrong age score of %q: expected %g, but %g", plugin.Name, w, got)
+		}
+	}
+}
+
+func TestPriorityScore(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Priority int
+		Want     float64
+	}{
+		"default": {Priority: 0, Want: 0},
+		"half":    {Priority: datatype.MaxPluginPriority / 2, Want: 0.5},
+		"max":     {Priority: datatype.MaxPluginPriority, Want: 1},
+	}
+	score, _ := newPriorityScore(nil, Config{})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			plugin := withPriority(newTestPlugin("a", datatype.Ready, now, nil), test.Priority)
+			state := newTestCycleState(now, unlimitedTestResource(), plugin)
+			if got := score.Score(state, plugin); math.Abs(got-test.Want) > 0.0001 {
+				t.Errorf("Wrong priority score: expected %g, but %g", test.Want, got)
+			}
+		})
+	}
+}
+
+func TestFairShareScore(t *testing.T) {
+	now := time.Now()
+	a := newTestPlugin("a", datatype.Ready, now, nil)
+	b := newTestPlugin("b", datatype.Ready, now, nil)
+	c := newTestPlugin("c", datatype.Ready, now, nil)
+	goals := goalsOf(
+		newTestGoal("g1", "alice", 0, a),
+		newTestGoal("g2", "alice", 0, b),
+		newTestGoal("g3", "bob", 0, c),
+	)
+	stage, err := newFairShareScore(map[string]string{"halfLife": "3600"}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := stage.(*fairShareScore)
+	score.now = func() time.Time { return now }
+	score.RecordRuntime(goals["g1"], a, 10*time.Minute)
+	state := &CycleState{
+		Goals:  goals,
+		NodeID: testNodeID,
+		Now:    now,
+		Ready:  readyPlugins(goals, testNodeID),
+	}
+	// Shares are of the time of the cycle. Runtime would be forgotten at the time of the accounting
+	score.now = func() time.Time { return now.Add(48 * time.Hour) }
+	score.Prepare(state)
+	// alice consumed all runtime through g1, so b of g2 is less served than a, and c of bob is the least served
+	want := map[*datatype.Plugin]float64{a: 0.25, b: 0.5, c: 1}
+	for plugin, w := range want {
+		if got := score.Score(state, plugin); math.Abs(got-w) > 0.0001 {
+			t.Errorf("Wrong fair-share score of %q: expected %g, but %g", plugin.Name, w, got)
+		}
+	}
+	if _, err := newFairShareScore(map[string]string{"halfLife": "-1"}, Config{}); err == nil {
+		t.Errorf("Negative half life must fail")
+	}
+}
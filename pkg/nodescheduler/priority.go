@@ -0,0 +1,104 @@
+package nodescheduler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"github.com/waggle-sensor/edge-scheduler/pkg/logger"
+	apiv1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const basePriorityClassName = "wes-app-priority"
+
+// priorityClassNameForPlugin returns the name of the priority class for the plugin.
+// Plugins of the default priority use the base priority class
+func priorityClassNameForPlugin(plugin *datatype.Plugin) string {
+	if priority := plugin.GetPriority(); priority > 0 {
+		return fmt.Sprintf("%s-%d", basePriorityClassName, priority)
+	}
+	return basePriorityClassName
+}
+
+// priorityClassForPlugin returns the priority class for the plugin. The value of the class
+// is the value of the base priority class plus the priority of the plugin. The class does not
+// preempt other pods as the scheduler preempts plugins itself
+func priorityClassForPlugin(plugin *datatype.Plugin, baseValue int32) *schedulingv1.PriorityClass {
+	preemptionPolicy := apiv1.PreemptNever
+	return &schedulingv1.PriorityClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: priorityClassNameForPlugin(plugin),
+		},
+		Value:            baseValue + int32(plugin.GetPriority()),
+		PreemptionPolicy: &preemptionPolicy,
+		Description:      fmt.Sprintf("Priority class for plugins of priority %d", plugin.GetPriority()),
+	}
+}
+
+// ensurePriorityClass creates the priority class for the plugin if it does not exist
+// and returns the name of the class
+func (rm *ResourceManager) ensurePriorityClass(plugin *datatype.Plugin) (string, error) {
+	name := priorityClassNameForPlugin(plugin)
+	if name == basePriorityClassName || rm.Clientset == nil {
+		return name, nil
+	}
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	if rm.priorityClasses == nil {
+		rm.priorityClasses = make(map[string]bool)
+	}
+	if rm.priorityClasses[name] {
+		return name, nil
+	}
+	var baseValue int32
+	if base, err := rm.Clientset.SchedulingV1().PriorityClasses().Get(context.TODO(), basePriorityClassName, metav1.GetOptions{}); err == nil {
+		baseValue = base.Value
+	} else {
+		logger.Error.Printf("Failed to get priority class %q. Priority starts from 0: %s", basePriorityClassName, err.Error())
+	}
+	_, err := rm.Clientset.SchedulingV1().PriorityClasses().Create(context.TODO(), priorityClassForPlugin(plugin, baseValue), metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return "", err
+	}
+	logger.Debug.Printf("Priority class %q is ready", name)
+	rm.priorityClasses[name] = true
+	return name, nil
+}
+
+// PreemptPlugin terminates the Kubernetes Job of the plugin to give its resource to other plugins.
+// The plugin is reported as preempted with the reason instead of failed. A plugin already
+// being preempted keeps the reason it was first preempted with
+func (rm *ResourceManager) PreemptPlugin(plugin *datatype.Plugin, reason string) error {
+	if plugin.PluginSpec == nil || plugin.PluginSpec.Job == "" {
+		return fmt.Errorf("Plugin %q has no Kubernetes Job to preempt", plugin.Name)
+	}
+	rm.mutex.Lock()
+	if rm.preempted == nil {
+		rm.preempted = make(map[string]string)
+	}
+	if _, exist := rm.preempted[plugin.PluginSpec.Job]; exist {
+		rm.mutex.Unlock()
+		logger.Debug.Printf("Plugin %q is already being preempted", plugin.Name)
+		return nil
+	}
+	rm.preempted[plugin.PluginSpec.Job] = reason
+	rm.mutex.Unlock()
+	if err := rm.TerminateJob(plugin.PluginSpec.Job); err != nil {
+		rm.takePreemption(plugin.PluginSpec.Job)
+		return err
+	}
+	return nil
+}
+
+// takePreemption returns the reason the job was preempted and forgets it.
+// It returns false if the job was not preempted
+func (rm *ResourceManager) takePreemption(jobName string) (string, bool) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	reason, exist := rm.preempted[jobName]
+	delete(rm.preempted, jobName)
+	return reason, exist
+}
@@ -0,0 +1,91 @@
+package nodescheduler
+
+import (
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPriorityClassForPlugin(t *testing.T) {
+	tests := map[string]struct {
+		Plugin    *datatype.Plugin
+		WantName  string
+		WantValue int32
+	}{
+		"nospec": {
+			Plugin:    &datatype.Plugin{Name: "test"},
+			WantName:  "wes-app-priority",
+			WantValue: 1000,
+		},
+		"default": {
+			Plugin:    &datatype.Plugin{Name: "test", PluginSpec: &datatype.PluginSpec{Image: "waggle/test"}},
+			WantName:  "wes-app-priority",
+			WantValue: 1000,
+		},
+		"priority": {
+			Plugin:    &datatype.Plugin{Name: "test", PluginSpec: &datatype.PluginSpec{Image: "waggle/test", Priority: 50}},
+			WantName:  "wes-app-priority-50",
+			WantValue: 1050,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := priorityClassNameForPlugin(test.Plugin); got != test.WantName {
+				t.Errorf("Wrong priority class name: expected %q, but %q", test.WantName, got)
+			}
+			class := priorityClassForPlugin(test.Plugin, 1000)
+			if class.Name != test.WantName || class.Value != test.WantValue {
+				t.Errorf("Wrong priority class: expected %q of %d, but %q of %d", test.WantName, test.WantValue, class.Name, class.Value)
+			}
+		})
+	}
+}
+
+func TestPreemptPlugin(t *testing.T) {
+	tests := map[string]struct {
+		Preempted  map[string]string
+		Job        string
+		WantErr    bool
+		WantReason string
+		WantExist  bool
+	}{
+		"running": {
+			Job:        "test",
+			WantReason: "second",
+			WantExist:  true,
+		},
+		"alreadypreempted": {
+			Preempted:  map[string]string{"test": "first"},
+			Job:        "test",
+			WantReason: "first",
+			WantExist:  true,
+		},
+		"nojob": {
+			Job:     "notexist",
+			WantErr: true,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rm := &ResourceManager{
+				Namespace: "ses",
+				Clientset: fake.NewSimpleClientset(&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "ses"},
+				}),
+				preempted: test.Preempted,
+			}
+			plugin := &datatype.Plugin{Name: "test", PluginSpec: &datatype.PluginSpec{Image: "waggle/test", Job: test.Job}}
+			err := rm.PreemptPlugin(plugin, "second")
+			if test.WantErr != (err != nil) {
+				t.Errorf("Wrong error: wanted error %t, got %v", test.WantErr, err)
+			}
+			reason, exist := rm.takePreemption(test.Job)
+			if exist != test.WantExist || reason != test.WantReason {
+				t.Errorf("Wrong preemption: expected %q (%t), but %q (%t)", test.WantReason, test.WantExist, reason, exist)
+			}
+		})
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 	metrics "k8s.io/metrics/pkg/client/clientset/versioned"
 )
 
@@ -52,15 +53,23 @@ var (
 // ResourceManager structs a resource manager talking to a local computing cluster to schedule plugins
 type ResourceManager struct {
 	Namespace     string
-	Clientset     *kubernetes.Clientset
+	Clientset     kubernetes.Interface
 	MetricsClient *metrics.Clientset
 	RMQManagement *RMQManagement
 	Notifier      *interfacing.Notifier
 	Simulate      bool
 	Plugins       []*datatype.Plugin
-	reserved      bool
+	// ResourceLimitRatio is the ratio of resource limits to requests of plugins.
+	// Plugins have no limit if zero
+	ResourceLimitRatio float64
+	// KnobInjection passes knobs of the profile chosen for plugins as either "env" or "args"
+	KnobInjection string
 	mutex         sync.Mutex
 	runner        string
+	// preempted holds reasons of Kubernetes Jobs terminated for preemption
+	preempted map[string]string
+	// priorityClasses holds priority classes created for plugins
+	priorityClasses map[string]bool
 }
 
 // NewResourceManager returns an instance of ResourceManager
@@ -72,7 +81,6 @@ func NewK3SResourceManager(incluster bool, kubeconfig string, runner string, sim
 			MetricsClient: nil,
 			Simulate:      simulate,
 			Plugins:       make([]*datatype.Plugin, 0),
-			reserved:      false,
 			runner:        runner,
 		}, nil
 	}
@@ -384,6 +392,10 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(plugin *datatype.Plugi
 		})
 	}
 
+	knobEnvs, knobArgs := knobsForPlugin(plugin, rm.KnobInjection)
+	envs = append(envs, knobEnvs...)
+	args := append(append([]string{}, plugin.PluginSpec.Args...), knobArgs...)
+
 	tag, err := plugin.PluginSpec.GetImageTag()
 	if err != nil {
 		return v1.PodTemplateSpec{}, err
@@ -506,23 +518,20 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(plugin *datatype.Plugi
 		},
 	}
 
+	require := plugin.GetRequiredResource()
+	gpuMemoryAdvertised := require.GPUMemoryInMega() > 0 && rm.isGPUMemoryAdvertised()
+	resources, _ := resourcesForPlugin(plugin, rm.ResourceLimitRatio, gpuMemoryAdvertised)
+	nodeSelector := nodeSelectorForPlugin(plugin, gpuMemoryAdvertised)
+
 	containers := []apiv1.Container{
 		{
 			SecurityContext: securityContextForConfig(plugin.PluginSpec),
 			Name:            plugin.Name,
 			Image:           plugin.PluginSpec.Image,
-			Args:            plugin.PluginSpec.Args,
+			Args:            args,
 			Env:             envs,
-			Resources: apiv1.ResourceRequirements{
-				Limits:   apiv1.ResourceList{},
-				Requests: apiv1.ResourceList{},
-				// TODO: this should be revisited when talking about resource-aware scheduling
-				// Requests: apiv1.ResourceList{
-				// 	apiv1.ResourceCPU:    resource.MustParse("1500m"),
-				// 	apiv1.ResourceMemory: resource.MustParse("1.5Gi"),
-				// },
-			},
-			VolumeMounts: volumeMounts,
+			Resources:       resources,
+			VolumeMounts:    volumeMounts,
 		},
 	}
 
@@ -530,17 +539,21 @@ func (rm *ResourceManager) createPodTemplateSpecForPlugin(plugin *datatype.Plugi
 		containers[0].Command = []string{plugin.PluginSpec.Entrypoint}
 	}
 
+	priorityClassName, err := rm.ensurePriorityClass(plugin)
+	if err != nil {
+		return v1.PodTemplateSpec{}, fmt.Errorf("Failed to create priority class for %q: %s", plugin.Name, err.Error())
+	}
+
 	return v1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels: rm.labelsForPlugin(plugin),
 		},
 		Spec: apiv1.PodSpec{
-			PriorityClassName: "wes-app-priority",
-			NodeSelector:      nodeSelectorForConfig(plugin.PluginSpec),
-			// TODO: The priority class will be revisited when using resource metrics to schedule plugins
-			InitContainers: initContainers,
-			Containers:     containers,
-			Volumes:        volumes,
+			PriorityClassName: priorityClassName,
+			NodeSelector:      nodeSelector,
+			InitContainers:    initContainers,
+			Containers:        containers,
+			Volumes:           volumes,
 		},
 	}, nil
 }
@@ -793,18 +806,65 @@ func (rm *ResourceManager) CleanUp() error {
 	return nil
 }
 
-func (rm *ResourceManager) UpdateReservation(value bool) {
-	rm.mutex.Lock()
-	defer rm.mutex.Unlock()
-	rm.reserved = value
+// getClusterResource returns the resource available on each node of the cluster to run plugins.
+// It is the allocatable resource of schedulable nodes minus the resource requested by
+// pods that are not terminated. If the metrics client is available, the resource
+// pods actually use is taken out instead when it is larger than what they request.
+// Resource is not limited in simulation
+func (rm *ResourceManager) getClusterResource() (*clusterResource, error) {
+	if rm.Simulate || rm.Clientset == nil {
+		return &clusterResource{unlimited: true}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	nodes, err := rm.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list nodes: %s", err.Error())
+	}
+	pods, err := rm.Clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list pods: %s", err.Error())
+	}
+	var podMetrics []metricsv1beta1.PodMetrics
+	if rm.MetricsClient != nil {
+		if list, err := rm.MetricsClient.MetricsV1beta1().PodMetricses("").List(ctx, metav1.ListOptions{}); err != nil {
+			logger.Debug.Printf("Failed to get pod metrics. Only resource requests are counted: %s", err.Error())
+		} else {
+			podMetrics = list.Items
+		}
+	}
+	return availableResource(nodes.Items, pods.Items, podMetrics), nil
 }
 
-func (rm *ResourceManager) WillItFit(plugin *datatype.Plugin) bool {
-	if rm.reserved {
+// isGPUMemoryAdvertised returns true if any node advertises GPU memory as an extended resource
+func (rm *ResourceManager) isGPUMemoryAdvertised() bool {
+	if rm.Clientset == nil {
 		return false
-	} else {
-		return true
 	}
+	nodes, err := rm.Clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		logger.Error.Printf("Failed to list nodes: %s", err.Error())
+		return false
+	}
+	for _, node := range nodes.Items {
+		if _, exist := node.Status.Allocatable[gpuMemoryResourceName]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// AssignJob names the Kubernetes Job the plugin runs as. It must be called before
+// LaunchAndWatchPlugin so that the scheduler reads the name without racing the launch
+func (rm *ResourceManager) AssignJob(plugin *datatype.Plugin) error {
+	name, err := pluginNameForSpecDeployment(plugin)
+	if err != nil {
+		return err
+	}
+	plugin.PluginSpec.Job = name
+	return nil
 }
 
 func (rm *ResourceManager) LaunchAndWatchPlugin(plugin *datatype.Plugin) {
@@ -823,13 +883,10 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(plugin *datatype.Plugin) {
 		return
 	}
 	logger.Info.Printf("Plugin %q deployed", job.Name)
-	plugin.PluginSpec.Job = job.Name
-	// rm.UpdateReservation(true)
 	watcher, err := rm.WatchJob(job.Name, rm.Namespace, 3)
 	if err != nil {
 		logger.Error.Printf("Failed to watch %q. Abort the execution", job.Name)
 		rm.TerminateJob(job.Name)
-		// rm.UpdateReservation(false)
 		rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusFailed).AddReason(err.Error()).AddK3SJobMeta(job).AddPluginMeta(plugin).Build())
 		return
 	}
@@ -848,11 +905,13 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(plugin *datatype.Plugin) {
 				logger.Debug.Printf("Plugin %s status %s: %s", job.Name, event.Type, job.Status.Conditions[0].Type)
 				switch job.Status.Conditions[0].Type {
 				case batchv1.JobComplete:
-					// rm.UpdateReservation(false)
 					rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusComplete).AddK3SJobMeta(job).AddPodMeta(pod).AddPluginMeta(plugin).Build())
 					return
 				case batchv1.JobFailed:
-					// rm.UpdateReservation(false)
+					if reason, preempted := rm.takePreemption(job.Name); preempted {
+						rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusPreempted).AddReason(reason).AddK3SJobMeta(job).AddPodMeta(pod).AddPluginMeta(plugin).Build())
+						return
+					}
 					rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusFailed).AddReason(job.Status.Conditions[0].Reason).AddK3SJobMeta(job).AddPodMeta(pod).AddPluginMeta(plugin).Build())
 					return
 				}
@@ -860,24 +919,23 @@ func (rm *ResourceManager) LaunchAndWatchPlugin(plugin *datatype.Plugin) {
 				logger.Debug.Printf("Plugin %s status %s: %s", job.Name, event.Type, "UNKNOWN")
 			}
 		case watch.Deleted:
+			if reason, preempted := rm.takePreemption(job.Name); preempted {
+				logger.Info.Printf("Plugin %q got preempted: %s", job.Name, reason)
+				rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusPreempted).AddReason(reason).AddK3SJobMeta(job).AddPluginMeta(plugin).Build())
+				return
+			}
 			logger.Debug.Printf("Plugin got deleted. Returning resource and notify")
-			// rm.UpdateReservation(false)
 			rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusFailed).AddReason("Plugin deleted").AddK3SJobMeta(job).AddPluginMeta(plugin).Build())
 			return
 		case watch.Error:
 			logger.Debug.Printf("Error on watcher. Returning resource and notify")
 			rm.TerminateJob(job.Name)
-			// rm.UpdateReservation(false)
 			rm.Notifier.Notify(datatype.NewEventBuilder(datatype.EventPluginStatusFailed).AddReason("Error on watcher").AddK3SJobMeta(job).AddPluginMeta(plugin).Build())
 			return
 		}
 	}
 }
 
-func (rm *ResourceManager) GatherResourceUse() {
-	// rm.Clientset.metricsv1
-}
-
 // RunGabageCollector cleans up completed/failed jobs that exceed
 // their lifespan specified in `ttlSecondsAfterFinished`
 //
@@ -934,7 +992,7 @@ func (rm *ResourceManager) Configure() (err error) {
 	return
 }
 
-func (rm *ResourceManager) Run(chanPluginToUpdate <-chan *datatype.Plugin) {
+func (rm *ResourceManager) Run(ctx context.Context, chanPluginToUpdate <-chan *datatype.Plugin) {
 	if rm.MetricsClient == nil {
 		logger.Info.Println("No metrics client is set. Metrics information cannot be obtained")
 	}
@@ -947,10 +1005,14 @@ func (rm *ResourceManager) Run(chanPluginToUpdate <-chan *datatype.Plugin) {
 	logger.Info.Printf("Pull goals from k3s configmap %s", configMapNameForGoals)
 	goalConfigMapFunc, _ := rm.GetConfigMapWatcher(configMapNameForGoals, "default")
 	goalWatcher := NewAdvancedWatcher(configMapNameForGoals, goalConfigMapFunc)
-	goalWatcher.Run()
+	goalWatcher.Run(ctx)
 	logger.Info.Println("Starting the main loop of resource manager...")
+	defer gabageCollectorTicker.Stop()
 	for {
 		select {
+		case <-ctx.Done():
+			logger.Info.Println("Resource manager stopped")
+			return
 		case <-gabageCollectorTicker.C:
 			err := rm.RunGabageCollector()
 			if err != nil {
@@ -962,7 +1024,8 @@ func (rm *ResourceManager) Run(chanPluginToUpdate <-chan *datatype.Plugin) {
 				if updatedConfigMap, ok := event.Object.(*apiv1.ConfigMap); ok {
 					logger.Debug.Printf("%v", updatedConfigMap.Data)
 					event := datatype.NewEventBuilder(datatype.EventGoalStatusReceivedBulk).
-						AddEntry("goals", updatedConfigMap.Data["goals"]).Build()
+						AddEntry("goals", updatedConfigMap.Data["goals"]).
+						AddEntry("signature", updatedConfigMap.Data["signature"]).Build()
 					rm.Notifier.Notify(event)
 				}
 			}
@@ -1131,38 +1194,51 @@ func NewAdvancedWatcher(n string, f func() (watch.Interface, error)) *AdvancedWa
 	}
 }
 
-func (w *AdvancedWatcher) runWatcher() error {
+func (w *AdvancedWatcher) runWatcher(ctx context.Context) error {
 	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 	lastEvent := time.Now()
 	timeOut := 30 * time.Minute
 	watcher, err := w.Func()
 	if err != nil {
 		return fmt.Errorf("Failed to get watcher from Kubernetes")
 	}
+	defer watcher.Stop()
 	for {
 		select {
 		case e, ok := <-watcher.ResultChan():
 			if !ok {
 				return fmt.Errorf("Watcher is closed")
 			} else {
-				w.C <- e
+				select {
+				case w.C <- e:
+				case <-ctx.Done():
+					return nil
+				}
 				lastEvent = time.Now()
 			}
 		case <-ticker.C:
 			if time.Now().After(lastEvent.Add(timeOut)) {
 				return fmt.Errorf("Watcher timed out")
 			}
+		case <-ctx.Done():
+			return nil
 		}
 	}
 }
 
-func (w *AdvancedWatcher) Run() {
+// Run keeps the watcher running until ctx is done
+func (w *AdvancedWatcher) Run(ctx context.Context) {
 	go func() {
 		for {
-			if err := w.runWatcher(); err != nil {
+			if err := w.runWatcher(ctx); err != nil {
 				logger.Error.Printf("Failed on watcher %q: %s", w.Name, err.Error())
 			}
-			time.Sleep(5 * time.Second)
+			select {
+			case <-time.After(5 * time.Second):
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 }
@@ -0,0 +1,112 @@
+package nodescheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/interfacing"
+	"github.com/waggle-sensor/edge-scheduler/pkg/sciencerule"
+)
+
+// nativeRuleEvaluator evaluates science rules in the scheduler against measures kept in memory.
+// Each goal has its own cronjobs and events
+type nativeRuleEvaluator struct {
+	mutex    sync.Mutex
+	measures *sciencerule.MeasureStore
+	states   map[string]*sciencerule.State
+	now      func() time.Time
+}
+
+func newNativeRuleEvaluator() *nativeRuleEvaluator {
+	return &nativeRuleEvaluator{
+		measures: sciencerule.NewMeasureStore(sciencerule.DefaultMeasureHistory),
+		states:   make(map[string]*sciencerule.State),
+		now:      time.Now,
+	}
+}
+
+func (e *nativeRuleEvaluator) AddMeasure(name string, value interface{}, timestamp time.Time) error {
+	e.measures.Add(name, value, timestamp)
+	return nil
+}
+
+func (e *nativeRuleEvaluator) Evaluate(goalID string, condition string) (bool, error) {
+	expression, err := sciencerule.Parse(condition)
+	if err != nil {
+		return false, err
+	}
+	e.mutex.Lock()
+	state, exist := e.states[goalID]
+	if !exist {
+		state = sciencerule.NewState()
+		e.states[goalID] = state
+	}
+	e.mutex.Unlock()
+	return expression.Evaluate(&sciencerule.Env{
+		Now:      e.now(),
+		Measures: e.measures,
+		State:    state,
+	})
+}
+
+func (e *nativeRuleEvaluator) Forget(goalID string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	delete(e.states, goalID)
+}
+
+// httpRuleEvaluator evaluates science rules by the science rule checker over HTTP
+type httpRuleEvaluator struct {
+	ruleCheckerURI string
+}
+
+func newHTTPRuleEvaluator(ruleCheckerURI string) *httpRuleEvaluator {
+	return &httpRuleEvaluator{ruleCheckerURI: ruleCheckerURI}
+}
+
+func (e *httpRuleEvaluator) AddMeasure(name string, value interface{}, timestamp time.Time) error {
+	r := interfacing.NewHTTPRequest(e.ruleCheckerURI)
+	data, _ := json.Marshal(map[string]interface{}{
+		"key":   name,
+		"value": value,
+	})
+	resp, err := r.RequestPost("store", data)
+	if err != nil {
+		return fmt.Errorf("Failed to send measure to checker: %s", err.Error())
+	}
+	if _, err := r.ParseJSONHTTPResponse(resp); err != nil {
+		return fmt.Errorf("Failed to parse response: %s", err.Error())
+	}
+	return nil
+}
+
+func (e *httpRuleEvaluator) Evaluate(goalID string, condition string) (bool, error) {
+	r := interfacing.NewHTTPRequest(e.ruleCheckerURI)
+	data, _ := json.Marshal(map[string]interface{}{
+		"rule": condition,
+	})
+	resp, err := r.RequestPost("evaluate", data)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get data from checker: %s", err.Error())
+	}
+	body, err := r.ParseJSONHTTPResponse(resp)
+	if err != nil {
+		return false, fmt.Errorf("Failed to parse response: %s", err.Error())
+	}
+	if r, exists := body["response"]; exists {
+		if r.(string) == "failed" {
+			return false, fmt.Errorf("Failed to evaluate rule: %s", body["error"])
+		}
+	}
+	if v, exists := body["result"]; exists {
+		if result, ok := v.(bool); ok {
+			return result, nil
+		}
+	}
+	return false, fmt.Errorf("Response does not contain result: %v", body)
+}
+
+// Forget does nothing as the checker does not keep rules by goal
+func (e *httpRuleEvaluator) Forget(goalID string) {}
@@ -0,0 +1,188 @@
+package nodescheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+// ConcurrencyLimits limits the number of plugins running at the same time. No limit applies if zero
+type ConcurrencyLimits struct {
+	// Global limits plugins running on the node
+	Global int `json:"global" yaml:"global"`
+	// Goal limits plugins running for each science goal
+	Goal int `json:"goal" yaml:"goal"`
+	// Devices limits plugins running on devices
+	Devices []DeviceLimit `json:"devices" yaml:"devices"`
+}
+
+// DeviceLimit limits plugins running on a device. A plugin runs on the device if its node selector
+// has all labels of Selector. Plugins requiring GPU memory have the label resource.gpu=true,
+// for example, at most one GPU plugin runs at a time with {"resource.gpu": "true"} and Max 1
+type DeviceLimit struct {
+	Name     string            `json:"name" yaml:"name"`
+	Selector map[string]string `json:"selector" yaml:"selector"`
+	Max      int               `json:"max" yaml:"max"`
+}
+
+// Validate returns an error if any of the limits is negative
+func (l *ConcurrencyLimits) Validate() error {
+	if l.Global < 0 || l.Goal < 0 {
+		return fmt.Errorf("Concurrency limits must not be negative")
+	}
+	for _, device := range l.Devices {
+		if device.Max < 0 {
+			return fmt.Errorf("Concurrency limit of device %q must not be negative", device.Name)
+		}
+		if len(device.Selector) < 1 {
+			return fmt.Errorf("Concurrency limit of device %q has no selector", device.Name)
+		}
+	}
+	return nil
+}
+
+// queuedPlugin is a plugin waiting for a slot
+type queuedPlugin struct {
+	plugin *datatype.Plugin
+	since  time.Time
+	reason string
+}
+
+// admittedPlugin is a plugin given a slot and how long it waited in the queue for it
+type admittedPlugin struct {
+	plugin *datatype.Plugin
+	waited time.Duration
+}
+
+// slotAllocation is the result of giving slots to plugins. Admitted plugins take a slot,
+// Queued plugins are those that joined the queue and Moved plugins are those that were
+// already waiting and changed their position in the queue
+type slotAllocation struct {
+	Admitted []admittedPlugin
+	Queued   []*queuedPlugin
+	Moved    []*queuedPlugin
+}
+
+// pluginSlots keeps the queue of "ready" plugins waiting for a slot under the concurrency limits
+type pluginSlots struct {
+	limits ConcurrencyLimits
+	queue  []*queuedPlugin
+}
+
+func newPluginSlots(limits ConcurrencyLimits) *pluginSlots {
+	return &pluginSlots{limits: limits}
+}
+
+// allocate gives slots to the plugins selected by the policy in the order while the running plugins
+// take theirs. Plugins that do not get a slot wait in the queue in the order. Plugins that waited before
+// but are not selected this time leave the queue
+func (s *pluginSlots) allocate(selected []*datatype.Plugin, running []*datatype.Plugin, now time.Time) (allocation slotAllocation) {
+	taken := append([]*datatype.Plugin{}, running...)
+	var queue []*queuedPlugin
+	for _, plugin := range selected {
+		reason := s.noSlotReason(plugin, taken)
+		if reason == "" {
+			taken = append(taken, plugin)
+			admitted := admittedPlugin{plugin: plugin}
+			if q := s.find(plugin); q != nil {
+				admitted.waited = now.Sub(q.since)
+			}
+			allocation.Admitted = append(allocation.Admitted, admitted)
+			continue
+		}
+		plugin.Status.Reason = reason
+		if q := s.find(plugin); q != nil {
+			q.reason = reason
+			queue = append(queue, q)
+		} else {
+			q := &queuedPlugin{plugin: plugin, since: now, reason: reason}
+			queue = append(queue, q)
+			allocation.Queued = append(allocation.Queued, q)
+		}
+	}
+	for i, q := range queue {
+		if position := s.position(q.plugin); position > 0 && position != i+1 {
+			allocation.Moved = append(allocation.Moved, q)
+		}
+	}
+	s.queue = queue
+	return
+}
+
+// position returns the position of the plugin in the queue starting from 1.
+// It returns 0 if the plugin is not in the queue
+func (s *pluginSlots) position(plugin *datatype.Plugin) int {
+	for i, q := range s.queue {
+		if q.plugin == plugin {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (s *pluginSlots) find(plugin *datatype.Plugin) *queuedPlugin {
+	for _, q := range s.queue {
+		if q.plugin == plugin {
+			return q
+		}
+	}
+	return nil
+}
+
+// noSlotReason returns why the plugin cannot take a slot while the other plugins take theirs.
+// It returns an empty string if a slot is available
+func (s *pluginSlots) noSlotReason(plugin *datatype.Plugin, taken []*datatype.Plugin) string {
+	if s.limits.Global > 0 && len(taken) >= s.limits.Global {
+		return fmt.Sprintf("No slot: %d plugins running on the node", len(taken))
+	}
+	if s.limits.Goal > 0 {
+		count := 0
+		for _, p := range taken {
+			if p.GoalID == plugin.GoalID {
+				count++
+			}
+		}
+		if count >= s.limits.Goal {
+			return fmt.Sprintf("No slot: %d plugins running for the goal", count)
+		}
+	}
+	labels := deviceLabelsForPlugin(plugin)
+	for _, device := range s.limits.Devices {
+		if device.Max < 1 || !matchLabels(labels, device.Selector) {
+			continue
+		}
+		count := 0
+		for _, p := range taken {
+			if matchLabels(deviceLabelsForPlugin(p), device.Selector) {
+				count++
+			}
+		}
+		if count >= device.Max {
+			return fmt.Sprintf("No slot: %d plugins running on device %s", count, device.Name)
+		}
+	}
+	return ""
+}
+
+// deviceLabelsForPlugin returns node labels the plugin requires to run
+func deviceLabelsForPlugin(plugin *datatype.Plugin) map[string]string {
+	labels := map[string]string{}
+	if plugin.PluginSpec != nil {
+		labels = nodeSelectorForConfig(plugin.PluginSpec)
+	}
+	require := plugin.GetRequiredResource()
+	if require.GPUMemoryInMega() > 0 {
+		labels[gpuNodeSelector] = "true"
+	}
+	return labels
+}
+
+func matchLabels(labels map[string]string, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package nodescheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+)
+
+func newSlotTestPlugin(name string, goalID string, selector map[string]string, gpuMemory string) *datatype.Plugin {
+	plugin := &datatype.Plugin{
+		Name:       name,
+		GoalID:     goalID,
+		PluginSpec: &datatype.PluginSpec{Image: "waggle/" + name, Selector: selector},
+	}
+	if gpuMemory != "" {
+		plugin.Status.KnobStatus = &datatype.Profile{Name: "gpu", Require: datatype.Resource{GPUMemory: gpuMemory}}
+	}
+	return plugin
+}
+
+func TestPluginSlotsAllocate(t *testing.T) {
+	gpu := func(name string, goalID string) *datatype.Plugin {
+		return newSlotTestPlugin(name, goalID, nil, "1Gi")
+	}
+	cpu := func(name string, goalID string) *datatype.Plugin {
+		return newSlotTestPlugin(name, goalID, nil, "")
+	}
+	gpuLimit := DeviceLimit{Name: "nxcore-gpu", Selector: map[string]string{gpuNodeSelector: "true"}, Max: 1}
+	tests := map[string]struct {
+		Limits       ConcurrencyLimits
+		Running      []*datatype.Plugin
+		Selected     []*datatype.Plugin
+		WantAdmitted []string
+		WantQueued   []string
+	}{
+		"nolimit": {
+			Running:      []*datatype.Plugin{cpu("a", "g1")},
+			Selected:     []*datatype.Plugin{cpu("b", "g1"), cpu("c", "g1")},
+			WantAdmitted: []string{"b", "c"},
+		},
+		"global": {
+			Limits:       ConcurrencyLimits{Global: 2},
+			Running:      []*datatype.Plugin{cpu("a", "g1")},
+			Selected:     []*datatype.Plugin{cpu("b", "g2"), cpu("c", "g3")},
+			WantAdmitted: []string{"b"},
+			WantQueued:   []string{"c"},
+		},
+		"goal": {
+			Limits:       ConcurrencyLimits{Goal: 1},
+			Running:      []*datatype.Plugin{cpu("a", "g1")},
+			Selected:     []*datatype.Plugin{cpu("b", "g1"), cpu("c", "g2"), cpu("d", "g2")},
+			WantAdmitted: []string{"c"},
+			WantQueued:   []string{"b", "d"},
+		},
+		"device": {
+			Limits:       ConcurrencyLimits{Devices: []DeviceLimit{gpuLimit}},
+			Selected:     []*datatype.Plugin{gpu("a", "g1"), gpu("b", "g2"), cpu("c", "g2")},
+			WantAdmitted: []string{"a", "c"},
+			WantQueued:   []string{"b"},
+		},
+		"deviceBySelector": {
+			Limits: ConcurrencyLimits{Devices: []DeviceLimit{gpuLimit}},
+			Running: []*datatype.Plugin{
+				newSlotTestPlugin("a", "g1", map[string]string{gpuNodeSelector: "true"}, ""),
+			},
+			Selected:     []*datatype.Plugin{gpu("b", "g2"), newSlotTestPlugin("c", "g2", map[string]string{"zone": "core"}, "")},
+			WantAdmitted: []string{"c"},
+			WantQueued:   []string{"b"},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			slots := newPluginSlots(test.Limits)
+			allocation := slots.allocate(test.Selected, test.Running, time.Now())
+			var admitted, queued []string
+			for _, a := range allocation.Admitted {
+				admitted = append(admitted, a.plugin.Name)
+			}
+			for _, q := range allocation.Queued {
+				queued = append(queued, q.plugin.Name)
+				if q.plugin.Status.Reason == "" {
+					t.Errorf("Queued plugin %q has no reason", q.plugin.Name)
+				}
+			}
+			if !equalNames(admitted, test.WantAdmitted) {
+				t.Errorf("Wrong plugins admitted: expected %v, but %v", test.WantAdmitted, admitted)
+			}
+			if !equalNames(queued, test.WantQueued) {
+				t.Errorf("Wrong plugins queued: expected %v, but %v", test.WantQueued, queued)
+			}
+			for i, name := range test.WantQueued {
+				for _, p := range test.Selected {
+					if p.Name == name && slots.position(p) != i+1 {
+						t.Errorf("Wrong queue position of %q: expected %d, but %d", name, i+1, slots.position(p))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPluginSlotsQueue(t *testing.T) {
+	now := time.Now()
+	slots := newPluginSlots(ConcurrencyLimits{Global: 1})
+	a := newSlotTestPlugin("a", "g1", nil, "")
+	b := newSlotTestPlugin("b", "g1", nil, "")
+	c := newSlotTestPlugin("c", "g1", nil, "")
+	// b and c wait for a to finish
+	allocation := slots.allocate([]*datatype.Plugin{b, c}, []*datatype.Plugin{a}, now)
+	if len(allocation.Queued) != 2 || slots.position(b) != 1 || slots.position(c) != 2 {
+		t.Fatalf("b and c must be queued in order: %d queued", len(allocation.Queued))
+	}
+	// b is still waiting and does not join the queue again
+	allocation = slots.allocate([]*datatype.Plugin{b, c}, []*datatype.Plugin{a}, now.Add(time.Minute))
+	if len(allocation.Queued) != 0 || len(allocation.Admitted) != 0 {
+		t.Fatalf("Nothing must change while a is running")
+	}
+	// a finished and b takes the slot after waiting for 2 minutes
+	allocation = slots.allocate([]*datatype.Plugin{b, c}, nil, now.Add(2*time.Minute))
+	if len(allocation.Admitted) != 1 || allocation.Admitted[0].plugin != b {
+		t.Fatalf("b must be admitted")
+	}
+	if allocation.Admitted[0].waited != 2*time.Minute {
+		t.Errorf("Wrong wait time of b: expected %s, but %s", 2*time.Minute, allocation.Admitted[0].waited)
+	}
+	if slots.position(b) != 0 || slots.position(c) != 1 {
+		t.Errorf("c must be the first in the queue: b at %d, c at %d", slots.position(b), slots.position(c))
+	}
+	if len(allocation.Moved) != 1 || allocation.Moved[0].plugin != c {
+		t.Errorf("c must be announced for moving in the queue: %d moved", len(allocation.Moved))
+	}
+	// c leaves the queue when not selected
+	slots.allocate(nil, []*datatype.Plugin{b}, now.Add(3*time.Minute))
+	if slots.position(c) != 0 {
+		t.Errorf("c must leave the queue")
+	}
+}
+
+func TestPluginSlotsPreemption(t *testing.T) {
+	slots := newPluginSlots(ConcurrencyLimits{Global: 1})
+	victim := newSlotTestPlugin("victim", "g1", nil, "")
+	preemptor := newSlotTestPlugin("preemptor", "g2", nil, "")
+	// The victim is still running until its preemption completes but gives its slot to the preemptor
+	running := excludePlugins([]*datatype.Plugin{victim}, []*datatype.Plugin{victim})
+	allocation := slots.allocate([]*datatype.Plugin{preemptor}, running, time.Now())
+	if len(allocation.Admitted) != 1 || allocation.Admitted[0].plugin != preemptor {
+		t.Errorf("Preemptor must take the slot of the victim: %d queued", len(allocation.Queued))
+	}
+}
+
+func equalNames(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package sciencerule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	cronMonthNames   = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronWeekdayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// cronSearchLimit bounds how far the next time of a schedule is searched for.
+// Schedules that never match, for example, on February 30th, have no next time
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// CronSchedule is a schedule of a cron expression of 5 fields:
+// minute, hour, day of month, month and day of week
+type CronSchedule struct {
+	expression string
+	minutes    uint64
+	hours      uint64
+	days       uint64
+	months     uint64
+	weekdays   uint64
+	// anyDay is true if the day of month or the day of week is "*". Otherwise,
+	// a day matches if either of them matches as in the standard cron
+	anyDay bool
+}
+
+// ParseCronSchedule parses a cron expression such as "*/10 * * * *". Fields may have lists,
+// ranges and steps. Months and days of week may be given by their names, for example, "jan" and "mon".
+// Sunday is either 0 or 7 in the day of week
+func ParseCronSchedule(expression string) (*CronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Cron expression %q must have 5 fields", expression)
+	}
+	s := &CronSchedule{expression: expression}
+	var err error
+	if s.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if s.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return nil, err
+	}
+	// Sunday is 0 as in time.Weekday
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	s.anyDay = strings.HasPrefix(fields[2], "*") || strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField returns the bits of values the field matches
+func parseCronField(field string, min int, max int, names map[string]int) (bits uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if sp := strings.SplitN(part, "/", 2); len(sp) == 2 {
+			s, err := strconv.Atoi(sp[1])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("Invalid step in cron field %q", field)
+			}
+			part, step = sp[0], s
+		}
+		low, high := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			sp := strings.SplitN(part, "-", 2)
+			l, err1 := parseCronValue(sp[0], names)
+			h, err2 := parseCronValue(sp[1], names)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("Invalid range in cron field %q", field)
+			}
+			low, high = l, h
+		default:
+			v, err := parseCronValue(part, names)
+			if err != nil {
+				return 0, fmt.Errorf("Invalid value in cron field %q", field)
+			}
+			low = v
+			if step == 1 {
+				high = v
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("Cron field %q is out of range", field)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, exist := names[strings.ToLower(s)]; exist {
+		return v, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// Matches returns true if the schedule runs at the minute of the time
+func (s *CronSchedule) Matches(t time.Time) bool {
+	return s.minutes&(1<<uint(t.Minute())) != 0 &&
+		s.hours&(1<<uint(t.Hour())) != 0 &&
+		s.months&(1<<uint(t.Month())) != 0 &&
+		s.matchesDay(t)
+}
+
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if s.anyDay {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+// Next returns the first time the schedule runs after the time. It returns the zero time
+// if the schedule does not run in the next 5 years
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case s.months&(1<<uint(month)) == 0:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) String() string {
+	return s.expression
+}
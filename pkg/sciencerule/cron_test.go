@@ -0,0 +1,125 @@
+package sciencerule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	tests := map[string]struct {
+		Expression string
+		WantErr    bool
+	}{
+		"everyMinute":   {Expression: "* * * * *"},
+		"hourly":        {Expression: "0 * * * *"},
+		"step":          {Expression: "*/10 * * * *"},
+		"list":          {Expression: "*/5 7,8,9 * * *"},
+		"range":         {Expression: "0 9-17 * * 1-5"},
+		"names":         {Expression: "0 0 * jan-mar MON"},
+		"sundayAsSeven": {Expression: "0 0 * * 7"},
+		"tooFewFields":  {Expression: "* * * *", WantErr: true},
+		"tooManyFields": {Expression: "* * * * * *", WantErr: true},
+		"outOfRange":    {Expression: "60 * * * *", WantErr: true},
+		"zeroDay":       {Expression: "0 0 0 * *", WantErr: true},
+		"zeroStep":      {Expression: "*/0 * * * *", WantErr: true},
+		"invertedRange": {Expression: "0 17-9 * * *", WantErr: true},
+		"invalidValue":  {Expression: "a * * * *", WantErr: true},
+		"invalidName":   {Expression: "0 0 * foo *", WantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseCronSchedule(test.Expression)
+			if (err != nil) != test.WantErr {
+				t.Errorf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	at := func(month time.Month, day int, hour int, minute int) time.Time {
+		return time.Date(2022, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := map[string]struct {
+		Expression string
+		After      time.Time
+		Want       time.Time
+	}{
+		"everyMinute": {
+			Expression: "* * * * *",
+			After:      at(6, 1, 12, 0).Add(30 * time.Second),
+			Want:       at(6, 1, 12, 1),
+		},
+		"notSameMinute": {
+			Expression: "0 * * * *",
+			After:      at(6, 1, 12, 0),
+			Want:       at(6, 1, 13, 0),
+		},
+		"step": {
+			Expression: "*/10 * * * *",
+			After:      at(6, 1, 12, 31),
+			Want:       at(6, 1, 12, 40),
+		},
+		"nextHour": {
+			Expression: "*/5 7,8,9 * * *",
+			After:      at(6, 1, 7, 58),
+			Want:       at(6, 1, 8, 0),
+		},
+		"nextDay": {
+			Expression: "*/5 7,8,9 * * *",
+			After:      at(6, 1, 9, 55),
+			Want:       at(6, 2, 7, 0),
+		},
+		"weekday": {
+			// 2022-06-04 is Saturday
+			Expression: "0 9 * * mon-fri",
+			After:      at(6, 3, 10, 0),
+			Want:       at(6, 6, 9, 0),
+		},
+		"sunday": {
+			Expression: "0 0 * * 7",
+			After:      at(6, 1, 0, 0),
+			Want:       at(6, 5, 0, 0),
+		},
+		"dayOrWeekday": {
+			// runs on the 10th or on Mondays
+			Expression: "0 0 10 * 1",
+			After:      at(6, 1, 0, 0),
+			Want:       at(6, 6, 0, 0),
+		},
+		"nextMonth": {
+			Expression: "0 0 1 * *",
+			After:      at(6, 1, 0, 0),
+			Want:       at(7, 1, 0, 0),
+		},
+		"nextYear": {
+			Expression: "30 6 1 jan *",
+			After:      at(6, 1, 0, 0),
+			Want:       time.Date(2023, time.January, 1, 6, 30, 0, 0, time.UTC),
+		},
+		"leapDay": {
+			Expression: "0 0 29 2 *",
+			After:      at(6, 1, 0, 0),
+			Want:       time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"never": {
+			Expression: "0 0 30 2 *",
+			After:      at(6, 1, 0, 0),
+			Want:       time.Time{},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := ParseCronSchedule(test.Expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(test.After); !got.Equal(test.Want) {
+				t.Errorf("Wrong next time: expected %s, but %s", test.Want, got)
+			}
+			if !test.Want.IsZero() && !s.Matches(test.Want) {
+				t.Errorf("Schedule must match %s", test.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package sciencerule
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoMeasure is returned when a rule looks up a measure that has no value. Rules
+// looking up measures that are not published yet fail with it
+var ErrNoMeasure = errors.New("No measure")
+
+// Env is the local state a condition is evaluated against
+type Env struct {
+	// Now is the time of the evaluation. Time functions use its location
+	Now      time.Time
+	Measures *MeasureStore
+	// State is what rules of a science goal remember between evaluations
+	State *State
+	// updates change State when the condition is true
+	updates []func()
+}
+
+// onTrue defers the update of the state until the condition turns out to be true
+func (env *Env) onTrue(update func()) {
+	env.updates = append(env.updates, update)
+}
+
+// Evaluate evaluates the condition and returns whether it is true. Numbers other than 0
+// and strings other than "" are true. Cronjobs run and events are seen only if the condition is true
+func (e *Expression) Evaluate(env *Env) (bool, error) {
+	local := *env
+	local.updates = nil
+	if local.Measures == nil {
+		local.Measures = NewMeasureStore(0)
+	}
+	if local.State == nil {
+		local.State = NewState()
+	}
+	v, err := e.root.eval(&local)
+	if err != nil {
+		return false, err
+	}
+	if !truthy(v) {
+		return false, nil
+	}
+	for _, update := range local.updates {
+		update()
+	}
+	return true, nil
+}
+
+type node interface {
+	eval(env *Env) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(env *Env) (interface{}, error) {
+	return n.value, nil
+}
+
+// timeMeasures are measures of the time of the evaluation
+var timeMeasures = map[string]func(time.Time) float64{
+	"sys.time.hour":    func(t time.Time) float64 { return float64(t.Hour()) },
+	"sys.time.minute":  func(t time.Time) float64 { return float64(t.Minute()) },
+	"sys.time.weekday": func(t time.Time) float64 { return float64(t.Weekday()) },
+	"sys.time.day":     func(t time.Time) float64 { return float64(t.Day()) },
+	"sys.time.month":   func(t time.Time) float64 { return float64(t.Month()) },
+}
+
+type measureNode struct {
+	name string
+}
+
+func (n *measureNode) eval(env *Env) (interface{}, error) {
+	if f, exist := timeMeasures[n.name]; exist {
+		return f(env.Now), nil
+	}
+	m, exist := env.Measures.Latest(n.name)
+	if !exist {
+		return nil, fmt.Errorf("%w %q", ErrNoMeasure, n.name)
+	}
+	return m.Value, nil
+}
+
+type callNode struct {
+	name     string
+	function function
+	args     []node
+}
+
+func (n *callNode) eval(env *Env) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	v, err := n.function.call(env, args)
+	if err != nil && !errors.Is(err, ErrNoMeasure) {
+		return nil, fmt.Errorf("%s: %s", n.name, err.Error())
+	}
+	return v, err
+}
+
+type notNode struct {
+	x node
+}
+
+func (n *notNode) eval(env *Env) (interface{}, error) {
+	mark := len(env.updates)
+	v, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	// updates are for the operand being true
+	env.updates = env.updates[:mark]
+	return !truthy(v), nil
+}
+
+// logicalNode is "and" or "or". The right hand side is not evaluated if
+// the left hand side decides the result. A side looking up a measure that
+// has no value is false
+type logicalNode struct {
+	op string
+	x  node
+	y  node
+}
+
+func (n *logicalNode) eval(env *Env) (interface{}, error) {
+	// updates of a false side must not change the state
+	mark := len(env.updates)
+	x, err := evalOrFalse(n.x, env)
+	if err != nil {
+		return nil, err
+	}
+	if !x {
+		env.updates = env.updates[:mark]
+		if n.op == "and" {
+			return false, nil
+		}
+	}
+	if n.op == "or" && x {
+		return true, nil
+	}
+	y, err := evalOrFalse(n.y, env)
+	if err != nil {
+		return nil, err
+	}
+	if !y {
+		env.updates = env.updates[:mark]
+	}
+	return y, nil
+}
+
+// evalOrFalse returns whether the node is true. It is false if the node looks up
+// a measure that has no value
+func evalOrFalse(n node, env *Env) (bool, error) {
+	v, err := n.eval(env)
+	if errors.Is(err, ErrNoMeasure) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return truthy(v), nil
+}
+
+// comparisonNode is a chain of comparisons. a < b <= c is a < b and b <= c
+// where b is evaluated once
+type comparisonNode struct {
+	operands []node
+	ops      []string
+}
+
+func (n *comparisonNode) eval(env *Env) (interface{}, error) {
+	x, err := n.operands[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range n.ops {
+		y, err := n.operands[i+1].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		result, err := compare(op, x, y)
+		if err != nil {
+			return nil, err
+		}
+		if !result {
+			return false, nil
+		}
+		x = y
+	}
+	return true, nil
+}
+
+type arithmeticNode struct {
+	op string
+	x  node
+	y  node
+}
+
+func (n *arithmeticNode) eval(env *Env) (interface{}, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	y, err := n.y.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	a, okA := toNumber(x)
+	b, okB := toNumber(y)
+	if !okA || !okB {
+		return nil, fmt.Errorf("Cannot apply %s to %s and %s", n.op, describe(x), describe(y))
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("Division by zero")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, fmt.Errorf("Division by zero")
+		}
+		// the result has the sign of the divisor as in Python
+		r := math.Mod(a, b)
+		if r != 0 && (r < 0) != (b < 0) {
+			r += b
+		}
+		return r, nil
+	}
+	return nil, fmt.Errorf("Unknown operator %s", n.op)
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case nil:
+		return false
+	}
+	return true
+}
+
+// toNumber returns the number of the value. True and False are 1 and 0 as in Python
+func toNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case nil:
+		return "None"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// compare compares numbers and booleans by their number and strings by their text.
+// Values of other types are not equal and cannot be ordered
+func compare(op string, x interface{}, y interface{}) (bool, error) {
+	var c int
+	a, okA := toNumber(x)
+	b, okB := toNumber(y)
+	s, okS := x.(string)
+	t, okT := y.(string)
+	switch {
+	case okA && okB:
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	case okS && okT:
+		c = strings.Compare(s, t)
+	default:
+		switch op {
+		case "==":
+			return x == nil && y == nil, nil
+		case "!=":
+			return !(x == nil && y == nil), nil
+		}
+		return false, fmt.Errorf("Cannot compare %s %s %s", describe(x), op, describe(y))
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return false, fmt.Errorf("Unknown operator %s", op)
+}
@@ -0,0 +1,242 @@
+package sciencerule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestEnv(now time.Time) *Env {
+	measures := NewMeasureStore(0)
+	measures.Add("env.raingauge.uint", 5, now.Add(-time.Minute))
+	measures.Add("env.coverage.cloud", 0.2, now.Add(-2*time.Hour))
+	measures.Add("env.detection.smoke", true, now.Add(-time.Minute))
+	measures.Add("env.detection.heat", false, now.Add(-time.Minute))
+	measures.Add("env.weather", "cloudy", now.Add(-time.Minute))
+	for i, v := range []float64{10, 20, 30, 40} {
+		measures.Add("env.temperature", v, now.Add(-time.Duration(100-i*30)*time.Minute))
+	}
+	return &Env{Now: now, Measures: measures, State: NewState()}
+}
+
+func TestEvaluate(t *testing.T) {
+	// 2022-06-01 is Wednesday
+	now := time.Date(2022, 6, 1, 14, 30, 0, 0, time.UTC)
+	tests := map[string]struct {
+		Condition string
+		Want      bool
+		WantErr   bool
+		NoMeasure bool
+	}{
+		"true":              {Condition: "True", Want: true},
+		"false":             {Condition: "false", Want: false},
+		"number":            {Condition: "2", Want: true},
+		"zero":              {Condition: "0", Want: false},
+		"emptyString":       {Condition: "''", Want: false},
+		"and":               {Condition: "True and False", Want: false},
+		"or":                {Condition: "False or True", Want: true},
+		"not":               {Condition: "not False", Want: true},
+		"precedence":        {Condition: "True or False and False", Want: true},
+		"notPrecedence":     {Condition: "not False and False", Want: false},
+		"parentheses":       {Condition: "(True or False) and False", Want: false},
+		"measure":           {Condition: "v('env.raingauge.uint') > 3", Want: true},
+		"measureName":       {Condition: "env.raingauge.uint == 5", Want: true},
+		"measureBool":       {Condition: "v('env.detection.heat') == True or v('env.detection.smoke') == True", Want: true},
+		"boolAsNumber":      {Condition: "v('env.detection.smoke') == 1", Want: true},
+		"measureString":     {Condition: "v('env.weather') == 'cloudy'", Want: true},
+		"stringNotEqual":    {Condition: "v('env.weather') != 'sunny'", Want: true},
+		"stringOrder":       {Condition: "'a' < 'b'", Want: true},
+		"mixedEqual":        {Condition: "v('env.weather') == 1", Want: false},
+		"mixedNotEqual":     {Condition: "v('env.weather') != 1", Want: true},
+		"mixedOrder":        {Condition: "v('env.weather') > 1", WantErr: true},
+		"chained":           {Condition: "1 < v('env.raingauge.uint') <= 5", Want: true},
+		"chainedFalse":      {Condition: "1 < v('env.raingauge.uint') < 5", Want: false},
+		"chainedFirstFalse": {Condition: "6 < v('env.raingauge.uint') < 10", Want: false},
+		"arithmetic":        {Condition: "v('env.raingauge.uint') * 2 + 1 == 11", Want: true},
+		"unaryMinus":        {Condition: "-v('env.raingauge.uint') == -5", Want: true},
+		"modulo":            {Condition: "sys.time.minute % 15 == 0", Want: true},
+		"negativeModulo":    {Condition: "-1 % 15 == 14", Want: true},
+		"divisionByZero":    {Condition: "1 / 0 > 1", WantErr: true},
+		"stringArithmetic":  {Condition: "'a' + 1 > 1", WantErr: true},
+		"noMeasure":         {Condition: "v('env.none') > 1", WantErr: true, NoMeasure: true},
+		"noMeasureName":     {Condition: "env.none > 1", WantErr: true, NoMeasure: true},
+		"noMeasureShortcut": {Condition: "False and v('env.none') > 1", Want: false},
+		"noMeasureOr":       {Condition: "True or v('env.none') > 1", Want: true},
+		"noMeasureOrLeft":   {Condition: "v('env.none') > 1 or v('env.raingauge.uint') > 3", Want: true},
+		"noMeasureOrFalse":  {Condition: "v('env.none') > 1 or False", Want: false},
+		"noMeasureAnd":      {Condition: "True and v('env.none') > 1", Want: false},
+		"noMeasureNot":      {Condition: "not v('env.none') > 1", WantErr: true, NoMeasure: true},
+		"window":            {Condition: "v('env.raingauge.uint', '5m') == 5", Want: true},
+		"windowNegative":    {Condition: "v('env.raingauge.uint', '-5m') == 5", Want: true},
+		"windowSeconds":     {Condition: "v('env.raingauge.uint', 300) == 5", Want: true},
+		"windowTooOld":      {Condition: "v('env.coverage.cloud', '1h') > 0.3", WantErr: true, NoMeasure: true},
+		"invalidWindow":     {Condition: "v('env.raingauge.uint', 'soon') > 1", WantErr: true},
+		"zeroWindow":        {Condition: "v('env.raingauge.uint', 0) > 1", WantErr: true},
+		"nameNotString":     {Condition: "v(1) > 1", WantErr: true},
+		"elapsed":           {Condition: "elapsed('env.raingauge.uint') == 60", Want: true},
+		"avg":               {Condition: "avg('env.temperature', '1h') == 35", Want: true},
+		"avgAll":            {Condition: "avg('env.temperature', '2h') == 25", Want: true},
+		"min":               {Condition: "min('env.temperature', '1h') == 30", Want: true},
+		"max":               {Condition: "max('env.temperature', '1h') == 40", Want: true},
+		"sum":               {Condition: "sum('env.temperature', '1h') == 70", Want: true},
+		"count":             {Condition: "count('env.temperature', '1h') == 2", Want: true},
+		"countNone":         {Condition: "count('env.none', '1h') == 0", Want: true},
+		"avgNone":           {Condition: "avg('env.none', '1h') > 1", WantErr: true, NoMeasure: true},
+		"hour":              {Condition: "hour() == 14 and sys.time.hour == 14", Want: true},
+		"minute":            {Condition: "minute() == 30", Want: true},
+		"weekday":           {Condition: "weekday() == 3 and sys.time.weekday == 3", Want: true},
+		"day":               {Condition: "day() == 1 and month() == 6", Want: true},
+		"daytime":           {Condition: "6 <= sys.time.hour < 18", Want: true},
+		"between":           {Condition: "between('09:00', '17:00')", Want: true},
+		"betweenEnd":        {Condition: "between('09:00', '14:30')", Want: false},
+		"betweenMidnight":   {Condition: "between('22:00', '06:00')", Want: false},
+		"betweenInvalid":    {Condition: "between('9', '17:00')", WantErr: true},
+		"eventNone":         {Condition: "e('env.event.traffic')", Want: false},
+		"invalidCronjob":    {Condition: "cronjob('a', '* *')", WantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := Parse(test.Condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := e.Evaluate(newTestEnv(now))
+			if (err != nil) != test.WantErr {
+				t.Fatalf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+			if errors.Is(err, ErrNoMeasure) != test.NoMeasure {
+				t.Errorf("Wrong error: expected no measure %t, but %v", test.NoMeasure, err)
+			}
+			if got != test.Want {
+				t.Errorf("Wrong result of %q: expected %t, but %t", test.Condition, test.Want, got)
+			}
+		})
+	}
+}
+
+func TestEvaluateCronjob(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 3, 0, 0, time.UTC)
+	e, err := Parse("v('env.raingauge.uint') > 3 and cronjob('water-detector', '*/10 * * * *')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv(start)
+	var runs []time.Time
+	// evaluates every 10 seconds for an hour
+	for now := start; now.Before(start.Add(time.Hour)); now = now.Add(10 * time.Second) {
+		env.Now = now
+		result, err := e.Evaluate(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result {
+			runs = append(runs, now)
+		}
+	}
+	if len(runs) != 6 {
+		t.Fatalf("Wrong number of runs: expected 6, but %v", runs)
+	}
+	for i, run := range runs {
+		want := time.Date(2022, 6, 1, 12, 10*(i+1), 0, 0, time.UTC)
+		if run.Truncate(time.Minute) != want {
+			t.Errorf("Wrong run: expected %s, but %s", want, run)
+		}
+	}
+}
+
+func TestEvaluateCronjobWaitsForRule(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 3, 0, 0, time.UTC)
+	tests := map[string]struct {
+		Condition string
+	}{
+		"and":       {Condition: "cronjob('a', '*/10 * * * *') and v('env.raingauge.uint') > 3"},
+		"noMeasure": {Condition: "cronjob('a', '*/10 * * * *') and v('env.rain') > 3"},
+		"orFalse":   {Condition: "(cronjob('a', '*/10 * * * *') and v('env.raingauge.uint') > 3) or False"},
+		"not":       {Condition: "not cronjob('a', '*/10 * * * *') and v('env.raingauge.uint') > 3"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := Parse(test.Condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := newTestEnv(start)
+			env.Measures = NewMeasureStore(0)
+			evaluate := func(now time.Time) bool {
+				env.Now = now
+				result, err := e.Evaluate(env)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return result
+			}
+			evaluate(start)
+			// the cronjob is due at 12:10 but the rest of the rule is false
+			if evaluate(start.Add(7 * time.Minute)) {
+				t.Fatalf("Rule must be false without rain")
+			}
+			env.Measures.Add("env.raingauge.uint", 5, start.Add(8*time.Minute))
+			env.Measures.Add("env.rain", 5, start.Add(8*time.Minute))
+			if name == "not" {
+				// the cronjob is still due and so its negation is false
+				if evaluate(start.Add(8 * time.Minute)) {
+					t.Errorf("Due cronjob must not run by its negation")
+				}
+				return
+			}
+			if !evaluate(start.Add(8 * time.Minute)) {
+				t.Errorf("Cronjob must run once the rest of the rule is true")
+			}
+			if evaluate(start.Add(9 * time.Minute)) {
+				t.Errorf("Cronjob must run once at 12:10")
+			}
+		})
+	}
+}
+
+func TestEvaluateEvent(t *testing.T) {
+	now := time.Now()
+	e, err := Parse("e('env.event.cloud.interesting')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := newTestEnv(now)
+	other := &Env{Now: now, Measures: env.Measures, State: NewState()}
+	env.Measures.Add("env.event.cloud.interesting", true, now)
+	for i, want := range []bool{true, false} {
+		if got, _ := e.Evaluate(env); got != want {
+			t.Errorf("Wrong result of evaluation %d: expected %t, but %t", i, want, got)
+		}
+	}
+	// each state sees the event once
+	if got, _ := e.Evaluate(other); !got {
+		t.Errorf("Event must be seen by another state")
+	}
+	env.Measures.Add("env.event.cloud.interesting", true, now.Add(time.Second))
+	if got, _ := e.Evaluate(env); !got {
+		t.Errorf("New event must be seen")
+	}
+	// the event is not seen by a rule that is false
+	withRain, err := Parse("e('env.event.cloud.interesting') and v('env.rain') > 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.Measures.Add("env.event.cloud.interesting", true, now.Add(2*time.Second))
+	if got, _ := withRain.Evaluate(env); got {
+		t.Errorf("Rule must be false without rain")
+	}
+	env.Measures.Add("env.rain", 5, now.Add(2*time.Second))
+	if got, _ := withRain.Evaluate(env); !got {
+		t.Errorf("Event must be seen once the rest of the rule is true")
+	}
+}
+
+func TestEvaluateWithoutState(t *testing.T) {
+	e, err := Parse("cronjob('a', '* * * * *') or v('env.none', '1h') > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, err := e.Evaluate(&Env{Now: time.Now()}); err != nil || result {
+		t.Errorf("Evaluation without measures must be false, but %t %v", result, err)
+	}
+}
@@ -0,0 +1,218 @@
+package sciencerule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type function struct {
+	minArgs int
+	maxArgs int
+	call    func(env *Env, args []interface{}) (interface{}, error)
+}
+
+// functions are the functions rules can call
+var functions = map[string]function{
+	// cronjob(name, spec) is true from each time the cron schedule passes until the rule is true
+	"cronjob": {2, 2, cronjobFunction},
+	// v(name[, window]) is the latest value of the measure. If window is given, for example, "1h",
+	// the value must be published within the window
+	"v": {1, 2, latestFunction},
+	// e(name) is true if the measure is published since the last time the rule was true with it
+	"e": {1, 1, eventFunction},
+	// elapsed(name) is the seconds since the measure was published last time
+	"elapsed": {1, 1, elapsedFunction},
+	// avg, min, max, sum and count(name, window) aggregate numbers of the measure published within the window
+	"avg":   {2, 2, aggregateFunction("avg")},
+	"min":   {2, 2, aggregateFunction("min")},
+	"max":   {2, 2, aggregateFunction("max")},
+	"sum":   {2, 2, aggregateFunction("sum")},
+	"count": {2, 2, aggregateFunction("count")},
+	// hour(), minute(), weekday(), day() and month() are of the time of the evaluation. Sunday is 0 of weekday
+	"hour":    {0, 0, timeFunction("sys.time.hour")},
+	"minute":  {0, 0, timeFunction("sys.time.minute")},
+	"weekday": {0, 0, timeFunction("sys.time.weekday")},
+	"day":     {0, 0, timeFunction("sys.time.day")},
+	"month":   {0, 0, timeFunction("sys.time.month")},
+	// between(start, end) is true if the time of the evaluation is between start and end
+	// in HH:MM. The range may cross midnight, for example, between('22:00', '06:00')
+	"between": {2, 2, betweenFunction},
+}
+
+func stringArg(args []interface{}, i int) (string, error) {
+	s, ok := args[i].(string)
+	if !ok {
+		return "", fmt.Errorf("Argument %d must be a string but %s", i+1, describe(args[i]))
+	}
+	return s, nil
+}
+
+// windowArg returns the duration of a window given in seconds or as a duration such as "1h".
+// A leading "-" is ignored as windows look back from now
+func windowArg(args []interface{}, i int) (time.Duration, error) {
+	var window time.Duration
+	switch v := args[i].(type) {
+	case float64:
+		window = time.Duration(v * float64(time.Second))
+	case string:
+		d, err := time.ParseDuration(strings.TrimPrefix(strings.TrimSpace(v), "-"))
+		if err != nil {
+			return 0, fmt.Errorf("Invalid window %q", v)
+		}
+		window = d
+	default:
+		return 0, fmt.Errorf("Argument %d must be a window but %s", i+1, describe(args[i]))
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("Window must be positive")
+	}
+	return window, nil
+}
+
+func cronjobFunction(env *Env, args []interface{}) (interface{}, error) {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := stringArg(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	due, run, err := env.State.cronjob(name, spec, env.Now)
+	if err != nil {
+		return nil, err
+	}
+	if due {
+		env.onTrue(run)
+	}
+	return due, nil
+}
+
+func latestFunction(env *Env, args []interface{}) (interface{}, error) {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, exist := env.Measures.Latest(name)
+	if !exist {
+		return nil, fmt.Errorf("%w %q", ErrNoMeasure, name)
+	}
+	if len(args) > 1 {
+		window, err := windowArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if m.Timestamp.Before(env.Now.Add(-window)) {
+			return nil, fmt.Errorf("%w %q within %s", ErrNoMeasure, name, window)
+		}
+	}
+	return m.Value, nil
+}
+
+func eventFunction(env *Env, args []interface{}) (interface{}, error) {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, exist := env.Measures.Latest(name)
+	if !exist {
+		return false, nil
+	}
+	newer, see := env.State.event(name, m.Timestamp)
+	if newer {
+		env.onTrue(see)
+	}
+	return newer, nil
+}
+
+func elapsedFunction(env *Env, args []interface{}) (interface{}, error) {
+	name, err := stringArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	m, exist := env.Measures.Latest(name)
+	if !exist {
+		return nil, fmt.Errorf("%w %q", ErrNoMeasure, name)
+	}
+	return env.Now.Sub(m.Timestamp).Seconds(), nil
+}
+
+func aggregateFunction(aggregate string) func(env *Env, args []interface{}) (interface{}, error) {
+	return func(env *Env, args []interface{}) (interface{}, error) {
+		name, err := stringArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		window, err := windowArg(args, 1)
+		if err != nil {
+			return nil, err
+		}
+		var values []float64
+		for _, m := range env.Measures.Since(name, env.Now.Add(-window)) {
+			if v, ok := toNumber(m.Value); ok {
+				values = append(values, v)
+			}
+		}
+		switch aggregate {
+		case "count":
+			return float64(len(values)), nil
+		case "sum":
+			sum := 0.
+			for _, v := range values {
+				sum += v
+			}
+			return sum, nil
+		}
+		if len(values) < 1 {
+			return nil, fmt.Errorf("%w %q within %s", ErrNoMeasure, name, window)
+		}
+		result := values[0]
+		for _, v := range values[1:] {
+			switch aggregate {
+			case "avg":
+				result += v
+			case "min":
+				if v < result {
+					result = v
+				}
+			case "max":
+				if v > result {
+					result = v
+				}
+			}
+		}
+		if aggregate == "avg" {
+			result /= float64(len(values))
+		}
+		return result, nil
+	}
+}
+
+func timeFunction(measure string) func(env *Env, args []interface{}) (interface{}, error) {
+	return func(env *Env, args []interface{}) (interface{}, error) {
+		return timeMeasures[measure](env.Now), nil
+	}
+}
+
+func betweenFunction(env *Env, args []interface{}) (interface{}, error) {
+	var bounds [2]time.Duration
+	for i := range bounds {
+		s, err := stringArg(args, i)
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse("15:04", s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time %q: must be HH:MM", s)
+		}
+		bounds[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	now := env.Now
+	sinceMidnight := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	start, end := bounds[0], bounds[1]
+	if start <= end {
+		return sinceMidnight >= start && sinceMidnight < end, nil
+	}
+	return sinceMidnight >= start || sinceMidnight < end, nil
+}
@@ -0,0 +1,274 @@
+package sciencerule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule is a science rule of the form "<plugin name>: <condition>". The plugin is
+// promoted to run when the condition is true
+type Rule struct {
+	Action    string
+	Condition *Expression
+}
+
+// ParseRule parses a science rule such as "water-detector: v('env.raingauge.uint') > 3"
+func ParseRule(rule string) (*Rule, error) {
+	sp := strings.SplitN(rule, ":", 2)
+	if len(sp) != 2 || strings.TrimSpace(sp[0]) == "" {
+		return nil, fmt.Errorf("Rule %q must be in the form of \"<plugin name>: <condition>\"", rule)
+	}
+	condition, err := Parse(sp[1])
+	if err != nil {
+		return nil, err
+	}
+	return &Rule{Action: strings.TrimSpace(sp[0]), Condition: condition}, nil
+}
+
+// Expression is a parsed condition of a science rule
+type Expression struct {
+	source string
+	root   node
+}
+
+// Parse parses a condition. Conditions are Python-like expressions of
+//   - and, or and not
+//   - comparisons ==, !=, <, <=, > and >= that may be chained as in 1 < v('x') <= 5
+//   - arithmetic +, -, *, / and %
+//   - numbers, strings in single or double quotes, True and False
+//   - function calls such as cronjob('name', '*/10 * * * *') and v('env.temperature')
+//   - names of measures such as env.temperature that are the latest value of the measure
+func Parse(condition string) (*Expression, error) {
+	tokens, err := tokenize(condition)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %q: %s", condition, err.Error())
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = fmt.Errorf("Unexpected %s", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse %q: %s", condition, err.Error())
+	}
+	return &Expression{source: strings.TrimSpace(condition), root: root}, nil
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && t.text == keyword
+}
+
+func (p *parser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.kind != tokenOperator {
+		return false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &logicalNode{op: "or", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &logicalNode{op: "and", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isKeyword("not") {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	x, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	c := &comparisonNode{operands: []node{x}}
+	for p.isOperator("==", "!=", "<", "<=", ">", ">=") {
+		c.ops = append(c.ops, p.next().text)
+		y, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		c.operands = append(c.operands, y)
+	}
+	if len(c.ops) < 1 {
+		return x, nil
+	}
+	return c, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.next().text
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = &arithmeticNode{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseProduct() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("*", "/", "%") {
+		op := p.next().text
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &arithmeticNode{op: op, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOperator("-", "+") {
+		op := p.next().text
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmeticNode{op: op, x: &literalNode{value: 0.}, y: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %s", t)
+		}
+		return &literalNode{value: v}, nil
+	case tokenString:
+		return &literalNode{value: t.text}, nil
+	case tokenLParen:
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRParen {
+			return nil, fmt.Errorf("Expected \")\" but %s", p.peek())
+		}
+		p.next()
+		return x, nil
+	case tokenIdent:
+		switch t.text {
+		case "True", "true":
+			return &literalNode{value: true}, nil
+		case "False", "false":
+			return &literalNode{value: false}, nil
+		case "and", "or", "not":
+			return nil, fmt.Errorf("Unexpected %s", t)
+		}
+		if p.peek().kind == tokenLParen {
+			return p.parseCall(t)
+		}
+		return &measureNode{name: t.text}, nil
+	}
+	return nil, fmt.Errorf("Unexpected %s", t)
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	f, exist := functions[name.text]
+	if !exist {
+		return nil, fmt.Errorf("Unknown function %s", name)
+	}
+	p.next()
+	call := &callNode{name: name.text, function: f}
+	if p.peek().kind != tokenRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if p.peek().kind != tokenRParen {
+		return nil, fmt.Errorf("Expected \")\" but %s", p.peek())
+	}
+	p.next()
+	if len(call.args) < f.minArgs || len(call.args) > f.maxArgs {
+		if f.minArgs == f.maxArgs {
+			return nil, fmt.Errorf("Function %s takes %d arguments but %d given", name.text, f.minArgs, len(call.args))
+		}
+		return nil, fmt.Errorf("Function %s takes %d to %d arguments but %d given", name.text, f.minArgs, f.maxArgs, len(call.args))
+	}
+	return call, nil
+}
@@ -0,0 +1,116 @@
+package sciencerule
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/waggle-sensor/edge-scheduler/pkg/datatype"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		Condition string
+		WantErr   bool
+	}{
+		"true":              {Condition: "True"},
+		"cronjob":           {Condition: "cronjob('myapp', '0 * * * *')"},
+		"doubleQuotes":      {Condition: `cronjob("myapp", "0 * * * *")`},
+		"andCronjob":        {Condition: "v('env.raingauge.uint') > 3 and cronjob('water-detector', '*/10 * * * *')"},
+		"orEvent":           {Condition: "cronjob('a', '*/10 * * * *') or e('env.event.traffic') == True"},
+		"chained":           {Condition: "sys.time.hour >= 6 and 0 < v('env.x') <= 5"},
+		"not":               {Condition: "not (v('env.x') > 1 or False)"},
+		"arithmetic":        {Condition: "(v('env.x') + 2) * -3 / 4 % 5 > -1.5e-1"},
+		"noArgs":            {Condition: "hour() < 12"},
+		"window":            {Condition: "avg('env.temperature', '-1h') > 30"},
+		"unterminated":      {Condition: "v('env.x", WantErr: true},
+		"unknownFunction":   {Condition: "foo('a')", WantErr: true},
+		"tooFewArgs":        {Condition: "cronjob('a')", WantErr: true},
+		"tooManyArgs":       {Condition: "hour(1)", WantErr: true},
+		"missingParen":      {Condition: "(v('env.x') > 1", WantErr: true},
+		"missingOperand":    {Condition: "v('env.x') >", WantErr: true},
+		"trailing":          {Condition: "True False", WantErr: true},
+		"danglingAnd":       {Condition: "True and", WantErr: true},
+		"unexpectedChar":    {Condition: "v('env.x') > 1 & True", WantErr: true},
+		"keywordAsOperand":  {Condition: "and True", WantErr: true},
+		"invalidNumber":     {Condition: "1.2.3 > 1", WantErr: true},
+		"missingArgComma":   {Condition: "cronjob('a' '* * * * *')", WantErr: true},
+		"empty":             {Condition: "", WantErr: true},
+		"emptyParentheses":  {Condition: "()", WantErr: true},
+		"measureWithDigits": {Condition: "env.count.car2 > 5"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse(test.Condition)
+			if (err != nil) != test.WantErr {
+				t.Errorf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := map[string]struct {
+		Rule      string
+		Action    string
+		Condition string
+		WantErr   bool
+	}{
+		"rule": {
+			Rule:      "imagesampler-top: cronjob('imagesampler-top', '0 * * * *')",
+			Action:    "imagesampler-top",
+			Condition: "cronjob('imagesampler-top', '0 * * * *')",
+		},
+		"colonInCondition": {
+			Rule:      "detector: between('22:00', '06:00')",
+			Action:    "detector",
+			Condition: "between('22:00', '06:00')",
+		},
+		"noAction":    {Rule: "cronjob('a', '* * * * *')", WantErr: true},
+		"emptyAction": {Rule: ": True", WantErr: true},
+		"invalid":     {Rule: "a: b(", WantErr: true},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule, err := ParseRule(test.Rule)
+			if (err != nil) != test.WantErr {
+				t.Fatalf("Wrong result: expected error %t, but %v", test.WantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if rule.Action != test.Action || rule.Condition.String() != test.Condition {
+				t.Errorf("Wrong rule: expected %q: %q, but %q: %q", test.Action, test.Condition, rule.Action, rule.Condition)
+			}
+		})
+	}
+}
+
+// TestParseJobRules parses science rules of the example jobs
+func TestParseJobRules(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "data", "jobs", "*.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := 0
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var job datatype.Job
+		if err := yaml.Unmarshal(raw, &job); err != nil {
+			t.Fatalf("Failed to read %s: %s", path, err.Error())
+		}
+		for _, r := range job.ScienceRules {
+			if _, err := ParseRule(r); err != nil {
+				t.Errorf("%s: %s", filepath.Base(path), err.Error())
+			}
+			parsed++
+		}
+	}
+	if parsed < 1 {
+		t.Errorf("No science rule found in the example jobs")
+	}
+}
@@ -0,0 +1,174 @@
+package sciencerule
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMeasureHistory is the default number of values kept for each measure
+const DefaultMeasureHistory = 1000
+
+// Measure is a value of a measure at a time
+type Measure struct {
+	Value     interface{}
+	Timestamp time.Time
+}
+
+// MeasureStore keeps recent values of measures that rules look up
+type MeasureStore struct {
+	mutex      sync.RWMutex
+	measures   map[string][]Measure
+	maxHistory int
+}
+
+// NewMeasureStore returns a store keeping up to maxHistory values for each measure.
+// DefaultMeasureHistory is used if maxHistory is not positive
+func NewMeasureStore(maxHistory int) *MeasureStore {
+	if maxHistory < 1 {
+		maxHistory = DefaultMeasureHistory
+	}
+	return &MeasureStore{
+		measures:   make(map[string][]Measure),
+		maxHistory: maxHistory,
+	}
+}
+
+// Add stores the value of the measure at the time. Numbers are stored as float64, and
+// strings that are numbers or booleans are stored as such. The oldest value is dropped
+// when the measure has more than the history the store keeps
+func (s *MeasureStore) Add(name string, value interface{}, timestamp time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	history := s.measures[name]
+	m := Measure{Value: normalizeValue(value), Timestamp: timestamp}
+	i := sort.Search(len(history), func(i int) bool {
+		return history[i].Timestamp.After(timestamp)
+	})
+	history = append(history, Measure{})
+	copy(history[i+1:], history[i:])
+	history[i] = m
+	if len(history) > s.maxHistory {
+		history = history[len(history)-s.maxHistory:]
+	}
+	s.measures[name] = history
+}
+
+// Latest returns the latest value of the measure
+func (s *MeasureStore) Latest(name string) (Measure, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	history := s.measures[name]
+	if len(history) < 1 {
+		return Measure{}, false
+	}
+	return history[len(history)-1], true
+}
+
+// Since returns values of the measure at or after the time from the oldest
+func (s *MeasureStore) Since(name string, since time.Time) []Measure {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	history := s.measures[name]
+	i := sort.Search(len(history), func(i int) bool {
+		return !history[i].Timestamp.Before(since)
+	})
+	return append([]Measure{}, history[i:]...)
+}
+
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64, bool:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+		return v
+	case nil:
+		return nil
+	default:
+		return value
+	}
+}
+
+// State keeps what rules of a science goal remember between evaluations:
+// the next time of cronjobs and the last event seen
+type State struct {
+	mutex    sync.Mutex
+	cronjobs map[string]*cronjobState
+	events   map[string]time.Time
+}
+
+type cronjobState struct {
+	schedule *CronSchedule
+	next     time.Time
+}
+
+// NewState returns an empty state
+func NewState() *State {
+	return &State{
+		cronjobs: make(map[string]*cronjobState),
+		events:   make(map[string]time.Time),
+	}
+}
+
+// cronjob returns true if the schedule of the cronjob passed since it ran last time. The first call of
+// a cronjob only sets when it runs next. Changing the schedule restarts the cronjob. The cronjob
+// stays due until run is called so that it runs only when the rest of the rule is also true
+func (s *State) cronjob(name string, spec string, now time.Time) (due bool, run func(), err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	c, exist := s.cronjobs[name]
+	if !exist || c.schedule.String() != spec {
+		schedule, err := ParseCronSchedule(spec)
+		if err != nil {
+			return false, nil, err
+		}
+		s.cronjobs[name] = &cronjobState{schedule: schedule, next: schedule.Next(now)}
+		return false, nil, nil
+	}
+	if c.next.IsZero() || now.Before(c.next) {
+		return false, nil, nil
+	}
+	run = func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c.next = c.schedule.Next(now)
+	}
+	return true, run, nil
+}
+
+// event returns true if the measure has a value newer than the one seen last time.
+// The value is not seen until see is called
+func (s *State) event(name string, latest time.Time) (newer bool, see func()) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if seen, exist := s.events[name]; exist && !latest.After(seen) {
+		return false, nil
+	}
+	see = func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.events[name] = latest
+	}
+	return true, see
+}
@@ -0,0 +1,135 @@
+package sciencerule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeasureStoreAdd(t *testing.T) {
+	now := time.Now()
+	tests := map[string]struct {
+		Value interface{}
+		Want  interface{}
+	}{
+		"float":        {Value: 1.5, Want: 1.5},
+		"int":          {Value: 3, Want: 3.},
+		"int64":        {Value: int64(3), Want: 3.},
+		"bool":         {Value: true, Want: true},
+		"numberString": {Value: "2.5", Want: 2.5},
+		"boolString":   {Value: "True", Want: true},
+		"string":       {Value: "cloudy", Want: "cloudy"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := NewMeasureStore(0)
+			s.Add("env.test", test.Value, now)
+			m, exist := s.Latest("env.test")
+			if !exist {
+				t.Fatal("Measure must exist")
+			}
+			if m.Value != test.Want {
+				t.Errorf("Wrong value: expected %v (%T), but %v (%T)", test.Want, test.Want, m.Value, m.Value)
+			}
+		})
+	}
+}
+
+func TestMeasureStoreHistory(t *testing.T) {
+	now := time.Now()
+	s := NewMeasureStore(3)
+	// values may arrive out of order
+	s.Add("env.test", 2, now.Add(-2*time.Minute))
+	s.Add("env.test", 4, now)
+	s.Add("env.test", 1, now.Add(-3*time.Minute))
+	s.Add("env.test", 3, now.Add(-time.Minute))
+	m, _ := s.Latest("env.test")
+	if m.Value != 4. {
+		t.Errorf("Wrong latest value: expected 4, but %v", m.Value)
+	}
+	history := s.Since("env.test", now.Add(-time.Hour))
+	if len(history) != 3 {
+		t.Fatalf("Wrong history: expected 3 values, but %v", history)
+	}
+	for i, want := range []float64{2, 3, 4} {
+		if history[i].Value != want {
+			t.Errorf("Wrong history: expected %g at %d, but %v", want, i, history[i].Value)
+		}
+	}
+	if got := s.Since("env.test", now.Add(-time.Minute)); len(got) != 2 {
+		t.Errorf("Wrong values since a minute ago: expected 2, but %v", got)
+	}
+	if _, exist := s.Latest("env.none"); exist {
+		t.Errorf("Measure not added must not exist")
+	}
+}
+
+func TestStateCronjob(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 3, 0, 0, time.UTC)
+	s := NewState()
+	tick := func(now time.Time) bool {
+		due, run, err := s.cronjob("myapp", "*/10 * * * *", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if due {
+			run()
+		}
+		return due
+	}
+	if tick(start) {
+		t.Errorf("Cronjob must not run at the first evaluation")
+	}
+	if tick(start.Add(6 * time.Minute)) {
+		t.Errorf("Cronjob must not run before 12:10")
+	}
+	// the cronjob stays due until it runs
+	for i := 0; i < 2; i++ {
+		if due, _, _ := s.cronjob("myapp", "*/10 * * * *", start.Add(7*time.Minute)); !due {
+			t.Errorf("Cronjob must be due at 12:10")
+		}
+	}
+	if !tick(start.Add(7*time.Minute + 5*time.Second)) {
+		t.Errorf("Cronjob must run at 12:10")
+	}
+	if tick(start.Add(7*time.Minute + 15*time.Second)) {
+		t.Errorf("Cronjob must run once at 12:10")
+	}
+	// a late evaluation runs the cronjob once for the schedules it missed
+	if !tick(start.Add(40 * time.Minute)) {
+		t.Errorf("Cronjob must run after missed schedules")
+	}
+	if tick(start.Add(41 * time.Minute)) {
+		t.Errorf("Cronjob must not run twice for missed schedules")
+	}
+	// changing the schedule restarts the cronjob
+	if due, _, _ := s.cronjob("myapp", "* * * * *", start.Add(50*time.Minute)); due {
+		t.Errorf("Cronjob must restart when its schedule changes")
+	}
+	if _, _, err := s.cronjob("invalid", "* *", start); err == nil {
+		t.Errorf("Invalid cron schedule must fail")
+	}
+}
+
+func TestStateEvent(t *testing.T) {
+	now := time.Now()
+	s := NewState()
+	see := func(latest time.Time) bool {
+		newer, seen := s.event("env.event", latest)
+		if newer {
+			seen()
+		}
+		return newer
+	}
+	if newer, _ := s.event("env.event", now); !newer {
+		t.Errorf("New event must be seen")
+	}
+	if !see(now) {
+		t.Errorf("Event must be new until it is seen")
+	}
+	if see(now) {
+		t.Errorf("Event must be seen once")
+	}
+	if !see(now.Add(time.Second)) {
+		t.Errorf("Newer event must be seen")
+	}
+}